@@ -17,7 +17,7 @@ func (api *api) CreateInvoice(ctx context.Context, amount uint64, description st
 	if api.svc.GetLNClient() == nil {
 		return nil, errors.New("LNClient not started")
 	}
-	transaction, err := api.svc.GetTransactionsService().MakeInvoice(ctx, amount, description, "", 0, nil, api.svc.GetLNClient(), nil, nil)
+	transaction, err := api.svc.GetTransactionsService().MakeInvoice(ctx, amount, description, "", 0, nil, api.svc.GetLNClient(), nil, nil, "")
 	if err != nil {
 		return nil, err
 	}
@@ -28,7 +28,7 @@ func (api *api) LookupInvoice(ctx context.Context, paymentHash string) (*LookupI
 	if api.svc.GetLNClient() == nil {
 		return nil, errors.New("LNClient not started")
 	}
-	transaction, err := api.svc.GetTransactionsService().LookupTransaction(ctx, paymentHash, nil, api.svc.GetLNClient(), nil)
+	transaction, err := api.svc.GetTransactionsService().LookupTransaction(ctx, paymentHash, nil, api.svc.GetLNClient(), nil, false)
 	if err != nil {
 		return nil, err
 	}
@@ -40,13 +40,13 @@ func (api *api) ListTransactions(ctx context.Context, appId *uint, limit uint64,
 	if api.svc.GetLNClient() == nil {
 		return nil, errors.New("LNClient not started")
 	}
-	transactions, err := api.svc.GetTransactionsService().ListTransactions(ctx, 0, 0, limit, offset, true, false, nil, api.svc.GetLNClient(), appId, true)
+	dbTransactions, err := api.svc.GetTransactionsService().ListTransactions(ctx, 0, 0, limit, offset, true, false, nil, api.svc.GetLNClient(), appId, true, transactions.ListTransactionsFilter{})
 	if err != nil {
 		return nil, err
 	}
 
 	apiTransactions := []Transaction{}
-	for _, transaction := range transactions {
+	for _, transaction := range dbTransactions {
 		apiTransactions = append(apiTransactions, *toApiTransaction(&transaction))
 	}
 
@@ -57,7 +57,7 @@ func (api *api) SendPayment(ctx context.Context, invoice string) (*SendPaymentRe
 	if api.svc.GetLNClient() == nil {
 		return nil, errors.New("LNClient not started")
 	}
-	transaction, err := api.svc.GetTransactionsService().SendPaymentSync(ctx, invoice, nil, api.svc.GetLNClient(), nil, nil)
+	transaction, err := api.svc.GetTransactionsService().SendPaymentSync(ctx, invoice, nil, api.svc.GetLNClient(), nil, nil, transactions.SendPaymentOptions{})
 	if err != nil {
 		return nil, err
 	}
@@ -125,13 +125,14 @@ func (api *api) TopupIsolatedApp(ctx context.Context, userApp *db.App, amountMsa
 		return errors.New("app is not isolated")
 	}
 
-	transaction, err := api.svc.GetTransactionsService().MakeInvoice(ctx, amountMsat, "top up", "", 0, nil, api.svc.GetLNClient(), &userApp.ID, nil)
+	transaction, err := api.svc.GetTransactionsService().MakeInvoice(ctx, amountMsat, "top up", "", 0, nil, api.svc.GetLNClient(), &userApp.ID, nil, "")
 
 	if err != nil {
 		return err
 	}
 
-	_, err = api.svc.GetTransactionsService().SendPaymentSync(ctx, transaction.PaymentRequest, nil, api.svc.GetLNClient(), nil, nil)
+	// top ups move funds within the node, so their amount is not checked against recent payments
+	_, err = api.svc.GetTransactionsService().SendPaymentSync(ctx, transaction.PaymentRequest, nil, api.svc.GetLNClient(), nil, nil, transactions.SendPaymentOptions{ConfirmLargeAmount: true})
 	return err
 }
 
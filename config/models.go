@@ -43,6 +43,8 @@ type AppConfig struct {
 	EnableAdvancedSetup   bool   `envconfig:"ENABLE_ADVANCED_SETUP" default:"true"`
 	AutoUnlockPassword    string `envconfig:"AUTO_UNLOCK_PASSWORD"`
 	LogDBQueries          bool   `envconfig:"LOG_DB_QUERIES" default:"false"`
+	// caching transaction lists is opt-in as results can be up to this many seconds old
+	ListTransactionsCacheTTLSeconds int `envconfig:"LIST_TRANSACTIONS_CACHE_TTL_SECONDS" default:"0"`
 }
 
 func (c *AppConfig) IsDefaultClientId() bool {
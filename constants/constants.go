@@ -9,6 +9,30 @@ const (
 	TRANSACTION_STATE_PENDING = "PENDING"
 	TRANSACTION_STATE_SETTLED = "SETTLED"
 	TRANSACTION_STATE_FAILED  = "FAILED"
+	// an invoice paid in parts (MPP) that has not received its full amount yet
+	TRANSACTION_STATE_ACCEPTED = "ACCEPTED"
+	// a payment received for an unknown invoice, held for review (see transactions.UnknownPaymentPolicy)
+	TRANSACTION_STATE_QUARANTINED = "QUARANTINED"
+
+	TRANSACTION_ENVIRONMENT_PROD = "prod"
+	TRANSACTION_ENVIRONMENT_TEST = "test"
+
+	// outgoing payments are either keysend payments (no payment request) or invoice payments
+	TRANSACTION_PAYMENT_KIND_KEYSEND = "keysend"
+	TRANSACTION_PAYMENT_KIND_INVOICE = "invoice"
+
+	// incoming payments are categorized by what was attached to them, in this order of precedence
+	TRANSACTION_INCOMING_KIND_BOOST   = "boost"
+	TRANSACTION_INCOMING_KIND_ZAP     = "zap"
+	TRANSACTION_INCOMING_KIND_KEYSEND = "keysend"
+	TRANSACTION_INCOMING_KIND_LNURL   = "lnurl"
+	TRANSACTION_INCOMING_KIND_INVOICE = "invoice"
+)
+
+const (
+	PAYMENT_INTENT_STATE_OPEN      = "OPEN"
+	PAYMENT_INTENT_STATE_FULFILLED = "FULFILLED"
+	PAYMENT_INTENT_STATE_EXPIRED   = "EXPIRED"
 )
 
 const (
@@ -36,6 +60,26 @@ const (
 // accounting for encryption and other metadata in the response, this is set to 4096 characters
 const INVOICE_METADATA_MAX_LENGTH = 4096
 
+// trusted apps can be given a higher metadata limit, but never more than this
+// (at this size only a few transactions fit in a single relay response)
+const INVOICE_METADATA_HARD_MAX_LENGTH = 65536
+
+// metadata key counting the chained self payments that led to a payment
+const SELF_PAYMENT_DEPTH_METADATA_KEY = "self_payment_depth"
+
+// minimum fee reserved for outgoing payments on backends without a specific minimum
+const DEFAULT_MIN_FEE_RESERVE_MSAT = 10000
+
+// metadata key used to tag a transaction with its environment (prod or test)
+const ENVIRONMENT_METADATA_KEY = "environment"
+
+// maximum chained self payments unless configured per app
+const DEFAULT_MAX_SELF_PAYMENT_DEPTH = 3
+
+// invoices an app can create within the rate limit window unless configured per app
+const DEFAULT_INVOICE_RATE_LIMIT = 100
+const DEFAULT_INVOICE_RATE_LIMIT_WINDOW_SECONDS = 60
+
 // errors used by NIP-47 and the transaction service
 const (
 	ERROR_INTERNAL             = "INTERNAL"
@@ -45,7 +89,26 @@ const (
 	ERROR_UNAUTHORIZED         = "UNAUTHORIZED"
 	ERROR_EXPIRED              = "EXPIRED"
 	ERROR_RESTRICTED           = "RESTRICTED"
+	ERROR_RATE_LIMITED         = "RATE_LIMITED"
 	ERROR_BAD_REQUEST          = "BAD_REQUEST"
 	ERROR_NOT_FOUND            = "NOT_FOUND"
 	ERROR_OTHER                = "OTHER"
 )
+
+// metadata key counting the keysend payments accumulated into an aggregated transaction
+const KEYSEND_COUNT_METADATA_KEY = "keysend_count"
+
+// metadata key set when a metadata field was truncated to fit the metadata limit
+const METADATA_TRUNCATED_METADATA_KEY = "metadata_truncated"
+
+// metadata key preserving the caller's description of an invoice whose description was prefixed
+const ORIGINAL_DESCRIPTION_METADATA_KEY = "original_description"
+
+// metadata key holding the signed attestations apps attached to a transaction
+const ATTESTATIONS_METADATA_KEY = "attestations"
+
+// metadata key grouping the keysend payments of a streaming session, e.g. listening to a podcast episode
+const BOOST_SESSION_ID_METADATA_KEY = "boost_session_id"
+
+// maximum length in bytes of a BOLT11 invoice description
+const INVOICE_DESCRIPTION_MAX_LENGTH = 639
@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	_ "embed"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// This migration adds an optional external reference to transactions.
+// An external reference can only be used by one outgoing payment that has not failed.
+var _202412051200_transaction_external_ref = &gormigrate.Migration{
+	ID: "202412051200_transaction_external_ref",
+	Migrate: func(tx *gorm.DB) error {
+
+		if err := tx.Exec(`
+	ALTER TABLE transactions ADD external_ref TEXT;
+	CREATE UNIQUE INDEX idx_transactions_external_ref ON transactions(external_ref) WHERE external_ref IS NOT NULL AND external_ref != '' AND type = 'outgoing' AND state != 'FAILED';
+`).Error; err != nil {
+			return err
+		}
+
+		return nil
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return nil
+	},
+}
@@ -0,0 +1,27 @@
+package migrations
+
+import (
+	_ "embed"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// This migration adds a per-app webhook url and signing secret
+var _202412061200_app_webhooks = &gormigrate.Migration{
+	ID: "202412061200_app_webhooks",
+	Migrate: func(tx *gorm.DB) error {
+
+		if err := tx.Exec(`
+	ALTER TABLE apps ADD webhook_url TEXT;
+	ALTER TABLE apps ADD webhook_secret TEXT;
+`).Error; err != nil {
+			return err
+		}
+
+		return nil
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return nil
+	},
+}
@@ -0,0 +1,27 @@
+package migrations
+
+import (
+	_ "embed"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// This migration stores the payee of outgoing payments so payment outcomes can be grouped by destination
+var _202412081200_transaction_payee_pubkey = &gormigrate.Migration{
+	ID: "202412081200_transaction_payee_pubkey",
+	Migrate: func(tx *gorm.DB) error {
+
+		if err := tx.Exec(`
+	ALTER TABLE transactions ADD payee_pubkey TEXT;
+	CREATE INDEX idx_transactions_payee_pubkey ON transactions(payee_pubkey);
+`).Error; err != nil {
+			return err
+		}
+
+		return nil
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return nil
+	},
+}
@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	_ "embed"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// This migration adds budget groups, which allow multiple apps to share one budget
+var _202412101200_budget_groups = &gormigrate.Migration{
+	ID: "202412101200_budget_groups",
+	Migrate: func(tx *gorm.DB) error {
+
+		if err := tx.Exec(`
+	CREATE TABLE budget_groups (id integer PRIMARY KEY AUTOINCREMENT,name text,max_amount_sat integer,budget_renewal text,created_at datetime,updated_at datetime);
+	ALTER TABLE apps ADD budget_group_id integer REFERENCES budget_groups(id) ON DELETE SET NULL;
+	CREATE INDEX idx_apps_budget_group_id ON apps(budget_group_id);
+`).Error; err != nil {
+			return err
+		}
+
+		return nil
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return nil
+	},
+}
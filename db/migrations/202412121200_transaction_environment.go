@@ -0,0 +1,27 @@
+package migrations
+
+import (
+	_ "embed"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// This migration tags transactions with the environment (prod or test) they were made in
+var _202412121200_transaction_environment = &gormigrate.Migration{
+	ID: "202412121200_transaction_environment",
+	Migrate: func(tx *gorm.DB) error {
+
+		if err := tx.Exec(`
+	ALTER TABLE transactions ADD environment TEXT NOT NULL DEFAULT 'prod';
+	CREATE INDEX idx_transactions_environment ON transactions (environment);
+`).Error; err != nil {
+			return err
+		}
+
+		return nil
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return nil
+	},
+}
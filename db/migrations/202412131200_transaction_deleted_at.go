@@ -0,0 +1,27 @@
+package migrations
+
+import (
+	_ "embed"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// This migration allows transactions to be soft-deleted (hidden from transaction lists)
+var _202412131200_transaction_deleted_at = &gormigrate.Migration{
+	ID: "202412131200_transaction_deleted_at",
+	Migrate: func(tx *gorm.DB) error {
+
+		if err := tx.Exec(`
+	ALTER TABLE transactions ADD deleted_at datetime;
+	CREATE INDEX idx_transactions_deleted_at ON transactions (deleted_at);
+`).Error; err != nil {
+			return err
+		}
+
+		return nil
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return nil
+	},
+}
@@ -0,0 +1,27 @@
+package migrations
+
+import (
+	_ "embed"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// This migration allows the proceeds of an invoice to be split across multiple apps
+var _202412141200_transaction_split_rule = &gormigrate.Migration{
+	ID: "202412141200_transaction_split_rule",
+	Migrate: func(tx *gorm.DB) error {
+
+		if err := tx.Exec(`
+	ALTER TABLE transactions ADD split_rule JSON;
+	ALTER TABLE transactions ADD split_from_id INTEGER;
+`).Error; err != nil {
+			return err
+		}
+
+		return nil
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return nil
+	},
+}
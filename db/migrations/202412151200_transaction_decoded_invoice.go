@@ -0,0 +1,27 @@
+package migrations
+
+import (
+	_ "embed"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// This migration allows apps to opt in to storing the full decoded invoice of their payments
+var _202412151200_transaction_decoded_invoice = &gormigrate.Migration{
+	ID: "202412151200_transaction_decoded_invoice",
+	Migrate: func(tx *gorm.DB) error {
+
+		if err := tx.Exec(`
+	ALTER TABLE apps ADD store_decoded_invoices BOOLEAN NOT NULL DEFAULT FALSE;
+	ALTER TABLE transactions ADD decoded_invoice JSON;
+`).Error; err != nil {
+			return err
+		}
+
+		return nil
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return nil
+	},
+}
@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	_ "embed"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// This migration records which relay NWC requests and their transactions came through
+var _202412161200_relay_url = &gormigrate.Migration{
+	ID: "202412161200_relay_url",
+	Migrate: func(tx *gorm.DB) error {
+
+		if err := tx.Exec(`
+	ALTER TABLE request_events ADD relay_url TEXT;
+	ALTER TABLE transactions ADD relay_url TEXT;
+	CREATE INDEX idx_transactions_relay_url ON transactions (relay_url);
+`).Error; err != nil {
+			return err
+		}
+
+		return nil
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return nil
+	},
+}
@@ -0,0 +1,26 @@
+package migrations
+
+import (
+	_ "embed"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// This migration allows apps to opt in to a single open invoice per description hash
+var _202412171200_app_unique_description_hash = &gormigrate.Migration{
+	ID: "202412171200_app_unique_description_hash",
+	Migrate: func(tx *gorm.DB) error {
+
+		if err := tx.Exec(`
+	ALTER TABLE apps ADD unique_description_hash BOOLEAN NOT NULL DEFAULT FALSE;
+`).Error; err != nil {
+			return err
+		}
+
+		return nil
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return nil
+	},
+}
@@ -0,0 +1,27 @@
+package migrations
+
+import (
+	_ "embed"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// This migration allows apps to accumulate streamed keysend payments into a single transaction
+var _202412181200_keysend_aggregation = &gormigrate.Migration{
+	ID: "202412181200_keysend_aggregation",
+	Migrate: func(tx *gorm.DB) error {
+
+		if err := tx.Exec(`
+	ALTER TABLE apps ADD keysend_aggregation_window_seconds INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE transactions ADD aggregate_open BOOLEAN NOT NULL DEFAULT FALSE;
+`).Error; err != nil {
+			return err
+		}
+
+		return nil
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return nil
+	},
+}
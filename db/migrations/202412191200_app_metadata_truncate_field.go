@@ -0,0 +1,26 @@
+package migrations
+
+import (
+	_ "embed"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// This migration allows apps to truncate a metadata field instead of having oversized metadata rejected
+var _202412191200_app_metadata_truncate_field = &gormigrate.Migration{
+	ID: "202412191200_app_metadata_truncate_field",
+	Migrate: func(tx *gorm.DB) error {
+
+		if err := tx.Exec(`
+	ALTER TABLE apps ADD metadata_truncate_field TEXT NOT NULL DEFAULT '';
+`).Error; err != nil {
+			return err
+		}
+
+		return nil
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return nil
+	},
+}
@@ -0,0 +1,27 @@
+package migrations
+
+import (
+	_ "embed"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// This migration adds payment intents, which reserve an app's budget for a payment made later
+var _202412201200_payment_intents = &gormigrate.Migration{
+	ID: "202412201200_payment_intents",
+	Migrate: func(tx *gorm.DB) error {
+
+		if err := tx.Exec(`
+	CREATE TABLE payment_intents (id integer PRIMARY KEY AUTOINCREMENT,app_id integer,state text,amount_msat integer,tolerance_msat integer,allowed_destinations text,expires_at datetime,transaction_id integer,created_at datetime,updated_at datetime,CONSTRAINT fk_payment_intents_app FOREIGN KEY (app_id) REFERENCES apps(id) ON DELETE CASCADE,CONSTRAINT fk_payment_intents_transaction FOREIGN KEY (transaction_id) REFERENCES transactions(id) ON DELETE SET NULL);
+	CREATE INDEX idx_payment_intents_app_id_state ON payment_intents(app_id, state);
+`).Error; err != nil {
+			return err
+		}
+
+		return nil
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return nil
+	},
+}
@@ -0,0 +1,26 @@
+package migrations
+
+import (
+	_ "embed"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// This migration records the on-chain fee of channels opened to receive incoming payments
+var _202412211200_transaction_channel_open_fee = &gormigrate.Migration{
+	ID: "202412211200_transaction_channel_open_fee",
+	Migrate: func(tx *gorm.DB) error {
+
+		if err := tx.Exec(`
+	ALTER TABLE transactions ADD channel_open_fee_msat INTEGER NOT NULL DEFAULT 0;
+`).Error; err != nil {
+			return err
+		}
+
+		return nil
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return nil
+	},
+}
@@ -0,0 +1,27 @@
+package migrations
+
+import (
+	_ "embed"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// This migration adds per-app limits on how many invoices can be created within a window
+var _202412221200_app_invoice_rate_limit = &gormigrate.Migration{
+	ID: "202412221200_app_invoice_rate_limit",
+	Migrate: func(tx *gorm.DB) error {
+
+		if err := tx.Exec(`
+	ALTER TABLE apps ADD invoice_rate_limit INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE apps ADD invoice_rate_limit_window_seconds INTEGER NOT NULL DEFAULT 0;
+`).Error; err != nil {
+			return err
+		}
+
+		return nil
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return nil
+	},
+}
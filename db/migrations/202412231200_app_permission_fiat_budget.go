@@ -0,0 +1,27 @@
+package migrations
+
+import (
+	_ "embed"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// This migration adds budgets set in a fiat currency to app permissions
+var _202412231200_app_permission_fiat_budget = &gormigrate.Migration{
+	ID: "202412231200_app_permission_fiat_budget",
+	Migrate: func(tx *gorm.DB) error {
+
+		if err := tx.Exec(`
+	ALTER TABLE app_permissions ADD max_amount_fiat REAL NOT NULL DEFAULT 0;
+	ALTER TABLE app_permissions ADD fiat_currency TEXT NOT NULL DEFAULT '';
+`).Error; err != nil {
+			return err
+		}
+
+		return nil
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return nil
+	},
+}
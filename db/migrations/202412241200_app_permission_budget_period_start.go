@@ -0,0 +1,26 @@
+package migrations
+
+import (
+	_ "embed"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// This migration records the last budget period seen for each permission, to detect budget resets
+var _202412241200_app_permission_budget_period_start = &gormigrate.Migration{
+	ID: "202412241200_app_permission_budget_period_start",
+	Migrate: func(tx *gorm.DB) error {
+
+		if err := tx.Exec(`
+	ALTER TABLE app_permissions ADD budget_period_start datetime;
+`).Error; err != nil {
+			return err
+		}
+
+		return nil
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return nil
+	},
+}
@@ -0,0 +1,27 @@
+package migrations
+
+import (
+	_ "embed"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// This migration adds activities, which record published events shown in the activity feed
+var _202412251200_activities = &gormigrate.Migration{
+	ID: "202412251200_activities",
+	Migrate: func(tx *gorm.DB) error {
+
+		if err := tx.Exec(`
+	CREATE TABLE activities (id integer PRIMARY KEY AUTOINCREMENT,type text,app_id integer,properties text,created_at datetime,CONSTRAINT fk_activities_app FOREIGN KEY (app_id) REFERENCES apps(id) ON DELETE CASCADE);
+	CREATE INDEX idx_activities_app_id_created_at ON activities(app_id, created_at);
+`).Error; err != nil {
+			return err
+		}
+
+		return nil
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return nil
+	},
+}
@@ -0,0 +1,26 @@
+package migrations
+
+import (
+	_ "embed"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// This migration tracks the amount received so far for invoices paid in parts
+var _202412261200_transaction_received_amount = &gormigrate.Migration{
+	ID: "202412261200_transaction_received_amount",
+	Migrate: func(tx *gorm.DB) error {
+
+		if err := tx.Exec(`
+	ALTER TABLE transactions ADD received_amount_msat INTEGER NOT NULL DEFAULT 0;
+`).Error; err != nil {
+			return err
+		}
+
+		return nil
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return nil
+	},
+}
@@ -0,0 +1,26 @@
+package migrations
+
+import (
+	_ "embed"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// This migration adds a per-app override of the minimum fee reserve of payments
+var _202412271200_app_min_fee_reserve = &gormigrate.Migration{
+	ID: "202412271200_app_min_fee_reserve",
+	Migrate: func(tx *gorm.DB) error {
+
+		if err := tx.Exec(`
+	ALTER TABLE apps ADD min_fee_reserve_msat INTEGER NOT NULL DEFAULT 0;
+`).Error; err != nil {
+			return err
+		}
+
+		return nil
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return nil
+	},
+}
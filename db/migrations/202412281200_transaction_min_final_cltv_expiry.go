@@ -0,0 +1,26 @@
+package migrations
+
+import (
+	_ "embed"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// This migration stores the min final CLTV expiry of the invoice of outgoing payments
+var _202412281200_transaction_min_final_cltv_expiry = &gormigrate.Migration{
+	ID: "202412281200_transaction_min_final_cltv_expiry",
+	Migrate: func(tx *gorm.DB) error {
+
+		if err := tx.Exec(`
+	ALTER TABLE transactions ADD min_final_cltv_expiry INTEGER NOT NULL DEFAULT 0;
+`).Error; err != nil {
+			return err
+		}
+
+		return nil
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return nil
+	},
+}
@@ -0,0 +1,26 @@
+package migrations
+
+import (
+	_ "embed"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// This migration adds a per-app prefix for the descriptions of the app's invoices
+var _202501011200_app_invoice_description_prefix = &gormigrate.Migration{
+	ID: "202501011200_app_invoice_description_prefix",
+	Migrate: func(tx *gorm.DB) error {
+
+		if err := tx.Exec(`
+	ALTER TABLE apps ADD invoice_description_prefix TEXT NOT NULL DEFAULT '';
+`).Error; err != nil {
+			return err
+		}
+
+		return nil
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return nil
+	},
+}
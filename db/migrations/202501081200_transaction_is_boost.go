@@ -0,0 +1,27 @@
+package migrations
+
+import (
+	_ "embed"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// This migration adds a flag for transactions carrying a boostagram, set for existing boosts
+var _202501081200_transaction_is_boost = &gormigrate.Migration{
+	ID: "202501081200_transaction_is_boost",
+	Migrate: func(tx *gorm.DB) error {
+
+		if err := tx.Exec(`
+	ALTER TABLE transactions ADD is_boost BOOLEAN NOT NULL DEFAULT FALSE;
+	UPDATE transactions SET is_boost = TRUE WHERE boostagram IS NOT NULL AND json_valid(boostagram) AND json_type(boostagram) == 'object';
+`).Error; err != nil {
+			return err
+		}
+
+		return nil
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return nil
+	},
+}
@@ -0,0 +1,26 @@
+package migrations
+
+import (
+	_ "embed"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// This migration adds an index for syncing transactions by the time they were last updated
+var _202501101200_transactions_updated_at_index = &gormigrate.Migration{
+	ID: "202501101200_transactions_updated_at_index",
+	Migrate: func(tx *gorm.DB) error {
+
+		if err := tx.Exec(`
+	CREATE INDEX idx_transactions_updated_at_id ON transactions(updated_at, id);
+`).Error; err != nil {
+			return err
+		}
+
+		return nil
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return nil
+	},
+}
@@ -23,6 +23,45 @@ func Migrate(gormDB *gorm.DB) error {
 		_202408191242_transaction_failure_reason,
 		_202408291715_app_metadata,
 		_202410141503_add_wallet_pubkey,
+		_202412021200_transaction_inbound_channel_id,
+		_202412031200_app_max_receive_amount,
+		_202412041200_app_require_description,
+		_202412051200_transaction_external_ref,
+		_202412061200_app_webhooks,
+		_202412071200_app_max_metadata_length,
+		_202412081200_transaction_payee_pubkey,
+		_202412091200_transaction_reissued_from_id,
+		_202412101200_budget_groups,
+		_202412111200_app_max_self_payment_depth,
+		_202412121200_transaction_environment,
+		_202412131200_transaction_deleted_at,
+		_202412141200_transaction_split_rule,
+		_202412151200_transaction_decoded_invoice,
+		_202412161200_relay_url,
+		_202412171200_app_unique_description_hash,
+		_202412181200_keysend_aggregation,
+		_202412191200_app_metadata_truncate_field,
+		_202412201200_payment_intents,
+		_202412211200_transaction_channel_open_fee,
+		_202412221200_app_invoice_rate_limit,
+		_202412231200_app_permission_fiat_budget,
+		_202412241200_app_permission_budget_period_start,
+		_202412251200_activities,
+		_202412261200_transaction_received_amount,
+		_202412271200_app_min_fee_reserve,
+		_202412281200_transaction_min_final_cltv_expiry,
+		_202412291200_app_default_invoice_description,
+		_202412301200_app_paused,
+		_202412311200_transaction_notified_at,
+		_202501011200_app_invoice_description_prefix,
+		_202501021200_app_payment_timeout,
+		_202501031200_transaction_pinned,
+		_202501041200_transaction_route,
+		_202501051200_transaction_failed_at,
+		_202501061200_app_max_in_flight_payments,
+		_202501071200_transaction_notify_url,
+		_202501081200_transaction_is_boost,
+		_202501101200_transactions_updated_at_index,
 	})
 
 	return m.Migrate()
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"gorm.io/datatypes"
+	"gorm.io/gorm"
 )
 
 type UserConfig struct {
@@ -25,6 +26,56 @@ type App struct {
 	UpdatedAt    time.Time
 	Isolated     bool
 	Metadata     datatypes.JSON
+	// maximum amount of a single invoice the app can create (0 = no limit)
+	MaxReceiveAmountSat uint64
+	// reject invoices without a description or description hash
+	RequireDescription bool
+	// per-app override of the encoded metadata limit (0 = default)
+	MaxMetadataLength uint
+	// maximum chained self payments this app can make (0 = default)
+	MaxSelfPaymentDepth uint
+	// callback URL for this app's transaction events, signed with WebhookSecret
+	WebhookUrl    string
+	WebhookSecret string
+	// apps in a budget group draw down the group's budget instead of their own
+	BudgetGroupId *uint
+	BudgetGroup   *BudgetGroup
+	// store the full decoded invoice on this app's outgoing payments
+	StoreDecodedInvoices bool
+	// only allow one open invoice per description hash (e.g. for LNURL-pay endpoints)
+	UniqueDescriptionHash bool
+	// accumulate keysends to the same destination sent within this many seconds
+	// of each other into a single transaction (0 = disabled)
+	KeysendAggregationWindowSeconds uint
+	// truncate this metadata field when metadata is over the limit, rather than
+	// rejecting the request (empty = reject)
+	MetadataTruncateField string
+	// maximum invoices the app can create within InvoiceRateLimitWindowSeconds (0 = default)
+	InvoiceRateLimit              uint
+	InvoiceRateLimitWindowSeconds uint
+	// per-app override of the minimum fee reserve of payments (0 = backend default)
+	MinFeeReserveMsat uint64
+	// description of invoices created without a description or description hash,
+	// e.g. amountless donation invoices (empty = none)
+	DefaultInvoiceDescription string
+	// prepended to the description of the app's invoices to identify them, e.g. "[MyShop] " (empty = none)
+	InvoiceDescriptionPrefix string
+	// reject new payments and invoices, e.g. while the app is suspected to be compromised.
+	// Pending payments and invoices can still settle.
+	Paused bool
+	// how long to wait for the app's payments to complete before leaving them pending (0 = backend default)
+	PaymentTimeoutSeconds uint
+	// maximum outgoing payments the app can have in flight at once (0 = no limit)
+	MaxInFlightPayments uint
+}
+
+type BudgetGroup struct {
+	ID            uint
+	Name          string `validate:"required"`
+	MaxAmountSat  int
+	BudgetRenewal string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
 }
 
 type AppPermission struct {
@@ -37,6 +88,11 @@ type AppPermission struct {
 	ExpiresAt     *time.Time
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
+	// budget in FiatCurrency, converted to MaxAmountSat at the current price when paying (0 = none)
+	MaxAmountFiat float64
+	FiatCurrency  string
+	// start of the budget period last seen when paying, to detect when the budget resets
+	BudgetPeriodStart *time.Time
 }
 
 type RequestEvent struct {
@@ -47,6 +103,7 @@ type RequestEvent struct {
 	ContentData string
 	Method      string
 	State       string
+	RelayUrl    string
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
 }
@@ -62,29 +119,101 @@ type ResponseEvent struct {
 }
 
 type Transaction struct {
-	ID              uint
-	AppId           *uint
-	App             *App
-	RequestEventId  *uint
-	RequestEvent    *RequestEvent
-	Type            string
-	State           string
-	AmountMsat      uint64
-	FeeMsat         uint64
-	FeeReserveMsat  uint64
-	PaymentRequest  string
-	PaymentHash     string
-	Description     string
-	DescriptionHash string
-	Preimage        *string
-	CreatedAt       time.Time
-	ExpiresAt       *time.Time
-	UpdatedAt       time.Time
-	SettledAt       *time.Time
-	Metadata        datatypes.JSON
-	SelfPayment     bool
-	Boostagram      datatypes.JSON
-	FailureReason   string
+	ID               uint
+	AppId            *uint
+	App              *App
+	RequestEventId   *uint
+	RequestEvent     *RequestEvent
+	Type             string
+	State            string
+	AmountMsat       uint64
+	FeeMsat          uint64
+	FeeReserveMsat   uint64
+	PaymentRequest   string
+	PaymentHash      string
+	Description      string
+	DescriptionHash  string
+	Preimage         *string
+	CreatedAt        time.Time
+	ExpiresAt        *time.Time
+	UpdatedAt        time.Time
+	SettledAt        *time.Time
+	Metadata         datatypes.JSON
+	SelfPayment      bool
+	Boostagram       datatypes.JSON
+	FailureReason    string
+	InboundChannelId string
+	ExternalRef      string
+	PayeePubkey      string
+	// set on an invoice reissued to extend the expiry of the original invoice
+	ReissuedFromId *uint
+	// prod or test, so developers can separate test transactions on a shared hub
+	Environment string
+	// hidden from transaction lists, but still counted in balances and budgets
+	DeletedAt gorm.DeletedAt
+	// shares of an incoming payment to credit to other apps when it is received
+	SplitRule datatypes.JSON
+	// set on the ledger entries created by splitting a received payment
+	SplitFromId *uint
+	// the complete decoded invoice of an outgoing payment, if the app opted in
+	DecodedInvoice datatypes.JSON
+	// the relay the NWC request for this transaction was received through
+	RelayUrl string
+	// set on an aggregated keysend transaction that further keysends can still be added to
+	AggregateOpen bool
+	// on-chain fee of the channel opened to receive this payment, on top of FeeMsat
+	ChannelOpenFeeMsat uint64
+	// amount received so far for an invoice paid in parts (MPP)
+	ReceivedAmountMsat uint64
+	// min final CLTV expiry (in blocks) of the invoice of an outgoing payment
+	MinFinalCltvExpiry uint
+	// when the settlement event of this transaction was consumed by all event subscribers
+	// (e.g. the NIP-47 notifier). Unset on settled transactions whose notifications may have been lost.
+	NotifiedAt *time.Time
+	// pinned by the user for quick access, e.g. a payment that is repeated regularly
+	Pinned bool
+	// hops (pubkeys and channel ids) of the route a settled outgoing payment took, if the backend returned them
+	Route datatypes.JSON
+	// when a payment failed, so the time it spent pending is known like for settled payments
+	FailedAt *time.Time
+	// whether the stored preimage hashes to the stored payment hash. Not stored, only set
+	// when requested on lookup, and nil if there is nothing to verify
+	PreimageMatchesPaymentHash *bool `gorm:"-"`
+	// one-time callback URL notified when this invoice is paid (empty = none)
+	NotifyUrl string
+	// whether the payment carries a parseable boostagram (keysend TLV 7629169)
+	IsBoost bool
+}
+
+// PaymentIntent reserves an app's budget (and balance, if isolated) for a payment
+// that is made later with an invoice matching the intent
+type PaymentIntent struct {
+	ID         uint
+	AppId      uint
+	App        App
+	State      string
+	AmountMsat uint64
+	// how far the invoice amount may differ from AmountMsat
+	ToleranceMsat uint64
+	// payee pubkeys the invoice may be for (empty = any)
+	AllowedDestinations datatypes.JSON
+	ExpiresAt           time.Time
+	// the payment made to fulfill the intent
+	TransactionId *uint
+	Transaction   *Transaction
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// Activity is a published event that is shown in the activity feed alongside transactions
+type Activity struct {
+	ID   uint
+	Type string
+	// the app the event is about, if any
+	AppId      *uint
+	App        *App
+	Properties datatypes.JSON
+	CreatedAt  time.Time
 }
 
 const (
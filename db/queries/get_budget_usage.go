@@ -8,6 +8,8 @@ import (
 	"gorm.io/gorm"
 )
 
+// GetBudgetUsageSat includes soft-deleted transactions, as hiding a payment does not undo it,
+// and the amounts reserved by open payment intents
 func GetBudgetUsageSat(tx *gorm.DB, appPermission *db.AppPermission) uint64 {
 	var result struct {
 		Sum uint64
@@ -16,7 +18,43 @@ func GetBudgetUsageSat(tx *gorm.DB, appPermission *db.AppPermission) uint64 {
 		Table("transactions").
 		Select("SUM(amount_msat + fee_msat + fee_reserve_msat) as sum").
 		Where("app_id = ? AND type = ? AND (state = ? OR state = ?) AND created_at > ?", appPermission.AppId, constants.TRANSACTION_TYPE_OUTGOING, constants.TRANSACTION_STATE_SETTLED, constants.TRANSACTION_STATE_PENDING, getStartOfBudget(appPermission.BudgetRenewal)).Scan(&result)
-	return result.Sum / 1000
+	reservedMsat := getPaymentIntentReservationsMsat(tx, "app_id = ? AND created_at > ?", appPermission.AppId, getStartOfBudget(appPermission.BudgetRenewal))
+	return (result.Sum + reservedMsat) / 1000
+}
+
+// GetBudgetGroupUsageSat sums the budget usage of all apps in the budget group
+func GetBudgetGroupUsageSat(tx *gorm.DB, budgetGroup *db.BudgetGroup) uint64 {
+	var result struct {
+		Sum uint64
+	}
+	tx.
+		Table("transactions").
+		Select("SUM(amount_msat + fee_msat + fee_reserve_msat) as sum").
+		Where("app_id IN (SELECT id FROM apps WHERE budget_group_id = ?) AND type = ? AND (state = ? OR state = ?) AND created_at > ?", budgetGroup.ID, constants.TRANSACTION_TYPE_OUTGOING, constants.TRANSACTION_STATE_SETTLED, constants.TRANSACTION_STATE_PENDING, getStartOfBudget(budgetGroup.BudgetRenewal)).Scan(&result)
+	reservedMsat := getPaymentIntentReservationsMsat(tx, "app_id IN (SELECT id FROM apps WHERE budget_group_id = ?) AND created_at > ?", budgetGroup.ID, getStartOfBudget(budgetGroup.BudgetRenewal))
+	return (result.Sum + reservedMsat) / 1000
+}
+
+// GetAppBudget returns the budget the app's payments count towards and how much of it is used:
+// the budget group's if the app belongs to one, otherwise the app's pay_invoice budget
+func GetAppBudget(tx *gorm.DB, app *db.App, appPermission *db.AppPermission) (maxAmountSat int, budgetRenewal string, budgetUsageSat uint64) {
+	if app.BudgetGroupId != nil {
+		var budgetGroup db.BudgetGroup
+		result := tx.Limit(1).Find(&budgetGroup, &db.BudgetGroup{
+			ID: *app.BudgetGroupId,
+		})
+		if result.RowsAffected > 0 {
+			if budgetGroup.MaxAmountSat == 0 {
+				return 0, budgetGroup.BudgetRenewal, 0
+			}
+			return budgetGroup.MaxAmountSat, budgetGroup.BudgetRenewal, GetBudgetGroupUsageSat(tx, &budgetGroup)
+		}
+	}
+
+	if appPermission.MaxAmountSat == 0 {
+		return 0, appPermission.BudgetRenewal, 0
+	}
+	return appPermission.MaxAmountSat, appPermission.BudgetRenewal, GetBudgetUsageSat(tx, appPermission)
 }
 
 func getStartOfBudget(budget_type string) time.Time {
@@ -43,6 +81,11 @@ func getStartOfBudget(budget_type string) time.Time {
 	}
 }
 
+// GetBudgetPeriodStart returns when the current budget period started (zero for budgets that never renew)
+func GetBudgetPeriodStart(budgetRenewal string) time.Time {
+	return getStartOfBudget(budgetRenewal)
+}
+
 func GetBudgetRenewsAt(budgetRenewal string) *uint64 {
 	budgetStart := getStartOfBudget(budgetRenewal)
 	switch budgetRenewal {
@@ -5,6 +5,8 @@ import (
 	"gorm.io/gorm"
 )
 
+// GetIsolatedBalance includes soft-deleted transactions, as hiding a transaction does not undo it.
+// Amounts reserved by open payment intents are not available.
 func GetIsolatedBalance(tx *gorm.DB, appId uint) uint64 {
 	var received struct {
 		Sum uint64
@@ -23,5 +25,7 @@ func GetIsolatedBalance(tx *gorm.DB, appId uint) uint64 {
 		Select("SUM(amount_msat + fee_msat + fee_reserve_msat) as sum").
 		Where("app_id = ? AND type = ? AND (state = ? OR state = ?)", appId, constants.TRANSACTION_TYPE_OUTGOING, constants.TRANSACTION_STATE_SETTLED, constants.TRANSACTION_STATE_PENDING).Scan(&spent)
 
-	return received.Sum - spent.Sum
+	reservedMsat := getPaymentIntentReservationsMsat(tx, "app_id = ?", appId)
+
+	return received.Sum - spent.Sum - reservedMsat
 }
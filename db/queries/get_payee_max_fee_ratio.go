@@ -0,0 +1,25 @@
+package queries
+
+import (
+	"github.com/getAlby/hub/constants"
+	"gorm.io/gorm"
+)
+
+// GetPayeeMaxFeeRatio returns the highest routing fee paid to a payee relative to the payment amount,
+// over settled outgoing payments. Self payments and test transactions are not included.
+// Soft-deleted transactions are included.
+func GetPayeeMaxFeeRatio(tx *gorm.DB, payee string) (float64, error) {
+	var result struct {
+		MaxFeeRatio float64
+	}
+	err := tx.
+		Table("transactions").
+		Select("COALESCE(MAX(fee_msat * 1.0 / amount_msat), 0) as max_fee_ratio").
+		Where("type = ? AND state = ? AND payee_pubkey = ? AND self_payment = ? AND amount_msat > 0 AND environment != ?",
+			constants.TRANSACTION_TYPE_OUTGOING, constants.TRANSACTION_STATE_SETTLED, payee, false, constants.TRANSACTION_ENVIRONMENT_TEST).
+		Scan(&result).Error
+	if err != nil {
+		return 0, err
+	}
+	return result.MaxFeeRatio, nil
+}
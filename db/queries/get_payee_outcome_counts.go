@@ -0,0 +1,28 @@
+package queries
+
+import (
+	"github.com/getAlby/hub/constants"
+	"gorm.io/gorm"
+)
+
+// GetPayeeOutcomeCounts counts settled and failed outgoing payments to a payee.
+// Self payments are not included, nor are test transactions if excludeTestTransactions is set.
+// Soft-deleted transactions are included.
+func GetPayeeOutcomeCounts(tx *gorm.DB, payee string, excludeTestTransactions bool) (settledCount uint64, failedCount uint64, err error) {
+	var result struct {
+		SettledCount uint64
+		FailedCount  uint64
+	}
+	query := tx.
+		Table("transactions").
+		Select("SUM(CASE WHEN state = ? THEN 1 ELSE 0 END) as settled_count, SUM(CASE WHEN state = ? THEN 1 ELSE 0 END) as failed_count", constants.TRANSACTION_STATE_SETTLED, constants.TRANSACTION_STATE_FAILED).
+		Where("type = ? AND payee_pubkey = ? AND self_payment = ?", constants.TRANSACTION_TYPE_OUTGOING, payee, false)
+	if excludeTestTransactions {
+		query = query.Where("environment != ?", constants.TRANSACTION_ENVIRONMENT_TEST)
+	}
+	err = query.Scan(&result).Error
+	if err != nil {
+		return 0, 0, err
+	}
+	return result.SettledCount, result.FailedCount, nil
+}
@@ -0,0 +1,22 @@
+package queries
+
+import (
+	"time"
+
+	"github.com/getAlby/hub/constants"
+	"gorm.io/gorm"
+)
+
+// getPaymentIntentReservationsMsat sums the most that can be paid to fulfill the open payment intents
+// matching the query. Expired intents no longer reserve anything, even before they are marked expired.
+func getPaymentIntentReservationsMsat(tx *gorm.DB, query string, args ...interface{}) uint64 {
+	var result struct {
+		Sum uint64
+	}
+	tx.
+		Table("payment_intents").
+		Select("SUM(amount_msat + tolerance_msat) as sum").
+		Where("state = ? AND expires_at > ?", constants.PAYMENT_INTENT_STATE_OPEN, time.Now()).
+		Where(query, args...).Scan(&result)
+	return result.Sum
+}
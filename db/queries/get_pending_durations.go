@@ -0,0 +1,45 @@
+package queries
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/getAlby/hub/constants"
+	"gorm.io/gorm"
+)
+
+// GetPendingDurations returns how long each outgoing payment which ended up in the given state
+// (settled or failed) between from and until (unix seconds, 0 = unbounded) was pending.
+// Self payments settle instantly so are not included, nor are payments which failed before
+// the time they failed was recorded.
+func GetPendingDurations(tx *gorm.DB, state string, from, until uint64) ([]time.Duration, error) {
+	completedAtColumn := "settled_at"
+	if state == constants.TRANSACTION_STATE_FAILED {
+		completedAtColumn = "failed_at"
+	}
+
+	var rows []struct {
+		CreatedAt   time.Time
+		CompletedAt time.Time
+	}
+	query := tx.
+		Table("transactions").
+		Select(fmt.Sprintf("created_at, %s AS completed_at", completedAtColumn)).
+		Where(fmt.Sprintf("type = ? AND state = ? AND %s IS NOT NULL AND self_payment = ?", completedAtColumn), constants.TRANSACTION_TYPE_OUTGOING, state, false)
+	if from > 0 {
+		query = query.Where(completedAtColumn+" >= ?", time.Unix(int64(from), 0))
+	}
+	if until > 0 {
+		query = query.Where(completedAtColumn+" <= ?", time.Unix(int64(until), 0))
+	}
+	err := query.Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	durations := make([]time.Duration, 0, len(rows))
+	for _, row := range rows {
+		durations = append(durations, max(row.CompletedAt.Sub(row.CreatedAt), 0))
+	}
+	return durations, nil
+}
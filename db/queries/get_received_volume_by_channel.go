@@ -0,0 +1,29 @@
+package queries
+
+import (
+	"github.com/getAlby/hub/constants"
+	"gorm.io/gorm"
+)
+
+type ChannelVolume struct {
+	InboundChannelId string
+	AmountMsat       uint64
+	Count            uint64
+}
+
+// GetReceivedVolumeByChannel sums settled incoming payments per inbound channel.
+// Self payments and payments where the backend did not report the channel are not included.
+func GetReceivedVolumeByChannel(tx *gorm.DB) ([]ChannelVolume, error) {
+	var channelVolumes []ChannelVolume
+	err := tx.
+		Table("transactions").
+		Select("inbound_channel_id, SUM(amount_msat) as amount_msat, COUNT(*) as count").
+		Where("type = ? AND state = ? AND self_payment = ? AND inbound_channel_id IS NOT NULL AND inbound_channel_id != ''", constants.TRANSACTION_TYPE_INCOMING, constants.TRANSACTION_STATE_SETTLED, false).
+		Group("inbound_channel_id").
+		Order("amount_msat desc").
+		Scan(&channelVolumes).Error
+	if err != nil {
+		return nil, err
+	}
+	return channelVolumes, nil
+}
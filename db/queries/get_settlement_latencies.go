@@ -0,0 +1,42 @@
+package queries
+
+import (
+	"time"
+
+	"github.com/getAlby/hub/constants"
+	"gorm.io/gorm"
+)
+
+// GetSettlementLatencies returns how long each payment of the given type that settled
+// between from and until (unix seconds, 0 = unbounded) took from creation to settlement.
+// Self payments and split ledger entries settle instantly so are not included, nor are
+// received keysend payments, which are only recorded once they have settled.
+func GetSettlementLatencies(tx *gorm.DB, transactionType string, from, until uint64) ([]time.Duration, error) {
+	var rows []struct {
+		CreatedAt time.Time
+		SettledAt time.Time
+	}
+	query := tx.
+		Table("transactions").
+		Select("created_at, settled_at").
+		Where("type = ? AND state = ? AND settled_at IS NOT NULL AND self_payment = ? AND split_from_id IS NULL", transactionType, constants.TRANSACTION_STATE_SETTLED, false)
+	if transactionType == constants.TRANSACTION_TYPE_INCOMING {
+		query = query.Where("payment_request != ''")
+	}
+	if from > 0 {
+		query = query.Where("settled_at >= ?", time.Unix(int64(from), 0))
+	}
+	if until > 0 {
+		query = query.Where("settled_at <= ?", time.Unix(int64(until), 0))
+	}
+	err := query.Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	latencies := make([]time.Duration, 0, len(rows))
+	for _, row := range rows {
+		latencies = append(latencies, max(row.SettledAt.Sub(row.CreatedAt), 0))
+	}
+	return latencies, nil
+}
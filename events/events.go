@@ -52,16 +52,32 @@ func (ep *eventPublisher) PublishSync(event *Event) {
 	ep.publish(event, true)
 }
 
-func (ep *eventPublisher) publish(event *Event, sync bool) {
+func (ep *eventPublisher) publish(event *Event, synchronous bool) {
 	ep.subscriberMtx.Lock()
 	defer ep.subscriberMtx.Unlock()
 	logger.Logger.WithFields(logrus.Fields{"event": event, "global": ep.globalProperties}).Debug("Publishing event")
+	var consumed sync.WaitGroup
 	for _, listener := range ep.listeners {
-		if sync {
+		if synchronous {
 			listener.ConsumeEvent(context.Background(), event, ep.globalProperties)
 		} else {
 			// consume event without blocking thread
-			go listener.ConsumeEvent(context.Background(), event, ep.globalProperties)
+			consumed.Add(1)
+			go func(listener EventSubscriber) {
+				defer consumed.Done()
+				listener.ConsumeEvent(context.Background(), event, ep.globalProperties)
+			}(listener)
+		}
+	}
+
+	if event.OnConsumed != nil {
+		if synchronous {
+			event.OnConsumed()
+		} else {
+			go func() {
+				consumed.Wait()
+				event.OnConsumed()
+			}()
 		}
 	}
 }
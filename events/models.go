@@ -19,6 +19,11 @@ type EventPublisher interface {
 type Event struct {
 	Event      string      `json:"event"`
 	Properties interface{} `json:"properties,omitempty"`
+	// the properties before the change the event is about, if known
+	// (e.g. a transaction before it was settled). Only passed to subscribers.
+	PreviousProperties interface{} `json:"-"`
+	// called once every subscriber has consumed the event, e.g. to record that it was delivered
+	OnConsumed func() `json:"-"`
 }
 
 type StaticChannelsBackupEvent struct {
@@ -16,6 +16,7 @@ import (
 	decodepay "github.com/nbd-wtf/ln-decodepay"
 	"github.com/sirupsen/logrus"
 
+	"github.com/getAlby/hub/config"
 	"github.com/getAlby/hub/lnclient"
 	"github.com/getAlby/hub/logger"
 )
@@ -208,6 +209,25 @@ func (bs *BreezService) LookupInvoice(ctx context.Context, paymentHash string) (
 	}
 }
 
+func (bs *BreezService) LookupPayment(ctx context.Context, paymentHash string) (lnclient.PaymentStatus, error) {
+	payment, err := bs.svc.PaymentByHash(paymentHash)
+	if err != nil {
+		return "", err
+	}
+	if payment == nil {
+		return lnclient.PAYMENT_STATUS_NOT_FOUND, nil
+	}
+
+	switch payment.Status {
+	case breez_sdk.PaymentStatusComplete:
+		return lnclient.PAYMENT_STATUS_SUCCEEDED, nil
+	case breez_sdk.PaymentStatusFailed:
+		return lnclient.PAYMENT_STATUS_FAILED, nil
+	default:
+		return lnclient.PAYMENT_STATUS_PENDING, nil
+	}
+}
+
 func (bs *BreezService) ListTransactions(ctx context.Context, from, until, limit, offset uint64, unpaid bool, invoiceType string) (transactions []lnclient.Transaction, err error) {
 
 	request := breez_sdk.ListPaymentsRequest{}
@@ -311,18 +331,25 @@ func breezPaymentToTransaction(payment *breez_sdk.Payment) (*lnclient.Transactio
 		descriptionHash = paymentRequest.DescriptionHash
 	}
 
+	// the fee of a received payment is the LSP's fee to open a channel for it
+	var channelOpenFeeMsat int64
+	if txType == "incoming" {
+		channelOpenFeeMsat = int64(payment.FeeMsat)
+	}
+
 	tx := &lnclient.Transaction{
-		Type:            txType,
-		Invoice:         lnDetails.Data.Bolt11,
-		Preimage:        lnDetails.Data.PaymentPreimage,
-		PaymentHash:     lnDetails.Data.PaymentHash,
-		Amount:          int64(payment.AmountMsat),
-		FeesPaid:        int64(payment.FeeMsat),
-		CreatedAt:       createdAt,
-		ExpiresAt:       expiresAt,
-		Metadata:        nil,
-		Description:     description,
-		DescriptionHash: descriptionHash,
+		Type:               txType,
+		Invoice:            lnDetails.Data.Bolt11,
+		Preimage:           lnDetails.Data.PaymentPreimage,
+		PaymentHash:        lnDetails.Data.PaymentHash,
+		Amount:             int64(payment.AmountMsat),
+		FeesPaid:           int64(payment.FeeMsat),
+		ChannelOpenFeeMsat: channelOpenFeeMsat,
+		CreatedAt:          createdAt,
+		ExpiresAt:          expiresAt,
+		Metadata:           nil,
+		Description:        description,
+		DescriptionHash:    descriptionHash,
 	}
 	if payment.Status == breez_sdk.PaymentStatusComplete {
 		settledAt := payment.PaymentTime
@@ -485,6 +512,10 @@ func (bs *BreezService) GetSupportedNIP47NotificationTypes() []string {
 	return []string{}
 }
 
+func (bs *BreezService) GetBackendType() string {
+	return config.BreezBackendType
+}
+
 func (bs *BreezService) GetPubkey() string {
 	return bs.pubkey
 }
@@ -11,6 +11,7 @@ import (
 
 	"github.com/elnosh/gonuts/wallet"
 	"github.com/elnosh/gonuts/wallet/storage"
+	"github.com/getAlby/hub/config"
 	"github.com/getAlby/hub/lnclient"
 	"github.com/getAlby/hub/logger"
 	decodepay "github.com/nbd-wtf/ln-decodepay"
@@ -149,6 +150,10 @@ func (cs *CashuService) LookupInvoice(ctx context.Context, paymentHash string) (
 	return transaction, nil
 }
 
+func (cs *CashuService) LookupPayment(ctx context.Context, paymentHash string) (lnclient.PaymentStatus, error) {
+	return "", errors.New("not supported")
+}
+
 func (cs *CashuService) ListTransactions(ctx context.Context, from, until, limit, offset uint64, unpaid bool, invoiceType string) (transactions []lnclient.Transaction, err error) {
 	transactions = []lnclient.Transaction{}
 
@@ -365,6 +370,10 @@ func (cs *CashuService) GetSupportedNIP47NotificationTypes() []string {
 	return []string{}
 }
 
+func (cs *CashuService) GetBackendType() string {
+	return config.CashuBackendType
+}
+
 func (svc *CashuService) GetPubkey() string {
 	return ""
 }
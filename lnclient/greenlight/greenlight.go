@@ -236,6 +236,10 @@ func (gs *GreenlightService) LookupInvoice(ctx context.Context, paymentHash stri
 	return transaction, nil
 }
 
+func (gs *GreenlightService) LookupPayment(ctx context.Context, paymentHash string) (lnclient.PaymentStatus, error) {
+	return "", errors.New("not supported")
+}
+
 func (gs *GreenlightService) ListTransactions(ctx context.Context, from, until, limit, offset uint64, unpaid bool, invoiceType string) (transactions []lnclient.Transaction, err error) {
 	listInvoicesResponse, err := gs.client.ListInvoices(glalby.ListInvoicesRequest{})
 
@@ -681,6 +685,10 @@ func (gs *GreenlightService) GetSupportedNIP47NotificationTypes() []string {
 	return []string{}
 }
 
+func (gs *GreenlightService) GetBackendType() string {
+	return config.GreenlightBackendType
+}
+
 func (gs *GreenlightService) GetPubkey() string {
 	return gs.pubkey
 }
@@ -727,6 +727,22 @@ func (ls *LDKService) LookupInvoice(ctx context.Context, paymentHash string) (tr
 	return transaction, nil
 }
 
+func (ls *LDKService) LookupPayment(ctx context.Context, paymentHash string) (lnclient.PaymentStatus, error) {
+	payment := ls.node.Payment(paymentHash)
+	if payment == nil {
+		return lnclient.PAYMENT_STATUS_NOT_FOUND, nil
+	}
+
+	switch payment.Status {
+	case ldk_node.PaymentStatusSucceeded:
+		return lnclient.PAYMENT_STATUS_SUCCEEDED, nil
+	case ldk_node.PaymentStatusFailed:
+		return lnclient.PAYMENT_STATUS_FAILED, nil
+	default:
+		return lnclient.PAYMENT_STATUS_PENDING, nil
+	}
+}
+
 func (ls *LDKService) ListTransactions(ctx context.Context, from, until, limit, offset uint64, unpaid bool, invoiceType string) (transactions []lnclient.Transaction, err error) {
 	transactions = []lnclient.Transaction{}
 
@@ -1671,6 +1687,10 @@ func (ls *LDKService) GetSupportedNIP47NotificationTypes() []string {
 	return []string{"payment_received", "payment_sent"}
 }
 
+func (ls *LDKService) GetBackendType() string {
+	return config.LDKBackendType
+}
+
 func (ls *LDKService) getPaymentFailReason(eventPaymentFailed *ldk_node.EventPaymentFailed) string {
 	var failureReason ldk_node.PaymentFailureReason
 	var failureReasonMessage string
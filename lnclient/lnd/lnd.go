@@ -16,8 +16,10 @@ import (
 
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	decodepay "github.com/nbd-wtf/ln-decodepay"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
+	"github.com/getAlby/hub/config"
 	"github.com/getAlby/hub/events"
 	"github.com/getAlby/hub/lnclient"
 	"github.com/getAlby/hub/lnclient/lnd/wrapper"
@@ -311,8 +313,57 @@ func (svc *LNDService) LookupInvoice(ctx context.Context, paymentHash string) (t
 	return transaction, nil
 }
 
+func (svc *LNDService) LookupPayment(ctx context.Context, paymentHash string) (lnclient.PaymentStatus, error) {
+	paymentHashBytes, err := hex.DecodeString(paymentHash)
+
+	if err != nil || len(paymentHashBytes) != 32 {
+		logger.Logger.WithFields(logrus.Fields{
+			"paymentHash": paymentHash,
+		}).Errorf("Invalid payment hash")
+		return "", errors.New("Payment hash must be 32 bytes hex")
+	}
+
+	// the first update is the current state of the payment
+	trackCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := svc.client.SubscribePayment(trackCtx, &routerrpc.TrackPaymentRequest{
+		PaymentHash: paymentHashBytes,
+	})
+	if err != nil {
+		return "", err
+	}
+	payment, err := stream.Recv()
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return lnclient.PAYMENT_STATUS_NOT_FOUND, nil
+		}
+		return "", err
+	}
+
+	switch payment.Status {
+	case lnrpc.Payment_SUCCEEDED:
+		return lnclient.PAYMENT_STATUS_SUCCEEDED, nil
+	case lnrpc.Payment_FAILED:
+		return lnclient.PAYMENT_STATUS_FAILED, nil
+	default:
+		return lnclient.PAYMENT_STATUS_PENDING, nil
+	}
+}
+
 func (svc *LNDService) SendPaymentSync(ctx context.Context, payReq string) (*lnclient.PayInvoiceResponse, error) {
-	resp, err := svc.client.SendPaymentSync(ctx, &lnrpc.SendRequest{PaymentRequest: payReq})
+	return svc.sendPaymentSync(ctx, &lnrpc.SendRequest{PaymentRequest: payReq})
+}
+
+func (svc *LNDService) SendPaymentSyncWithOutgoingChannel(ctx context.Context, payReq string, outgoingChannelId string) (*lnclient.PayInvoiceResponse, error) {
+	outgoingChanId, err := strconv.ParseUint(outgoingChannelId, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid channel id: %w", err)
+	}
+	return svc.sendPaymentSync(ctx, &lnrpc.SendRequest{PaymentRequest: payReq, OutgoingChanId: outgoingChanId})
+}
+
+func (svc *LNDService) sendPaymentSync(ctx context.Context, sendRequest *lnrpc.SendRequest) (*lnclient.PayInvoiceResponse, error) {
+	resp, err := svc.client.SendPaymentSync(ctx, sendRequest)
 	if err != nil {
 		return nil, err
 	}
@@ -326,13 +377,21 @@ func (svc *LNDService) SendPaymentSync(ctx context.Context, payReq string) (*lnc
 	}
 
 	var fee uint64 = 0
+	var route []lnclient.RouteHop
 	if resp.PaymentRoute != nil {
 		fee = uint64(resp.PaymentRoute.TotalFeesMsat)
+		for _, hop := range resp.PaymentRoute.Hops {
+			route = append(route, lnclient.RouteHop{
+				Pubkey:    hop.PubKey,
+				ChannelId: strconv.FormatUint(hop.ChanId, 10),
+			})
+		}
 	}
 
 	return &lnclient.PayInvoiceResponse{
 		Preimage: hex.EncodeToString(resp.PaymentPreimage),
 		Fee:      fee,
+		Route:    route,
 	}, nil
 }
 
@@ -932,6 +991,24 @@ func lndInvoiceToTransaction(invoice *lnrpc.Invoice) *lnclient.Transaction {
 		expiresAt = &expiresAtUnix
 	}
 
+	// only record the channel for settled invoices, based on the settled HTLCs
+	// (canceled HTLCs may have arrived on a different channel).
+	// MPP payments received over multiple channels are not attributed to any channel.
+	var inboundChannelId string
+	if invoice.State == lnrpc.Invoice_SETTLED {
+		for _, htlc := range invoice.Htlcs {
+			if htlc.State != lnrpc.InvoiceHTLCState_SETTLED {
+				continue
+			}
+			htlcChannelId := strconv.FormatUint(htlc.ChanId, 10)
+			if inboundChannelId != "" && inboundChannelId != htlcChannelId {
+				inboundChannelId = ""
+				break
+			}
+			inboundChannelId = htlcChannelId
+		}
+	}
+
 	if invoice.IsKeysend {
 		tlvRecords := []lnclient.TLVRecord{}
 		for _, htlc := range invoice.Htlcs {
@@ -946,17 +1023,18 @@ func lndInvoiceToTransaction(invoice *lnrpc.Invoice) *lnclient.Transaction {
 	}
 
 	return &lnclient.Transaction{
-		Type:            "incoming",
-		Invoice:         invoice.PaymentRequest,
-		Description:     invoice.Memo,
-		DescriptionHash: hex.EncodeToString(invoice.DescriptionHash),
-		Preimage:        preimage,
-		PaymentHash:     hex.EncodeToString(invoice.RHash),
-		Amount:          invoice.ValueMsat,
-		CreatedAt:       invoice.CreationDate,
-		SettledAt:       settledAt,
-		ExpiresAt:       expiresAt,
-		Metadata:        metadata,
+		Type:             "incoming",
+		Invoice:          invoice.PaymentRequest,
+		Description:      invoice.Memo,
+		DescriptionHash:  hex.EncodeToString(invoice.DescriptionHash),
+		Preimage:         preimage,
+		PaymentHash:      hex.EncodeToString(invoice.RHash),
+		Amount:           invoice.ValueMsat,
+		CreatedAt:        invoice.CreationDate,
+		SettledAt:        settledAt,
+		ExpiresAt:        expiresAt,
+		Metadata:         metadata,
+		InboundChannelId: inboundChannelId,
 	}
 }
 
@@ -983,6 +1061,10 @@ func (svc *LNDService) GetNodeStatus(ctx context.Context) (nodeStatus *lnclient.
 	if err != nil {
 		return nil, err
 	}
+	lndInfo, err := svc.client.GetInfo(ctx, &lnrpc.GetInfoRequest{})
+	if err != nil {
+		return nil, err
+	}
 
 	return &lnclient.NodeStatus{
 		InternalNodeStatus: map[string]interface{}{
@@ -992,6 +1074,7 @@ func (svc *LNDService) GetNodeStatus(ctx context.Context) (nodeStatus *lnclient.
 			"network_info": networkInfo,
 			"wallet_state": state.GetState().String(),
 		},
+		Syncing: !lndInfo.SyncedToChain,
 	}, nil
 }
 
@@ -1096,6 +1179,10 @@ func (svc *LNDService) GetSupportedNIP47NotificationTypes() []string {
 	return []string{"payment_received", "payment_sent"}
 }
 
+func (svc *LNDService) GetBackendType() string {
+	return config.LNDBackendType
+}
+
 func (svc *LNDService) GetPubkey() string {
 	return svc.nodeInfo.Pubkey
 }
@@ -37,7 +37,23 @@ type Transaction struct {
 	ExpiresAt       *int64
 	SettledAt       *int64
 	Metadata        Metadata
-}
+	// channel a settled incoming payment arrived on (if reported by the backend).
+	// Empty for multi-part payments received over more than one channel.
+	InboundChannelId string
+	// on-chain fee charged for a channel opened to receive an incoming payment
+	// (if reported by the backend). 0 if no channel was opened.
+	ChannelOpenFeeMsat int64
+}
+
+type PaymentStatus string
+
+const (
+	PAYMENT_STATUS_PENDING   PaymentStatus = "pending"
+	PAYMENT_STATUS_SUCCEEDED PaymentStatus = "succeeded"
+	PAYMENT_STATUS_FAILED    PaymentStatus = "failed"
+	// the backend has no record of the payment
+	PAYMENT_STATUS_NOT_FOUND PaymentStatus = "not_found"
+)
 
 type NodeConnectionInfo struct {
 	Pubkey  string `json:"pubkey"`
@@ -52,6 +68,8 @@ type LNClient interface {
 	GetInfo(ctx context.Context) (info *NodeInfo, err error)
 	MakeInvoice(ctx context.Context, amount int64, description string, descriptionHash string, expiry int64) (transaction *Transaction, err error)
 	LookupInvoice(ctx context.Context, paymentHash string) (transaction *Transaction, err error)
+	// LookupPayment returns the backend's status of an outgoing payment
+	LookupPayment(ctx context.Context, paymentHash string) (PaymentStatus, error)
 	ListTransactions(ctx context.Context, from, until, limit, offset uint64, unpaid bool, invoiceType string) (transactions []Transaction, err error)
 	Shutdown() error
 	ListChannels(ctx context.Context) (channels []Channel, err error)
@@ -77,6 +95,12 @@ type LNClient interface {
 	UpdateLastWalletSyncRequest()
 	GetSupportedNIP47Methods() []string
 	GetSupportedNIP47NotificationTypes() []string
+	GetBackendType() string
+}
+
+// OutgoingChannelPayer is implemented by backends which can pay an invoice through a specific channel
+type OutgoingChannelPayer interface {
+	SendPaymentSyncWithOutgoingChannel(ctx context.Context, payReq string, outgoingChannelId string) (*PayInvoiceResponse, error)
 }
 
 type Channel struct {
@@ -100,6 +124,8 @@ type Channel struct {
 
 type NodeStatus struct {
 	InternalNodeStatus interface{} `json:"internalNodeStatus"`
+	// true while the node is catching up with the chain. Backends which cannot tell report false
+	Syncing bool `json:"syncing"`
 }
 
 type ConnectPeerRequest struct {
@@ -160,6 +186,13 @@ type LightningBalanceResponse struct {
 type PayInvoiceResponse struct {
 	Preimage string `json:"preimage"`
 	Fee      uint64 `json:"fee"`
+	// hops of the route the payment took, if the backend returns them
+	Route []RouteHop `json:"route,omitempty"`
+}
+
+type RouteHop struct {
+	Pubkey    string `json:"pubkey"`
+	ChannelId string `json:"channel_id"`
 }
 
 type PayKeysendResponse struct {
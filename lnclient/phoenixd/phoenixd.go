@@ -12,6 +12,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/getAlby/hub/config"
 	"github.com/getAlby/hub/lnclient"
 	"github.com/getAlby/hub/logger"
 	decodepay "github.com/nbd-wtf/ln-decodepay"
@@ -125,6 +126,10 @@ func (svc *PhoenixService) GetBalances(ctx context.Context) (*lnclient.BalancesR
 	}, nil
 }
 
+func (svc *PhoenixService) LookupPayment(ctx context.Context, paymentHash string) (lnclient.PaymentStatus, error) {
+	return "", errors.New("not supported")
+}
+
 func (svc *PhoenixService) ListTransactions(ctx context.Context, from, until, limit, offset uint64, unpaid bool, invoiceType string) (transactions []lnclient.Transaction, err error) {
 	incomingQuery := url.Values{}
 	if from != 0 {
@@ -180,6 +185,8 @@ func (svc *PhoenixService) ListTransactions(ctx context.Context, from, until, li
 			CreatedAt:   time.UnixMilli(invoice.CreatedAt).Unix(),
 			Description: invoice.Description,
 			SettledAt:   settledAt,
+			// phoenixd only charges incoming payments for the liquidity (channel open or splice) to receive them
+			ChannelOpenFeeMsat: invoice.Fees * 1000,
 		}
 		transactions = append(transactions, transaction)
 	}
@@ -383,17 +390,19 @@ func (svc *PhoenixService) LookupInvoice(ctx context.Context, paymentHash string
 	expiresAt := time.UnixMilli(int64(paymentRequest.CreatedAt) * 1000).Add(time.Duration(paymentRequest.Expiry) * time.Second).Unix()
 
 	transaction = &lnclient.Transaction{
-		Type:            "incoming",
-		Invoice:         invoiceRes.Invoice,
-		Preimage:        invoiceRes.Preimage,
-		PaymentHash:     invoiceRes.PaymentHash,
-		Amount:          invoiceRes.ReceivedSat * 1000,
-		FeesPaid:        invoiceRes.Fees * 1000,
-		CreatedAt:       time.UnixMilli(invoiceRes.CreatedAt).Unix(),
-		Description:     invoiceRes.Description,
-		SettledAt:       settledAt,
-		ExpiresAt:       &expiresAt,
-		DescriptionHash: paymentRequest.DescriptionHash,
+		Type:        "incoming",
+		Invoice:     invoiceRes.Invoice,
+		Preimage:    invoiceRes.Preimage,
+		PaymentHash: invoiceRes.PaymentHash,
+		Amount:      invoiceRes.ReceivedSat * 1000,
+		FeesPaid:    invoiceRes.Fees * 1000,
+		// phoenixd only charges incoming payments for the liquidity (channel open or splice) to receive them
+		ChannelOpenFeeMsat: invoiceRes.Fees * 1000,
+		CreatedAt:          time.UnixMilli(invoiceRes.CreatedAt).Unix(),
+		Description:        invoiceRes.Description,
+		SettledAt:          settledAt,
+		ExpiresAt:          &expiresAt,
+		DescriptionHash:    paymentRequest.DescriptionHash,
 	}
 	return transaction, nil
 }
@@ -532,6 +541,10 @@ func (svc *PhoenixService) GetSupportedNIP47NotificationTypes() []string {
 	return []string{}
 }
 
+func (svc *PhoenixService) GetBackendType() string {
+	return config.PhoenixBackendType
+}
+
 func (svc *PhoenixService) GetPubkey() string {
 	return svc.pubkey
 }
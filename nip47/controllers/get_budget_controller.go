@@ -28,7 +28,7 @@ func (controller *nip47Controller) HandleGetBudgetEvent(ctx context.Context, nip
 	appPermission := db.AppPermission{}
 	controller.db.Where("app_id = ? AND scope = ?", app.ID, models.PAY_INVOICE_METHOD).First(&appPermission)
 
-	maxAmount := appPermission.MaxAmountSat
+	maxAmount, budgetRenewal, usedBudget := queries.GetAppBudget(controller.db, app, &appPermission)
 	if maxAmount == 0 {
 		publishResponse(&models.Response{
 			ResultType: nip47Request.Method,
@@ -37,12 +37,11 @@ func (controller *nip47Controller) HandleGetBudgetEvent(ctx context.Context, nip
 		return
 	}
 
-	usedBudget := queries.GetBudgetUsageSat(controller.db, &appPermission)
 	responsePayload := &getBudgetResponse{
 		TotalBudget:   uint64(maxAmount * 1000),
 		UsedBudget:    usedBudget * 1000,
-		RenewalPeriod: appPermission.BudgetRenewal,
-		RenewsAt:      queries.GetBudgetRenewsAt(appPermission.BudgetRenewal),
+		RenewalPeriod: budgetRenewal,
+		RenewsAt:      queries.GetBudgetRenewsAt(budgetRenewal),
 	}
 
 	publishResponse(&models.Response{
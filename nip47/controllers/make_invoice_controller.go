@@ -3,7 +3,6 @@ package controllers
 import (
 	"context"
 
-	"github.com/getAlby/hub/constants"
 	"github.com/getAlby/hub/logger"
 	"github.com/getAlby/hub/nip47/models"
 	"github.com/nbd-wtf/go-nostr"
@@ -16,6 +15,8 @@ type makeInvoiceParams struct {
 	DescriptionHash string                 `json:"description_hash"`
 	Expiry          uint64                 `json:"expiry"`
 	Metadata        map[string]interface{} `json:"metadata,omitempty"`
+	// non-standard: a URL to notify once this invoice is paid
+	NotifyUrl string `json:"notify_url,omitempty"`
 }
 type makeInvoiceResponse struct {
 	models.Transaction
@@ -37,11 +38,12 @@ func (controller *nip47Controller) HandleMakeInvoiceEvent(ctx context.Context, n
 		"description_hash": makeInvoiceParams.DescriptionHash,
 		"expiry":           makeInvoiceParams.Expiry,
 		"metadata":         makeInvoiceParams.Metadata,
+		"notify_url":       makeInvoiceParams.NotifyUrl,
 	}).Info("Making invoice")
 
 	expiry := makeInvoiceParams.Expiry
 
-	transaction, err := controller.transactionsService.MakeInvoice(ctx, makeInvoiceParams.Amount, makeInvoiceParams.Description, makeInvoiceParams.DescriptionHash, expiry, makeInvoiceParams.Metadata, controller.lnClient, &appId, &requestEventId)
+	transaction, err := controller.transactionsService.MakeInvoice(ctx, makeInvoiceParams.Amount, makeInvoiceParams.Description, makeInvoiceParams.DescriptionHash, expiry, makeInvoiceParams.Metadata, controller.lnClient, &appId, &requestEventId, makeInvoiceParams.NotifyUrl)
 	if err != nil {
 		logger.Logger.WithFields(logrus.Fields{
 			"request_event_id": requestEventId,
@@ -53,10 +55,7 @@ func (controller *nip47Controller) HandleMakeInvoiceEvent(ctx context.Context, n
 
 		publishResponse(&models.Response{
 			ResultType: nip47Request.Method,
-			Error: &models.Error{
-				Code:    constants.ERROR_INTERNAL,
-				Message: err.Error(),
-			},
+			Error:      mapNip47Error(err),
 		}, nostr.Tags{})
 		return
 	}
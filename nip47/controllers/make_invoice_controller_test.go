@@ -9,6 +9,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/getAlby/hub/constants"
 	"github.com/getAlby/hub/db"
 	"github.com/getAlby/hub/nip47/models"
 	"github.com/getAlby/hub/nip47/permissions"
@@ -52,6 +53,13 @@ func TestHandleMakeInvoiceEvent(t *testing.T) {
 	app, _, err := tests.CreateApp(svc)
 	assert.NoError(t, err)
 
+	err = svc.DB.Create(&db.AppPermission{
+		AppId: app.ID,
+		App:   *app,
+		Scope: constants.MAKE_INVOICE_SCOPE,
+	}).Error
+	assert.NoError(t, err)
+
 	dbRequestEvent := &db.RequestEvent{
 		AppId: &app.ID,
 	}
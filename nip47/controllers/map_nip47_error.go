@@ -19,6 +19,69 @@ func mapNip47Error(err error) *models.Error {
 	if errors.Is(err, transactions.NewQuotaExceededError()) {
 		code = constants.ERROR_QUOTA_EXCEEDED
 	}
+	if errors.Is(err, transactions.NewReceiveLimitExceededError()) {
+		code = constants.ERROR_RESTRICTED
+	}
+	if errors.Is(err, transactions.NewAppPausedError()) {
+		code = constants.ERROR_RESTRICTED
+	}
+	if errors.Is(err, transactions.NewInvoiceRateLimitExceededError()) {
+		code = constants.ERROR_RATE_LIMITED
+	}
+	if errors.Is(err, transactions.NewTooManyInFlightPaymentsError()) {
+		code = constants.ERROR_RATE_LIMITED
+	}
+	if errors.Is(err, transactions.NewSelfPaymentLoopError()) {
+		code = constants.ERROR_RESTRICTED
+	}
+	if errors.Is(err, transactions.NewSelfPaymentInvoiceNotFoundError()) {
+		code = constants.ERROR_NOT_FOUND
+	}
+	if errors.Is(err, transactions.NewSelfPaymentInvoiceExpiredError()) {
+		code = constants.ERROR_EXPIRED
+	}
+	if errors.Is(err, transactions.NewInvoiceAlreadyPaidError()) {
+		code = constants.ERROR_RESTRICTED
+	}
+	if errors.Is(err, transactions.NewInvoiceExpiredError()) {
+		code = constants.ERROR_EXPIRED
+	}
+	if errors.Is(err, transactions.NewInvalidDestinationError()) {
+		code = constants.ERROR_BAD_REQUEST
+	}
+	if errors.Is(err, transactions.NewCustomRecordsLimitExceededError()) {
+		code = constants.ERROR_BAD_REQUEST
+	}
+	if errors.Is(err, transactions.NewInvalidPreimageError()) {
+		code = constants.ERROR_BAD_REQUEST
+	}
+	if errors.Is(err, transactions.NewInvalidMetadataError()) {
+		code = constants.ERROR_BAD_REQUEST
+	}
+	if errors.Is(err, transactions.NewInvalidNotifyUrlError()) {
+		code = constants.ERROR_BAD_REQUEST
+	}
+	if errors.Is(err, transactions.NewInvalidAttestationError()) {
+		code = constants.ERROR_BAD_REQUEST
+	}
+	if errors.Is(err, transactions.NewInvoiceDecodeError()) {
+		code = constants.ERROR_BAD_REQUEST
+	}
+	if errors.Is(err, transactions.NewNetworkMismatchError()) {
+		code = constants.ERROR_BAD_REQUEST
+	}
+	if errors.Is(err, transactions.NewAnomalousAmountWarning()) {
+		code = constants.ERROR_RESTRICTED
+	}
+	if errors.Is(err, transactions.NewNodeNotReadyError()) {
+		code = constants.ERROR_OTHER
+	}
+	if errors.Is(err, transactions.NewOutgoingChannelNotSupportedError()) {
+		code = constants.ERROR_NOT_IMPLEMENTED
+	}
+	if errors.Is(err, transactions.NewInvalidOutgoingChannelError()) {
+		code = constants.ERROR_BAD_REQUEST
+	}
 
 	return &models.Error{
 		Code:    code,
@@ -27,10 +27,10 @@ const nip47MultiPayJson = `
 	"method": "multi_pay_invoice",
 	"params": {
 		"invoices": [{
-				"invoice": "lntb1230n1pjypux0pp5xgxzcks5jtx06k784f9dndjh664wc08ucrganpqn52d0ftrh9n8sdqyw3jscqzpgxqyz5vqsp5rkx7cq252p3frx8ytjpzc55rkgyx2mfkzzraa272dqvr2j6leurs9qyyssqhutxa24r5hqxstchz5fxlslawprqjnarjujp5sm3xj7ex73s32sn54fthv2aqlhp76qmvrlvxppx9skd3r5ut5xutgrup8zuc6ay73gqmra29m"
+				"invoice": "lntb1230n1p54twgqpp5xgxzcks5jtx06k784f9dndjh664wc08ucrganpqn52d0ftrh9n8sdqyw3jscqzpgxq8zals8sqsp5tynvacqrpgkdjeu94ngtekxlwtu9yjsuxe87s43k0fdyk2jtad6s9qrsgqxvul4gsatkatf3a5pgzmh2qf5sqxx227x3fn8nfws47gcm7p92p8h4853cwt4hgjc7ak7lk43vh5phkff4h2k46ua93eyrx099nq3fsq0gdu94"
 			},
 			{
-				"invoice": "lntbs1230n1pnvxqc2dqqnp4q0w0f29u6f7yrrpr5y6wj45gtnyhtch9u2m2j7qrws8eevrw90c72pp57gnea9rwqh9c62dl67akgyhuxm7dd3fgwufyuyctgx3awuv8f7cqsp56rtp7kryxssfp3lk7h79uv7n55dc4nwuvslva64caxz45ysefmeq9qyysgqcqpcxqyz5vq7trlnnrjjtfkaw3evfgqh7nxayppkvlkxa2nzhg39zs372j7hff8kht7j40hl0elh2ukhu26nzawvk3aqszdl8ppxhzsgtumemewtccq3xryqt"
+				"invoice": "lntb1230n1p54twgqpp553v82vyzz7z0aagwcjqgarurjcqmymkagt4tvqydj8qtunpvccmsdqqcqzpgxq8zals8sqnntqegc0tnw87u9pcvgwxaux9qnazfy842a9rpec60puu8zqenu4llpe2gfajdf2k285k2hnufgrw0axd8d9fwnsjayey9vavu29vhsq48ehz7"
 			}
 		]
 	}
@@ -46,7 +46,7 @@ const nip47MultiPayOneMalformedInvoiceJson = `
 				"id": "invoiceId123"
 			},
 			{
-				"invoice": "lntb1230n1pjypux0pp5xgxzcks5jtx06k784f9dndjh664wc08ucrganpqn52d0ftrh9n8sdqyw3jscqzpgxqyz5vqsp5rkx7cq252p3frx8ytjpzc55rkgyx2mfkzzraa272dqvr2j6leurs9qyyssqhutxa24r5hqxstchz5fxlslawprqjnarjujp5sm3xj7ex73s32sn54fthv2aqlhp76qmvrlvxppx9skd3r5ut5xutgrup8zuc6ay73gqmra29m"
+				"invoice": "lntb1230n1p54twgqpp5xgxzcks5jtx06k784f9dndjh664wc08ucrganpqn52d0ftrh9n8sdqyw3jscqzpgxq8zals8sqsp5tynvacqrpgkdjeu94ngtekxlwtu9yjsuxe87s43k0fdyk2jtad6s9qrsgqxvul4gsatkatf3a5pgzmh2qf5sqxx227x3fn8nfws47gcm7p92p8h4853cwt4hgjc7ak7lk43vh5phkff4h2k46ua93eyrx099nq3fsq0gdu94"
 			}
 		]
 	}
@@ -107,7 +107,7 @@ func TestHandleMultiPayInvoiceEvent_Success(t *testing.T) {
 
 	var paymentHashes = []string{
 		"320c2c5a1492ccfd5bc7aa4ad9b657d6aaec3cfcc0d1d98413a29af4ac772ccf",
-		"f2279e946e05cb8d29bfd7bb6412fc36fcd6c52877124e130b41a3d771874fb0",
+		"a4587530821784fef50ec4808e8f839601b26edd42eab6008d91c0be4c2cc637",
 	}
 
 	assert.Equal(t, 2, len(responses))
@@ -260,7 +260,7 @@ func TestHandleMultiPayInvoiceEvent_IsolatedApp_OneBudgetExceeded(t *testing.T)
 	// so ensure we have results for both payment hashes
 	var paymentHashes = []string{
 		"320c2c5a1492ccfd5bc7aa4ad9b657d6aaec3cfcc0d1d98413a29af4ac772ccf",
-		"f2279e946e05cb8d29bfd7bb6412fc36fcd6c52877124e130b41a3d771874fb0",
+		"a4587530821784fef50ec4808e8f839601b26edd42eab6008d91c0be4c2cc637",
 	}
 
 	assert.NotEqual(t, dTags[0].GetFirst([]string{"d"}).Value(), dTags[1].GetFirst([]string{"d"}).Value())
@@ -341,7 +341,7 @@ func TestHandleMultiPayInvoiceEvent_LNClient_OnePaymentFailed(t *testing.T) {
 	// so ensure we have results for both payment hashes
 	var paymentHashes = []string{
 		"320c2c5a1492ccfd5bc7aa4ad9b657d6aaec3cfcc0d1d98413a29af4ac772ccf",
-		"f2279e946e05cb8d29bfd7bb6412fc36fcd6c52877124e130b41a3d771874fb0",
+		"a4587530821784fef50ec4808e8f839601b26edd42eab6008d91c0be4c2cc637",
 	}
 
 	assert.NotEqual(t, dTags[0].GetFirst([]string{"d"}).Value(), dTags[1].GetFirst([]string{"d"}).Value())
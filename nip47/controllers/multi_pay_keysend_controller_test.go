@@ -24,7 +24,7 @@ const nip47MultiPayKeysendJson = `
 	"params": {
 		"keysends": [{
 				"amount": 123000,
-				"pubkey": "123pubkey2",
+				"pubkey": "0266e4598d1d3c415f572a8488830b60f7e744ed9235eb0b1ba93283b315c03518",
 				"tlv_records": [{
 					"type": 5482373484,
 					"value": "fajsn341414fq"
@@ -32,7 +32,7 @@ const nip47MultiPayKeysendJson = `
 			},
 			{
 				"amount": 123000,
-				"pubkey": "123pubkey2",
+				"pubkey": "0266e4598d1d3c415f572a8488830b60f7e744ed9235eb0b1ba93283b315c03518",
 				"tlv_records": [{
 					"type": 5482373484,
 					"value": "fajsn341414fq"
@@ -49,7 +49,7 @@ const nip47MultiPayKeysendOneOverflowingBudgetJson = `
 	"params": {
 		"keysends": [{
 				"amount": 123000,
-				"pubkey": "123pubkey2",
+				"pubkey": "0266e4598d1d3c415f572a8488830b60f7e744ed9235eb0b1ba93283b315c03518",
 				"id": "customId",
 				"tlv_records": [{
 					"type": 5482373484,
@@ -58,7 +58,7 @@ const nip47MultiPayKeysendOneOverflowingBudgetJson = `
 			},
 			{
 				"amount": 500000,
-				"pubkey": "500pubkey",
+				"pubkey": "03864ef025fde8fb587d989186ce6a4a186895ee44a926bfc370e2c366597a3f8f",
 				"tlv_records": [{
 					"type": 5482373484,
 					"value": "fajsn341414fq"
@@ -116,7 +116,7 @@ func TestHandleMultiPayKeysendEvent_Success(t *testing.T) {
 		assert.Equal(t, 64, len(responses[i].Result.(payResponse).Preimage))
 		assert.Equal(t, uint64(1), responses[i].Result.(payResponse).FeesPaid)
 		assert.Nil(t, responses[i].Error)
-		assert.Equal(t, "123pubkey2", dTags[i].GetFirst([]string{"d"}).Value())
+		assert.Equal(t, "0266e4598d1d3c415f572a8488830b60f7e744ed9235eb0b1ba93283b315c03518", dTags[i].GetFirst([]string{"d"}).Value())
 	}
 }
 
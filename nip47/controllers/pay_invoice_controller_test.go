@@ -21,7 +21,7 @@ const nip47PayInvoiceJson = `
 {
 	"method": "pay_invoice",
 	"params": {
-		"invoice": "lntb1230n1pjypux0pp5xgxzcks5jtx06k784f9dndjh664wc08ucrganpqn52d0ftrh9n8sdqyw3jscqzpgxqyz5vqsp5rkx7cq252p3frx8ytjpzc55rkgyx2mfkzzraa272dqvr2j6leurs9qyyssqhutxa24r5hqxstchz5fxlslawprqjnarjujp5sm3xj7ex73s32sn54fthv2aqlhp76qmvrlvxppx9skd3r5ut5xutgrup8zuc6ay73gqmra29m",
+		"invoice": "lntb1230n1p54twgqpp5xgxzcks5jtx06k784f9dndjh664wc08ucrganpqn52d0ftrh9n8sdqyw3jscqzpgxq8zals8sqsp5tynvacqrpgkdjeu94ngtekxlwtu9yjsuxe87s43k0fdyk2jtad6s9qrsgqxvul4gsatkatf3a5pgzmh2qf5sqxx227x3fn8nfws47gcm7p92p8h4853cwt4hgjc7ak7lk43vh5phkff4h2k46ua93eyrx099nq3fsq0gdu94",
 		"metadata": {"a": 123}
 	}
 }
@@ -75,7 +75,7 @@ func TestHandlePayInvoiceEvent(t *testing.T) {
 	assert.Equal(t, "123preimage", publishedResponse.Result.(payResponse).Preimage)
 
 	transactionType := constants.TRANSACTION_TYPE_OUTGOING
-	transaction, err := transactionsSvc.LookupTransaction(ctx, "320c2c5a1492ccfd5bc7aa4ad9b657d6aaec3cfcc0d1d98413a29af4ac772ccf", &transactionType, svc.LNClient, &app.ID)
+	transaction, err := transactionsSvc.LookupTransaction(ctx, "320c2c5a1492ccfd5bc7aa4ad9b657d6aaec3cfcc0d1d98413a29af4ac772ccf", &transactionType, svc.LNClient, &app.ID, false)
 	assert.NoError(t, err)
 
 	type dummyMetadata struct {
@@ -22,7 +22,7 @@ const nip47KeysendJson = `
 	"method": "pay_keysend",
 	"params": {
 		"amount": 123000,
-		"pubkey": "123pubkey2",
+		"pubkey": "0266e4598d1d3c415f572a8488830b60f7e744ed9235eb0b1ba93283b315c03518",
 		"tlv_records": [{
 			"type": 5482373484,
 			"value": "fajsn341414fq"
@@ -36,7 +36,7 @@ const nip47KeysendJsonWithPreimage = `
 	"method": "pay_keysend",
 	"params": {
 		"amount": 123000,
-		"pubkey": "123pubkey2",
+		"pubkey": "0266e4598d1d3c415f572a8488830b60f7e744ed9235eb0b1ba93283b315c03518",
 		"preimage": "018465013e2337234a7e5530a21c4a8cf70d84231f4a8ff0b1e2cce3cb2bd03b",
 		"tlv_records": [{
 			"type": 5482373484,
@@ -48,7 +48,7 @@ func (svc *nip47Service) HandleEvent(ctx context.Context, relay nostrmodels.Rela
 	}
 
 	// store request event
-	requestEvent := db.RequestEvent{AppId: nil, NostrId: event.ID, State: db.REQUEST_EVENT_STATE_HANDLER_EXECUTING}
+	requestEvent := db.RequestEvent{AppId: nil, NostrId: event.ID, State: db.REQUEST_EVENT_STATE_HANDLER_EXECUTING, RelayUrl: relay.String()}
 	err = svc.db.Create(&requestEvent).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrDuplicatedKey) {
@@ -275,6 +275,7 @@ func (svc *nip47Service) HandleEvent(ctx context.Context, relay nostrmodels.Rela
 				Event: "nwc_permission_denied",
 				Properties: map[string]interface{}{
 					"request_method": nip47Request.Method,
+					"app_id":         app.ID,
 					"app_name":       app.Name,
 					// "app_pubkey":     app.AppPubkey,
 					"code":    code,
@@ -142,6 +142,11 @@ func TestHandleResponse_WithPermission(t *testing.T) {
 	assert.Equal(t, models.GET_INFO_METHOD, unmarshalledResponse.ResultType)
 	expectedMethods := slices.Concat([]string{constants.GET_BALANCE_SCOPE}, permissions.GetAlwaysGrantedMethods())
 	assert.Equal(t, expectedMethods, unmarshalledResponse.Result.Methods)
+
+	requestEvent := db.RequestEvent{}
+	err = svc.DB.First(&requestEvent, &db.RequestEvent{NostrId: reqEvent.ID}).Error
+	assert.NoError(t, err)
+	assert.Equal(t, tests.MockRelayUrl, requestEvent.RelayUrl)
 }
 
 func TestHandleResponse_DuplicateRequest(t *testing.T) {
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"strings"
 
+	"github.com/getAlby/hub/constants"
 	"github.com/getAlby/hub/logger"
 	"github.com/getAlby/hub/transactions"
 	"github.com/sirupsen/logrus"
@@ -35,9 +36,15 @@ func ToNip47Transaction(transaction *transactions.Transaction) *Transaction {
 		}
 	}
 
+	// NIP-47 has no state for partially paid invoices or payments held for review
+	state := strings.ToLower(transaction.State)
+	if transaction.State == constants.TRANSACTION_STATE_ACCEPTED || transaction.State == constants.TRANSACTION_STATE_QUARANTINED {
+		state = strings.ToLower(constants.TRANSACTION_STATE_PENDING)
+	}
+
 	return &Transaction{
 		Type:            transaction.Type,
-		State:           strings.ToLower(transaction.State),
+		State:           state,
 		Invoice:         transaction.PaymentRequest,
 		Description:     transaction.Description,
 		DescriptionHash: transaction.DescriptionHash,
@@ -8,4 +8,6 @@ import (
 
 type Relay interface {
 	Publish(ctx context.Context, event nostr.Event) error
+	// String returns the relay URL
+	String() string
 }
@@ -7,6 +7,7 @@ import (
 	"github.com/getAlby/hub/lnclient"
 	"github.com/getAlby/hub/service/keys"
 	"github.com/getAlby/hub/transactions"
+	"github.com/getAlby/hub/webhooks"
 	"gorm.io/gorm"
 )
 
@@ -20,6 +21,7 @@ type Service interface {
 	GetEventPublisher() events.EventPublisher
 	GetLNClient() lnclient.LNClient
 	GetTransactionsService() transactions.TransactionsService
+	GetWebhooksService() webhooks.WebhooksService
 	GetDB() *gorm.DB
 	GetConfig() config.Config
 	GetKeys() keys.Keys
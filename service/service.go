@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/adrg/xdg"
 	"github.com/nbd-wtf/go-nostr"
@@ -21,6 +22,7 @@ import (
 	"github.com/getAlby/hub/service/keys"
 	"github.com/getAlby/hub/transactions"
 	"github.com/getAlby/hub/version"
+	"github.com/getAlby/hub/webhooks"
 
 	"github.com/getAlby/hub/config"
 	"github.com/getAlby/hub/db"
@@ -35,6 +37,7 @@ type service struct {
 	db                  *gorm.DB
 	lnClient            lnclient.LNClient
 	transactionsService transactions.TransactionsService
+	webhooksService     webhooks.WebhooksService
 	albyOAuthSvc        alby.AlbyOAuthService
 	eventPublisher      events.EventPublisher
 	ctx                 context.Context
@@ -106,13 +109,17 @@ func NewService(ctx context.Context) (*service, error) {
 		albyOAuthSvc:        alby.NewAlbyOAuthService(gormDB, cfg, keys, eventPublisher),
 		nip47Service:        nip47.NewNip47Service(gormDB, cfg, keys, eventPublisher),
 		transactionsService: transactions.NewTransactionsService(gormDB, eventPublisher),
+		webhooksService:     webhooks.NewWebhooksService(gormDB),
 		db:                  gormDB,
 		keys:                keys,
 	}
 
+	svc.transactionsService.SetListTransactionsCacheTTL(time.Duration(appConfig.ListTransactionsCacheTTLSeconds) * time.Second)
+
 	eventPublisher.RegisterSubscriber(svc.transactionsService)
 	eventPublisher.RegisterSubscriber(svc.nip47Service)
 	eventPublisher.RegisterSubscriber(svc.albyOAuthSvc)
+	eventPublisher.RegisterSubscriber(svc.webhooksService)
 
 	eventPublisher.Publish(&events.Event{
 		Event: "nwc_started",
@@ -232,6 +239,10 @@ func (svc *service) GetTransactionsService() transactions.TransactionsService {
 	return svc.transactionsService
 }
 
+func (svc *service) GetWebhooksService() webhooks.WebhooksService {
+	return svc.webhooksService
+}
+
 func (svc *service) GetKeys() keys.Keys {
 	return svc.keys
 }
@@ -37,6 +37,24 @@ func CreateAppWithPrivateKey(svc *TestService, senderPrivkey string) (app *db.Ap
 	return app, ss, nil
 }
 
+// CreateAppWithPermissions creates an app with the given permissions, which are linked to the new app
+func CreateAppWithPermissions(svc *TestService, appPermissions ...*db.AppPermission) (*db.App, error) {
+	app, _, err := CreateApp(svc)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, appPermission := range appPermissions {
+		appPermission.AppId = app.ID
+		appPermission.App = *app
+		err = svc.DB.Create(appPermission).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	return app, nil
+}
+
 func CreateLegacyApp(svc *TestService, senderPrivkey string) (app *db.App, ss []byte, err error) {
 
 	pairingPublicKey, _ := nostr.GetPublicKey(senderPrivkey)
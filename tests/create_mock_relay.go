@@ -7,6 +7,8 @@ import (
 	"github.com/nbd-wtf/go-nostr"
 )
 
+const MockRelayUrl = "wss://relay.example.com"
+
 type mockRelay struct {
 	PublishedEvent *nostr.Event
 }
@@ -20,3 +22,7 @@ func (relay *mockRelay) Publish(ctx context.Context, event nostr.Event) error {
 	relay.PublishedEvent = &event
 	return nil
 }
+
+func (relay *mockRelay) String() string {
+	return MockRelayUrl
+}
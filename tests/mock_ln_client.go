@@ -11,9 +11,17 @@ import (
 // lnbcrt5u1pjuywzppp5h69dt59cypca2wxu69sw8ga0g39a3yx7dqug5nthrw3rcqgfdu4qdqqcqzzsxqyz5vqsp5gzlpzszyj2k30qmpme7jsfzr24wqlvt9xdmr7ay34lfelz050krs9qyyssq038x07nh8yuv8hdpjh5y8kqp7zcd62ql9na9xh7pla44htjyy02sz23q7qm2tza6ct4ypljk54w9k9qsrsu95usk8ce726ytep6vhhsq9mhf9a
 const MockPaymentHash500 = "be8ad5d0b82071d538dcd160e3a3af444bd890de68388a4d771ba23c01096f2a"
 
-const MockInvoice = "lntb1230n1pjypux0pp5xgxzcks5jtx06k784f9dndjh664wc08ucrganpqn52d0ftrh9n8sdqyw3jscqzpgxqyz5vqsp5rkx7cq252p3frx8ytjpzc55rkgyx2mfkzzraa272dqvr2j6leurs9qyyssqhutxa24r5hqxstchz5fxlslawprqjnarjujp5sm3xj7ex73s32sn54fthv2aqlhp76qmvrlvxppx9skd3r5ut5xutgrup8zuc6ay73gqmra29m"
+// 123 sat testnet invoice with the description "te" (expires in 2126)
+const MockInvoice = "lntb1230n1p54twgqpp5xgxzcks5jtx06k784f9dndjh664wc08ucrganpqn52d0ftrh9n8sdqyw3jscqzpgxq8zals8sqsp5tynvacqrpgkdjeu94ngtekxlwtu9yjsuxe87s43k0fdyk2jtad6s9qrsgqxvul4gsatkatf3a5pgzmh2qf5sqxx227x3fn8nfws47gcm7p92p8h4853cwt4hgjc7ak7lk43vh5phkff4h2k46ua93eyrx099nq3fsq0gdu94"
 const MockPaymentHash = "320c2c5a1492ccfd5bc7aa4ad9b657d6aaec3cfcc0d1d98413a29af4ac772ccf" // for the above invoice
 
+// 123 sat testnet invoice that expired in 2023
+const MockExpiredInvoice = "lntb1230n1pjypux0pp5xgxzcks5jtx06k784f9dndjh664wc08ucrganpqn52d0ftrh9n8sdqyw3jscqzpgxqyz5vqsp5rkx7cq252p3frx8ytjpzc55rkgyx2mfkzzraa272dqvr2j6leurs9qyyssqhutxa24r5hqxstchz5fxlslawprqjnarjujp5sm3xj7ex73s32sn54fthv2aqlhp76qmvrlvxppx9skd3r5ut5xutgrup8zuc6ay73gqmra29m"
+
+// 123 sat testnet invoice with an empty description (expires in 2126)
+const MockInvoiceWithoutDescription = "lntb1230n1p54twgqpp553v82vyzz7z0aagwcjqgarurjcqmymkagt4tvqydj8qtunpvccmsdqqcqzpgxq8zals8sqnntqegc0tnw87u9pcvgwxaux9qnazfy842a9rpec60puu8zqenu4llpe2gfajdf2k285k2hnufgrw0axd8d9fwnsjayey9vavu29vhsq48ehz7"
+const MockPaymentHashWithoutDescription = "a4587530821784fef50ec4808e8f839601b26edd42eab6008d91c0be4c2cc637" // for the above invoice
+
 var MockNodeInfo = lnclient.NodeInfo{
 	Alias:       "bob",
 	Color:       "#3399FF",
@@ -40,7 +48,7 @@ var MockLNClientTransactions = []lnclient.Transaction{
 		DescriptionHash: "hash1",
 		Preimage:        "preimage1",
 		PaymentHash:     MockPaymentHash,
-		Amount:          1000,
+		Amount:          123000,
 		FeesPaid:        50,
 		SettledAt:       &MockTimeUnix,
 		Metadata: map[string]interface{}{
@@ -68,6 +76,18 @@ type MockLn struct {
 	Pubkey                     string
 	MockTransaction            *lnclient.Transaction
 	SupportedNotificationTypes *[]string
+	BackendType                string
+	PaymentStatus              lnclient.PaymentStatus
+	LookupPaymentError         error
+	// how long payments take, or until the context is done
+	PayInvoiceDelay time.Duration
+	NodeSyncing     bool
+	NodeStatusError error
+	Channels        []lnclient.Channel
+	// the channel the last payment was sent through
+	OutgoingChannelId string
+	// the expiry the last invoice was requested with
+	MakeInvoiceExpiry int64
 }
 
 func NewMockLn() (*MockLn, error) {
@@ -75,6 +95,14 @@ func NewMockLn() (*MockLn, error) {
 }
 
 func (mln *MockLn) SendPaymentSync(ctx context.Context, payReq string) (*lnclient.PayInvoiceResponse, error) {
+	if mln.PayInvoiceDelay > 0 {
+		select {
+		case <-time.After(mln.PayInvoiceDelay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
 	if len(mln.PayInvoiceResponses) > 0 {
 		response := mln.PayInvoiceResponses[0]
 		err := mln.PayInvoiceErrors[0]
@@ -88,6 +116,11 @@ func (mln *MockLn) SendPaymentSync(ctx context.Context, payReq string) (*lnclien
 	}, nil
 }
 
+func (mln *MockLn) SendPaymentSyncWithOutgoingChannel(ctx context.Context, payReq string, outgoingChannelId string) (*lnclient.PayInvoiceResponse, error) {
+	mln.OutgoingChannelId = outgoingChannelId
+	return mln.SendPaymentSync(ctx, payReq)
+}
+
 func (mln *MockLn) SendKeysend(ctx context.Context, amount uint64, destination string, custom_records []lnclient.TLVRecord, preimage string) (*lnclient.PayKeysendResponse, error) {
 	return &lnclient.PayKeysendResponse{
 		Fee: 1,
@@ -99,6 +132,7 @@ func (mln *MockLn) GetInfo(ctx context.Context) (info *lnclient.NodeInfo, err er
 }
 
 func (mln *MockLn) MakeInvoice(ctx context.Context, amount int64, description string, descriptionHash string, expiry int64) (transaction *lnclient.Transaction, err error) {
+	mln.MakeInvoiceExpiry = expiry
 	return MockLNClientTransaction, nil
 }
 
@@ -109,6 +143,16 @@ func (mln *MockLn) LookupInvoice(ctx context.Context, paymentHash string) (trans
 	return MockLNClientTransaction, nil
 }
 
+func (mln *MockLn) LookupPayment(ctx context.Context, paymentHash string) (lnclient.PaymentStatus, error) {
+	if mln.LookupPaymentError != nil {
+		return "", mln.LookupPaymentError
+	}
+	if mln.PaymentStatus != "" {
+		return mln.PaymentStatus, nil
+	}
+	return lnclient.PAYMENT_STATUS_NOT_FOUND, nil
+}
+
 func (mln *MockLn) ListTransactions(ctx context.Context, from, until, limit, offset uint64, unpaid bool, invoiceType string) (invoices []lnclient.Transaction, err error) {
 	return MockLNClientTransactions, nil
 }
@@ -117,6 +161,9 @@ func (mln *MockLn) Shutdown() error {
 }
 
 func (mln *MockLn) ListChannels(ctx context.Context) (channels []lnclient.Channel, err error) {
+	if mln.Channels != nil {
+		return mln.Channels, nil
+	}
 	return []lnclient.Channel{}, nil
 }
 func (mln *MockLn) GetNodeConnectionInfo(ctx context.Context) (nodeConnectionInfo *lnclient.NodeConnectionInfo, err error) {
@@ -165,7 +212,12 @@ func (mln *MockLn) GetStorageDir() (string, error) {
 	return "", nil
 }
 func (mln *MockLn) GetNodeStatus(ctx context.Context) (nodeStatus *lnclient.NodeStatus, err error) {
-	return nil, nil
+	if mln.NodeStatusError != nil {
+		return nil, mln.NodeStatusError
+	}
+	return &lnclient.NodeStatus{
+		Syncing: mln.NodeSyncing,
+	}, nil
 }
 func (mln *MockLn) GetNetworkGraph(ctx context.Context, nodeIds []string) (lnclient.NetworkGraphResponse, error) {
 	return nil, nil
@@ -191,6 +243,11 @@ func (mln *MockLn) GetSupportedNIP47NotificationTypes() []string {
 
 	return []string{"payment_received", "payment_sent"}
 }
+
+func (mln *MockLn) GetBackendType() string {
+	return mln.BackendType
+}
+
 func (mln *MockLn) GetPubkey() string {
 	if mln.Pubkey != "" {
 		return mln.Pubkey
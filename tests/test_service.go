@@ -79,4 +79,8 @@ type TestService struct {
 
 func RemoveTestService() {
 	os.Remove(testDB)
+	// the WAL files are removed too, as the next test would otherwise reuse the shared memory file
+	// which is still mapped by this test's connections, crashing any late write (e.g. from an event subscriber)
+	os.Remove(testDB + "-wal")
+	os.Remove(testDB + "-shm")
 }
@@ -0,0 +1,60 @@
+package transactions
+
+import (
+	"context"
+	"time"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/logger"
+)
+
+// ListActiveInvoices returns the invoices which can still be paid (pending and not expired), oldest first,
+// e.g. for a point of sale to show all outstanding invoices.
+// Invoices without an expiry are always included.
+func (svc *transactionsService) ListActiveInvoices(ctx context.Context, appId *uint) ([]Transaction, error) {
+	incoming := constants.TRANSACTION_TYPE_INCOMING
+	tx, err := svc.filterTransactions(svc.db, 0, 0, &incoming, appId, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var transactions []Transaction
+	result := tx.
+		Where("state == ?", constants.TRANSACTION_STATE_PENDING).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Order("created_at asc, id asc").
+		Find(&transactions)
+	if result.Error != nil {
+		logger.Logger.WithError(result.Error).Error("Failed to list active invoices")
+		return nil, result.Error
+	}
+
+	return transactions, nil
+}
+
+// GetNextExpiringInvoice returns the open invoice which expires soonest, e.g. for a point of sale
+// to show a countdown. Invoices without an expiry are not included.
+func (svc *transactionsService) GetNextExpiringInvoice(ctx context.Context, appId *uint) (*Transaction, error) {
+	incoming := constants.TRANSACTION_TYPE_INCOMING
+	tx, err := svc.filterTransactions(svc.db, 0, 0, &incoming, appId, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var transaction Transaction
+	result := tx.
+		Where("state == ?", constants.TRANSACTION_STATE_PENDING).
+		Where("expires_at > ?", time.Now()).
+		Order("expires_at asc, id asc").
+		Limit(1).
+		Find(&transaction)
+	if result.Error != nil {
+		logger.Logger.WithError(result.Error).Error("Failed to get next expiring invoice")
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, NewNotFoundError()
+	}
+
+	return &transaction, nil
+}
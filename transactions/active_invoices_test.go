@@ -0,0 +1,112 @@
+package transactions
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListActiveInvoices(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+
+	future := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Minute)
+
+	for _, transaction := range []db.Transaction{
+		{PaymentHash: "active", State: constants.TRANSACTION_STATE_PENDING, ExpiresAt: &future, CreatedAt: time.Now().Add(-2 * time.Minute)},
+		{PaymentHash: "no-expiry", State: constants.TRANSACTION_STATE_PENDING, CreatedAt: time.Now().Add(-time.Minute)},
+		{PaymentHash: "expired", State: constants.TRANSACTION_STATE_PENDING, ExpiresAt: &past},
+		{PaymentHash: "paid", State: constants.TRANSACTION_STATE_SETTLED, ExpiresAt: &future},
+		{PaymentHash: "app-invoice", State: constants.TRANSACTION_STATE_PENDING, ExpiresAt: &future, AppId: &app.ID},
+	} {
+		transaction.Type = constants.TRANSACTION_TYPE_INCOMING
+		transaction.AmountMsat = 1000
+		svc.DB.Create(&transaction)
+	}
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_PENDING,
+		Type:        constants.TRANSACTION_TYPE_OUTGOING,
+		PaymentHash: "outgoing",
+		ExpiresAt:   &future,
+		AmountMsat:  1000,
+	})
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	transactions, err := transactionsService.ListActiveInvoices(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"active", "no-expiry", "app-invoice"}, getPaymentHashes(transactions))
+
+	transactions, err = transactionsService.ListActiveInvoices(ctx, &app.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"app-invoice"}, getPaymentHashes(transactions))
+}
+
+func TestGetNextExpiringInvoice(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	_, err = transactionsService.GetNextExpiringInvoice(ctx, nil)
+	assert.ErrorIs(t, err, NewNotFoundError())
+
+	inOneMinute := time.Now().Add(time.Minute)
+	inTenMinutes := time.Now().Add(10 * time.Minute)
+	inOneHour := time.Now().Add(time.Hour)
+	inThirtySeconds := time.Now().Add(30 * time.Second)
+	past := time.Now().Add(-time.Minute)
+
+	for _, transaction := range []db.Transaction{
+		{PaymentHash: "one-hour", State: constants.TRANSACTION_STATE_PENDING, ExpiresAt: &inOneHour, AppId: &app.ID},
+		{PaymentHash: "one-minute", State: constants.TRANSACTION_STATE_PENDING, ExpiresAt: &inOneMinute},
+		{PaymentHash: "ten-minutes", State: constants.TRANSACTION_STATE_PENDING, ExpiresAt: &inTenMinutes, AppId: &app.ID},
+		{PaymentHash: "no-expiry", State: constants.TRANSACTION_STATE_PENDING},
+		{PaymentHash: "expired", State: constants.TRANSACTION_STATE_PENDING, ExpiresAt: &past, AppId: &app.ID},
+		{PaymentHash: "paid", State: constants.TRANSACTION_STATE_SETTLED, ExpiresAt: &inThirtySeconds, AppId: &app.ID},
+	} {
+		transaction.Type = constants.TRANSACTION_TYPE_INCOMING
+		transaction.AmountMsat = 1000
+		svc.DB.Create(&transaction)
+	}
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_PENDING,
+		Type:        constants.TRANSACTION_TYPE_OUTGOING,
+		PaymentHash: "outgoing",
+		ExpiresAt:   &inThirtySeconds,
+		AmountMsat:  1000,
+		AppId:       &app.ID,
+	})
+
+	transaction, err := transactionsService.GetNextExpiringInvoice(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "one-minute", transaction.PaymentHash)
+
+	transaction, err = transactionsService.GetNextExpiringInvoice(ctx, &app.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "ten-minutes", transaction.PaymentHash)
+
+	otherApp, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+	_, err = transactionsService.GetNextExpiringInvoice(ctx, &otherApp.ID)
+	assert.ErrorIs(t, err, NewNotFoundError())
+}
@@ -0,0 +1,136 @@
+package transactions
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/events"
+	"github.com/getAlby/hub/logger"
+	"gorm.io/datatypes"
+)
+
+type ActivityType string
+
+const (
+	// a settled or failed transaction
+	ActivityTypeTransaction      ActivityType = "transaction"
+	ActivityTypePermissionDenied ActivityType = "permission_denied"
+	ActivityTypeBudgetWarning    ActivityType = "budget_warning"
+	ActivityTypeChannelReady     ActivityType = "channel_ready"
+	ActivityTypeChannelClosed    ActivityType = "channel_closed"
+)
+
+// events recorded for the activity feed
+var activityTypesByEvent = map[string]ActivityType{
+	"nwc_permission_denied": ActivityTypePermissionDenied,
+	"nwc_budget_warning":    ActivityTypeBudgetWarning,
+	"nwc_channel_ready":     ActivityTypeChannelReady,
+	"nwc_channel_closed":    ActivityTypeChannelClosed,
+}
+
+type ActivityItem struct {
+	Type ActivityType
+	Time time.Time
+	// set for ActivityTypeTransaction
+	Transaction *Transaction
+	// the properties of the event, set for other activity types
+	Properties datatypes.JSON
+}
+
+// recordActivity stores a published event that is shown in the activity feed
+func (svc *transactionsService) recordActivity(event *events.Event, activityType ActivityType) {
+	propertiesBytes, err := json.Marshal(event.Properties)
+	if err != nil {
+		logger.Logger.WithField("event", event.Event).WithError(err).Error("Failed to serialize activity properties")
+		return
+	}
+
+	activity := db.Activity{
+		Type:       string(activityType),
+		AppId:      getActivityAppId(event),
+		Properties: datatypes.JSON(propertiesBytes),
+	}
+	err = svc.db.Create(&activity).Error
+	if err != nil {
+		logger.Logger.WithField("event", event.Event).WithError(err).Error("Failed to record activity")
+	}
+}
+
+func getActivityAppId(event *events.Event) *uint {
+	properties, ok := event.Properties.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	// budget warnings identify the app by "id"
+	for _, key := range []string{"app_id", "id"} {
+		if appId, ok := properties[key].(uint); ok {
+			return &appId
+		}
+	}
+	return nil
+}
+
+// ListActivity returns the most recent settled and failed transactions and recorded events, newest first.
+// For an app, only its own transactions and events are returned; node events such as channel
+// openings are only part of the feed of the whole hub.
+func (svc *transactionsService) ListActivity(ctx context.Context, limit uint64, appId *uint) ([]ActivityItem, error) {
+	transactionsQuery := svc.db.
+		Where("state IN ?", []string{constants.TRANSACTION_STATE_SETTLED, constants.TRANSACTION_STATE_FAILED}).
+		Order("COALESCE(settled_at, updated_at) desc, id desc")
+	activitiesQuery := svc.db.Order("created_at desc, id desc")
+	if appId != nil {
+		transactionsQuery = transactionsQuery.Where("app_id = ?", *appId)
+		activitiesQuery = activitiesQuery.Where("app_id = ?", *appId)
+	}
+	if limit > 0 {
+		transactionsQuery = transactionsQuery.Limit(int(limit))
+		activitiesQuery = activitiesQuery.Limit(int(limit))
+	}
+
+	var transactions []Transaction
+	err := transactionsQuery.Find(&transactions).Error
+	if err != nil {
+		logger.Logger.WithError(err).Error("Failed to list activity transactions")
+		return nil, err
+	}
+
+	var activities []db.Activity
+	err = activitiesQuery.Find(&activities).Error
+	if err != nil {
+		logger.Logger.WithError(err).Error("Failed to list activities")
+		return nil, err
+	}
+
+	items := make([]ActivityItem, 0, len(transactions)+len(activities))
+	for i := range transactions {
+		activityTime := transactions[i].UpdatedAt
+		if transactions[i].SettledAt != nil {
+			activityTime = *transactions[i].SettledAt
+		}
+		items = append(items, ActivityItem{
+			Type:        ActivityTypeTransaction,
+			Time:        activityTime,
+			Transaction: &transactions[i],
+		})
+	}
+	for _, activity := range activities {
+		items = append(items, ActivityItem{
+			Type:       ActivityType(activity.Type),
+			Time:       activity.CreatedAt,
+			Properties: activity.Properties,
+		})
+	}
+
+	slices.SortStableFunc(items, func(a, b ActivityItem) int {
+		return b.Time.Compare(a.Time)
+	})
+	if limit > 0 && uint64(len(items)) > limit {
+		items = items[:limit]
+	}
+
+	return items, nil
+}
@@ -0,0 +1,128 @@
+package transactions
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/events"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListActivity(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	now := time.Now()
+	settledAt := now.Add(-3 * time.Minute)
+	settledTransaction := db.Transaction{
+		AppId:       &app.ID,
+		Type:        constants.TRANSACTION_TYPE_OUTGOING,
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		PaymentHash: tests.MockPaymentHash,
+		AmountMsat:  123000,
+		SettledAt:   &settledAt,
+	}
+	require.NoError(t, svc.DB.Create(&settledTransaction).Error)
+	failedTransaction := db.Transaction{
+		AppId:       &app.ID,
+		Type:        constants.TRANSACTION_TYPE_OUTGOING,
+		State:       constants.TRANSACTION_STATE_FAILED,
+		PaymentHash: tests.MockPaymentHash500,
+		AmountMsat:  500000,
+		UpdatedAt:   now.Add(-1 * time.Minute),
+	}
+	require.NoError(t, svc.DB.Create(&failedTransaction).Error)
+	// pending transactions are not part of the feed
+	require.NoError(t, svc.DB.Create(&db.Transaction{
+		AppId:       &app.ID,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		State:       constants.TRANSACTION_STATE_PENDING,
+		PaymentHash: tests.MockPaymentHashWithoutDescription,
+		AmountMsat:  1000,
+	}).Error)
+
+	transactionsService.ConsumeEvent(ctx, &events.Event{
+		Event: "nwc_permission_denied",
+		Properties: map[string]interface{}{
+			"app_id":   app.ID,
+			"app_name": app.Name,
+			"code":     constants.ERROR_QUOTA_EXCEEDED,
+			"message":  "Your app does not have enough budget remaining to make this payment.",
+		},
+	}, map[string]interface{}{})
+	transactionsService.ConsumeEvent(ctx, &events.Event{
+		Event: "nwc_channel_ready",
+		Properties: map[string]interface{}{
+			"counterparty_node_id": "02ff7c3da0679c37c2914a1f392a88a01a243a0773a1794fba7252e15e4e40f4f3",
+			"capacity":             1_000_000,
+		},
+	}, map[string]interface{}{})
+	transactionsService.ConsumeEvent(ctx, &events.Event{
+		Event: "nwc_budget_warning",
+		Properties: map[string]interface{}{
+			"name": app.Name,
+			"id":   app.ID,
+		},
+	}, map[string]interface{}{})
+	// other events are not recorded
+	transactionsService.ConsumeEvent(ctx, &events.Event{
+		Event:      "nwc_app_created",
+		Properties: map[string]interface{}{"name": app.Name, "id": app.ID},
+	}, map[string]interface{}{})
+
+	var activities []db.Activity
+	require.NoError(t, svc.DB.Order("id").Find(&activities).Error)
+	require.Equal(t, 3, len(activities))
+	for i, createdAt := range []time.Time{now.Add(-2 * time.Minute), now.Add(-4 * time.Minute), now.Add(-30 * time.Second)} {
+		require.NoError(t, svc.DB.Model(&activities[i]).Update("created_at", createdAt).Error)
+	}
+
+	items, err := transactionsService.ListActivity(ctx, 0, nil)
+	require.NoError(t, err)
+	require.Equal(t, 5, len(items))
+	assert.Equal(t, ActivityTypeBudgetWarning, items[0].Type)
+	assert.Equal(t, ActivityTypeTransaction, items[1].Type)
+	assert.Equal(t, failedTransaction.ID, items[1].Transaction.ID)
+	assert.Equal(t, ActivityTypePermissionDenied, items[2].Type)
+	assert.Equal(t, ActivityTypeTransaction, items[3].Type)
+	assert.Equal(t, settledTransaction.ID, items[3].Transaction.ID)
+	assert.Equal(t, ActivityTypeChannelReady, items[4].Type)
+
+	for i := 1; i < len(items); i++ {
+		assert.False(t, items[i].Time.After(items[i-1].Time))
+	}
+
+	// event activities carry the event properties rather than a transaction
+	assert.Nil(t, items[2].Transaction)
+	var properties map[string]interface{}
+	require.NoError(t, json.Unmarshal(items[2].Properties, &properties))
+	assert.Equal(t, constants.ERROR_QUOTA_EXCEEDED, properties["code"])
+	assert.Nil(t, items[1].Properties)
+
+	// node events are not part of an app's feed
+	items, err = transactionsService.ListActivity(ctx, 0, &app.ID)
+	require.NoError(t, err)
+	require.Equal(t, 4, len(items))
+	assert.Equal(t, ActivityTypeBudgetWarning, items[0].Type)
+	assert.Equal(t, ActivityTypeTransaction, items[3].Type)
+
+	items, err = transactionsService.ListActivity(ctx, 2, nil)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(items))
+	assert.Equal(t, ActivityTypeBudgetWarning, items[0].Type)
+	assert.Equal(t, failedTransaction.ID, items[1].Transaction.ID)
+}
@@ -0,0 +1,80 @@
+package transactions
+
+import (
+	"slices"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// number of recent settled payments the amount of a new payment is compared against
+const anomalousAmountHistorySize = 100
+
+// fewer recent payments than this are not enough to tell what amount is unusual
+const anomalousAmountMinHistorySize = 10
+
+// payments above this multiple of the 95th percentile of recent payments are anomalous
+const anomalousAmountMultiplier = 10
+
+type paymentAmountStats struct {
+	Count         uint64
+	P95AmountMsat uint64
+}
+
+// SetAnomalousAmountCheck enables rejecting payments with an amount far above the app's
+// recent payments (e.g. an extra zero typed by mistake) unless the amount is confirmed.
+// Disabled by default.
+func (svc *transactionsService) SetAnomalousAmountCheck(enabled bool) {
+	svc.anomalousAmountCheck = enabled
+}
+
+// validateAmountNotAnomalous rejects a payment whose amount is an outlier compared to the
+// recent settled payments of the app (or of the node itself if no app is given)
+func (svc *transactionsService) validateAmountNotAnomalous(appId *uint, amountMsat uint64) error {
+	if !svc.anomalousAmountCheck {
+		return nil
+	}
+
+	stats, err := svc.getRecentPaymentAmountStats(appId)
+	if err != nil {
+		logger.Logger.WithError(err).Error("Failed to get recent payment amounts")
+		return err
+	}
+	if stats.Count < anomalousAmountMinHistorySize {
+		return nil
+	}
+
+	if amountMsat > stats.P95AmountMsat*anomalousAmountMultiplier {
+		logger.Logger.WithFields(logrus.Fields{
+			"app_id":          appId,
+			"amount_msat":     amountMsat,
+			"p95_amount_msat": stats.P95AmountMsat,
+		}).Warn("Payment amount is unusually high compared to recent payments")
+		return newAnomalousAmountWarningWithAmounts(amountMsat, stats.P95AmountMsat)
+	}
+	return nil
+}
+
+func (svc *transactionsService) getRecentPaymentAmountStats(appId *uint) (*paymentAmountStats, error) {
+	tx := svc.db.Model(&db.Transaction{}).
+		Where("type == ? AND state == ?", constants.TRANSACTION_TYPE_OUTGOING, constants.TRANSACTION_STATE_SETTLED)
+	if appId != nil {
+		tx = tx.Where("app_id == ?", *appId)
+	} else {
+		tx = tx.Where("app_id IS NULL")
+	}
+
+	var amounts []uint64
+	result := tx.Order("settled_at desc").Limit(anomalousAmountHistorySize).Pluck("amount_msat", &amounts)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	slices.Sort(amounts)
+	return &paymentAmountStats{
+		Count:         uint64(len(amounts)),
+		P95AmountMsat: getPercentile(amounts, 95),
+	}, nil
+}
@@ -0,0 +1,154 @@
+package transactions
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createPaymentHistory(t *testing.T, svc *tests.TestService, appId *uint, count int, amountMsat uint64) {
+	settledAt := time.Now().Add(-time.Hour)
+	for i := 0; i < count; i++ {
+		require.NoError(t, svc.DB.Create(&db.Transaction{
+			AppId:       appId,
+			State:       constants.TRANSACTION_STATE_SETTLED,
+			Type:        constants.TRANSACTION_TYPE_OUTGOING,
+			PaymentHash: fmt.Sprintf("history%d", i),
+			AmountMsat:  amountMsat,
+			SettledAt:   &settledAt,
+		}).Error)
+	}
+}
+
+func TestSendPaymentSync_AnomalousAmount(t *testing.T) {
+	ctx := context.TODO()
+
+	// the mock invoice is 123 sats
+	for name, testCase := range map[string]struct {
+		checkEnabled       bool
+		historyCount       int
+		historyAmountMsat  uint64
+		confirmLargeAmount bool
+		expectedError      error
+	}{
+		"normal amount": {
+			checkEnabled:      true,
+			historyCount:      20,
+			historyAmountMsat: 100_000,
+		},
+		"anomalous amount": {
+			checkEnabled:      true,
+			historyCount:      20,
+			historyAmountMsat: 10_000,
+			expectedError:     NewAnomalousAmountWarning(),
+		},
+		"anomalous amount confirmed": {
+			checkEnabled:       true,
+			historyCount:       20,
+			historyAmountMsat:  10_000,
+			confirmLargeAmount: true,
+		},
+		"not enough history": {
+			checkEnabled:      true,
+			historyCount:      anomalousAmountMinHistorySize - 1,
+			historyAmountMsat: 10_000,
+		},
+		"check disabled": {
+			checkEnabled:      false,
+			historyCount:      20,
+			historyAmountMsat: 10_000,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer tests.RemoveTestService()
+			svc, err := tests.CreateTestService()
+			require.NoError(t, err)
+
+			createPaymentHistory(t, svc, nil, testCase.historyCount, testCase.historyAmountMsat)
+
+			transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+			transactionsService.SetAnomalousAmountCheck(testCase.checkEnabled)
+
+			transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, nil, nil, SendPaymentOptions{ConfirmLargeAmount: testCase.confirmLargeAmount})
+			if testCase.expectedError != nil {
+				assert.ErrorIs(t, err, testCase.expectedError)
+				assert.EqualError(t, err, "The amount of 123000 msat is unusually high compared to recent payments (95th percentile: 10000 msat). Confirm the amount to pay anyway")
+				assert.Nil(t, transaction)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transaction.State)
+		})
+	}
+}
+
+func TestSendPaymentSync_AnomalousAmountUsesAppHistory(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+	appPermission := &db.AppPermission{
+		AppId: app.ID,
+		App:   *app,
+		Scope: constants.PAY_INVOICE_SCOPE,
+	}
+	require.NoError(t, svc.DB.Create(appPermission).Error)
+
+	// the node's own small payments do not affect the app
+	createPaymentHistory(t, svc, nil, 20, 10_000)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transactionsService.SetAnomalousAmountCheck(true)
+
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, nil, SendPaymentOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transaction.State)
+}
+
+func TestGetRecentPaymentAmountStats(t *testing.T) {
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	settledAt := time.Now()
+	for i := 1; i <= 20; i++ {
+		svc.DB.Create(&db.Transaction{
+			State:       constants.TRANSACTION_STATE_SETTLED,
+			Type:        constants.TRANSACTION_TYPE_OUTGOING,
+			PaymentHash: fmt.Sprintf("payment%d", i),
+			AmountMsat:  uint64(i * 1000),
+			SettledAt:   &settledAt,
+		})
+	}
+	// pending and incoming transactions are not payments made
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_PENDING,
+		Type:        constants.TRANSACTION_TYPE_OUTGOING,
+		PaymentHash: "pending",
+		AmountMsat:  1_000_000,
+	})
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		PaymentHash: "incoming",
+		AmountMsat:  1_000_000,
+		SettledAt:   &settledAt,
+	})
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	stats, err := transactionsService.getRecentPaymentAmountStats(nil)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(20), stats.Count)
+	assert.Equal(t, uint64(19_000), stats.P95AmountMsat)
+}
@@ -0,0 +1,86 @@
+package transactions
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/lnclient"
+	"github.com/getAlby/hub/logger"
+)
+
+// ReceivedPayment is what is known about a payment received without an invoice of one of the apps
+// (e.g. a keysend), to attribute it to the recipient app
+type ReceivedPayment struct {
+	CustomRecords []lnclient.TLVRecord
+	Metadata      map[string]interface{}
+	// nil if the payment has no boostagram or it could not be parsed
+	Boostagram *Boostagram
+}
+
+// AppIdResolver finds the app a received payment is for. ok is false if the resolver
+// cannot tell, in which case the next resolver is tried.
+type AppIdResolver func(payment *ReceivedPayment) (appId uint, ok bool)
+
+// RegisterAppIdResolver adds a way to attribute received payments to apps, tried after the
+// custom key TLV record and the resolvers registered before it. Resolved apps that do not exist are ignored.
+// Resolvers should be registered before payments are processed.
+func (svc *transactionsService) RegisterAppIdResolver(resolve AppIdResolver) {
+	svc.appIdResolvers = append(svc.appIdResolvers, resolve)
+}
+
+func (svc *transactionsService) registerDefaultAppIdResolvers() {
+	svc.RegisterAppIdResolver(getAppIdFromCustomKeyRecord)
+}
+
+// resolveAppId returns the app a received payment is for, or nil if it is for the node itself
+func (svc *transactionsService) resolveAppId(customRecords []lnclient.TLVRecord, metadata map[string]interface{}, boostagramBytes []byte) *uint {
+	payment := &ReceivedPayment{
+		CustomRecords: customRecords,
+		Metadata:      metadata,
+	}
+	if len(boostagramBytes) > 0 {
+		var boostagram Boostagram
+		if err := json.Unmarshal(boostagramBytes, &boostagram); err == nil {
+			boostagram.normalize()
+			payment.Boostagram = &boostagram
+		}
+	}
+
+	for _, resolve := range svc.appIdResolvers {
+		appId, ok := resolve(payment)
+		if !ok {
+			continue
+		}
+		app := db.App{}
+		err := svc.db.Take(&app, &db.App{
+			ID: appId,
+		}).Error
+		if err != nil {
+			logger.Logger.WithError(err).WithField("app_id", appId).Error("Failed to find app resolved for received payment")
+			continue
+		}
+		return &app.ID
+	}
+	return nil
+}
+
+func getAppIdFromCustomKeyRecord(payment *ReceivedPayment) (uint, bool) {
+	for _, record := range payment.CustomRecords {
+		if record.Type == CustomKeyTlvType {
+			decodedString, err := hex.DecodeString(record.Value)
+			if err != nil {
+				logger.Logger.WithError(err).Error("Failed to parse custom key TLV record as hex")
+				continue
+			}
+			customValue, err := strconv.ParseUint(string(decodedString), 10, 64)
+			if err != nil {
+				logger.Logger.WithError(err).Error("Failed to parse custom key TLV record as number")
+				continue
+			}
+			return uint(customValue), true
+		}
+	}
+	return 0, false
+}
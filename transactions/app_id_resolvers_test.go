@@ -0,0 +1,103 @@
+package transactions
+
+import (
+	"context"
+	"encoding/hex"
+	"strconv"
+	"testing"
+
+	"github.com/getAlby/hub/events"
+	"github.com/getAlby/hub/lnclient"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// attributes payments by an "app_id" metadata field, as reported by some backends
+func resolveAppIdFromMetadata(payment *ReceivedPayment) (uint, bool) {
+	appId, ok := payment.Metadata["app_id"].(float64)
+	if !ok {
+		return 0, false
+	}
+	return uint(appId), true
+}
+
+func TestReceiveKeysend_AppIdResolver(t *testing.T) {
+	ctx := context.TODO()
+
+	// the first app created in each test has ID 1 and the second ID 2
+	app := uint(1)
+	otherApp := uint(2)
+
+	for name, testCase := range map[string]struct {
+		registerResolver bool
+		metadataAppId    uint
+		customKeyAppId   uint
+		expectedAppId    *uint
+	}{
+		"resolved from metadata": {
+			registerResolver: true,
+			metadataAppId:    app,
+			expectedAppId:    &app,
+		},
+		"resolver not registered": {
+			metadataAppId: app,
+		},
+		"custom key is tried first": {
+			registerResolver: true,
+			metadataAppId:    otherApp,
+			customKeyAppId:   app,
+			expectedAppId:    &app,
+		},
+		"unknown app": {
+			registerResolver: true,
+			metadataAppId:    1000,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer tests.RemoveTestService()
+			svc, err := tests.CreateTestService()
+			require.NoError(t, err)
+
+			for _, appId := range []uint{app, otherApp} {
+				createdApp, _, err := tests.CreateApp(svc)
+				require.NoError(t, err)
+				require.Equal(t, appId, createdApp.ID)
+			}
+
+			transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+			if testCase.registerResolver {
+				transactionsService.RegisterAppIdResolver(resolveAppIdFromMetadata)
+			}
+
+			tlv := []lnclient.TLVRecord{}
+			if testCase.customKeyAppId != 0 {
+				tlv = append(tlv, lnclient.TLVRecord{
+					Type:  CustomKeyTlvType,
+					Value: hex.EncodeToString([]byte(strconv.FormatUint(uint64(testCase.customKeyAppId), 10))),
+				})
+			}
+			tx := lnclient.Transaction{
+				Type:        "incoming",
+				Preimage:    "9f59b18f80a77c2930deb8be5ff1143eacdd1891c63c23d61bc9f99c64e57325",
+				PaymentHash: "ae4277b7be3ca1420cafd24c143866190f52b996856b0e4164763f936e61ea1b",
+				Amount:      1000,
+				SettledAt:   &tests.MockTimeUnix,
+				Metadata: map[string]interface{}{
+					"tlv_records": tlv,
+					// metadata is JSON-decoded, so numbers are floats
+					"app_id": float64(testCase.metadataAppId),
+				},
+			}
+
+			transactionsService.ConsumeEvent(ctx, &events.Event{
+				Event:      "nwc_lnclient_payment_received",
+				Properties: &tx,
+			}, map[string]interface{}{})
+
+			transaction, err := transactionsService.LookupTransaction(ctx, tx.PaymentHash, nil, svc.LNClient, nil, false)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.expectedAppId, transaction.AppId)
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package transactions
+
+import (
+	"context"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/events"
+	"github.com/getAlby/hub/logger"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// PauseApp stops an app from making payments and creating invoices until it is resumed,
+// e.g. while it is suspected to be compromised. The app's pending payments and invoices
+// can still settle.
+func (svc *transactionsService) PauseApp(ctx context.Context, appId uint) error {
+	return svc.setAppPaused(appId, true)
+}
+
+// ResumeApp allows a paused app to make payments and create invoices again
+func (svc *transactionsService) ResumeApp(ctx context.Context, appId uint) error {
+	return svc.setAppPaused(appId, false)
+}
+
+func (svc *transactionsService) setAppPaused(appId uint, paused bool) error {
+	result := svc.db.Model(&db.App{}).Where("id = ?", appId).Update("paused", paused)
+	if result.Error != nil {
+		logger.Logger.WithFields(logrus.Fields{
+			"app_id": appId,
+			"paused": paused,
+		}).WithError(result.Error).Error("Failed to update app paused state")
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return NewNotFoundError()
+	}
+	return nil
+}
+
+// validateAppNotPaused rejects requests of a paused app, regardless of where they come from
+func (svc *transactionsService) validateAppNotPaused(tx *gorm.DB, appId *uint) error {
+	if appId == nil {
+		return nil
+	}
+
+	var app db.App
+	result := tx.Limit(1).Find(&app, &db.App{
+		ID: *appId,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 && app.Paused {
+		svc.publishAppPausedEvent(&app)
+		return NewAppPausedError()
+	}
+	return nil
+}
+
+func (svc *transactionsService) publishAppPausedEvent(app *db.App) {
+	svc.eventPublisher.Publish(&events.Event{
+		Event: "nwc_permission_denied",
+		Properties: map[string]interface{}{
+			"app_id":   app.ID,
+			"app_name": app.Name,
+			"code":     constants.ERROR_RESTRICTED,
+			"message":  NewAppPausedError().Error(),
+		},
+	})
+}
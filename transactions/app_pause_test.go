@@ -0,0 +1,132 @@
+package transactions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/events"
+	"github.com/getAlby/hub/lnclient"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendPaymentSync_App_Paused(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, err := tests.CreateAppWithPermissions(svc, &db.AppPermission{Scope: constants.PAY_INVOICE_SCOPE}, &db.AppPermission{Scope: constants.MAKE_INVOICE_SCOPE})
+	require.NoError(t, err)
+
+	mockEventConsumer := tests.NewMockEventConsumer()
+	svc.EventPublisher.RegisterSubscriber(mockEventConsumer)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	require.NoError(t, transactionsService.PauseApp(ctx, app.ID))
+
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, nil, SendPaymentOptions{})
+	assert.ErrorIs(t, err, NewAppPausedError())
+	assert.Nil(t, transaction)
+
+	transaction, err = transactionsService.SendKeysend(ctx, 1000, mockPayee, nil, "", "", svc.LNClient, &app.ID, nil)
+	assert.ErrorIs(t, err, NewAppPausedError())
+	assert.Nil(t, transaction)
+
+	var count int64
+	svc.DB.Model(&db.Transaction{}).Count(&count)
+	assert.Zero(t, count)
+
+	permissionDeniedEvents := getEvents(mockEventConsumer.GetConsumedEvents(), "nwc_permission_denied")
+	require.Len(t, permissionDeniedEvents, 2)
+	assert.Equal(t, constants.ERROR_RESTRICTED, permissionDeniedEvents[0].Properties.(map[string]interface{})["code"])
+}
+
+func TestMakeInvoice_App_Paused(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, err := tests.CreateAppWithPermissions(svc, &db.AppPermission{Scope: constants.PAY_INVOICE_SCOPE}, &db.AppPermission{Scope: constants.MAKE_INVOICE_SCOPE})
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	require.NoError(t, transactionsService.PauseApp(ctx, app.ID))
+
+	transaction, err := transactionsService.MakeInvoice(ctx, 1234, "Hello world", "", 0, nil, svc.LNClient, &app.ID, nil, "")
+	assert.ErrorIs(t, err, NewAppPausedError())
+	assert.Nil(t, transaction)
+}
+
+func TestResumeApp(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, err := tests.CreateAppWithPermissions(svc, &db.AppPermission{Scope: constants.PAY_INVOICE_SCOPE}, &db.AppPermission{Scope: constants.MAKE_INVOICE_SCOPE})
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	require.NoError(t, transactionsService.PauseApp(ctx, app.ID))
+	require.NoError(t, transactionsService.ResumeApp(ctx, app.ID))
+
+	transaction, err := transactionsService.MakeInvoice(ctx, 1234, "Hello world", "", 0, nil, svc.LNClient, &app.ID, nil, "")
+	require.NoError(t, err)
+	assert.Equal(t, constants.TRANSACTION_STATE_PENDING, transaction.State)
+
+	transaction, err = transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, nil, SendPaymentOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transaction.State)
+}
+
+func TestPauseApp_PendingInvoiceSettles(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, err := tests.CreateAppWithPermissions(svc, &db.AppPermission{Scope: constants.PAY_INVOICE_SCOPE}, &db.AppPermission{Scope: constants.MAKE_INVOICE_SCOPE})
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.MakeInvoice(ctx, 1234, "Hello world", "", 0, nil, svc.LNClient, &app.ID, nil, "")
+	require.NoError(t, err)
+
+	require.NoError(t, transactionsService.PauseApp(ctx, app.ID))
+
+	transactionsService.ConsumeEvent(ctx, &events.Event{
+		Event: "nwc_lnclient_payment_received",
+		Properties: &lnclient.Transaction{
+			Type:        "incoming",
+			Invoice:     tests.MockInvoice,
+			Preimage:    tests.MockLNClientTransaction.Preimage,
+			PaymentHash: tests.MockLNClientTransaction.PaymentHash,
+			Amount:      123000,
+			SettledAt:   &tests.MockTimeUnix,
+		},
+	}, map[string]interface{}{})
+
+	var dbTransaction db.Transaction
+	svc.DB.Find(&dbTransaction, transaction.ID)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, dbTransaction.State)
+}
+
+func TestPauseApp_NotFound(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	assert.ErrorIs(t, transactionsService.PauseApp(ctx, 1000), NewNotFoundError())
+}
@@ -0,0 +1,67 @@
+package transactions
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/lnclient"
+	"github.com/getAlby/hub/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// sendPaymentWithAppTimeout sends a payment through the LNClient, giving up after the app's
+// payment timeout unless the caller's context already has a deadline.
+// Giving up returns a timeout error, so the payment is left pending as it may still succeed.
+func (svc *transactionsService) sendPaymentWithAppTimeout(ctx context.Context, payReq string, outgoingChannelId string, appId *uint, lnClient lnclient.LNClient) (*lnclient.PayInvoiceResponse, error) {
+	timeout := svc.getAppPaymentTimeout(appId)
+	if _, hasDeadline := ctx.Deadline(); timeout == 0 || hasDeadline {
+		return sendPayment(ctx, payReq, outgoingChannelId, lnClient)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type sendPaymentResult struct {
+		response *lnclient.PayInvoiceResponse
+		err      error
+	}
+	// buffered so the backend call can finish after we stopped waiting for it
+	resultChan := make(chan sendPaymentResult, 1)
+	go func() {
+		response, err := sendPayment(ctx, payReq, outgoingChannelId, lnClient)
+		resultChan <- sendPaymentResult{response: response, err: err}
+	}()
+
+	select {
+	case result := <-resultChan:
+		if result.err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			// the backend gave up because of our deadline, the payment may still be in flight
+			return nil, lnclient.NewTimeoutError()
+		}
+		return result.response, result.err
+	case <-ctx.Done():
+		// backends which do not observe the context keep trying in the background.
+		// The payment stays pending until its status is checked later.
+		logger.Logger.WithFields(logrus.Fields{
+			"app_id":  *appId,
+			"timeout": timeout,
+		}).Warn("App payment timeout reached")
+		return nil, lnclient.NewTimeoutError()
+	}
+}
+
+func (svc *transactionsService) getAppPaymentTimeout(appId *uint) time.Duration {
+	if appId == nil {
+		return 0
+	}
+	var app db.App
+	result := svc.db.Limit(1).Find(&app, &db.App{
+		ID: *appId,
+	})
+	if result.RowsAffected == 0 {
+		return 0
+	}
+	return time.Duration(app.PaymentTimeoutSeconds) * time.Second
+}
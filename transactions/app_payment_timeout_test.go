@@ -0,0 +1,96 @@
+package transactions
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/lnclient"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendPaymentSync_AppPaymentTimeout(t *testing.T) {
+	ctx := context.TODO()
+
+	for name, testCase := range map[string]struct {
+		paymentTimeoutSeconds uint
+		payInvoiceDelay       time.Duration
+		expectTimeout         bool
+	}{
+		"no app timeout": {
+			paymentTimeoutSeconds: 0,
+			payInvoiceDelay:       100 * time.Millisecond,
+		},
+		"payment completes within app timeout": {
+			paymentTimeoutSeconds: 2,
+			payInvoiceDelay:       100 * time.Millisecond,
+		},
+		"app timeout reached": {
+			paymentTimeoutSeconds: 1,
+			payInvoiceDelay:       5 * time.Second,
+			expectTimeout:         true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer tests.RemoveTestService()
+			svc, err := tests.CreateTestService()
+			require.NoError(t, err)
+
+			app, err := tests.CreateAppWithPermissions(svc, &db.AppPermission{Scope: constants.PAY_INVOICE_SCOPE})
+			require.NoError(t, err)
+			app.PaymentTimeoutSeconds = testCase.paymentTimeoutSeconds
+			require.NoError(t, svc.DB.Save(app).Error)
+
+			svc.LNClient.(*tests.MockLn).PayInvoiceDelay = testCase.payInvoiceDelay
+
+			transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+			start := time.Now()
+			transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, nil, SendPaymentOptions{})
+			if !testCase.expectTimeout {
+				require.NoError(t, err)
+				assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transaction.State)
+				return
+			}
+
+			assert.ErrorIs(t, err, lnclient.NewTimeoutError())
+			assert.Nil(t, transaction)
+			assert.Less(t, time.Since(start), testCase.payInvoiceDelay)
+
+			// the payment may still succeed, so it is left pending
+			var dbTransaction db.Transaction
+			result := svc.DB.Limit(1).Find(&dbTransaction, &db.Transaction{
+				PaymentHash: tests.MockPaymentHash,
+				Type:        constants.TRANSACTION_TYPE_OUTGOING,
+			})
+			require.Equal(t, int64(1), result.RowsAffected)
+			assert.Equal(t, constants.TRANSACTION_STATE_PENDING, dbTransaction.State)
+		})
+	}
+}
+
+func TestSendPaymentSync_AppPaymentTimeout_CallerDeadline(t *testing.T) {
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, err := tests.CreateAppWithPermissions(svc, &db.AppPermission{Scope: constants.PAY_INVOICE_SCOPE})
+	require.NoError(t, err)
+	app.PaymentTimeoutSeconds = 1
+	require.NoError(t, svc.DB.Save(app).Error)
+
+	svc.LNClient.(*tests.MockLn).PayInvoiceDelay = 1500 * time.Millisecond
+
+	// a deadline given by the caller takes precedence over the app's timeout
+	ctx, cancel := context.WithTimeout(context.TODO(), 5*time.Second)
+	defer cancel()
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, nil, SendPaymentOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transaction.State)
+}
@@ -2,12 +2,17 @@ package transactions
 
 import (
 	"context"
+	"encoding/json"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/getAlby/hub/constants"
 	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/db/queries"
+	"github.com/getAlby/hub/lnclient"
 	"github.com/getAlby/hub/tests"
+	decodepay "github.com/nbd-wtf/ln-decodepay"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -27,7 +32,7 @@ func TestSendPaymentSync_App_NoPermission(t *testing.T) {
 	assert.NoError(t, err)
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
-	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID, SendPaymentOptions{})
 
 	assert.Error(t, err)
 	assert.Equal(t, "app does not have pay_invoice scope", err.Error())
@@ -56,7 +61,7 @@ func TestSendPaymentSync_App_WithPermission(t *testing.T) {
 	assert.NoError(t, err)
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
-	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID, SendPaymentOptions{})
 
 	assert.NoError(t, err)
 	assert.Equal(t, uint64(123000), transaction.AmountMsat)
@@ -93,7 +98,7 @@ func TestSendPaymentSync_App_BudgetExceeded(t *testing.T) {
 	svc.EventPublisher.RegisterSubscriber(mockEventConsumer)
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
-	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID, SendPaymentOptions{})
 
 	assert.Error(t, err)
 	assert.ErrorIs(t, err, NewQuotaExceededError())
@@ -103,8 +108,18 @@ func TestSendPaymentSync_App_BudgetExceeded(t *testing.T) {
 	assert.Equal(t, "nwc_permission_denied", mockEventConsumer.GetConsumedEvents()[0].Event)
 	assert.Equal(t, app.Name, mockEventConsumer.GetConsumedEvents()[0].Properties.(map[string]interface{})["app_name"])
 	assert.Equal(t, constants.ERROR_QUOTA_EXCEEDED, mockEventConsumer.GetConsumedEvents()[0].Properties.(map[string]interface{})["code"])
-	expectedMessage := NewQuotaExceededError().Error() + " te" // invoice description is "te" in the mock invoice
+	// 123 sat invoice + 10 sat fee reserve, 1 sat budget
+	assert.Contains(t, err.Error(), "requested 133 sat (133000 msat), only 1 sat (1000 msat) remaining")
+	expectedMessage := err.Error() + " te" // invoice description is "te" in the mock invoice
 	assert.Equal(t, expectedMessage, mockEventConsumer.GetConsumedEvents()[0].Properties.(map[string]interface{})["message"])
+	assert.Equal(t, uint64(133000), mockEventConsumer.GetConsumedEvents()[0].Properties.(map[string]interface{})["requested_msat"])
+	assert.Equal(t, uint64(1000), mockEventConsumer.GetConsumedEvents()[0].Properties.(map[string]interface{})["remaining_msat"])
+
+	// the error identifies the app
+	appId, appName, ok := GetPermissionDeniedApp(err)
+	assert.True(t, ok)
+	assert.Equal(t, app.ID, appId)
+	assert.Equal(t, app.Name, appName)
 }
 
 func TestSendPaymentSync_App_BudgetExceeded_SettledPayment(t *testing.T) {
@@ -140,7 +155,7 @@ func TestSendPaymentSync_App_BudgetExceeded_SettledPayment(t *testing.T) {
 	assert.NoError(t, err)
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
-	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID, SendPaymentOptions{})
 
 	assert.Error(t, err)
 	assert.ErrorIs(t, err, NewQuotaExceededError())
@@ -179,7 +194,7 @@ func TestSendPaymentSync_App_BudgetExceeded_UnsettledPayment(t *testing.T) {
 	assert.NoError(t, err)
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
-	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID, SendPaymentOptions{})
 
 	assert.Error(t, err)
 	assert.ErrorIs(t, err, NewQuotaExceededError())
@@ -219,7 +234,7 @@ func TestSendPaymentSync_App_BudgetNotExceeded_FailedPayment(t *testing.T) {
 	assert.NoError(t, err)
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
-	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID, SendPaymentOptions{})
 
 	assert.NoError(t, err)
 	assert.Equal(t, uint64(123000), transaction.AmountMsat)
@@ -228,3 +243,399 @@ func TestSendPaymentSync_App_BudgetNotExceeded_FailedPayment(t *testing.T) {
 	assert.Equal(t, app.ID, *transaction.AppId)
 	assert.Equal(t, dbRequestEvent.ID, *transaction.RequestEventId)
 }
+
+func TestSendPaymentSync_App_RequireDescription(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	assert.NoError(t, err)
+	app.RequireDescription = true
+	svc.DB.Save(&app)
+
+	appPermission := &db.AppPermission{
+		AppId: app.ID,
+		App:   *app,
+		Scope: constants.PAY_INVOICE_SCOPE,
+	}
+	err = svc.DB.Create(appPermission).Error
+	assert.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockInvoiceWithoutDescription, nil, svc.LNClient, &app.ID, nil, SendPaymentOptions{})
+	assert.ErrorIs(t, err, NewDescriptionRequiredError())
+	assert.Nil(t, transaction)
+
+	// no transaction is created
+	var count int64
+	svc.DB.Model(&db.Transaction{}).Count(&count)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestSendPaymentSync_App_DescriptionNotRequired(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	assert.NoError(t, err)
+
+	appPermission := &db.AppPermission{
+		AppId: app.ID,
+		App:   *app,
+		Scope: constants.PAY_INVOICE_SCOPE,
+	}
+	err = svc.DB.Create(appPermission).Error
+	assert.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockInvoiceWithoutDescription, nil, svc.LNClient, &app.ID, nil, SendPaymentOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transaction.State)
+	assert.Equal(t, "", transaction.Description)
+}
+
+func TestSendPaymentSync_App_RaisedMetadataLimit(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	assert.NoError(t, err)
+	app.MaxMetadataLength = 8192
+	svc.DB.Save(&app)
+
+	appPermission := &db.AppPermission{
+		AppId: app.ID,
+		App:   *app,
+		Scope: constants.PAY_INVOICE_SCOPE,
+	}
+	err = svc.DB.Create(appPermission).Error
+	assert.NoError(t, err)
+
+	metadata := make(map[string]interface{})
+	metadata["randomkey"] = strings.Repeat("a", 8192-15) // json encoding adds 16 characters
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, metadata, svc.LNClient, &app.ID, nil, SendPaymentOptions{})
+	assert.Error(t, err)
+	assert.Equal(t, "encoded payment metadata provided is too large. Limit: 8192 Received: 8193", err.Error())
+	assert.Nil(t, transaction)
+
+	metadata["randomkey"] = strings.Repeat("a", constants.INVOICE_METADATA_MAX_LENGTH) // above the default limit
+	transaction, err = transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, metadata, svc.LNClient, &app.ID, nil, SendPaymentOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transaction.State)
+}
+
+func TestSendPaymentSync_App_BudgetGroupExceeded(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	budgetGroup := &db.BudgetGroup{
+		Name:         "family",
+		MaxAmountSat: 200,
+	}
+	err = svc.DB.Create(budgetGroup).Error
+	assert.NoError(t, err)
+
+	apps := []*db.App{}
+	for i := 0; i < 2; i++ {
+		app, _, err := tests.CreateApp(svc)
+		assert.NoError(t, err)
+		app.BudgetGroupId = &budgetGroup.ID
+		svc.DB.Save(&app)
+
+		err = svc.DB.Create(&db.AppPermission{
+			AppId: app.ID,
+			App:   *app,
+			Scope: constants.PAY_INVOICE_SCOPE,
+		}).Error
+		assert.NoError(t, err)
+		apps = append(apps, app)
+	}
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	// first app uses 123 of the 200 sat shared budget
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &apps[0].ID, nil, SendPaymentOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transaction.State)
+
+	// second app cannot spend what the first app already used
+	transaction, err = transactionsService.SendPaymentSync(ctx, tests.MockInvoiceWithoutDescription, nil, svc.LNClient, &apps[1].ID, nil, SendPaymentOptions{})
+	assert.ErrorIs(t, err, NewQuotaExceededError())
+	assert.Contains(t, err.Error(), "only 77 sat (77000 msat) remaining")
+	assert.Nil(t, transaction)
+}
+
+func TestSendPaymentSync_App_BudgetGroupOverridesAppBudget(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	budgetGroup := &db.BudgetGroup{
+		Name:         "family",
+		MaxAmountSat: 1000,
+	}
+	err = svc.DB.Create(budgetGroup).Error
+	assert.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	assert.NoError(t, err)
+	app.BudgetGroupId = &budgetGroup.ID
+	svc.DB.Save(&app)
+
+	err = svc.DB.Create(&db.AppPermission{
+		AppId:        app.ID,
+		App:          *app,
+		Scope:        constants.PAY_INVOICE_SCOPE,
+		MaxAmountSat: 1,
+	}).Error
+	assert.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, nil, SendPaymentOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transaction.State)
+}
+
+func TestListPendingBudgetReservations(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	assert.NoError(t, err)
+	otherApp, _, err := tests.CreateApp(svc)
+	assert.NoError(t, err)
+
+	err = svc.DB.Create(&db.AppPermission{
+		AppId: app.ID,
+		App:   *app,
+		Scope: constants.PAY_INVOICE_SCOPE,
+	}).Error
+	assert.NoError(t, err)
+
+	// the payment may still succeed, so it keeps its reservation
+	svc.LNClient.(*tests.MockLn).PayInvoiceErrors = append(svc.LNClient.(*tests.MockLn).PayInvoiceErrors, lnclient.NewTimeoutError())
+	svc.LNClient.(*tests.MockLn).PayInvoiceResponses = append(svc.LNClient.(*tests.MockLn).PayInvoiceResponses, nil)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	_, err = transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, nil, SendPaymentOptions{})
+	assert.ErrorIs(t, err, lnclient.NewTimeoutError())
+
+	for _, transaction := range []db.Transaction{
+		{AppId: &app.ID, Type: constants.TRANSACTION_TYPE_OUTGOING, State: constants.TRANSACTION_STATE_SETTLED, AmountMsat: 1000},
+		{AppId: &app.ID, Type: constants.TRANSACTION_TYPE_OUTGOING, State: constants.TRANSACTION_STATE_FAILED, AmountMsat: 1000},
+		{AppId: &app.ID, Type: constants.TRANSACTION_TYPE_INCOMING, State: constants.TRANSACTION_STATE_PENDING, AmountMsat: 1000},
+		{AppId: &otherApp.ID, Type: constants.TRANSACTION_TYPE_OUTGOING, State: constants.TRANSACTION_STATE_PENDING, AmountMsat: 1000},
+	} {
+		err = svc.DB.Create(&transaction).Error
+		assert.NoError(t, err)
+	}
+
+	reservations, err := transactionsService.ListPendingBudgetReservations(ctx, app.ID)
+	assert.NoError(t, err)
+	require.Equal(t, 1, len(reservations))
+	assert.Equal(t, tests.MockLNClientTransaction.PaymentHash, reservations[0].PaymentHash)
+	assert.Equal(t, uint64(123000), reservations[0].AmountMsat)
+	assert.Equal(t, uint64(10000), reservations[0].FeeReserveMsat)
+}
+
+func TestListPendingBudgetReservations_AppNotFound(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	reservations, err := transactionsService.ListPendingBudgetReservations(ctx, 1000)
+	assert.ErrorIs(t, err, NewNotFoundError())
+	assert.Nil(t, reservations)
+}
+
+func TestSendPaymentSync_App_StoreDecodedInvoice(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	assert.NoError(t, err)
+	app.StoreDecodedInvoices = true
+	svc.DB.Save(&app)
+
+	err = svc.DB.Create(&db.AppPermission{
+		AppId: app.ID,
+		App:   *app,
+		Scope: constants.PAY_INVOICE_SCOPE,
+	}).Error
+	assert.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, nil, SendPaymentOptions{})
+	assert.NoError(t, err)
+	require.NotNil(t, transaction.DecodedInvoice)
+
+	var storedTransaction db.Transaction
+	svc.DB.First(&storedTransaction, transaction.ID)
+
+	var decodedInvoice decodepay.Bolt11
+	err = json.Unmarshal(storedTransaction.DecodedInvoice, &decodedInvoice)
+	assert.NoError(t, err)
+
+	expectedInvoice, err := decodepay.Decodepay(tests.MockLNClientTransaction.Invoice)
+	require.NoError(t, err)
+	assert.Equal(t, expectedInvoice, decodedInvoice)
+	assert.Equal(t, tests.MockLNClientTransaction.PaymentHash, decodedInvoice.PaymentHash)
+	assert.Equal(t, int64(123000), decodedInvoice.MSatoshi)
+	assert.Equal(t, "te", decodedInvoice.Description)
+	assert.Equal(t, "02ff7c3da0679c37c2914a1f392a88a01a243a0773a1794fba7252e15e4e40f4f3", decodedInvoice.Payee)
+}
+
+func TestSendPaymentSync_App_DecodedInvoiceNotStoredByDefault(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	assert.NoError(t, err)
+
+	err = svc.DB.Create(&db.AppPermission{
+		AppId: app.ID,
+		App:   *app,
+		Scope: constants.PAY_INVOICE_SCOPE,
+	}).Error
+	assert.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, nil, SendPaymentOptions{})
+	assert.NoError(t, err)
+	assert.Nil(t, transaction.DecodedInvoice)
+}
+
+func TestSendKeysend_App_BudgetReset(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	assert.NoError(t, err)
+
+	appPermission := &db.AppPermission{
+		AppId:         app.ID,
+		App:           *app,
+		Scope:         constants.PAY_INVOICE_SCOPE,
+		MaxAmountSat:  1000,
+		BudgetRenewal: constants.BUDGET_RENEWAL_MONTHLY,
+	}
+	err = svc.DB.Create(appPermission).Error
+	assert.NoError(t, err)
+
+	dbRequestEvent := &db.RequestEvent{}
+	err = svc.DB.Create(&dbRequestEvent).Error
+	assert.NoError(t, err)
+
+	mockEventConsumer := tests.NewMockEventConsumer()
+	svc.EventPublisher.RegisterSubscriber(mockEventConsumer)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	// the first payment records the current budget period without a reset
+	_, err = transactionsService.SendKeysend(ctx, uint64(100000), mockKeysendDestination, nil, "", "", svc.LNClient, &app.ID, &dbRequestEvent.ID)
+	require.NoError(t, err)
+	assert.Empty(t, getEvents(mockEventConsumer.GetConsumedEvents(), "nwc_budget_reset"))
+
+	err = svc.DB.First(appPermission, appPermission.ID).Error
+	require.NoError(t, err)
+	startOfMonth := queries.GetBudgetPeriodStart(constants.BUDGET_RENEWAL_MONTHLY)
+	require.NotNil(t, appPermission.BudgetPeriodStart)
+	assert.True(t, startOfMonth.Equal(*appPermission.BudgetPeriodStart))
+
+	// simulate the previous payment being made last month
+	lastMonth := startOfMonth.AddDate(0, -1, 0)
+	err = svc.DB.Model(appPermission).Update("budget_period_start", lastMonth).Error
+	require.NoError(t, err)
+	err = svc.DB.Model(&db.Transaction{}).Where("app_id = ?", app.ID).Update("created_at", lastMonth).Error
+	require.NoError(t, err)
+
+	_, err = transactionsService.SendKeysend(ctx, uint64(100000), mockKeysendDestination, nil, "", "", svc.LNClient, &app.ID, &dbRequestEvent.ID)
+	require.NoError(t, err)
+
+	budgetResetEvents := getEvents(mockEventConsumer.GetConsumedEvents(), "nwc_budget_reset")
+	require.Equal(t, 1, len(budgetResetEvents))
+	properties := budgetResetEvents[0].Properties.(map[string]interface{})
+	assert.Equal(t, app.Name, properties["name"])
+	assert.Equal(t, app.ID, properties["id"])
+	assert.Equal(t, constants.BUDGET_RENEWAL_MONTHLY, properties["budget_renewal"])
+	// last month's payment no longer counts towards the budget
+	assert.Equal(t, uint64(1000), properties["remaining_sat"])
+
+	// further payments in the same period do not reset the budget again
+	_, err = transactionsService.SendKeysend(ctx, uint64(100000), mockKeysendDestination, nil, "", "", svc.LNClient, &app.ID, &dbRequestEvent.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(getEvents(mockEventConsumer.GetConsumedEvents(), "nwc_budget_reset")))
+}
+
+func TestSendKeysend_App_BudgetResetNotAdvancedByPaymentIntent(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	assert.NoError(t, err)
+
+	lastMonth := queries.GetBudgetPeriodStart(constants.BUDGET_RENEWAL_MONTHLY).AddDate(0, -1, 0)
+	appPermission := &db.AppPermission{
+		AppId:             app.ID,
+		App:               *app,
+		Scope:             constants.PAY_INVOICE_SCOPE,
+		MaxAmountSat:      1000,
+		BudgetRenewal:     constants.BUDGET_RENEWAL_MONTHLY,
+		BudgetPeriodStart: &lastMonth,
+	}
+	err = svc.DB.Create(appPermission).Error
+	assert.NoError(t, err)
+
+	mockEventConsumer := tests.NewMockEventConsumer()
+	svc.EventPublisher.RegisterSubscriber(mockEventConsumer)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	// checking the app can pay for an intent does not start the new budget period
+	_, err = transactionsService.CreatePaymentIntent(ctx, app.ID, 100000, 0, nil, 3600)
+	require.NoError(t, err)
+	assert.Empty(t, getEvents(mockEventConsumer.GetConsumedEvents(), "nwc_budget_reset"))
+
+	err = svc.DB.First(appPermission, appPermission.ID).Error
+	require.NoError(t, err)
+	require.NotNil(t, appPermission.BudgetPeriodStart)
+	assert.True(t, lastMonth.Equal(*appPermission.BudgetPeriodStart))
+
+	_, err = transactionsService.SendKeysend(ctx, uint64(100000), mockKeysendDestination, nil, "", "", svc.LNClient, &app.ID, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(getEvents(mockEventConsumer.GetConsumedEvents(), "nwc_budget_reset")))
+}
@@ -0,0 +1,149 @@
+package transactions
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/logger"
+	"github.com/sirupsen/logrus"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Attestation is a statement about a transaction (e.g. "verified purchase") signed by a third party,
+// which anyone can verify with VerifyAttestation
+type Attestation struct {
+	AppId uint `json:"app_id"`
+	// hex-encoded x-only public key of the signer, as used by nostr
+	Pubkey  string `json:"pubkey"`
+	Content string `json:"content"`
+	// hex-encoded BIP-340 schnorr signature of GetAttestationHash
+	Signature string `json:"signature"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// GetAttestationHash returns the hash an attestation signs, which commits to the transaction's payment hash
+// so an attestation cannot be copied to another transaction
+func GetAttestationHash(paymentHash string, content string) []byte {
+	hash := sha256.Sum256([]byte(paymentHash + content))
+	return hash[:]
+}
+
+// VerifyAttestation checks the attestation was signed by its pubkey for the transaction with the given payment hash
+func VerifyAttestation(paymentHash string, attestation *Attestation) error {
+	pubkeyBytes, err := hex.DecodeString(attestation.Pubkey)
+	if err != nil {
+		return newInvalidAttestationErrorWithReason("pubkey is not hex-encoded")
+	}
+	pubkey, err := schnorr.ParsePubKey(pubkeyBytes)
+	if err != nil {
+		return newInvalidAttestationErrorWithReason("invalid pubkey: " + err.Error())
+	}
+
+	signatureBytes, err := hex.DecodeString(attestation.Signature)
+	if err != nil {
+		return newInvalidAttestationErrorWithReason("signature is not hex-encoded")
+	}
+	signature, err := schnorr.ParseSignature(signatureBytes)
+	if err != nil {
+		return newInvalidAttestationErrorWithReason("invalid signature: " + err.Error())
+	}
+
+	if !signature.Verify(GetAttestationHash(paymentHash, attestation.Content), pubkey) {
+		return newInvalidAttestationErrorWithReason("signature does not match")
+	}
+	return nil
+}
+
+// AddTransactionAttestation verifies a signed attestation and appends it to the metadata of one of the app's transactions.
+// Attestations cannot be changed or removed once added.
+func (svc *transactionsService) AddTransactionAttestation(ctx context.Context, id uint, appId uint, pubkey string, content string, signature string) (*Transaction, error) {
+	var transaction db.Transaction
+
+	err := svc.inTransaction(func(tx *gorm.DB, balanceChanges *[]balanceChange) error {
+		result := tx.Limit(1).Find(&transaction, &db.Transaction{
+			ID:    id,
+			AppId: &appId,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return NewNotFoundError()
+		}
+
+		attestation := Attestation{
+			AppId:     appId,
+			Pubkey:    pubkey,
+			Content:   content,
+			Signature: signature,
+			CreatedAt: time.Now().Unix(),
+		}
+		err := VerifyAttestation(transaction.PaymentHash, &attestation)
+		if err != nil {
+			return err
+		}
+
+		metadata, err := addAttestation(transaction.Metadata, attestation)
+		if err != nil {
+			return err
+		}
+		// attestations count towards the metadata limit so the transaction can still be listed
+		maxMetadataLength := svc.getMaxMetadataLength(&appId)
+		if len(metadata) > maxMetadataLength {
+			return newInvalidAttestationErrorWithReason(fmt.Sprintf("metadata would exceed the limit of %d", maxMetadataLength))
+		}
+		transaction.Metadata = metadata
+
+		return tx.Model(&transaction).Update("metadata", metadata).Error
+	})
+	if err != nil {
+		logger.Logger.WithFields(logrus.Fields{
+			"id":     id,
+			"app_id": appId,
+		}).WithError(err).Error("Failed to add transaction attestation")
+		return nil, err
+	}
+
+	return &transaction, nil
+}
+
+// GetAttestations returns the attestations attached to a transaction, oldest first
+func GetAttestations(metadata datatypes.JSON) ([]Attestation, error) {
+	var metadataMap struct {
+		Attestations []Attestation `json:"attestations"`
+	}
+	if len(metadata) > 0 {
+		if err := json.Unmarshal(metadata, &metadataMap); err != nil {
+			return nil, err
+		}
+	}
+	return metadataMap.Attestations, nil
+}
+
+func addAttestation(metadata datatypes.JSON, attestation Attestation) (datatypes.JSON, error) {
+	attestations, err := GetAttestations(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	metadataMap := map[string]interface{}{}
+	if len(metadata) > 0 {
+		if err := json.Unmarshal(metadata, &metadataMap); err != nil {
+			return nil, err
+		}
+	}
+	metadataMap[constants.ATTESTATIONS_METADATA_KEY] = append(attestations, attestation)
+	metadataBytes, err := json.Marshal(metadataMap)
+	if err != nil {
+		return nil, err
+	}
+	return datatypes.JSON(metadataBytes), nil
+}
@@ -0,0 +1,170 @@
+package transactions
+
+import (
+	"context"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func signTestAttestation(t *testing.T, privateKey *btcec.PrivateKey, paymentHash string, content string) (string, string) {
+	signature, err := schnorr.Sign(privateKey, GetAttestationHash(paymentHash, content))
+	require.NoError(t, err)
+	return hex.EncodeToString(schnorr.SerializePubKey(privateKey.PubKey())), hex.EncodeToString(signature.Serialize())
+}
+
+func TestAddTransactionAttestation(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+
+	dbTransaction := db.Transaction{
+		AppId:       &app.ID,
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		PaymentHash: tests.MockPaymentHash,
+		AmountMsat:  123000,
+		Metadata:    []byte(`{"order_id":"123"}`),
+	}
+	require.NoError(t, svc.DB.Create(&dbTransaction).Error)
+
+	privateKey, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	pubkey, signature := signTestAttestation(t, privateKey, tests.MockPaymentHash, "verified purchase")
+	transaction, err := transactionsService.AddTransactionAttestation(ctx, dbTransaction.ID, app.ID, pubkey, "verified purchase", signature)
+	require.NoError(t, err)
+
+	_, signature2 := signTestAttestation(t, privateKey, tests.MockPaymentHash, "5 stars")
+	transaction, err = transactionsService.AddTransactionAttestation(ctx, dbTransaction.ID, app.ID, pubkey, "5 stars", signature2)
+	require.NoError(t, err)
+
+	// attestations are appended, existing metadata is kept
+	assert.Contains(t, string(transaction.Metadata), `"order_id":"123"`)
+	attestations, err := GetAttestations(transaction.Metadata)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(attestations))
+	assert.Equal(t, "verified purchase", attestations[0].Content)
+	assert.Equal(t, "5 stars", attestations[1].Content)
+	assert.Equal(t, app.ID, attestations[0].AppId)
+	assert.Equal(t, pubkey, attestations[0].Pubkey)
+
+	// anyone can verify the stored attestations
+	for _, attestation := range attestations {
+		assert.NoError(t, VerifyAttestation(tests.MockPaymentHash, &attestation))
+	}
+
+	var storedTransaction db.Transaction
+	require.NoError(t, svc.DB.First(&storedTransaction, dbTransaction.ID).Error)
+	assert.Equal(t, string(transaction.Metadata), string(storedTransaction.Metadata))
+}
+
+func TestAddTransactionAttestation_Invalid(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+	otherApp, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+
+	dbTransaction := db.Transaction{
+		AppId:       &app.ID,
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		PaymentHash: tests.MockPaymentHash,
+		AmountMsat:  123000,
+	}
+	require.NoError(t, svc.DB.Create(&dbTransaction).Error)
+
+	privateKey, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	pubkey, signature := signTestAttestation(t, privateKey, tests.MockPaymentHash, "verified purchase")
+	_, otherTransactionSignature := signTestAttestation(t, privateKey, "other payment hash", "verified purchase")
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	for name, testCase := range map[string]struct {
+		appId         uint
+		pubkey        string
+		content       string
+		signature     string
+		expectedError error
+	}{
+		"another app's transaction": {
+			appId:         otherApp.ID,
+			pubkey:        pubkey,
+			content:       "verified purchase",
+			signature:     signature,
+			expectedError: NewNotFoundError(),
+		},
+		"different content": {
+			appId:         app.ID,
+			pubkey:        pubkey,
+			content:       "verified refund",
+			signature:     signature,
+			expectedError: NewInvalidAttestationError(),
+		},
+		"signed for another transaction": {
+			appId:         app.ID,
+			pubkey:        pubkey,
+			content:       "verified purchase",
+			signature:     otherTransactionSignature,
+			expectedError: NewInvalidAttestationError(),
+		},
+		"invalid pubkey": {
+			appId:         app.ID,
+			pubkey:        "not a pubkey",
+			content:       "verified purchase",
+			signature:     signature,
+			expectedError: NewInvalidAttestationError(),
+		},
+		"too large": {
+			appId:         app.ID,
+			pubkey:        pubkey,
+			content:       strings.Repeat("a", constants.INVOICE_METADATA_MAX_LENGTH),
+			expectedError: NewInvalidAttestationError(),
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			signature := testCase.signature
+			if signature == "" {
+				_, signature = signTestAttestation(t, privateKey, tests.MockPaymentHash, testCase.content)
+			}
+			transaction, err := transactionsService.AddTransactionAttestation(ctx, dbTransaction.ID, testCase.appId, testCase.pubkey, testCase.content, signature)
+			assert.ErrorIs(t, err, testCase.expectedError)
+			assert.Nil(t, transaction)
+		})
+	}
+
+	var storedTransaction db.Transaction
+	require.NoError(t, svc.DB.First(&storedTransaction, dbTransaction.ID).Error)
+	attestations, err := GetAttestations(storedTransaction.Metadata)
+	require.NoError(t, err)
+	assert.Empty(t, attestations)
+}
+
+func TestNormalizeMetadata_Attestations(t *testing.T) {
+	_, err := normalizeMetadata(map[string]interface{}{
+		constants.ATTESTATIONS_METADATA_KEY: []interface{}{},
+	})
+	assert.ErrorIs(t, err, NewInvalidMetadataError())
+}
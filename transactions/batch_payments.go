@@ -0,0 +1,242 @@
+package transactions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/getAlby/hub/lnclient"
+	"github.com/getAlby/hub/logger"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type BatchMode string
+
+const (
+	// every invoice is attempted, regardless of earlier failures
+	BatchModeBestEffort BatchMode = "best_effort"
+	// the whole batch is checked against the app's balance and budget before anything is sent,
+	// and sending stops at the first failure. Nothing is reserved by the check, so a concurrent
+	// payment can still use up the balance or budget, and payments already sent are not undone
+	BatchModeFailFast BatchMode = "fail_fast"
+)
+
+type BatchPaymentResult struct {
+	PayReq      string
+	Transaction *Transaction
+	// nil if the payment succeeded
+	Error error
+}
+
+// BatchProgressCallback is called with the number of completed items each time an item of a batch completes
+type BatchProgressCallback func(done, total int)
+
+// how long a finished batch waits for its progress callback to catch up before returning
+var batchProgressTimeout = 5 * time.Second
+
+type batchAbortedError struct {
+}
+
+func NewBatchAbortedError() error {
+	return &batchAbortedError{}
+}
+
+func (err *batchAbortedError) Error() string {
+	return "Not sent because an earlier payment in the batch failed"
+}
+
+// BatchItemError is why an item of a batch failed validation
+type BatchItemError struct {
+	// position of the item in the batch
+	Index int
+	Err   error
+}
+
+// batchValidationError lists every invalid item of a batch, so all of them can be fixed at once
+type batchValidationError struct {
+	items []BatchItemError
+}
+
+func NewBatchValidationError() error {
+	return &batchValidationError{}
+}
+
+func newBatchValidationErrorWithItems(items []BatchItemError) error {
+	return &batchValidationError{
+		items: items,
+	}
+}
+
+func (err *batchValidationError) Error() string {
+	if len(err.items) == 0 {
+		return "Some items of the batch are invalid"
+	}
+	reasons := make([]string, 0, len(err.items))
+	for _, item := range err.items {
+		reasons = append(reasons, fmt.Sprintf("item %d: %v", item.Index, item.Err))
+	}
+	return fmt.Sprintf("%d items of the batch are invalid: %s", len(err.items), strings.Join(reasons, "; "))
+}
+
+// Is matches any batch validation error, regardless of the items
+func (err *batchValidationError) Is(target error) bool {
+	_, ok := target.(*batchValidationError)
+	return ok
+}
+
+// Unwrap returns the error of each item, so errors.Is matches e.g. an expired invoice in the batch
+func (err *batchValidationError) Unwrap() []error {
+	errs := make([]error, 0, len(err.items))
+	for _, item := range err.items {
+		errs = append(errs, item.Err)
+	}
+	return errs
+}
+
+// GetBatchItemErrors returns the invalid items of a batch validation error, in batch order.
+// ok is false if the error is not a batch validation error.
+func GetBatchItemErrors(err error) (items []BatchItemError, ok bool) {
+	var batchValidationErr *batchValidationError
+	if !errors.As(err, &batchValidationErr) {
+		return nil, false
+	}
+	return batchValidationErr.items, true
+}
+
+// SendPaymentBatch pays a list of invoices in order and returns the result of each payment.
+// An error is only returned if the batch could not be started (e.g. in fail-fast mode,
+// invoices are invalid or the batch exceeds the app's balance or budget). Invalid invoices
+// are all listed in the error, see GetBatchItemErrors.
+// Note that payments already sent cannot be undone if a later payment fails.
+// If progress is set, it is called as each payment completes.
+func (svc *transactionsService) SendPaymentBatch(ctx context.Context, payReqs []string, mode BatchMode, lnClient lnclient.LNClient, appId *uint, requestEventId *uint, progress BatchProgressCallback) ([]BatchPaymentResult, error) {
+	if mode != BatchModeBestEffort && mode != BatchModeFailFast {
+		return nil, errors.New("unknown batch mode: " + string(mode))
+	}
+
+	if mode == BatchModeFailFast {
+		err := svc.validateCanPayBatch(payReqs, lnClient, appId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	progressReporter := newBatchProgressReporter(progress, len(payReqs))
+	defer progressReporter.finish()
+
+	results := make([]BatchPaymentResult, 0, len(payReqs))
+	aborted := false
+	for _, payReq := range payReqs {
+		if aborted {
+			results = append(results, BatchPaymentResult{
+				PayReq: payReq,
+				Error:  NewBatchAbortedError(),
+			})
+			progressReporter.report(len(results))
+			continue
+		}
+
+		transaction, err := svc.SendPaymentSync(ctx, payReq, nil, lnClient, appId, requestEventId, SendPaymentOptions{})
+		results = append(results, BatchPaymentResult{
+			PayReq:      payReq,
+			Transaction: transaction,
+			Error:       err,
+		})
+		if err != nil {
+			logger.Logger.WithFields(logrus.Fields{
+				"bolt11": payReq,
+				"mode":   mode,
+			}).WithError(err).Error("Failed to send batch payment")
+			aborted = mode == BatchModeFailFast
+		}
+		progressReporter.report(len(results))
+	}
+
+	return results, nil
+}
+
+// validateCanPayBatch checks every invoice of the batch is valid, returning all invalid invoices at once,
+// then checks that the app can currently afford the whole batch, including the fee reserve of every payment.
+// This is a check only: nothing is reserved, and each payment is validated again when it is sent
+func (svc *transactionsService) validateCanPayBatch(payReqs []string, lnClient lnclient.LNClient, appId *uint) error {
+	var totalAmountMsat uint64
+	var totalFeeReserveMsat uint64
+	var itemErrors []BatchItemError
+	for index, payReq := range payReqs {
+		paymentRequest, err := decodeInvoice(strings.ToLower(payReq))
+		if err == nil {
+			err = validateInvoiceNotExpired(&paymentRequest)
+		}
+		if err != nil {
+			logger.Logger.WithFields(logrus.Fields{
+				"bolt11": payReq,
+				"index":  index,
+			}).WithError(err).Error("Invalid invoice in batch")
+			itemErrors = append(itemErrors, BatchItemError{Index: index, Err: err})
+			continue
+		}
+		totalAmountMsat += uint64(paymentRequest.MSatoshi)
+		totalFeeReserveMsat += svc.calculateFeeReserveMsat(uint64(paymentRequest.MSatoshi), paymentRequest.Payee, appId, lnClient)
+	}
+	if len(itemErrors) > 0 {
+		return newBatchValidationErrorWithItems(itemErrors)
+	}
+
+	return svc.db.Transaction(func(tx *gorm.DB) error {
+		return svc.validateCanPay(tx, appId, totalAmountMsat, totalFeeReserveMsat, "", lnClient, nil)
+	})
+}
+
+// batchProgressReporter calls a batch's progress callback from its own goroutine,
+// so a slow or stuck callback cannot hold up the batch
+type batchProgressReporter struct {
+	updates  chan int
+	finished chan struct{}
+}
+
+func newBatchProgressReporter(callback BatchProgressCallback, total int) *batchProgressReporter {
+	if callback == nil {
+		return nil
+	}
+
+	reporter := &batchProgressReporter{
+		// every update fits in the buffer, so reporting never blocks
+		updates:  make(chan int, total),
+		finished: make(chan struct{}),
+	}
+	go func() {
+		defer close(reporter.finished)
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Logger.WithField("panic", r).Error("Batch progress callback panicked")
+			}
+		}()
+		for done := range reporter.updates {
+			callback(done, total)
+		}
+	}()
+	return reporter
+}
+
+func (reporter *batchProgressReporter) report(done int) {
+	if reporter == nil {
+		return
+	}
+	reporter.updates <- done
+}
+
+// finish waits for the callback to receive the remaining updates, for at most batchProgressTimeout
+func (reporter *batchProgressReporter) finish() {
+	if reporter == nil {
+		return
+	}
+	close(reporter.updates)
+	select {
+	case <-reporter.finished:
+	case <-time.After(batchProgressTimeout):
+		logger.Logger.Warn("Timed out waiting for batch progress callback")
+	}
+}
@@ -0,0 +1,275 @@
+package transactions
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestSendPaymentBatch_BestEffort(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	svc.LNClient.(*tests.MockLn).PayInvoiceErrors = append(svc.LNClient.(*tests.MockLn).PayInvoiceErrors, errors.New("Some error"))
+	svc.LNClient.(*tests.MockLn).PayInvoiceResponses = append(svc.LNClient.(*tests.MockLn).PayInvoiceResponses, nil)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	results, err := transactionsService.SendPaymentBatch(ctx, []string{tests.MockLNClientTransaction.Invoice, tests.MockInvoiceWithoutDescription}, BatchModeBestEffort, svc.LNClient, nil, nil, nil)
+	assert.NoError(t, err)
+	require.Equal(t, 2, len(results))
+
+	assert.Equal(t, tests.MockLNClientTransaction.Invoice, results[0].PayReq)
+	assert.EqualError(t, results[0].Error, "Some error")
+	assert.Nil(t, results[0].Transaction)
+
+	// later payments are still sent
+	assert.Equal(t, tests.MockInvoiceWithoutDescription, results[1].PayReq)
+	assert.NoError(t, results[1].Error)
+	require.NotNil(t, results[1].Transaction)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, results[1].Transaction.State)
+}
+
+func TestSendPaymentBatch_FailFast_StopsAtFailure(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	svc.LNClient.(*tests.MockLn).PayInvoiceErrors = append(svc.LNClient.(*tests.MockLn).PayInvoiceErrors, errors.New("Some error"))
+	svc.LNClient.(*tests.MockLn).PayInvoiceResponses = append(svc.LNClient.(*tests.MockLn).PayInvoiceResponses, nil)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	results, err := transactionsService.SendPaymentBatch(ctx, []string{tests.MockLNClientTransaction.Invoice, tests.MockInvoiceWithoutDescription}, BatchModeFailFast, svc.LNClient, nil, nil, nil)
+	assert.NoError(t, err)
+	require.Equal(t, 2, len(results))
+
+	assert.EqualError(t, results[0].Error, "Some error")
+	assert.ErrorIs(t, results[1].Error, NewBatchAbortedError())
+	assert.Nil(t, results[1].Transaction)
+
+	var count int64
+	svc.DB.Model(&db.Transaction{}).Where("payment_hash = ?", tests.MockPaymentHashWithoutDescription).Count(&count)
+	assert.Zero(t, count)
+}
+
+func TestSendPaymentBatch_BudgetExceeded(t *testing.T) {
+	ctx := context.TODO()
+
+	for _, mode := range []BatchMode{BatchModeFailFast, BatchModeBestEffort} {
+		t.Run(string(mode), func(t *testing.T) {
+			defer tests.RemoveTestService()
+			svc, err := tests.CreateTestService()
+			require.NoError(t, err)
+
+			app, _, err := tests.CreateApp(svc)
+			assert.NoError(t, err)
+
+			// enough for one 123 sat invoice with its fee reserve, but not two
+			err = svc.DB.Create(&db.AppPermission{
+				AppId:         app.ID,
+				App:           *app,
+				Scope:         constants.PAY_INVOICE_SCOPE,
+				MaxAmountSat:  200,
+				BudgetRenewal: constants.BUDGET_RENEWAL_NEVER,
+			}).Error
+			assert.NoError(t, err)
+
+			transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+			results, err := transactionsService.SendPaymentBatch(ctx, []string{tests.MockLNClientTransaction.Invoice, tests.MockInvoiceWithoutDescription}, mode, svc.LNClient, &app.ID, nil, nil)
+
+			if mode == BatchModeFailFast {
+				// nothing is sent
+				assert.ErrorIs(t, err, NewQuotaExceededError())
+				assert.Nil(t, results)
+				var count int64
+				svc.DB.Model(&db.Transaction{}).Count(&count)
+				assert.Zero(t, count)
+				return
+			}
+
+			assert.NoError(t, err)
+			require.Equal(t, 2, len(results))
+			assert.NoError(t, results[0].Error)
+			assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, results[0].Transaction.State)
+			assert.ErrorIs(t, results[1].Error, NewQuotaExceededError())
+		})
+	}
+}
+
+func TestSendPaymentBatch_FailFast_InvalidInvoice(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	results, err := transactionsService.SendPaymentBatch(ctx, []string{tests.MockLNClientTransaction.Invoice, "invalid"}, BatchModeFailFast, svc.LNClient, nil, nil, nil)
+	assert.Error(t, err)
+	assert.Nil(t, results)
+
+	var count int64
+	svc.DB.Model(&db.Transaction{}).Count(&count)
+	assert.Zero(t, count)
+}
+
+func TestSendPaymentBatch_FailFast_ExpiredInvoice(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	results, err := transactionsService.SendPaymentBatch(ctx, []string{tests.MockLNClientTransaction.Invoice, tests.MockExpiredInvoice}, BatchModeFailFast, svc.LNClient, nil, nil, nil)
+	assert.ErrorIs(t, err, NewInvoiceExpiredError())
+	assert.Nil(t, results)
+
+	var count int64
+	svc.DB.Model(&db.Transaction{}).Count(&count)
+	assert.Zero(t, count)
+}
+
+func TestSendPaymentBatch_FailFast_MultipleInvalidItems(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	payReqs := []string{"invalid", tests.MockLNClientTransaction.Invoice, tests.MockExpiredInvoice, tests.MockInvoiceWithoutDescription, ""}
+	results, err := transactionsService.SendPaymentBatch(ctx, payReqs, BatchModeFailFast, svc.LNClient, nil, nil, nil)
+	assert.Nil(t, results)
+	assert.ErrorIs(t, err, NewBatchValidationError())
+	assert.ErrorIs(t, err, NewInvoiceExpiredError())
+	assert.ErrorIs(t, err, NewInvoiceDecodeError())
+	assert.Contains(t, err.Error(), "3 items of the batch are invalid")
+
+	items, ok := GetBatchItemErrors(err)
+	require.True(t, ok)
+	require.Equal(t, 3, len(items))
+	assert.Equal(t, 0, items[0].Index)
+	assert.ErrorIs(t, items[0].Err, NewInvoiceDecodeError())
+	assert.Equal(t, 2, items[1].Index)
+	assert.ErrorIs(t, items[1].Err, NewInvoiceExpiredError())
+	assert.Equal(t, 4, items[2].Index)
+	assert.ErrorIs(t, items[2].Err, NewInvoiceDecodeError())
+
+	var count int64
+	svc.DB.Model(&db.Transaction{}).Count(&count)
+	assert.Zero(t, count)
+
+	_, ok = GetBatchItemErrors(NewInvoiceExpiredError())
+	assert.False(t, ok)
+}
+
+func TestSendPaymentBatch_UnknownMode(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	_, err = transactionsService.SendPaymentBatch(ctx, []string{tests.MockLNClientTransaction.Invoice}, BatchMode("sometimes"), svc.LNClient, nil, nil, nil)
+	assert.EqualError(t, err, "unknown batch mode: sometimes")
+}
+
+func TestSendPaymentBatch_Progress(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	svc.LNClient.(*tests.MockLn).PayInvoiceErrors = append(svc.LNClient.(*tests.MockLn).PayInvoiceErrors, errors.New("Some error"))
+	svc.LNClient.(*tests.MockLn).PayInvoiceResponses = append(svc.LNClient.(*tests.MockLn).PayInvoiceResponses, nil)
+
+	var progress [][2]int
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	_, err = transactionsService.SendPaymentBatch(ctx, []string{tests.MockLNClientTransaction.Invoice, tests.MockInvoiceWithoutDescription}, BatchModeFailFast, svc.LNClient, nil, nil, func(done, total int) {
+		progress = append(progress, [2]int{done, total})
+	})
+	assert.NoError(t, err)
+
+	// aborted payments also count as completed
+	assert.Equal(t, [][2]int{{1, 2}, {2, 2}}, progress)
+}
+
+func TestSendPaymentBatch_BlockedProgressCallback(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	originalTimeout := batchProgressTimeout
+	batchProgressTimeout = 100 * time.Millisecond
+	defer func() {
+		batchProgressTimeout = originalTimeout
+	}()
+
+	unblock := make(chan struct{})
+	defer close(unblock)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	results, err := transactionsService.SendPaymentBatch(ctx, []string{tests.MockLNClientTransaction.Invoice, tests.MockInvoiceWithoutDescription}, BatchModeBestEffort, svc.LNClient, nil, nil, func(done, total int) {
+		<-unblock
+	})
+	assert.NoError(t, err)
+	require.Equal(t, 2, len(results))
+	assert.NoError(t, results[0].Error)
+	assert.NoError(t, results[1].Error)
+}
+
+func TestSendPaymentBatch_FailFast_TopUpOnPayment(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+	app.Isolated = true
+	require.NoError(t, svc.DB.Save(app).Error)
+
+	err = svc.DB.Create(&db.AppPermission{
+		AppId: app.ID,
+		App:   *app,
+		Scope: constants.PAY_INVOICE_SCOPE,
+	}).Error
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	topUpCalls := 0
+	transactionsService.SetTopUpCallback(func(tx *gorm.DB, topUpApp *db.App, shortfallMsat uint64) error {
+		topUpCalls++
+		return tx.Create(&db.Transaction{
+			AppId:      &topUpApp.ID,
+			State:      constants.TRANSACTION_STATE_SETTLED,
+			Type:       constants.TRANSACTION_TYPE_INCOMING,
+			AmountMsat: shortfallMsat,
+		}).Error
+	})
+
+	// the check before the batch is sent does not top up the app, only the payment does
+	results, err := transactionsService.SendPaymentBatch(ctx, []string{tests.MockLNClientTransaction.Invoice}, BatchModeFailFast, svc.LNClient, &app.ID, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(results))
+	assert.NoError(t, results[0].Error)
+	assert.Equal(t, 1, topUpCalls)
+}
@@ -0,0 +1,113 @@
+package transactions
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/logger"
+	"gorm.io/datatypes"
+)
+
+// the boost session id of a transaction, or an empty string. json_extract fails on malformed JSON
+const boostSessionIdColumn = "COALESCE(CASE WHEN json_valid(metadata) THEN json_extract(metadata, '$." + constants.BOOST_SESSION_ID_METADATA_KEY + "') END, '')"
+
+// BoostSession sums up the keysend payments sent with the same session id
+type BoostSession struct {
+	SessionId string
+	AppId     *uint
+	// podcast of the session's first boostagram which names one
+	Podcast         string
+	TotalAmountMsat uint64
+	TotalFeeMsat    uint64
+	// number of keysend payments, including those accumulated into aggregated transactions
+	Count          uint64
+	FirstPaymentAt time.Time
+	LastPaymentAt  time.Time
+}
+
+// ListBoostSessions returns the boost sessions with settled keysend payments within the given period,
+// most recently active first
+func (svc *transactionsService) ListBoostSessions(ctx context.Context, appId *uint, from, until uint64) ([]BoostSession, error) {
+	outgoing := constants.TRANSACTION_TYPE_OUTGOING
+	tx, err := svc.filterTransactions(svc.db, from, until, &outgoing, appId, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var transactions []Transaction
+	result := tx.
+		Where("state == ?", constants.TRANSACTION_STATE_SETTLED).
+		Where(boostSessionIdColumn + " != ''").
+		Order("created_at asc").
+		Find(&transactions)
+	if result.Error != nil {
+		logger.Logger.WithError(result.Error).Error("Failed to list boost sessions")
+		return nil, result.Error
+	}
+
+	type boostSessionKey struct {
+		appId     uint
+		sessionId string
+	}
+	sessionsByKey := map[boostSessionKey]*BoostSession{}
+	sessions := []*BoostSession{}
+	for _, transaction := range transactions {
+		key := boostSessionKey{sessionId: getBoostSessionId(transaction.Metadata)}
+		if transaction.AppId != nil {
+			key.appId = *transaction.AppId
+		}
+		session, ok := sessionsByKey[key]
+		if !ok {
+			session = &BoostSession{
+				SessionId:      key.sessionId,
+				AppId:          transaction.AppId,
+				FirstPaymentAt: transaction.CreatedAt,
+			}
+			sessionsByKey[key] = session
+			sessions = append(sessions, session)
+		}
+
+		session.TotalAmountMsat += transaction.AmountMsat
+		session.TotalFeeMsat += transaction.FeeMsat
+		session.Count += max(getKeysendCount(transaction.Metadata), 1)
+
+		paymentAt := transaction.CreatedAt
+		if transaction.SettledAt != nil {
+			paymentAt = *transaction.SettledAt
+		}
+		if paymentAt.After(session.LastPaymentAt) {
+			session.LastPaymentAt = paymentAt
+		}
+
+		if session.Podcast == "" {
+			if boostagram := parseBoostagram(&transaction); boostagram != nil {
+				session.Podcast = boostagram.Podcast
+			}
+		}
+	}
+
+	slices.SortStableFunc(sessions, func(a, b *BoostSession) int {
+		return cmp.Compare(b.LastPaymentAt.UnixNano(), a.LastPaymentAt.UnixNano())
+	})
+
+	boostSessions := make([]BoostSession, 0, len(sessions))
+	for _, session := range sessions {
+		boostSessions = append(boostSessions, *session)
+	}
+	return boostSessions, nil
+}
+
+func getBoostSessionId(metadata datatypes.JSON) string {
+	metadataMap := map[string]interface{}{}
+	if len(metadata) > 0 {
+		if err := json.Unmarshal(metadata, &metadataMap); err != nil {
+			return ""
+		}
+	}
+	sessionId, _ := metadataMap[constants.BOOST_SESSION_ID_METADATA_KEY].(string)
+	return sessionId
+}
@@ -0,0 +1,106 @@
+package transactions
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/lnclient"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func boostagramRecords(podcast string) []lnclient.TLVRecord {
+	return []lnclient.TLVRecord{
+		{Type: BoostagramTlvType, Value: hex.EncodeToString([]byte(`{"podcast":"` + podcast + `","action":"stream"}`))},
+	}
+}
+
+func TestListBoostSessions(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, err := tests.CreateAppWithPermissions(svc, &db.AppPermission{Scope: constants.PAY_INVOICE_SCOPE})
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	for i := 0; i < 3; i++ {
+		_, err = transactionsService.SendKeysend(ctx, uint64(1000), mockKeysendDestination, boostagramRecords("Pod A"), "", "session1", svc.LNClient, &app.ID, nil)
+		require.NoError(t, err)
+	}
+	_, err = transactionsService.SendKeysend(ctx, uint64(2000), otherKeysendDestination, boostagramRecords("Pod B"), "", "session2", svc.LNClient, &app.ID, nil)
+	require.NoError(t, err)
+	// keysends without a session are not listed
+	_, err = transactionsService.SendKeysend(ctx, uint64(5000), mockKeysendDestination, nil, "", "", svc.LNClient, &app.ID, nil)
+	require.NoError(t, err)
+
+	var transaction db.Transaction
+	require.NoError(t, svc.DB.Order("id").First(&transaction).Error)
+	assert.Equal(t, "session1", getMetadata(t, transaction)[constants.BOOST_SESSION_ID_METADATA_KEY])
+
+	sessions, err := transactionsService.ListBoostSessions(ctx, &app.ID, 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(sessions))
+
+	// most recently active first
+	assert.Equal(t, "session2", sessions[0].SessionId)
+	assert.Equal(t, "Pod B", sessions[0].Podcast)
+	assert.Equal(t, uint64(2000), sessions[0].TotalAmountMsat)
+	assert.Equal(t, uint64(1), sessions[0].Count)
+
+	assert.Equal(t, "session1", sessions[1].SessionId)
+	assert.Equal(t, &app.ID, sessions[1].AppId)
+	assert.Equal(t, "Pod A", sessions[1].Podcast)
+	assert.Equal(t, uint64(3000), sessions[1].TotalAmountMsat)
+	assert.Equal(t, uint64(3), sessions[1].TotalFeeMsat)
+	assert.Equal(t, uint64(3), sessions[1].Count)
+	assert.False(t, sessions[1].LastPaymentAt.Before(sessions[1].FirstPaymentAt))
+
+	// sessions of other apps are not included
+	otherApp, err := tests.CreateAppWithPermissions(svc, &db.AppPermission{Scope: constants.PAY_INVOICE_SCOPE})
+	require.NoError(t, err)
+	sessions, err = transactionsService.ListBoostSessions(ctx, &otherApp.ID, 0, 0)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+}
+
+func TestListBoostSessions_Aggregated(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, err := tests.CreateAppWithPermissions(svc, &db.AppPermission{Scope: constants.PAY_INVOICE_SCOPE})
+	require.NoError(t, err)
+	err = svc.DB.Model(app).Update("keysend_aggregation_window_seconds", 60).Error
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	for _, sessionId := range []string{"session1", "session1", "session2", "session1"} {
+		_, err = transactionsService.SendKeysend(ctx, uint64(1000), mockKeysendDestination, nil, "", sessionId, svc.LNClient, &app.ID, nil)
+		require.NoError(t, err)
+	}
+
+	// keysends of different sessions to the same destination are aggregated separately
+	var transactions []db.Transaction
+	svc.DB.Order("id").Find(&transactions)
+	require.Equal(t, 2, len(transactions))
+	assert.Equal(t, uint64(3000), transactions[0].AmountMsat)
+	assert.Equal(t, uint64(1000), transactions[1].AmountMsat)
+
+	sessions, err := transactionsService.ListBoostSessions(ctx, &app.ID, 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(sessions))
+	assert.Equal(t, "session1", sessions[0].SessionId)
+	assert.Equal(t, uint64(3), sessions[0].Count)
+	assert.Equal(t, uint64(3000), sessions[0].TotalAmountMsat)
+	assert.Equal(t, "session2", sessions[1].SessionId)
+	assert.Equal(t, uint64(1), sessions[1].Count)
+}
@@ -0,0 +1,192 @@
+package transactions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/lnclient"
+	"github.com/getAlby/hub/logger"
+	"github.com/sirupsen/logrus"
+)
+
+type TransactionWithBoostagram struct {
+	Transaction
+	// nil if the transaction has no boostagram or it could not be parsed
+	Boostagram *Boostagram
+}
+
+// ListTransactionsWithBoostagrams returns the same transactions as ListTransactions,
+// with boostagrams parsed once on the server side.
+// Malformed boostagrams are skipped rather than failing the whole list.
+func (svc *transactionsService) ListTransactionsWithBoostagrams(ctx context.Context, from, until, limit, offset uint64, unpaidOutgoing bool, unpaidIncoming bool, transactionType *string, lnClient lnclient.LNClient, appId *uint, forceFilterByAppId bool) ([]TransactionWithBoostagram, error) {
+	transactions, err := svc.ListTransactions(ctx, from, until, limit, offset, unpaidOutgoing, unpaidIncoming, transactionType, lnClient, appId, forceFilterByAppId, ListTransactionsFilter{})
+	if err != nil {
+		return nil, err
+	}
+
+	transactionsWithBoostagrams := make([]TransactionWithBoostagram, 0, len(transactions))
+	for _, transaction := range transactions {
+		transactionsWithBoostagrams = append(transactionsWithBoostagrams, TransactionWithBoostagram{
+			Transaction: transaction,
+			Boostagram:  parseBoostagram(&transaction),
+		})
+	}
+
+	return transactionsWithBoostagrams, nil
+}
+
+// ListTopBoostagrams returns received boostagrams ordered by their total value, highest first.
+// value_msat_total may be encoded as a number or a string, and boostagrams without one sort last.
+// Transactions with a missing or malformed boostagram are not included.
+func (svc *transactionsService) ListTopBoostagrams(ctx context.Context, from, until uint64, limit int) ([]TransactionWithBoostagram, error) {
+	incoming := constants.TRANSACTION_TYPE_INCOMING
+	tx, err := svc.filterTransactions(svc.db, from, until, &incoming, nil, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// boosts are JSON objects (see isBoost), so json_extract does not fail on malformed JSON
+	tx = tx.
+		Where("state == ?", constants.TRANSACTION_STATE_SETTLED).
+		Where("is_boost").
+		Order("COALESCE(CAST(json_extract(boostagram, '$.value_msat_total') AS INTEGER), 0) desc").
+		Order("created_at desc")
+
+	if limit > 0 {
+		tx = tx.Limit(limit)
+	}
+
+	var transactions []Transaction
+	result := tx.Find(&transactions)
+	if result.Error != nil {
+		logger.Logger.WithError(result.Error).Error("Failed to list top boostagrams")
+		return nil, result.Error
+	}
+
+	transactionsWithBoostagrams := make([]TransactionWithBoostagram, 0, len(transactions))
+	for _, transaction := range transactions {
+		transactionsWithBoostagrams = append(transactionsWithBoostagrams, TransactionWithBoostagram{
+			Transaction: transaction,
+			Boostagram:  parseBoostagram(&transaction),
+		})
+	}
+
+	return transactionsWithBoostagrams, nil
+}
+
+// BoostStats sums up the boostagrams received for a podcast feed
+type BoostStats struct {
+	FeedId string
+	// sum of value_msat_total, the full amount boosted including splits paid to others
+	TotalValueMsat int64
+	Count          uint64
+	// boostagrams without a sender id are not counted as senders
+	UniqueSenders uint64
+}
+
+// GetBoostagramStats returns totals of the settled boostagrams received for the given feed within the given period.
+// Feed and sender ids are compared as strings, whether the sender encoded them as strings or numbers.
+func (svc *transactionsService) GetBoostagramStats(ctx context.Context, feedId string, from, until uint64) (*BoostStats, error) {
+	incoming := constants.TRANSACTION_TYPE_INCOMING
+	tx, err := svc.filterTransactions(svc.db, from, until, &incoming, nil, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var transactions []Transaction
+	result := tx.
+		Where("state == ?", constants.TRANSACTION_STATE_SETTLED).
+		Where("is_boost").
+		Find(&transactions)
+	if result.Error != nil {
+		logger.Logger.WithError(result.Error).Error("Failed to get boostagram stats")
+		return nil, result.Error
+	}
+
+	stats := &BoostStats{
+		FeedId: feedId,
+	}
+	senders := map[string]struct{}{}
+	for _, transaction := range transactions {
+		boostagram := parseBoostagram(&transaction)
+		if boostagram == nil || boostagram.FeedId.StringData != feedId {
+			continue
+		}
+		stats.TotalValueMsat += boostagram.ValueMsatTotal
+		stats.Count++
+		if boostagram.SenderId.StringData != "" {
+			senders[boostagram.SenderId.StringData] = struct{}{}
+		}
+	}
+	stats.UniqueSenders = uint64(len(senders))
+
+	return stats, nil
+}
+
+func parseBoostagram(transaction *Transaction) *Boostagram {
+	if len(transaction.Boostagram) == 0 {
+		return nil
+	}
+
+	var boostagram Boostagram
+	err := json.Unmarshal(transaction.Boostagram, &boostagram)
+	if err != nil {
+		logger.Logger.WithError(err).WithFields(logrus.Fields{
+			"payment_hash": transaction.PaymentHash,
+			"boostagram":   transaction.Boostagram,
+		}).Warn("Failed to deserialize transaction boostagram")
+		return nil
+	}
+	boostagram.normalize()
+
+	return &boostagram
+}
+
+// UnmarshalJSON accepts value_msat_total encoded either as a number or as a numeric string
+func (boostagram *Boostagram) UnmarshalJSON(data []byte) error {
+	type boostagramAlias Boostagram
+	aux := struct {
+		*boostagramAlias
+		ValueMsatTotal *StringOrNumber `json:"value_msat_total"`
+	}{
+		boostagramAlias: (*boostagramAlias)(boostagram),
+	}
+	err := json.Unmarshal(data, &aux)
+	if err != nil {
+		return err
+	}
+
+	boostagram.ValueMsatTotal = 0
+	if aux.ValueMsatTotal != nil {
+		if aux.ValueMsatTotal.StringData != "" {
+			valueMsatTotal, err := strconv.ParseInt(aux.ValueMsatTotal.StringData, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid value_msat_total %q: %w", aux.ValueMsatTotal.StringData, err)
+			}
+			boostagram.ValueMsatTotal = valueMsatTotal
+		} else {
+			boostagram.ValueMsatTotal = aux.ValueMsatTotal.NumberData
+		}
+	}
+	return nil
+}
+
+// normalize ensures StringOrNumber fields always have their string representation set,
+// whether the sender encoded them as strings or numbers
+func (boostagram *Boostagram) normalize() {
+	for _, field := range []*StringOrNumber{&boostagram.Episode, &boostagram.FeedId, &boostagram.ItemId, &boostagram.SenderId} {
+		if field.StringData == "" && field.NumberData != 0 {
+			field.StringData = field.String()
+		}
+	}
+}
+
+// isBoost returns whether the value of a boostagram TLV record (7629169) is a JSON object.
+// This is the definition of a boost everywhere, and must match the is_boost migration.
+func isBoost(boostagramBytes []byte) bool {
+	var boostagram map[string]json.RawMessage
+	return json.Unmarshal(boostagramBytes, &boostagram) == nil && boostagram != nil
+}
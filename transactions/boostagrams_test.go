@@ -0,0 +1,205 @@
+package transactions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+func TestListTransactionsWithBoostagrams(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		PaymentHash: "hash1",
+		AmountMsat:  1000,
+		Boostagram:  datatypes.JSON(`{"podcast":"Pod","feedID":123,"sender_id":"abc","episode":"ep 1","value_msat_total":1000}`),
+		IsBoost:     true,
+	})
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		PaymentHash: "hash2",
+		AmountMsat:  2000,
+		Boostagram:  datatypes.JSON(`{"podcast":`),
+	})
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		PaymentHash: "hash3",
+		AmountMsat:  3000,
+	})
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transactions, err := transactionsService.ListTransactionsWithBoostagrams(ctx, 0, 0, 0, 0, false, false, nil, svc.LNClient, nil, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(transactions))
+
+	transactionsByHash := map[string]TransactionWithBoostagram{}
+	for _, transaction := range transactions {
+		transactionsByHash[transaction.PaymentHash] = transaction
+	}
+
+	boostagram := transactionsByHash["hash1"].Boostagram
+	require.NotNil(t, boostagram)
+	assert.Equal(t, "Pod", boostagram.Podcast)
+	assert.Equal(t, "123", boostagram.FeedId.StringData)
+	assert.Equal(t, int64(123), boostagram.FeedId.NumberData)
+	assert.Equal(t, "abc", boostagram.SenderId.String())
+	assert.Equal(t, "ep 1", boostagram.Episode.String())
+	assert.Equal(t, int64(1000), boostagram.ValueMsatTotal)
+
+	// malformed boostagram is skipped
+	assert.Nil(t, transactionsByHash["hash2"].Boostagram)
+	assert.Equal(t, uint64(2000), transactionsByHash["hash2"].AmountMsat)
+
+	// no boostagram
+	assert.Nil(t, transactionsByHash["hash3"].Boostagram)
+}
+
+func TestListTopBoostagrams(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	for paymentHash, boostagram := range map[string]string{
+		"small":     `{"podcast":"Pod","value_msat_total":1000}`,
+		"large":     `{"podcast":"Pod","value_msat_total":50000}`,
+		"medium":    `{"podcast":"Pod","feedID":"123","value_msat_total":"20000"}`,
+		"zero":      `{"podcast":"Pod","value_msat_total":0}`,
+		"missing":   `{"podcast":"Pod"}`,
+		"malformed": `{"podcast":`,
+	} {
+		svc.DB.Create(&db.Transaction{
+			State:       constants.TRANSACTION_STATE_SETTLED,
+			Type:        constants.TRANSACTION_TYPE_INCOMING,
+			PaymentHash: paymentHash,
+			AmountMsat:  1000,
+			Boostagram:  datatypes.JSON(boostagram),
+			IsBoost:     isBoost([]byte(boostagram)),
+		})
+	}
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		PaymentHash: "no-boostagram",
+		AmountMsat:  1000,
+	})
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_PENDING,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		PaymentHash: "unpaid",
+		AmountMsat:  1000,
+		Boostagram:  datatypes.JSON(`{"podcast":"Pod","value_msat_total":90000}`),
+		IsBoost:     true,
+	})
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_OUTGOING,
+		PaymentHash: "sent",
+		AmountMsat:  1000,
+		Boostagram:  datatypes.JSON(`{"podcast":"Pod","value_msat_total":80000}`),
+		IsBoost:     true,
+	})
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	boostagrams, err := transactionsService.ListTopBoostagrams(ctx, 0, 0, 0)
+	assert.NoError(t, err)
+	require.Equal(t, 5, len(boostagrams))
+
+	assert.Equal(t, "large", boostagrams[0].PaymentHash)
+	require.NotNil(t, boostagrams[0].Boostagram)
+	assert.Equal(t, int64(50000), boostagrams[0].Boostagram.ValueMsatTotal)
+	// values sent as strings are ordered numerically
+	assert.Equal(t, "medium", boostagrams[1].PaymentHash)
+	require.NotNil(t, boostagrams[1].Boostagram)
+	assert.Equal(t, int64(20000), boostagrams[1].Boostagram.ValueMsatTotal)
+	assert.Equal(t, "123", boostagrams[1].Boostagram.FeedId.String())
+	assert.Equal(t, "small", boostagrams[2].PaymentHash)
+	// zero and missing values come last
+	assert.ElementsMatch(t, []string{"zero", "missing"}, []string{boostagrams[3].PaymentHash, boostagrams[4].PaymentHash})
+
+	boostagrams, err = transactionsService.ListTopBoostagrams(ctx, 0, 0, 2)
+	assert.NoError(t, err)
+	require.Equal(t, 2, len(boostagrams))
+	assert.Equal(t, "large", boostagrams[0].PaymentHash)
+	assert.Equal(t, "medium", boostagrams[1].PaymentHash)
+}
+
+func TestGetBoostagramStats(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	for paymentHash, boostagram := range map[string]string{
+		"alice-1":    `{"podcast":"Pod","feedID":123,"sender_id":"alice","value_msat_total":1000}`,
+		"alice-2":    `{"podcast":"Pod","feedID":"123","sender_id":"alice","value_msat_total":"2000"}`,
+		"bob":        `{"podcast":"Pod","feedID":"123","sender_id":42,"value_msat_total":5000}`,
+		"bob-string": `{"podcast":"Pod","feedID":123,"sender_id":"42","value_msat_total":3000}`,
+		"anonymous":  `{"podcast":"Pod","feedID":123,"value_msat_total":4000}`,
+		"other-feed": `{"podcast":"Other","feedID":456,"sender_id":"alice","value_msat_total":90000}`,
+		"no-feed":    `{"podcast":"Pod","sender_id":"carol","value_msat_total":80000}`,
+		"malformed":  `{"podcast":`,
+	} {
+		svc.DB.Create(&db.Transaction{
+			State:       constants.TRANSACTION_STATE_SETTLED,
+			Type:        constants.TRANSACTION_TYPE_INCOMING,
+			PaymentHash: paymentHash,
+			AmountMsat:  1000,
+			Boostagram:  datatypes.JSON(boostagram),
+			IsBoost:     isBoost([]byte(boostagram)),
+		})
+	}
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_PENDING,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		PaymentHash: "unpaid",
+		AmountMsat:  1000,
+		Boostagram:  datatypes.JSON(`{"podcast":"Pod","feedID":123,"sender_id":"dave","value_msat_total":70000}`),
+		IsBoost:     true,
+	})
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_OUTGOING,
+		PaymentHash: "sent",
+		AmountMsat:  1000,
+		Boostagram:  datatypes.JSON(`{"podcast":"Pod","feedID":123,"sender_id":"erin","value_msat_total":60000}`),
+		IsBoost:     true,
+	})
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	stats, err := transactionsService.GetBoostagramStats(ctx, "123", 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "123", stats.FeedId)
+	assert.Equal(t, int64(15000), stats.TotalValueMsat)
+	assert.Equal(t, uint64(5), stats.Count)
+	// alice boosted twice, and bob's id was sent as a number and as a string
+	assert.Equal(t, uint64(2), stats.UniqueSenders)
+
+	stats, err = transactionsService.GetBoostagramStats(ctx, "456", 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(90000), stats.TotalValueMsat)
+	assert.Equal(t, uint64(1), stats.Count)
+	assert.Equal(t, uint64(1), stats.UniqueSenders)
+
+	stats, err = transactionsService.GetBoostagramStats(ctx, "789", 0, 0)
+	require.NoError(t, err)
+	assert.Zero(t, stats.TotalValueMsat)
+	assert.Zero(t, stats.Count)
+	assert.Zero(t, stats.UniqueSenders)
+}
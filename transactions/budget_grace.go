@@ -0,0 +1,8 @@
+package transactions
+
+// SetBudgetGrace allows payments to exceed an app's budget by up to the given amount,
+// so rounding of msat amounts and fee reserve estimates does not deny payments right at the budget.
+// The grace is small, so the budget is still effectively enforced. Defaults to zero.
+func (svc *transactionsService) SetBudgetGrace(graceMsat uint64) {
+	svc.budgetGraceMsat = graceMsat
+}
@@ -0,0 +1,68 @@
+package transactions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendPaymentSync_BudgetGrace(t *testing.T) {
+	ctx := context.TODO()
+
+	// 123 sat invoice + 10 sat fee reserve
+	for name, testCase := range map[string]struct {
+		maxAmountSat    int
+		budgetGraceMsat uint64
+		expectedError   error
+	}{
+		"within budget": {
+			maxAmountSat: 133,
+		},
+		"over budget without grace": {
+			maxAmountSat:  132,
+			expectedError: NewQuotaExceededError(),
+		},
+		"over budget within grace": {
+			maxAmountSat:    132,
+			budgetGraceMsat: 1000,
+		},
+		"over budget beyond grace": {
+			maxAmountSat:    131,
+			budgetGraceMsat: 1000,
+			expectedError:   NewQuotaExceededError(),
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer tests.RemoveTestService()
+			svc, err := tests.CreateTestService()
+			require.NoError(t, err)
+
+			app, _, err := tests.CreateApp(svc)
+			require.NoError(t, err)
+			err = svc.DB.Create(&db.AppPermission{
+				AppId:        app.ID,
+				App:          *app,
+				Scope:        constants.PAY_INVOICE_SCOPE,
+				MaxAmountSat: testCase.maxAmountSat,
+			}).Error
+			require.NoError(t, err)
+
+			transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+			transactionsService.SetBudgetGrace(testCase.budgetGraceMsat)
+
+			transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, nil, SendPaymentOptions{})
+			if testCase.expectedError != nil {
+				assert.ErrorIs(t, err, testCase.expectedError)
+				assert.Nil(t, transaction)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transaction.State)
+		})
+	}
+}
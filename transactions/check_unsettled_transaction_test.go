@@ -95,3 +95,48 @@ func TestCheckUnsettledTransactions(t *testing.T) {
 	settledTransaction := mockEventConsumer.GetConsumedEvents()[0].Properties.(*db.Transaction)
 	assert.Equal(t, dbTransaction.ID, settledTransaction.ID)
 }
+
+func TestCheckUnsettledTransactions_MinFinalCltvExpiry(t *testing.T) {
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	// both payments are older than the default window of a day
+	highCltvTransaction := db.Transaction{
+		State:              constants.TRANSACTION_STATE_PENDING,
+		Type:               constants.TRANSACTION_TYPE_OUTGOING,
+		PaymentHash:        tests.MockLNClientTransaction.PaymentHash,
+		AmountMsat:         123000,
+		CreatedAt:          time.Now().Add(-48 * time.Hour),
+		MinFinalCltvExpiry: 432, // ~3 days
+	}
+	svc.DB.Create(&highCltvTransaction)
+	normalCltvTransaction := db.Transaction{
+		State:              constants.TRANSACTION_STATE_PENDING,
+		Type:               constants.TRANSACTION_TYPE_OUTGOING,
+		PaymentHash:        tests.MockLNClientTransaction.PaymentHash,
+		AmountMsat:         123000,
+		CreatedAt:          time.Now().Add(-48 * time.Hour),
+		MinFinalCltvExpiry: 40,
+	}
+	svc.DB.Create(&normalCltvTransaction)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	settledAt := time.Now().Unix()
+	svc.LNClient.(*tests.MockLn).MockTransaction = &lnclient.Transaction{
+		SettledAt: &settledAt,
+		Preimage:  "dummy",
+	}
+	svc.LNClient.(*tests.MockLn).SupportedNotificationTypes = &[]string{}
+
+	transactionsService.checkUnsettledTransactions(context.TODO(), svc.LNClient)
+
+	svc.DB.Find(&highCltvTransaction, db.Transaction{
+		ID: highCltvTransaction.ID,
+	})
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, highCltvTransaction.State)
+	svc.DB.Find(&normalCltvTransaction, db.Transaction{
+		ID: normalCltvTransaction.ID,
+	})
+	assert.Equal(t, constants.TRANSACTION_STATE_PENDING, normalCltvTransaction.State)
+}
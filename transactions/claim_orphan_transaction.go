@@ -0,0 +1,63 @@
+package transactions
+
+import (
+	"context"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/logger"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// ClaimOrphanTransaction assigns an incoming transaction that is not attributed to any app,
+// e.g. one received before an app was set up to claim it or with an unresolvable custom key,
+// to the given app. If the app is isolated the amount is added to its balance.
+func (svc *transactionsService) ClaimOrphanTransaction(ctx context.Context, paymentHash string, appId uint) error {
+	var app db.App
+	result := svc.db.Limit(1).Find(&app, &db.App{
+		ID: appId,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return NewNotFoundError()
+	}
+
+	return svc.inTransaction(func(tx *gorm.DB, balanceChanges *[]balanceChange) error {
+		var dbTransaction db.Transaction
+		result := tx.Unscoped().Limit(1).Where("split_from_id IS NULL").Find(&dbTransaction, &db.Transaction{
+			Type:        constants.TRANSACTION_TYPE_INCOMING,
+			PaymentHash: paymentHash,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return NewNotFoundError()
+		}
+		if dbTransaction.AppId != nil {
+			return NewTransactionAlreadyClaimedError()
+		}
+
+		// only claim the transaction if no other app claimed it in the meantime
+		result = tx.Unscoped().Model(&db.Transaction{}).Where("id = ? AND app_id IS NULL", dbTransaction.ID).Update("app_id", app.ID)
+		if result.Error != nil {
+			logger.Logger.WithError(result.Error).WithField("payment_hash", paymentHash).Error("Failed to claim orphan transaction")
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return NewTransactionAlreadyClaimedError()
+		}
+
+		dbTransaction.AppId = &app.ID
+		recordBalanceChange(balanceChanges, &dbTransaction, 0)
+
+		logger.Logger.WithFields(logrus.Fields{
+			"payment_hash": paymentHash,
+			"app_id":       app.ID,
+		}).Info("Claimed orphan transaction")
+		return nil
+	})
+}
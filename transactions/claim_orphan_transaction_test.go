@@ -0,0 +1,96 @@
+package transactions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/db/queries"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClaimOrphanTransaction_IsolatedApp(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+	app.Isolated = true
+	svc.DB.Save(&app)
+
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		PaymentHash: tests.MockLNClientTransaction.PaymentHash,
+		AmountMsat:  123000,
+	})
+	assert.Equal(t, uint64(0), queries.GetIsolatedBalance(svc.DB, app.ID))
+
+	mockEventConsumer := tests.NewMockEventConsumer()
+	svc.EventPublisher.RegisterSubscriber(mockEventConsumer)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	err = transactionsService.ClaimOrphanTransaction(ctx, tests.MockLNClientTransaction.PaymentHash, app.ID)
+	require.NoError(t, err)
+
+	var transaction db.Transaction
+	svc.DB.Find(&transaction, &db.Transaction{PaymentHash: tests.MockLNClientTransaction.PaymentHash})
+	require.NotNil(t, transaction.AppId)
+	assert.Equal(t, app.ID, *transaction.AppId)
+	assert.Equal(t, uint64(123000), queries.GetIsolatedBalance(svc.DB, app.ID))
+
+	balanceChangedEvents := getBalanceChangedEvents(mockEventConsumer.GetConsumedEvents())
+	require.Len(t, balanceChangedEvents, 1)
+	assert.Equal(t, int64(123000), balanceChangedEvents[0].Properties.(map[string]interface{})["delta_msat"])
+}
+
+func TestClaimOrphanTransaction_AlreadyClaimed(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+	otherApp, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		PaymentHash: tests.MockLNClientTransaction.PaymentHash,
+		AmountMsat:  123000,
+		AppId:       &otherApp.ID,
+	})
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	err = transactionsService.ClaimOrphanTransaction(ctx, tests.MockLNClientTransaction.PaymentHash, app.ID)
+	assert.ErrorIs(t, err, NewTransactionAlreadyClaimedError())
+
+	var transaction db.Transaction
+	svc.DB.Find(&transaction, &db.Transaction{PaymentHash: tests.MockLNClientTransaction.PaymentHash})
+	require.NotNil(t, transaction.AppId)
+	assert.Equal(t, otherApp.ID, *transaction.AppId)
+}
+
+func TestClaimOrphanTransaction_NotFound(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	err = transactionsService.ClaimOrphanTransaction(ctx, tests.MockLNClientTransaction.PaymentHash, app.ID)
+	assert.ErrorIs(t, err, NewNotFoundError())
+}
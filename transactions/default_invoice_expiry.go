@@ -0,0 +1,16 @@
+package transactions
+
+// SetDefaultInvoiceExpiry sets the expiry (in seconds) of invoices created without one, separately for
+// amountless invoices (e.g. donations, which can be paid days later) and fixed amount invoices
+// (e.g. at a point of sale, which are paid within minutes). 0 leaves the backend's default.
+func (svc *transactionsService) SetDefaultInvoiceExpiry(amountlessExpiry uint64, fixedAmountExpiry uint64) {
+	svc.amountlessInvoiceExpiry = amountlessExpiry
+	svc.fixedAmountInvoiceExpiry = fixedAmountExpiry
+}
+
+func (svc *transactionsService) getDefaultInvoiceExpiry(amount uint64) uint64 {
+	if amount == 0 {
+		return svc.amountlessInvoiceExpiry
+	}
+	return svc.fixedAmountInvoiceExpiry
+}
@@ -0,0 +1,60 @@
+package transactions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMakeInvoice_DefaultExpiry(t *testing.T) {
+	ctx := context.TODO()
+
+	for name, testCase := range map[string]struct {
+		amount                   uint64
+		expiry                   uint64
+		amountlessInvoiceExpiry  uint64
+		fixedAmountInvoiceExpiry uint64
+		expectedExpiry           int64
+	}{
+		"amountless": {
+			amount:                   0,
+			amountlessInvoiceExpiry:  3 * 24 * 60 * 60,
+			fixedAmountInvoiceExpiry: 10 * 60,
+			expectedExpiry:           3 * 24 * 60 * 60,
+		},
+		"fixed amount": {
+			amount:                   1234,
+			amountlessInvoiceExpiry:  3 * 24 * 60 * 60,
+			fixedAmountInvoiceExpiry: 10 * 60,
+			expectedExpiry:           10 * 60,
+		},
+		"expiry given": {
+			amount:                   1234,
+			expiry:                   60,
+			amountlessInvoiceExpiry:  3 * 24 * 60 * 60,
+			fixedAmountInvoiceExpiry: 10 * 60,
+			expectedExpiry:           60,
+		},
+		"no defaults": {
+			amount:         1234,
+			expectedExpiry: 0,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer tests.RemoveTestService()
+			svc, err := tests.CreateTestService()
+			require.NoError(t, err)
+
+			transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+			transactionsService.SetDefaultInvoiceExpiry(testCase.amountlessInvoiceExpiry, testCase.fixedAmountInvoiceExpiry)
+
+			_, err = transactionsService.MakeInvoice(ctx, testCase.amount, "Hello world", "", testCase.expiry, nil, svc.LNClient, nil, nil, "")
+			require.NoError(t, err)
+			// 0 lets the backend use its own default
+			assert.Equal(t, testCase.expectedExpiry, svc.LNClient.(*tests.MockLn).MakeInvoiceExpiry)
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package transactions
+
+import (
+	"cmp"
+	"encoding/json"
+	"slices"
+)
+
+// DescriptionExtractor produces a transaction description from the (hex-decoded) value
+// of a TLV record. ok is false if no description can be extracted from the record,
+// in which case the next record or extractor is tried.
+type DescriptionExtractor func(value []byte) (description string, ok bool)
+
+type descriptionExtractorRegistration struct {
+	tlvType  uint64
+	priority int
+	extract  DescriptionExtractor
+}
+
+// RegisterDescriptionExtractor adds an extractor for TLV records of the given type.
+// Extractors with a higher priority are tried first; extractors with the same priority
+// are tried in the order they were registered.
+// Extractors should be registered before payments are processed.
+func (svc *transactionsService) RegisterDescriptionExtractor(tlvType uint64, priority int, extract DescriptionExtractor) {
+	svc.descriptionExtractors = append(svc.descriptionExtractors, descriptionExtractorRegistration{
+		tlvType:  tlvType,
+		priority: priority,
+		extract:  extract,
+	})
+	slices.SortStableFunc(svc.descriptionExtractors, func(a, b descriptionExtractorRegistration) int {
+		return cmp.Compare(b.priority, a.priority)
+	})
+}
+
+func (svc *transactionsService) registerDefaultDescriptionExtractors() {
+	svc.RegisterDescriptionExtractor(BoostagramTlvType, 100, extractBoostagramDescription)
+	// TODO: consider adding support for this in LDK
+	svc.RegisterDescriptionExtractor(WhatsatTlvType, 0, extractWhatsatDescription)
+}
+
+func extractBoostagramDescription(value []byte) (string, bool) {
+	var boostagram Boostagram
+	if err := json.Unmarshal(value, &boostagram); err != nil {
+		return "", false
+	}
+	return boostagram.Message, true
+}
+
+func extractWhatsatDescription(value []byte) (string, bool) {
+	return string(value), true
+}
@@ -0,0 +1,78 @@
+package transactions
+
+import (
+	"context"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/getAlby/hub/lnclient"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const mockMessagingTlvType = 5482373484
+
+func TestGetDescriptionFromCustomRecords_Defaults(t *testing.T) {
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	whatsatRecord := lnclient.TLVRecord{Type: WhatsatTlvType, Value: hex.EncodeToString([]byte("whatsat message"))}
+	boostagramRecord := lnclient.TLVRecord{Type: BoostagramTlvType, Value: hex.EncodeToString([]byte(`{"message":"boostagram message"}`))}
+	malformedBoostagramRecord := lnclient.TLVRecord{Type: BoostagramTlvType, Value: hex.EncodeToString([]byte(`{"message":`))}
+
+	assert.Equal(t, "whatsat message", transactionsService.getDescriptionFromCustomRecords([]lnclient.TLVRecord{whatsatRecord}))
+	// boostagrams take priority regardless of record order
+	assert.Equal(t, "boostagram message", transactionsService.getDescriptionFromCustomRecords([]lnclient.TLVRecord{whatsatRecord, boostagramRecord}))
+	// malformed records fall through to the next extractor
+	assert.Equal(t, "whatsat message", transactionsService.getDescriptionFromCustomRecords([]lnclient.TLVRecord{malformedBoostagramRecord, whatsatRecord}))
+	assert.Equal(t, "", transactionsService.getDescriptionFromCustomRecords([]lnclient.TLVRecord{{Type: mockMessagingTlvType, Value: hex.EncodeToString([]byte("unknown"))}}))
+}
+
+func TestRegisterDescriptionExtractor(t *testing.T) {
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transactionsService.RegisterDescriptionExtractor(mockMessagingTlvType, 50, func(value []byte) (string, bool) {
+		message, ok := strings.CutPrefix(string(value), "msg:")
+		return message, ok
+	})
+
+	messagingRecord := lnclient.TLVRecord{Type: mockMessagingTlvType, Value: hex.EncodeToString([]byte("msg:hello"))}
+	invalidMessagingRecord := lnclient.TLVRecord{Type: mockMessagingTlvType, Value: hex.EncodeToString([]byte("hello"))}
+	whatsatRecord := lnclient.TLVRecord{Type: WhatsatTlvType, Value: hex.EncodeToString([]byte("whatsat message"))}
+	boostagramRecord := lnclient.TLVRecord{Type: BoostagramTlvType, Value: hex.EncodeToString([]byte(`{"message":"boostagram message"}`))}
+
+	assert.Equal(t, "hello", transactionsService.getDescriptionFromCustomRecords([]lnclient.TLVRecord{messagingRecord}))
+	// tried after boostagrams but before whatsat messages
+	assert.Equal(t, "hello", transactionsService.getDescriptionFromCustomRecords([]lnclient.TLVRecord{whatsatRecord, messagingRecord}))
+	assert.Equal(t, "boostagram message", transactionsService.getDescriptionFromCustomRecords([]lnclient.TLVRecord{messagingRecord, boostagramRecord}))
+	assert.Equal(t, "whatsat message", transactionsService.getDescriptionFromCustomRecords([]lnclient.TLVRecord{invalidMessagingRecord, whatsatRecord}))
+}
+
+func TestSendKeysend_CustomDescriptionExtractor(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transactionsService.RegisterDescriptionExtractor(mockMessagingTlvType, 200, func(value []byte) (string, bool) {
+		return strings.ToUpper(string(value)), true
+	})
+
+	customRecords := []lnclient.TLVRecord{
+		{Type: BoostagramTlvType, Value: hex.EncodeToString([]byte(`{"message":"boostagram message"}`))},
+		{Type: mockMessagingTlvType, Value: hex.EncodeToString([]byte("hello"))},
+	}
+	transaction, err := transactionsService.SendKeysend(ctx, uint64(1000), mockKeysendDestination, customRecords, "", "", svc.LNClient, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "HELLO", transaction.Description)
+}
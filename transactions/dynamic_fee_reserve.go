@@ -0,0 +1,67 @@
+package transactions
+
+import (
+	"math"
+
+	"github.com/getAlby/hub/db/queries"
+	"github.com/getAlby/hub/logger"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// payees need at least this many settled or failed payments before their history is used
+	dynamicFeeReserveMinPayments = 3
+	// payees with at least this success rate get a fee reserve based on the fees previously paid to them
+	dynamicFeeReserveReliableSuccessRate = 0.9
+	// payees with a success rate below this get a larger fee reserve, as payments to them
+	// often need more expensive routes
+	dynamicFeeReserveUnreliableSuccessRate = 0.5
+	// the highest fee previously paid to a reliable payee is multiplied by this to leave room for fee changes
+	dynamicFeeReserveFeeMultiplier = 2
+	// the static fee reserve is multiplied by this for unreliable payees
+	dynamicFeeReserveUnreliableMultiplier = 2
+)
+
+// SetDynamicFeeReserve sets whether the fee reserve of payments is adjusted based on
+// previous payments to the same payee. Disabled by default.
+func (svc *transactionsService) SetDynamicFeeReserve(enabled bool) {
+	svc.dynamicFeeReserve = enabled
+}
+
+// adjustFeeReserveMsat adjusts the static fee reserve of a payment based on previous payments to the payee:
+// it is lowered for reliable payees, down to twice the highest fee paid to them before but never below
+// minFeeReserveMsat, and raised for unreliable payees.
+// The static fee reserve is kept if there are not enough previous payments.
+func (svc *transactionsService) adjustFeeReserveMsat(amount uint64, payee string, staticFeeReserveMsat uint64, minFeeReserveMsat uint64) uint64 {
+	settledCount, failedCount, err := queries.GetPayeeOutcomeCounts(svc.db, payee, true)
+	if err != nil {
+		logger.Logger.WithError(err).WithField("payee", payee).Error("Failed to get payee outcome counts for fee reserve")
+		return staticFeeReserveMsat
+	}
+	if settledCount+failedCount < dynamicFeeReserveMinPayments {
+		return staticFeeReserveMsat
+	}
+
+	successRate := float64(settledCount) / float64(settledCount+failedCount)
+	feeReserveMsat := staticFeeReserveMsat
+	switch {
+	case successRate >= dynamicFeeReserveReliableSuccessRate:
+		maxFeeRatio, err := queries.GetPayeeMaxFeeRatio(svc.db, payee)
+		if err != nil {
+			logger.Logger.WithError(err).WithField("payee", payee).Error("Failed to get payee fee history for fee reserve")
+			return staticFeeReserveMsat
+		}
+		feeReserveMsat = uint64(math.Ceil(float64(amount) * maxFeeRatio * dynamicFeeReserveFeeMultiplier))
+		feeReserveMsat = min(max(feeReserveMsat, minFeeReserveMsat), staticFeeReserveMsat)
+	case successRate < dynamicFeeReserveUnreliableSuccessRate:
+		feeReserveMsat = staticFeeReserveMsat * dynamicFeeReserveUnreliableMultiplier
+	}
+
+	logger.Logger.WithFields(logrus.Fields{
+		"payee":                   payee,
+		"success_rate":            successRate,
+		"static_fee_reserve_msat": staticFeeReserveMsat,
+		"fee_reserve_msat":        feeReserveMsat,
+	}).Debug("Adjusted fee reserve based on payee history")
+	return feeReserveMsat
+}
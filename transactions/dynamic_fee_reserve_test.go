@@ -0,0 +1,83 @@
+package transactions
+
+import (
+	"testing"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createPayeeHistory(svc *tests.TestService, states ...string) {
+	for _, state := range states {
+		svc.DB.Create(&db.Transaction{
+			State:       state,
+			Type:        constants.TRANSACTION_TYPE_OUTGOING,
+			PayeePubkey: mockPayee,
+			AmountMsat:  1_000_000,
+			FeeMsat:     1_000,
+		})
+	}
+}
+
+func TestCalculateFeeReserveMsat_NoHistory(t *testing.T) {
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transactionsService.SetDynamicFeeReserve(true)
+
+	// 1% of the amount
+	assert.Equal(t, uint64(100_000), transactionsService.calculateFeeReserveMsat(10_000_000, mockPayee, nil, svc.LNClient))
+	// minimum fee reserve
+	assert.Equal(t, uint64(constants.DEFAULT_MIN_FEE_RESERVE_MSAT), transactionsService.calculateFeeReserveMsat(10_000, mockPayee, nil, svc.LNClient))
+}
+
+func TestCalculateFeeReserveMsat_ReliablePayee(t *testing.T) {
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	createPayeeHistory(svc, constants.TRANSACTION_STATE_SETTLED, constants.TRANSACTION_STATE_SETTLED, constants.TRANSACTION_STATE_SETTLED)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	// static fee reserve unless enabled
+	assert.Equal(t, uint64(100_000), transactionsService.calculateFeeReserveMsat(10_000_000, mockPayee, nil, svc.LNClient))
+
+	transactionsService.SetDynamicFeeReserve(true)
+	// twice the highest fee previously paid (0.1%)
+	assert.Equal(t, uint64(20_000), transactionsService.calculateFeeReserveMsat(10_000_000, mockPayee, nil, svc.LNClient))
+	// never below the minimum fee reserve
+	assert.Equal(t, uint64(constants.DEFAULT_MIN_FEE_RESERVE_MSAT), transactionsService.calculateFeeReserveMsat(1_000_000, mockPayee, nil, svc.LNClient))
+	// other payees use the static fee reserve
+	assert.Equal(t, uint64(100_000), transactionsService.calculateFeeReserveMsat(10_000_000, "other payee", nil, svc.LNClient))
+}
+
+func TestCalculateFeeReserveMsat_UnreliablePayee(t *testing.T) {
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	createPayeeHistory(svc, constants.TRANSACTION_STATE_SETTLED, constants.TRANSACTION_STATE_FAILED, constants.TRANSACTION_STATE_FAILED)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transactionsService.SetDynamicFeeReserve(true)
+
+	assert.Equal(t, uint64(200_000), transactionsService.calculateFeeReserveMsat(10_000_000, mockPayee, nil, svc.LNClient))
+}
+
+func TestCalculateFeeReserveMsat_NotEnoughHistory(t *testing.T) {
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	createPayeeHistory(svc, constants.TRANSACTION_STATE_FAILED, constants.TRANSACTION_STATE_FAILED)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transactionsService.SetDynamicFeeReserve(true)
+
+	assert.Equal(t, uint64(100_000), transactionsService.calculateFeeReserveMsat(10_000_000, mockPayee, nil, svc.LNClient))
+}
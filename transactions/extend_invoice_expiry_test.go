@@ -0,0 +1,143 @@
+package transactions
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+func TestExtendInvoiceExpiry(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	expiresAt := time.Now().Add(time.Minute)
+	original := &db.Transaction{
+		State:       constants.TRANSACTION_STATE_PENDING,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		PaymentHash: "originalhash",
+		AmountMsat:  1000,
+		Description: "original description",
+		ExpiresAt:   &expiresAt,
+		Metadata:    datatypes.JSON(`{"order":42}`),
+	}
+	svc.DB.Create(original)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.ExtendInvoiceExpiry(ctx, "originalhash", 3600, svc.LNClient, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, original.ID, *transaction.ReissuedFromId)
+	assert.Equal(t, tests.MockLNClientTransaction.PaymentHash, transaction.PaymentHash)
+	assert.Equal(t, constants.TRANSACTION_STATE_PENDING, transaction.State)
+	assert.Equal(t, "original description", transaction.Description)
+	assert.Equal(t, datatypes.JSON(`{"order":42}`), transaction.Metadata)
+
+	// the original invoice is left untouched
+	var originalTransaction db.Transaction
+	svc.DB.First(&originalTransaction, original.ID)
+	assert.Equal(t, constants.TRANSACTION_STATE_PENDING, originalTransaction.State)
+	assert.Nil(t, originalTransaction.ReissuedFromId)
+}
+
+func TestExtendInvoiceExpiry_WithinGracePeriod(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	expiresAt := time.Now().Add(-time.Minute)
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_PENDING,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		PaymentHash: "originalhash",
+		AmountMsat:  1000,
+		ExpiresAt:   &expiresAt,
+	})
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.ExtendInvoiceExpiry(ctx, "originalhash", 3600, svc.LNClient, nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, transaction)
+}
+
+func TestExtendInvoiceExpiry_ExpiredBeyondGracePeriod(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	expiresAt := time.Now().Add(-time.Hour)
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_PENDING,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		PaymentHash: "originalhash",
+		AmountMsat:  1000,
+		ExpiresAt:   &expiresAt,
+	})
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.ExtendInvoiceExpiry(ctx, "originalhash", 3600, svc.LNClient, nil)
+	assert.EqualError(t, err, "invoice expired too long ago to be extended")
+	assert.Nil(t, transaction)
+}
+
+func TestExtendInvoiceExpiry_NotPending(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		PaymentHash: "originalhash",
+		AmountMsat:  1000,
+	})
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.ExtendInvoiceExpiry(ctx, "originalhash", 3600, svc.LNClient, nil)
+	assert.EqualError(t, err, "cannot extend invoice in state SETTLED")
+	assert.Nil(t, transaction)
+}
+
+func TestExtendInvoiceExpiry_OtherApp(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	assert.NoError(t, err)
+	otherApp, _, err := tests.CreateApp(svc)
+	assert.NoError(t, err)
+
+	svc.DB.Create(&db.Transaction{
+		AppId:       &otherApp.ID,
+		State:       constants.TRANSACTION_STATE_PENDING,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		PaymentHash: "originalhash",
+		AmountMsat:  1000,
+	})
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.ExtendInvoiceExpiry(ctx, "originalhash", 3600, svc.LNClient, &app.ID)
+	assert.ErrorIs(t, err, NewNotFoundError())
+	assert.Nil(t, transaction)
+
+	transaction, err = transactionsService.ExtendInvoiceExpiry(ctx, "originalhash", 3600, svc.LNClient, &otherApp.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, otherApp.ID, *transaction.AppId)
+}
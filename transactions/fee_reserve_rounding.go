@@ -0,0 +1,31 @@
+package transactions
+
+import "math"
+
+// FeeReserveRounding is how the percentage fee reserve of a payment is rounded to a whole msat
+type FeeReserveRounding string
+
+const (
+	// round up, so the reserve is never below the percentage. This is the default.
+	FeeReserveRoundingCeil FeeReserveRounding = "ceil"
+	// round down, to not over-reserve on backends which charge fees with msat precision
+	FeeReserveRoundingFloor FeeReserveRounding = "floor"
+	// round to the nearest msat, with halves rounded up
+	FeeReserveRoundingNearest FeeReserveRounding = "nearest"
+)
+
+// SetFeeReserveRounding sets how the percentage fee reserve of payments is rounded
+func (svc *transactionsService) SetFeeReserveRounding(rounding FeeReserveRounding) {
+	svc.feeReserveRounding = rounding
+}
+
+func roundFeeReserveMsat(feeReserveMsat float64, rounding FeeReserveRounding) float64 {
+	switch rounding {
+	case FeeReserveRoundingFloor:
+		return math.Floor(feeReserveMsat)
+	case FeeReserveRoundingNearest:
+		return math.Round(feeReserveMsat)
+	default:
+		return math.Ceil(feeReserveMsat)
+	}
+}
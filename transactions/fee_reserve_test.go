@@ -0,0 +1,131 @@
+package transactions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetFeeReserve_Default(t *testing.T) {
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	// 1% of the amount
+	assert.Equal(t, uint64(100_000), transactionsService.GetFeeReserve(10_000_000, "", nil, svc.LNClient))
+	assert.Equal(t, uint64(100_000), transactionsService.GetFeeReserve(10_000_000, "", &app.ID, svc.LNClient))
+	// minimum fee reserve
+	assert.Equal(t, uint64(constants.DEFAULT_MIN_FEE_RESERVE_MSAT), transactionsService.GetFeeReserve(123_000, "", nil, svc.LNClient))
+	assert.Equal(t, uint64(constants.DEFAULT_MIN_FEE_RESERVE_MSAT), transactionsService.GetFeeReserve(123_000, "", &app.ID, svc.LNClient))
+}
+
+func TestGetFeeReserve_AppOverride(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+	app.Isolated = true
+	app.MinFeeReserveMsat = 50_000
+	svc.DB.Save(&app)
+
+	err = svc.DB.Create(&db.AppPermission{
+		AppId: app.ID,
+		App:   *app,
+		Scope: constants.PAY_INVOICE_SCOPE,
+	}).Error
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	assert.Equal(t, uint64(50_000), transactionsService.GetFeeReserve(123_000, "", &app.ID, svc.LNClient))
+	// 1% is still used if it is higher
+	assert.Equal(t, uint64(100_000), transactionsService.GetFeeReserve(10_000_000, "", &app.ID, svc.LNClient))
+	// other payments are not affected
+	assert.Equal(t, uint64(constants.DEFAULT_MIN_FEE_RESERVE_MSAT), transactionsService.GetFeeReserve(123_000, "", nil, svc.LNClient))
+
+	// the balance covers the invoice with the default fee reserve, but not with the app's
+	svc.DB.Create(&db.Transaction{
+		AppId:      &app.ID,
+		State:      constants.TRANSACTION_STATE_SETTLED,
+		Type:       constants.TRANSACTION_TYPE_INCOMING,
+		AmountMsat: 133_000,
+	})
+	dbRequestEvent := &db.RequestEvent{}
+	require.NoError(t, svc.DB.Create(&dbRequestEvent).Error)
+
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID, SendPaymentOptions{})
+	assert.ErrorIs(t, err, NewInsufficientBalanceError())
+	assert.Nil(t, transaction)
+}
+
+func TestGetFeeReserve_Rounding(t *testing.T) {
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	// amounts over 1_000_000 msat, so 1% is above the minimum fee reserve
+	for name, testCase := range map[string]struct {
+		rounding         FeeReserveRounding
+		exactFeeReserve  uint64
+		belowHalfReserve uint64
+		halfFeeReserve   uint64
+		aboveHalfReserve uint64
+	}{
+		"ceil": {
+			rounding:         FeeReserveRoundingCeil,
+			exactFeeReserve:  10_000,
+			belowHalfReserve: 10_001,
+			halfFeeReserve:   10_001,
+			aboveHalfReserve: 10_001,
+		},
+		"floor": {
+			rounding:         FeeReserveRoundingFloor,
+			exactFeeReserve:  10_000,
+			belowHalfReserve: 10_000,
+			halfFeeReserve:   10_000,
+			aboveHalfReserve: 10_000,
+		},
+		"nearest": {
+			rounding:         FeeReserveRoundingNearest,
+			exactFeeReserve:  10_000,
+			belowHalfReserve: 10_000,
+			halfFeeReserve:   10_001,
+			aboveHalfReserve: 10_001,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+			transactionsService.SetFeeReserveRounding(testCase.rounding)
+
+			assert.Equal(t, testCase.exactFeeReserve, transactionsService.GetFeeReserve(1_000_000, "", nil, svc.LNClient))
+			assert.Equal(t, testCase.belowHalfReserve, transactionsService.GetFeeReserve(1_000_049, "", nil, svc.LNClient))
+			assert.Equal(t, testCase.halfFeeReserve, transactionsService.GetFeeReserve(1_000_050, "", nil, svc.LNClient))
+			assert.Equal(t, testCase.aboveHalfReserve, transactionsService.GetFeeReserve(1_000_099, "", nil, svc.LNClient))
+			// the minimum fee reserve still applies
+			assert.Equal(t, uint64(constants.DEFAULT_MIN_FEE_RESERVE_MSAT), transactionsService.GetFeeReserve(123_000, "", nil, svc.LNClient))
+		})
+	}
+}
+
+func TestGetFeeReserve_DefaultRoundingIsCeil(t *testing.T) {
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	assert.Equal(t, uint64(10_001), transactionsService.GetFeeReserve(1_000_001, "", nil, svc.LNClient))
+}
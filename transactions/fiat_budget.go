@@ -0,0 +1,81 @@
+package transactions
+
+import (
+	"context"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// PriceSource provides the current price of one bitcoin in a fiat currency (e.g. "USD")
+type PriceSource interface {
+	GetBitcoinPrice(ctx context.Context, currency string) (float64, error)
+}
+
+// how long to wait for the price source before falling back to the last known price
+const priceSourceTimeout = 5 * time.Second
+
+// bitcoinPriceCache keeps the last price received for each currency
+type bitcoinPriceCache struct {
+	mu     sync.Mutex
+	prices map[string]float64
+}
+
+// SetPriceSource sets the price source used to convert fiat budgets to sats.
+// Without a price source, fiat budgets cannot be enforced and payments from apps with one are rejected.
+func (svc *transactionsService) SetPriceSource(priceSource PriceSource) {
+	svc.priceSource = priceSource
+}
+
+// applyFiatBudget sets the sat budget of a permission with a fiat budget from the current price,
+// so it is enforced like any other budget. The permission is not saved.
+func (svc *transactionsService) applyFiatBudget(appPermission *db.AppPermission) error {
+	if appPermission.MaxAmountFiat <= 0 {
+		return nil
+	}
+
+	price, err := svc.getBitcoinPrice(appPermission.FiatCurrency)
+	if err != nil {
+		return err
+	}
+
+	// a budget worth less than 1 sat still allows nothing to be spent, as 0 would mean no limit
+	appPermission.MaxAmountSat = max(int(math.Floor(appPermission.MaxAmountFiat/price*1e8)), 1)
+	return nil
+}
+
+// getBitcoinPrice returns the current price from the price source,
+// or the last known price if the price source is unavailable
+func (svc *transactionsService) getBitcoinPrice(currency string) (float64, error) {
+	currency = strings.ToUpper(currency)
+	cache := svc.bitcoinPriceCache
+
+	if svc.priceSource != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), priceSourceTimeout)
+		defer cancel()
+		price, err := svc.priceSource.GetBitcoinPrice(ctx, currency)
+		if err == nil && price > 0 {
+			cache.mu.Lock()
+			cache.prices[currency] = price
+			cache.mu.Unlock()
+			return price, nil
+		}
+		logger.Logger.WithFields(logrus.Fields{
+			"currency": currency,
+			"price":    price,
+		}).WithError(err).Warn("Failed to fetch bitcoin price, falling back to last known price")
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	price, ok := cache.prices[currency]
+	if !ok {
+		return 0, NewPriceUnavailableError()
+	}
+	return price, nil
+}
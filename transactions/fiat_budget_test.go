@@ -0,0 +1,149 @@
+package transactions
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockPriceSource struct {
+	prices map[string]float64
+	err    error
+}
+
+func (priceSource *mockPriceSource) GetBitcoinPrice(ctx context.Context, currency string) (float64, error) {
+	if priceSource.err != nil {
+		return 0, priceSource.err
+	}
+	return priceSource.prices[currency], nil
+}
+
+func TestSendPaymentSync_App_FiatBudget(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	// $0.10 at $50,000 per bitcoin is 200 sats
+	app, err := tests.CreateAppWithPermissions(svc, &db.AppPermission{
+		Scope:         constants.PAY_INVOICE_SCOPE,
+		BudgetRenewal: constants.BUDGET_RENEWAL_MONTHLY,
+		MaxAmountFiat: 0.10,
+		FiatCurrency:  "usd",
+	})
+	require.NoError(t, err)
+
+	dbRequestEvent := &db.RequestEvent{}
+	err = svc.DB.Create(dbRequestEvent).Error
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transactionsService.SetPriceSource(&mockPriceSource{prices: map[string]float64{"USD": 50_000}})
+
+	// 123 sat invoice + 10 sat fee reserve
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID, SendPaymentOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transaction.State)
+}
+
+func TestSendPaymentSync_App_FiatBudgetExceeded(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	// $0.05 at $50,000 per bitcoin is 100 sats
+	app, err := tests.CreateAppWithPermissions(svc, &db.AppPermission{
+		Scope:         constants.PAY_INVOICE_SCOPE,
+		BudgetRenewal: constants.BUDGET_RENEWAL_MONTHLY,
+		MaxAmountFiat: 0.05,
+		FiatCurrency:  "usd",
+	})
+	require.NoError(t, err)
+
+	dbRequestEvent := &db.RequestEvent{}
+	err = svc.DB.Create(dbRequestEvent).Error
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transactionsService.SetPriceSource(&mockPriceSource{prices: map[string]float64{"USD": 50_000}})
+
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID, SendPaymentOptions{})
+	assert.ErrorIs(t, err, NewQuotaExceededError())
+	assert.Contains(t, err.Error(), "requested 133 sat (133000 msat), only 100 sat (100000 msat) remaining")
+	assert.Nil(t, transaction)
+}
+
+func TestSendPaymentSync_App_FiatBudget_PriceSourceUnavailable(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	// $0.05 is 100 sats at $50,000 per bitcoin and 1000 sats at $5,000 per bitcoin
+	app, err := tests.CreateAppWithPermissions(svc, &db.AppPermission{
+		Scope:         constants.PAY_INVOICE_SCOPE,
+		BudgetRenewal: constants.BUDGET_RENEWAL_MONTHLY,
+		MaxAmountFiat: 0.05,
+		FiatCurrency:  "usd",
+	})
+	require.NoError(t, err)
+
+	dbRequestEvent := &db.RequestEvent{}
+	err = svc.DB.Create(dbRequestEvent).Error
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	priceSource := &mockPriceSource{prices: map[string]float64{"USD": 50_000}}
+	transactionsService.SetPriceSource(priceSource)
+
+	_, err = transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID, SendPaymentOptions{})
+	assert.ErrorIs(t, err, NewQuotaExceededError())
+
+	// the last known price is used while the price source is unavailable
+	priceSource.prices["USD"] = 5_000
+	priceSource.err = errors.New("price source unavailable")
+	_, err = transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID, SendPaymentOptions{})
+	assert.ErrorIs(t, err, NewQuotaExceededError())
+
+	priceSource.err = nil
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID, SendPaymentOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transaction.State)
+}
+
+func TestSendPaymentSync_App_FiatBudget_NoKnownPrice(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, err := tests.CreateAppWithPermissions(svc, &db.AppPermission{
+		Scope:         constants.PAY_INVOICE_SCOPE,
+		BudgetRenewal: constants.BUDGET_RENEWAL_MONTHLY,
+		MaxAmountFiat: 10,
+		FiatCurrency:  "usd",
+	})
+	require.NoError(t, err)
+
+	dbRequestEvent := &db.RequestEvent{}
+	err = svc.DB.Create(dbRequestEvent).Error
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transactionsService.SetPriceSource(&mockPriceSource{err: errors.New("price source unavailable")})
+
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID, SendPaymentOptions{})
+	assert.ErrorIs(t, err, NewPriceUnavailableError())
+	assert.Nil(t, transaction)
+}
@@ -0,0 +1,120 @@
+package transactions
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/lnclient"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForceFailPayment(t *testing.T) {
+	ctx := context.TODO()
+
+	testCases := []struct {
+		paymentStatus lnclient.PaymentStatus
+		expectedError string
+	}{
+		{paymentStatus: lnclient.PAYMENT_STATUS_FAILED},
+		{paymentStatus: lnclient.PAYMENT_STATUS_NOT_FOUND},
+		{paymentStatus: lnclient.PAYMENT_STATUS_PENDING, expectedError: NewPaymentInFlightError().Error()},
+		{paymentStatus: lnclient.PAYMENT_STATUS_SUCCEEDED, expectedError: "the payment succeeded and cannot be marked as failed"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(string(testCase.paymentStatus), func(t *testing.T) {
+			defer tests.RemoveTestService()
+			svc, err := tests.CreateTestService()
+			require.NoError(t, err)
+
+			svc.LNClient.(*tests.MockLn).PaymentStatus = testCase.paymentStatus
+
+			dbTransaction := createPendingPayment(svc)
+
+			transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+			err = transactionsService.ForceFailPayment(ctx, dbTransaction.ID, "confirmed failed with LSP", svc.LNClient)
+
+			var transaction db.Transaction
+			svc.DB.First(&transaction, dbTransaction.ID)
+
+			if testCase.expectedError != "" {
+				assert.EqualError(t, err, testCase.expectedError)
+				assert.Equal(t, constants.TRANSACTION_STATE_PENDING, transaction.State)
+				assert.Equal(t, uint64(10000), transaction.FeeReserveMsat)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, constants.TRANSACTION_STATE_FAILED, transaction.State)
+			assert.Equal(t, "confirmed failed with LSP", transaction.FailureReason)
+			assert.Zero(t, transaction.FeeReserveMsat)
+		})
+	}
+}
+
+func TestForceFailPayment_LookupError(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	svc.LNClient.(*tests.MockLn).LookupPaymentError = errors.New("not supported")
+
+	dbTransaction := createPendingPayment(svc)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	err = transactionsService.ForceFailPayment(ctx, dbTransaction.ID, "confirmed failed with LSP", svc.LNClient)
+	assert.EqualError(t, err, "not supported")
+
+	var transaction db.Transaction
+	svc.DB.First(&transaction, dbTransaction.ID)
+	assert.Equal(t, constants.TRANSACTION_STATE_PENDING, transaction.State)
+}
+
+func TestForceFailPayment_NotPending(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	svc.LNClient.(*tests.MockLn).PaymentStatus = lnclient.PAYMENT_STATUS_FAILED
+
+	dbTransaction := createPendingPayment(svc)
+	svc.DB.Model(&dbTransaction).Update("state", constants.TRANSACTION_STATE_SETTLED)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	err = transactionsService.ForceFailPayment(ctx, dbTransaction.ID, "confirmed failed with LSP", svc.LNClient)
+	assert.EqualError(t, err, "cannot fail payment in state SETTLED")
+}
+
+func TestForceFailPayment_NotFound(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	err = transactionsService.ForceFailPayment(ctx, 1, "confirmed failed with LSP", svc.LNClient)
+	assert.ErrorIs(t, err, NewNotFoundError())
+}
+
+func createPendingPayment(svc *tests.TestService) db.Transaction {
+	dbTransaction := db.Transaction{
+		Type:           constants.TRANSACTION_TYPE_OUTGOING,
+		State:          constants.TRANSACTION_STATE_PENDING,
+		PaymentRequest: tests.MockInvoice,
+		PaymentHash:    tests.MockPaymentHash,
+		AmountMsat:     123000,
+		FeeReserveMsat: 10000,
+	}
+	svc.DB.Create(&dbTransaction)
+	return dbTransaction
+}
@@ -0,0 +1,49 @@
+package transactions
+
+import (
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/events"
+	"github.com/getAlby/hub/logger"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// validateInFlightPayments limits how many outgoing payments an app can have pending at once,
+// so a single app cannot tie up the node with many simultaneous HTLCs.
+// The count and the new pending payment are written in the same (immediate) DB transaction,
+// so concurrent payments cannot exceed the limit.
+func (svc *transactionsService) validateInFlightPayments(tx *gorm.DB, app *db.App) error {
+	if app.MaxInFlightPayments == 0 {
+		return nil
+	}
+
+	var inFlightCount int64
+	err := tx.Model(&db.Transaction{}).
+		Where("app_id = ? AND type = ? AND state = ?", app.ID, constants.TRANSACTION_TYPE_OUTGOING, constants.TRANSACTION_STATE_PENDING).
+		Count(&inFlightCount).Error
+	if err != nil {
+		logger.Logger.WithError(err).Error("Failed to count in-flight payments")
+		return err
+	}
+
+	if inFlightCount >= int64(app.MaxInFlightPayments) {
+		logger.Logger.WithFields(logrus.Fields{
+			"app_id":    app.ID,
+			"limit":     app.MaxInFlightPayments,
+			"in_flight": inFlightCount,
+		}).Warn("App exceeded in-flight payment limit")
+		svc.eventPublisher.Publish(&events.Event{
+			Event: "nwc_permission_denied",
+			Properties: map[string]interface{}{
+				"app_id":   app.ID,
+				"app_name": app.Name,
+				"code":     constants.ERROR_RATE_LIMITED,
+				"message":  NewTooManyInFlightPaymentsError().Error(),
+			},
+		})
+		return NewTooManyInFlightPaymentsError()
+	}
+
+	return nil
+}
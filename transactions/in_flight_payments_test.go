@@ -0,0 +1,94 @@
+package transactions
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendPaymentSync_MaxInFlightPayments(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, err := tests.CreateAppWithPermissions(svc, &db.AppPermission{Scope: constants.PAY_INVOICE_SCOPE})
+	require.NoError(t, err)
+	app.MaxInFlightPayments = 2
+	require.NoError(t, svc.DB.Save(app).Error)
+
+	// keep payments in flight while the others are attempted
+	svc.LNClient.(*tests.MockLn).PayInvoiceDelay = 500 * time.Millisecond
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	const paymentCount = 5
+	errs := make([]error, paymentCount)
+	var wg sync.WaitGroup
+	for i := 0; i < paymentCount; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, nil, SendPaymentOptions{})
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		if err == nil {
+			succeeded++
+			continue
+		}
+		assert.ErrorIs(t, err, NewTooManyInFlightPaymentsError())
+	}
+	assert.Equal(t, 2, succeeded)
+
+	// only the allowed payments were recorded
+	var count int64
+	svc.DB.Model(&db.Transaction{}).Count(&count)
+	assert.Equal(t, int64(2), count)
+
+	// payments can be made again once the in-flight payments completed
+	transaction, err := transactionsService.SendKeysend(ctx, 1000, mockPayee, nil, "", "", svc.LNClient, &app.ID, nil)
+	require.NoError(t, err)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transaction.State)
+}
+
+func TestSendPaymentSync_MaxInFlightPaymentsUnlimited(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, err := tests.CreateAppWithPermissions(svc, &db.AppPermission{Scope: constants.PAY_INVOICE_SCOPE})
+	require.NoError(t, err)
+	svc.LNClient.(*tests.MockLn).PayInvoiceDelay = 200 * time.Millisecond
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	const paymentCount = 5
+	errs := make([]error, paymentCount)
+	var wg sync.WaitGroup
+	for i := 0; i < paymentCount; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, nil, SendPaymentOptions{})
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+}
@@ -0,0 +1,69 @@
+package transactions
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/getAlby/hub/constants"
+)
+
+// kind of the nostr event of a zap request (NIP-57), which zap invoices use as their description
+const zapRequestEventKind = 9734
+
+// the incoming kind of a transaction, which must match GetIncomingKind. json_extract fails on malformed JSON
+var incomingKindColumn = fmt.Sprintf(`CASE
+	WHEN is_boost THEN '%s'
+	WHEN json_valid(description) AND json_type(description) == 'object' AND json_extract(description, '$.kind') == %d THEN '%s'
+	WHEN payment_request IS NULL OR payment_request == '' THEN '%s'
+	WHEN json_valid(description) AND json_type(description) == 'array' THEN '%s'
+	ELSE '%s'
+END`,
+	constants.TRANSACTION_INCOMING_KIND_BOOST,
+	zapRequestEventKind, constants.TRANSACTION_INCOMING_KIND_ZAP,
+	constants.TRANSACTION_INCOMING_KIND_KEYSEND,
+	constants.TRANSACTION_INCOMING_KIND_LNURL,
+	constants.TRANSACTION_INCOMING_KIND_INVOICE)
+
+// GetIncomingKind categorizes a received payment: a boost (see isBoost), a zap (paying a NIP-57
+// zap request), a keysend payment, an LNURL payment (whose invoice commits to LNURL metadata) or a plain invoice.
+// Returns an empty string for outgoing transactions.
+func GetIncomingKind(transaction *Transaction) string {
+	if transaction.Type != constants.TRANSACTION_TYPE_INCOMING {
+		return ""
+	}
+
+	if transaction.IsBoost {
+		return constants.TRANSACTION_INCOMING_KIND_BOOST
+	}
+
+	var zapRequest struct {
+		Kind int `json:"kind"`
+	}
+	if json.Unmarshal([]byte(transaction.Description), &zapRequest) == nil && zapRequest.Kind == zapRequestEventKind {
+		return constants.TRANSACTION_INCOMING_KIND_ZAP
+	}
+
+	if transaction.PaymentRequest == "" {
+		return constants.TRANSACTION_INCOMING_KIND_KEYSEND
+	}
+
+	// LNURL-pay invoices describe the payment with the LNURL metadata, a JSON array (LUD-06)
+	var lnurlMetadata []interface{}
+	if json.Unmarshal([]byte(transaction.Description), &lnurlMetadata) == nil && lnurlMetadata != nil {
+		return constants.TRANSACTION_INCOMING_KIND_LNURL
+	}
+
+	return constants.TRANSACTION_INCOMING_KIND_INVOICE
+}
+
+func isValidIncomingKind(incomingKind string) bool {
+	switch incomingKind {
+	case constants.TRANSACTION_INCOMING_KIND_BOOST,
+		constants.TRANSACTION_INCOMING_KIND_ZAP,
+		constants.TRANSACTION_INCOMING_KIND_KEYSEND,
+		constants.TRANSACTION_INCOMING_KIND_LNURL,
+		constants.TRANSACTION_INCOMING_KIND_INVOICE:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package transactions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+func TestGetIncomingKind(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	incomingTransactions := map[string]db.Transaction{
+		constants.TRANSACTION_INCOMING_KIND_BOOST: {
+			Boostagram: datatypes.JSON(`{"podcast":"Pod","value_msat_total":1000}`),
+			IsBoost:    true,
+		},
+		constants.TRANSACTION_INCOMING_KIND_ZAP: {
+			PaymentRequest: tests.MockInvoice,
+			Description:    `{"kind":9734,"content":"great post","tags":[["p","abc"]]}`,
+		},
+		constants.TRANSACTION_INCOMING_KIND_KEYSEND: {
+			Description: "keysend message",
+		},
+		constants.TRANSACTION_INCOMING_KIND_LNURL: {
+			PaymentRequest: tests.MockInvoice,
+			Description:    `[["text/plain","Pay to alice"],["text/identifier","alice@example.com"]]`,
+		},
+		constants.TRANSACTION_INCOMING_KIND_INVOICE: {
+			PaymentRequest: tests.MockInvoice,
+			Description:    "coffee",
+		},
+	}
+	for incomingKind, transaction := range incomingTransactions {
+		transaction.State = constants.TRANSACTION_STATE_SETTLED
+		transaction.Type = constants.TRANSACTION_TYPE_INCOMING
+		transaction.PaymentHash = incomingKind
+		transaction.AmountMsat = 1000
+		svc.DB.Create(&transaction)
+	}
+	// other nostr events and malformed boostagrams do not change the kind
+	svc.DB.Create(&db.Transaction{
+		State:          constants.TRANSACTION_STATE_SETTLED,
+		Type:           constants.TRANSACTION_TYPE_INCOMING,
+		PaymentRequest: tests.MockInvoice,
+		PaymentHash:    "other-event",
+		Description:    `{"kind":1,"content":"hello"}`,
+		Boostagram:     datatypes.JSON(`{"podcast":`),
+	})
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_OUTGOING,
+		PaymentHash: "outgoing",
+		Description: `{"kind":9734}`,
+	})
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	for incomingKind := range incomingTransactions {
+		t.Run(incomingKind, func(t *testing.T) {
+			transactions, err := transactionsService.ListTransactions(ctx, 0, 0, 0, 0, false, false, nil, svc.LNClient, nil, false, ListTransactionsFilter{IncomingKind: &incomingKind})
+			require.NoError(t, err)
+
+			expectedPaymentHashes := []string{incomingKind}
+			if incomingKind == constants.TRANSACTION_INCOMING_KIND_INVOICE {
+				expectedPaymentHashes = append(expectedPaymentHashes, "other-event")
+			}
+			paymentHashes := []string{}
+			for _, transaction := range transactions {
+				paymentHashes = append(paymentHashes, transaction.PaymentHash)
+				assert.Equal(t, incomingKind, GetIncomingKind(&transaction))
+			}
+			assert.ElementsMatch(t, expectedPaymentHashes, paymentHashes)
+		})
+	}
+
+	outgoingTransaction, err := transactionsService.LookupTransaction(ctx, "outgoing", nil, svc.LNClient, nil, false)
+	require.NoError(t, err)
+	assert.Empty(t, GetIncomingKind(outgoingTransaction))
+
+	incomingKind := "onchain"
+	_, err = transactionsService.ListTransactions(ctx, 0, 0, 0, 0, false, false, nil, svc.LNClient, nil, false, ListTransactionsFilter{IncomingKind: &incomingKind})
+	assert.EqualError(t, err, "unknown incoming kind: onchain")
+}
@@ -0,0 +1,75 @@
+package transactions
+
+import (
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/lightningnetwork/lnd/zpay32"
+	decodepay "github.com/nbd-wtf/ln-decodepay"
+)
+
+type InvoiceDecodeErrorCategory string
+
+const (
+	// not a BOLT11 invoice, or a corrupted one
+	InvoiceDecodeErrorCategoryMalformed InvoiceDecodeErrorCategory = "malformed"
+	// a BOLT11 invoice with a typo, e.g. from copying it by hand
+	InvoiceDecodeErrorCategoryInvalidChecksum InvoiceDecodeErrorCategory = "invalid_checksum"
+	// an invoice for an unknown network
+	InvoiceDecodeErrorCategoryWrongNetwork InvoiceDecodeErrorCategory = "wrong_network"
+	// an invoice requiring features we do not support
+	InvoiceDecodeErrorCategoryUnsupportedFeature InvoiceDecodeErrorCategory = "unsupported_feature"
+)
+
+// the bech32 prefixes of mainnet, testnet, signet and regtest invoices
+var knownInvoiceNetworks = []string{"bc", "tb", "tbs", "bcrt"}
+
+// decodeInvoice decodes a BOLT11 invoice, returning an invoice decode error
+// with the category of the failure if it cannot be paid
+func decodeInvoice(payReq string) (decodepay.Bolt11, error) {
+	paymentRequest, err := decodepay.Decodepay(payReq)
+	if err != nil {
+		return decodepay.Bolt11{}, newInvoiceDecodeErrorWithCategory(getInvoiceDecodeErrorCategory(err), err)
+	}
+
+	// the network is taken from the invoice, so invoices for unknown networks still decode
+	if !slices.Contains(knownInvoiceNetworks, paymentRequest.Currency) {
+		return decodepay.Bolt11{}, newInvoiceDecodeErrorWithCategory(InvoiceDecodeErrorCategoryWrongNetwork, nil)
+	}
+
+	// the invoice is decoded again as unknown required features are ignored by default
+	_, err = zpay32.Decode(payReq, &chaincfg.Params{Bech32HRPSegwit: paymentRequest.Currency}, zpay32.WithErrorOnUnknownFeatureBit())
+	if err != nil {
+		return decodepay.Bolt11{}, newInvoiceDecodeErrorWithCategory(getInvoiceDecodeErrorCategory(err), err)
+	}
+
+	return paymentRequest, nil
+}
+
+// getInvoiceDecodeErrorCategory classifies the errors of the invoice decoder,
+// which only returns errors with a message
+func getInvoiceDecodeErrorCategory(err error) InvoiceDecodeErrorCategory {
+	message := err.Error()
+	switch {
+	case strings.Contains(message, "checksum failed"):
+		return InvoiceDecodeErrorCategoryInvalidChecksum
+	case strings.Contains(message, "not for current active network"):
+		return InvoiceDecodeErrorCategoryWrongNetwork
+	case strings.Contains(message, "unknown feature bits"):
+		return InvoiceDecodeErrorCategoryUnsupportedFeature
+	default:
+		return InvoiceDecodeErrorCategoryMalformed
+	}
+}
+
+// GetInvoiceDecodeErrorCategory returns the category of an invoice decode error,
+// or an empty category if err is not one
+func GetInvoiceDecodeErrorCategory(err error) InvoiceDecodeErrorCategory {
+	var decodeErr *invoiceDecodeError
+	if !errors.As(err, &decodeErr) {
+		return ""
+	}
+	return decodeErr.category
+}
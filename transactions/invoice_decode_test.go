@@ -0,0 +1,94 @@
+package transactions
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/lightningnetwork/lnd/lnwire"
+	"github.com/lightningnetwork/lnd/zpay32"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/getAlby/hub/tests"
+)
+
+// encodeTestInvoice signs a 1 sat invoice for the given network prefix and required features
+func encodeTestInvoice(t *testing.T, network string, features ...lnwire.FeatureBit) string {
+	privateKey, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+
+	invoice, err := zpay32.NewInvoice(&chaincfg.Params{Bech32HRPSegwit: network}, [32]byte{1}, time.Now(),
+		zpay32.Amount(1000),
+		zpay32.Description("test"),
+		zpay32.PaymentAddr([32]byte{2}),
+		zpay32.Features(lnwire.NewFeatureVector(lnwire.NewRawFeatureVector(features...), lnwire.Features)),
+	)
+	require.NoError(t, err)
+
+	payReq, err := invoice.Encode(zpay32.MessageSigner{
+		SignCompact: func(msg []byte) ([]byte, error) {
+			return ecdsa.SignCompact(privateKey, chainhash.HashB(msg), true), nil
+		},
+	})
+	require.NoError(t, err)
+	return payReq
+}
+
+func TestDecodeInvoice(t *testing.T) {
+	for name, testCase := range map[string]struct {
+		payReq   string
+		category InvoiceDecodeErrorCategory
+	}{
+		"empty":                {payReq: "", category: InvoiceDecodeErrorCategoryMalformed},
+		"not an invoice":       {payReq: "not an invoice", category: InvoiceDecodeErrorCategoryMalformed},
+		"lightning address":    {payReq: "hello@getalby.com", category: InvoiceDecodeErrorCategoryMalformed},
+		"truncated":            {payReq: tests.MockInvoice[:50], category: InvoiceDecodeErrorCategoryInvalidChecksum},
+		"typo":                 {payReq: tests.MockInvoice[:len(tests.MockInvoice)-1] + "q", category: InvoiceDecodeErrorCategoryInvalidChecksum},
+		"unknown network":      {payReq: encodeTestInvoice(t, "xyz"), category: InvoiceDecodeErrorCategoryWrongNetwork},
+		"unknown feature bits": {payReq: encodeTestInvoice(t, "tb", lnwire.FeatureBit(100)), category: InvoiceDecodeErrorCategoryUnsupportedFeature},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := decodeInvoice(testCase.payReq)
+			assert.ErrorIs(t, err, NewInvoiceDecodeError())
+			assert.Equal(t, testCase.category, GetInvoiceDecodeErrorCategory(err))
+		})
+	}
+}
+
+func TestDecodeInvoice_Valid(t *testing.T) {
+	for name, payReq := range map[string]string{
+		"mock invoice":         tests.MockInvoice,
+		"mainnet":              encodeTestInvoice(t, "bc"),
+		"regtest":              encodeTestInvoice(t, "bcrt"),
+		"optional feature bit": encodeTestInvoice(t, "tb", lnwire.FeatureBit(101)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			paymentRequest, err := decodeInvoice(payReq)
+			require.NoError(t, err)
+			assert.NotEmpty(t, paymentRequest.PaymentHash)
+		})
+	}
+}
+
+func TestGetInvoiceDecodeErrorCategory_OtherError(t *testing.T) {
+	assert.Equal(t, InvoiceDecodeErrorCategory(""), GetInvoiceDecodeErrorCategory(NewInsufficientBalanceError()))
+}
+
+func TestSendPaymentSync_MalformedInvoice(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockInvoice[:len(tests.MockInvoice)-1]+"q", nil, svc.LNClient, nil, nil, SendPaymentOptions{})
+	assert.ErrorIs(t, err, NewInvoiceDecodeError())
+	assert.Equal(t, InvoiceDecodeErrorCategoryInvalidChecksum, GetInvoiceDecodeErrorCategory(err))
+	assert.Nil(t, transaction)
+}
@@ -0,0 +1,47 @@
+package transactions
+
+import (
+	"maps"
+	"unicode/utf8"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+)
+
+// applyInvoiceDescriptionPrefix prepends the app's description prefix to the description of an invoice,
+// preserving the original description in the metadata. If the prefixed description is too long
+// for an invoice, the original description is truncated.
+// Invoices with a description hash are not changed, as the hash commits to the description.
+func (svc *transactionsService) applyInvoiceDescriptionPrefix(appId *uint, description string, descriptionHash string, metadata map[string]interface{}) (string, map[string]interface{}) {
+	if appId == nil || description == "" || descriptionHash != "" {
+		return description, metadata
+	}
+
+	var app db.App
+	result := svc.db.Limit(1).Find(&app, &db.App{
+		ID: *appId,
+	})
+	if result.RowsAffected == 0 || app.InvoiceDescriptionPrefix == "" {
+		return description, metadata
+	}
+
+	metadata = maps.Clone(metadata)
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
+	metadata[constants.ORIGINAL_DESCRIPTION_METADATA_KEY] = description
+
+	return truncateUTF8(app.InvoiceDescriptionPrefix+description, constants.INVOICE_DESCRIPTION_MAX_LENGTH), metadata
+}
+
+// truncateUTF8 truncates s to at most maxLength bytes without splitting a character
+func truncateUTF8(s string, maxLength int) string {
+	if len(s) <= maxLength {
+		return s
+	}
+	// step back to the start of the character that would be split
+	for maxLength > 0 && !utf8.RuneStart(s[maxLength]) {
+		maxLength--
+	}
+	return s[:maxLength]
+}
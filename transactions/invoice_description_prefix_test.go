@@ -0,0 +1,117 @@
+package transactions
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMakeInvoice_App_DescriptionPrefix(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+	app.InvoiceDescriptionPrefix = "[MyShop] "
+	svc.DB.Save(&app)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	transaction, err := transactionsService.MakeInvoice(ctx, 1234, "Order 42", "", 0, map[string]interface{}{"order_id": "42"}, svc.LNClient, &app.ID, nil, "")
+	require.NoError(t, err)
+	assert.Equal(t, "[MyShop] Order 42", transaction.Description)
+
+	var metadata map[string]interface{}
+	require.NoError(t, json.Unmarshal(transaction.Metadata, &metadata))
+	assert.Equal(t, "Order 42", metadata[constants.ORIGINAL_DESCRIPTION_METADATA_KEY])
+	assert.Equal(t, "42", metadata["order_id"])
+
+	// the description hash commits to another description
+	transaction, err = transactionsService.MakeInvoice(ctx, 1234, "Order 42", "3cf1c7f9a1c7e3a1aeee5aa6b4e8c1b4f3bb2d1e3b4a0e6c2e0e7c2d52b3a1f9", 0, nil, svc.LNClient, &app.ID, nil, "")
+	require.NoError(t, err)
+	assert.Equal(t, "Order 42", transaction.Description)
+	assert.Nil(t, transaction.Metadata)
+
+	// invoices without a description are not prefixed
+	transaction, err = transactionsService.MakeInvoice(ctx, 1234, "", "", 0, nil, svc.LNClient, &app.ID, nil, "")
+	require.NoError(t, err)
+	assert.Empty(t, transaction.Description)
+
+	// invoices not created by the app
+	transaction, err = transactionsService.MakeInvoice(ctx, 1234, "Order 42", "", 0, nil, svc.LNClient, nil, nil, "")
+	require.NoError(t, err)
+	assert.Equal(t, "Order 42", transaction.Description)
+}
+
+func TestMakeInvoice_App_DescriptionPrefix_DefaultDescription(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+	app.InvoiceDescriptionPrefix = "[MyShop] "
+	app.DefaultInvoiceDescription = "Donation"
+	svc.DB.Save(&app)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.MakeInvoice(ctx, 0, "", "", 0, nil, svc.LNClient, &app.ID, nil, "")
+	require.NoError(t, err)
+	assert.Equal(t, "[MyShop] Donation", transaction.Description)
+}
+
+func TestMakeInvoice_App_DescriptionPrefix_MaxLength(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+	app.InvoiceDescriptionPrefix = "[MyShop] "
+	svc.DB.Save(&app)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	for name, description := range map[string]string{
+		"ascii": strings.Repeat("a", constants.INVOICE_DESCRIPTION_MAX_LENGTH),
+		// 3 byte characters, which must not be split
+		"multibyte": strings.Repeat("€", constants.INVOICE_DESCRIPTION_MAX_LENGTH/3),
+	} {
+		t.Run(name, func(t *testing.T) {
+			transaction, err := transactionsService.MakeInvoice(ctx, 1234, description, "", 0, nil, svc.LNClient, &app.ID, nil, "")
+			require.NoError(t, err)
+
+			assert.True(t, strings.HasPrefix(transaction.Description, "[MyShop] "))
+			assert.LessOrEqual(t, len(transaction.Description), constants.INVOICE_DESCRIPTION_MAX_LENGTH)
+			assert.Greater(t, len(transaction.Description), constants.INVOICE_DESCRIPTION_MAX_LENGTH-3)
+			assert.True(t, utf8.ValidString(transaction.Description))
+
+			// the full description is preserved
+			var metadata map[string]interface{}
+			require.NoError(t, json.Unmarshal(transaction.Metadata, &metadata))
+			assert.Equal(t, description, metadata[constants.ORIGINAL_DESCRIPTION_METADATA_KEY])
+		})
+	}
+}
+
+func TestTruncateUTF8(t *testing.T) {
+	assert.Equal(t, "hello", truncateUTF8("hello", 10))
+	assert.Equal(t, "hel", truncateUTF8("hello", 3))
+	assert.Equal(t, "a", truncateUTF8("a€", 3))
+	assert.Equal(t, "a€", truncateUTF8("a€", 4))
+	assert.Equal(t, "", truncateUTF8("€", 2))
+}
@@ -0,0 +1,88 @@
+package transactions
+
+import (
+	"context"
+	"sync"
+
+	"github.com/getAlby/hub/lnclient"
+	"github.com/getAlby/hub/logger"
+	decodepay "github.com/nbd-wtf/ln-decodepay"
+	"github.com/sirupsen/logrus"
+)
+
+// the bech32 prefix of invoices on each network, by the network names returned by the LN backends
+var invoiceNetworkPrefixes = map[string]string{
+	"bitcoin": "bc",
+	"mainnet": "bc",
+	"testnet": "tb",
+	"signet":  "tbs",
+	"regtest": "bcrt",
+}
+
+// nodeNetworkCache keeps the network of the LN client it was last fetched from,
+// as a node does not change networks while it is running
+type nodeNetworkCache struct {
+	mu       sync.Mutex
+	lnClient lnclient.LNClient
+	network  string
+}
+
+// getNodeNetwork returns the network of the node, only asking the LN backend the first time
+// for each LN client
+func (svc *transactionsService) getNodeNetwork(ctx context.Context, lnClient lnclient.LNClient) (string, error) {
+	cache := svc.nodeNetworkCache
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if cache.lnClient == lnClient && cache.network != "" {
+		return cache.network, nil
+	}
+
+	nodeInfo, err := lnClient.GetInfo(ctx)
+	if err != nil {
+		return "", err
+	}
+	cache.lnClient = lnClient
+	cache.network = nodeInfo.Network
+	return nodeInfo.Network, nil
+}
+
+// validateInvoiceNetwork rejects invoices for a different network than the node's,
+// which would otherwise fail with an unclear error from the LN backend
+func (svc *transactionsService) validateInvoiceNetwork(ctx context.Context, paymentRequest *decodepay.Bolt11, lnClient lnclient.LNClient) error {
+	nodeNetwork, err := svc.getNodeNetwork(ctx, lnClient)
+	if err != nil {
+		// the LN backend will still reject the payment if the network does not match
+		logger.Logger.WithError(err).Warn("Failed to get node info to check the invoice network")
+		return nil
+	}
+
+	nodePrefix, ok := invoiceNetworkPrefixes[nodeNetwork]
+	if !ok {
+		logger.Logger.WithFields(logrus.Fields{
+			"network": nodeNetwork,
+		}).Warn("Unknown node network, not checking the invoice network")
+		return nil
+	}
+
+	if paymentRequest.Currency != nodePrefix {
+		return newNetworkMismatchErrorWithNetworks(getInvoiceNetwork(paymentRequest.Currency), nodeNetwork)
+	}
+	return nil
+}
+
+// getInvoiceNetwork returns the name of the network of an invoice prefix
+func getInvoiceNetwork(prefix string) string {
+	switch prefix {
+	case "bc":
+		return "bitcoin"
+	case "tb":
+		return "testnet"
+	case "tbs":
+		return "signet"
+	case "bcrt":
+		return "regtest"
+	default:
+		return prefix
+	}
+}
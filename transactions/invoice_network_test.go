@@ -0,0 +1,117 @@
+package transactions
+
+import (
+	"context"
+	"testing"
+
+	decodepay "github.com/nbd-wtf/ln-decodepay"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/tests"
+)
+
+func TestSendPaymentSync_NetworkMismatch(t *testing.T) {
+	ctx := context.TODO()
+
+	for name, testCase := range map[string]struct {
+		nodeNetwork string
+		payReq      string
+		message     string
+	}{
+		"mainnet invoice on testnet": {
+			nodeNetwork: "testnet",
+			payReq:      encodeTestInvoice(t, "bc"),
+			message:     "The invoice is for bitcoin but the node is on testnet",
+		},
+		"testnet invoice on mainnet": {
+			nodeNetwork: "bitcoin",
+			payReq:      tests.MockInvoice,
+			message:     "The invoice is for testnet but the node is on bitcoin",
+		},
+		"signet invoice on mainnet": {
+			nodeNetwork: "mainnet",
+			payReq:      encodeTestInvoice(t, "tbs"),
+			message:     "The invoice is for signet but the node is on mainnet",
+		},
+		"testnet invoice on signet": {
+			nodeNetwork: "signet",
+			payReq:      tests.MockInvoice,
+			message:     "The invoice is for testnet but the node is on signet",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer tests.RemoveTestService()
+			svc, err := tests.CreateTestService()
+			require.NoError(t, err)
+
+			mockNodeInfo := tests.MockNodeInfo
+			defer func() { tests.MockNodeInfo = mockNodeInfo }()
+			tests.MockNodeInfo.Network = testCase.nodeNetwork
+
+			transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+			transaction, err := transactionsService.SendPaymentSync(ctx, testCase.payReq, nil, svc.LNClient, nil, nil, SendPaymentOptions{})
+			assert.ErrorIs(t, err, NewNetworkMismatchError())
+			assert.EqualError(t, err, testCase.message)
+			assert.Nil(t, transaction)
+
+			// no transaction is created
+			var count int64
+			svc.DB.Model(&db.Transaction{}).Count(&count)
+			assert.Zero(t, count)
+		})
+	}
+}
+
+func TestSendPaymentSync_NetworkMatches(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	// the mock node is on testnet, like the mock invoice
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockInvoice, nil, svc.LNClient, nil, nil, SendPaymentOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "123preimage", *transaction.Preimage)
+}
+
+func TestSendPaymentSync_NodeNetworkCached(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	_, err = transactionsService.SendPaymentSync(ctx, tests.MockInvoice, nil, svc.LNClient, nil, nil, SendPaymentOptions{})
+	require.NoError(t, err)
+
+	// the network is not fetched from the node again
+	mockNodeInfo := tests.MockNodeInfo
+	defer func() { tests.MockNodeInfo = mockNodeInfo }()
+	tests.MockNodeInfo.Network = "bitcoin"
+
+	paymentRequest, err := decodepay.Decodepay(tests.MockInvoice)
+	require.NoError(t, err)
+	err = transactionsService.validateInvoiceNetwork(ctx, &paymentRequest, svc.LNClient)
+	assert.NoError(t, err)
+}
+
+func TestSendPaymentSync_UnknownNodeNetwork(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	mockNodeInfo := tests.MockNodeInfo
+	defer func() { tests.MockNodeInfo = mockNodeInfo }()
+	tests.MockNodeInfo.Network = ""
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	_, err = transactionsService.SendPaymentSync(ctx, tests.MockInvoice, nil, svc.LNClient, nil, nil, SendPaymentOptions{})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,31 @@
+package transactions
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/getAlby/hub/utils"
+)
+
+// validateNotifyUrl checks the URL an invoice's payment is posted to, if one is set.
+// The notification itself is delivered by the webhooks service when the invoice settles.
+// Only https URLs of public hosts are accepted, as the URL is set by apps rather than the node owner.
+// Hosts that resolve to a non-public address are also refused when the notification is delivered.
+func validateNotifyUrl(notifyUrl string) error {
+	if notifyUrl == "" {
+		return nil
+	}
+	parsedUrl, err := url.Parse(notifyUrl)
+	if err != nil || parsedUrl.Scheme != "https" || parsedUrl.Hostname() == "" {
+		return NewInvalidNotifyUrlError()
+	}
+	hostname := strings.ToLower(parsedUrl.Hostname())
+	if hostname == "localhost" || strings.HasSuffix(hostname, ".localhost") {
+		return NewInvalidNotifyUrlError()
+	}
+	if ip := net.ParseIP(hostname); ip != nil && !utils.IsPublicIP(ip) {
+		return NewInvalidNotifyUrlError()
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package transactions
+
+import (
+	"time"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/events"
+	"github.com/getAlby/hub/logger"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// validateInvoiceRateLimit limits how many invoices an app can request within a sliding window,
+// so a misbehaving app cannot flood the node with invoices. Invoices count towards the limit
+// from when they were created, whether or not they were paid or hidden since. Invoices created
+// by the hub on behalf of the app, received keysends and split shares are not counted.
+func (svc *transactionsService) validateInvoiceRateLimit(tx *gorm.DB, appId *uint) error {
+	if appId == nil {
+		return nil
+	}
+
+	var app db.App
+	result := tx.Limit(1).Find(&app, &db.App{
+		ID: *appId,
+	})
+	if result.RowsAffected == 0 {
+		return NewNotFoundError()
+	}
+
+	limit := uint(constants.DEFAULT_INVOICE_RATE_LIMIT)
+	if app.InvoiceRateLimit > 0 {
+		limit = app.InvoiceRateLimit
+	}
+	windowSeconds := uint(constants.DEFAULT_INVOICE_RATE_LIMIT_WINDOW_SECONDS)
+	if app.InvoiceRateLimitWindowSeconds > 0 {
+		windowSeconds = app.InvoiceRateLimitWindowSeconds
+	}
+	windowStart := time.Now().Add(-time.Duration(windowSeconds) * time.Second)
+
+	var recentInvoiceCount int64
+	err := tx.Unscoped().Model(&db.Transaction{}).
+		Where("app_id = ? AND type = ? AND request_event_id IS NOT NULL AND created_at > ?", app.ID, constants.TRANSACTION_TYPE_INCOMING, windowStart).
+		Count(&recentInvoiceCount).Error
+	if err != nil {
+		logger.Logger.WithError(err).Error("Failed to count recent invoices")
+		return err
+	}
+
+	if recentInvoiceCount >= int64(limit) {
+		logger.Logger.WithFields(logrus.Fields{
+			"app_id":         app.ID,
+			"limit":          limit,
+			"window_seconds": windowSeconds,
+		}).Warn("App exceeded invoice rate limit")
+		svc.eventPublisher.Publish(&events.Event{
+			Event: "nwc_permission_denied",
+			Properties: map[string]interface{}{
+				"app_id":   app.ID,
+				"app_name": app.Name,
+				"code":     constants.ERROR_RATE_LIMITED,
+				"message":  NewInvoiceRateLimitExceededError().Error(),
+			},
+		})
+		return NewInvoiceRateLimitExceededError()
+	}
+
+	return nil
+}
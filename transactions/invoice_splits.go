@@ -0,0 +1,148 @@
+package transactions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/events"
+	"github.com/getAlby/hub/logger"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// SplitRuleShare is the percentage of a received payment to credit to an app
+type SplitRuleShare struct {
+	AppId   uint `json:"app_id"`
+	Percent uint `json:"percent"`
+}
+
+// SetInvoiceSplitRule splits the proceeds of an unpaid invoice across apps (e.g. a shared tip jar).
+// When the invoice is paid, each app is credited its share as a separate incoming transaction.
+// The percentages must add up to 100.
+func (svc *transactionsService) SetInvoiceSplitRule(ctx context.Context, paymentHash string, splitRule []SplitRuleShare) error {
+	if len(splitRule) == 0 {
+		return errors.New("split rule must have at least one share")
+	}
+
+	var totalPercent uint
+	for _, share := range splitRule {
+		if share.Percent == 0 {
+			return errors.New("split rule shares must be greater than 0 percent")
+		}
+		totalPercent += share.Percent
+	}
+	if totalPercent != 100 {
+		return fmt.Errorf("split rule shares must add up to 100 percent, got %d", totalPercent)
+	}
+
+	splitRuleBytes, err := json.Marshal(splitRule)
+	if err != nil {
+		return err
+	}
+
+	return svc.inTransaction(func(tx *gorm.DB, balanceChanges *[]balanceChange) error {
+		for _, share := range splitRule {
+			result := tx.Limit(1).Find(&db.App{}, &db.App{
+				ID: share.AppId,
+			})
+			if result.RowsAffected == 0 {
+				return fmt.Errorf("app %d in split rule not found", share.AppId)
+			}
+		}
+
+		var transaction db.Transaction
+		result := tx.Limit(1).Where("split_from_id IS NULL").Find(&transaction, &db.Transaction{
+			Type:        constants.TRANSACTION_TYPE_INCOMING,
+			PaymentHash: paymentHash,
+		})
+		if result.RowsAffected == 0 {
+			return NewNotFoundError()
+		}
+		if transaction.State != constants.TRANSACTION_STATE_PENDING {
+			return errors.New("only unpaid invoices can be split")
+		}
+
+		return tx.Model(&transaction).Update("split_rule", splitRuleBytes).Error
+	})
+}
+
+// applySplitRule credits each app in the transaction's split rule with its share of the amount.
+// The transaction itself becomes the first share so the entries add up to the received amount;
+// any rounding remainder goes to the first share.
+func (svc *transactionsService) applySplitRule(tx *gorm.DB, dbTransaction *db.Transaction, balanceChanges *[]balanceChange) ([]db.Transaction, error) {
+	var splitRule []SplitRuleShare
+	err := json.Unmarshal(dbTransaction.SplitRule, &splitRule)
+	if err != nil {
+		return nil, err
+	}
+	if len(splitRule) == 0 {
+		return nil, nil
+	}
+
+	shareAmounts := make([]uint64, len(splitRule))
+	var splitAmount uint64
+	for i, share := range splitRule {
+		shareAmounts[i] = dbTransaction.AmountMsat * uint64(share.Percent) / 100
+		splitAmount += shareAmounts[i]
+	}
+	shareAmounts[0] += dbTransaction.AmountMsat - splitAmount
+
+	splitTransactions := []db.Transaction{}
+	for i, share := range splitRule[1:] {
+		appId := share.AppId
+		splitTransaction := db.Transaction{
+			AppId:           &appId,
+			Type:            dbTransaction.Type,
+			State:           dbTransaction.State,
+			AmountMsat:      shareAmounts[i+1],
+			PaymentRequest:  dbTransaction.PaymentRequest,
+			PaymentHash:     dbTransaction.PaymentHash,
+			Description:     dbTransaction.Description,
+			DescriptionHash: dbTransaction.DescriptionHash,
+			Preimage:        dbTransaction.Preimage,
+			ExpiresAt:       dbTransaction.ExpiresAt,
+			SettledAt:       dbTransaction.SettledAt,
+			Metadata:        dbTransaction.Metadata,
+			SelfPayment:     dbTransaction.SelfPayment,
+			Boostagram:      dbTransaction.Boostagram,
+			IsBoost:         dbTransaction.IsBoost,
+			Environment:     dbTransaction.Environment,
+			SplitFromId:     &dbTransaction.ID,
+		}
+		err := tx.Create(&splitTransaction).Error
+		if err != nil {
+			return nil, err
+		}
+		recordBalanceChange(balanceChanges, &splitTransaction, 0)
+		splitTransactions = append(splitTransactions, splitTransaction)
+	}
+
+	firstAppId := splitRule[0].AppId
+	err = tx.Unscoped().Model(dbTransaction).Updates(map[string]interface{}{
+		"AppId":      &firstAppId,
+		"AmountMsat": shareAmounts[0],
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Logger.WithFields(logrus.Fields{
+		"payment_hash": dbTransaction.PaymentHash,
+		"shares":       len(splitRule),
+	}).Info("Split received payment across apps")
+
+	return splitTransactions, nil
+}
+
+func (svc *transactionsService) publishSplitTransactions(splitTransactions []db.Transaction) {
+	for i := range splitTransactions {
+		svc.eventPublisher.Publish(svc.trackNotification(&events.Event{
+			Event:      "nwc_payment_received",
+			Properties: &splitTransactions[i],
+		}))
+	}
+}
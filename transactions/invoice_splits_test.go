@@ -0,0 +1,165 @@
+package transactions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/db/queries"
+	"github.com/getAlby/hub/events"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetInvoiceSplitRule_SplitsReceivedPayment(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app1, _, err := tests.CreateApp(svc)
+	assert.NoError(t, err)
+	app2, _, err := tests.CreateApp(svc)
+	assert.NoError(t, err)
+	for _, app := range []*db.App{app1, app2} {
+		app.Isolated = true
+		svc.DB.Save(app)
+	}
+
+	mockEventConsumer := tests.NewMockEventConsumer()
+	svc.EventPublisher.RegisterSubscriber(mockEventConsumer)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	invoice, err := transactionsService.MakeInvoice(ctx, 1000, "tip jar", "", 0, nil, svc.LNClient, nil, nil, "")
+	require.NoError(t, err)
+
+	err = transactionsService.SetInvoiceSplitRule(ctx, invoice.PaymentHash, []SplitRuleShare{
+		{AppId: app1.ID, Percent: 70},
+		{AppId: app2.ID, Percent: 30},
+	})
+	assert.NoError(t, err)
+
+	transactionsService.ConsumeEvent(ctx, &events.Event{
+		Event:      "nwc_lnclient_payment_received",
+		Properties: tests.MockLNClientTransaction,
+	}, map[string]interface{}{})
+
+	assert.Equal(t, uint64(86100), queries.GetIsolatedBalance(svc.DB, app1.ID))
+	assert.Equal(t, uint64(36900), queries.GetIsolatedBalance(svc.DB, app2.ID))
+
+	var transactions []db.Transaction
+	svc.DB.Order("id asc").Find(&transactions)
+	require.Equal(t, 2, len(transactions))
+	var totalAmountMsat uint64
+	for _, transaction := range transactions {
+		assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transaction.State)
+		assert.Equal(t, constants.TRANSACTION_TYPE_INCOMING, transaction.Type)
+		assert.Equal(t, invoice.PaymentHash, transaction.PaymentHash)
+		totalAmountMsat += transaction.AmountMsat
+	}
+	assert.Equal(t, uint64(123000), totalAmountMsat)
+	assert.Equal(t, app1.ID, *transactions[0].AppId)
+	assert.Nil(t, transactions[0].SplitFromId)
+	assert.Equal(t, app2.ID, *transactions[1].AppId)
+	assert.Equal(t, transactions[0].ID, *transactions[1].SplitFromId)
+
+	// each app is notified of its share
+	receivedAppIds := []uint{}
+	for _, event := range mockEventConsumer.GetConsumedEvents() {
+		if event.Event == "nwc_payment_received" {
+			receivedAppIds = append(receivedAppIds, *event.Properties.(*db.Transaction).AppId)
+		}
+	}
+	assert.ElementsMatch(t, []uint{app1.ID, app2.ID}, receivedAppIds)
+
+	// a repeated notification does not split the payment again
+	transactionsService.ConsumeEvent(ctx, &events.Event{
+		Event:      "nwc_lnclient_payment_received",
+		Properties: tests.MockLNClientTransaction,
+	}, map[string]interface{}{})
+	var count int64
+	svc.DB.Model(&db.Transaction{}).Count(&count)
+	assert.Equal(t, int64(2), count)
+}
+
+func TestSetInvoiceSplitRule_Invalid(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	assert.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	invoice, err := transactionsService.MakeInvoice(ctx, 1000, "tip jar", "", 0, nil, svc.LNClient, nil, nil, "")
+	require.NoError(t, err)
+
+	err = transactionsService.SetInvoiceSplitRule(ctx, invoice.PaymentHash, []SplitRuleShare{
+		{AppId: app.ID, Percent: 70},
+	})
+	assert.EqualError(t, err, "split rule shares must add up to 100 percent, got 70")
+
+	err = transactionsService.SetInvoiceSplitRule(ctx, invoice.PaymentHash, []SplitRuleShare{
+		{AppId: app.ID, Percent: 70},
+		{AppId: app.ID + 1, Percent: 30},
+	})
+	assert.ErrorContains(t, err, "in split rule not found")
+
+	err = transactionsService.SetInvoiceSplitRule(ctx, "unknown", []SplitRuleShare{
+		{AppId: app.ID, Percent: 100},
+	})
+	assert.ErrorIs(t, err, NewNotFoundError())
+
+	svc.DB.Model(invoice).Update("state", constants.TRANSACTION_STATE_SETTLED)
+	err = transactionsService.SetInvoiceSplitRule(ctx, invoice.PaymentHash, []SplitRuleShare{
+		{AppId: app.ID, Percent: 100},
+	})
+	assert.EqualError(t, err, "only unpaid invoices can be split")
+}
+
+func TestSetInvoiceSplitRule_LookupReturnsSplitTransaction(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app1, _, err := tests.CreateApp(svc)
+	assert.NoError(t, err)
+	app2, _, err := tests.CreateApp(svc)
+	assert.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	invoice, err := transactionsService.MakeInvoice(ctx, 1000, "tip jar", "", 0, nil, svc.LNClient, nil, nil, "")
+	require.NoError(t, err)
+
+	err = transactionsService.SetInvoiceSplitRule(ctx, invoice.PaymentHash, []SplitRuleShare{
+		{AppId: app1.ID, Percent: 70},
+		{AppId: app2.ID, Percent: 30},
+	})
+	require.NoError(t, err)
+
+	transactionsService.ConsumeEvent(ctx, &events.Event{
+		Event:      "nwc_lnclient_payment_received",
+		Properties: tests.MockLNClientTransaction,
+	}, map[string]interface{}{})
+
+	// the shares have the same payment hash, but only the transaction they were split from is looked up
+	transaction, err := transactionsService.LookupTransaction(ctx, invoice.PaymentHash, nil, svc.LNClient, nil, false)
+	require.NoError(t, err)
+	assert.Equal(t, invoice.ID, transaction.ID)
+	assert.Nil(t, transaction.SplitFromId)
+
+	// the split transaction was credited to an app, so it cannot be claimed, and neither can its shares
+	err = transactionsService.ClaimOrphanTransaction(ctx, invoice.PaymentHash, app2.ID)
+	assert.Error(t, err)
+	var shares []db.Transaction
+	svc.DB.Where("split_from_id = ?", invoice.ID).Find(&shares)
+	require.Equal(t, 1, len(shares))
+	assert.Equal(t, app2.ID, *shares[0].AppId)
+}
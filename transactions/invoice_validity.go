@@ -0,0 +1,18 @@
+package transactions
+
+import (
+	"time"
+)
+
+// GetInvoiceValidity returns when an invoice was created, when it expires and how long it remains valid,
+// so clients can show e.g. "valid for 1 hour". Invoices which never expire have no expiry.
+// remaining is 0 for expired invoices and for invoices which never expire.
+func GetInvoiceValidity(transaction *Transaction) (created time.Time, expires *time.Time, remaining time.Duration) {
+	created = transaction.CreatedAt
+	if transaction.ExpiresAt == nil {
+		return created, nil, 0
+	}
+
+	expiresAt := *transaction.ExpiresAt
+	return created, &expiresAt, max(time.Until(expiresAt), 0)
+}
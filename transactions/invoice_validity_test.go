@@ -0,0 +1,51 @@
+package transactions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetInvoiceValidity(t *testing.T) {
+	createdAt := time.Now().Add(-30 * time.Minute)
+
+	t.Run("valid", func(t *testing.T) {
+		expiresAt := createdAt.Add(time.Hour)
+		created, expires, remaining := GetInvoiceValidity(&Transaction{
+			Type:      constants.TRANSACTION_TYPE_INCOMING,
+			CreatedAt: createdAt,
+			ExpiresAt: &expiresAt,
+		})
+		assert.Equal(t, createdAt, created)
+		require.NotNil(t, expires)
+		assert.Equal(t, expiresAt, *expires)
+		assert.Equal(t, time.Hour, expires.Sub(created))
+		assert.InDelta(t, float64(30*time.Minute), float64(remaining), float64(time.Second))
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		expiresAt := createdAt.Add(10 * time.Minute)
+		created, expires, remaining := GetInvoiceValidity(&Transaction{
+			Type:      constants.TRANSACTION_TYPE_INCOMING,
+			CreatedAt: createdAt,
+			ExpiresAt: &expiresAt,
+		})
+		assert.Equal(t, createdAt, created)
+		require.NotNil(t, expires)
+		assert.Equal(t, expiresAt, *expires)
+		assert.Zero(t, remaining)
+	})
+
+	t.Run("never expiring", func(t *testing.T) {
+		created, expires, remaining := GetInvoiceValidity(&Transaction{
+			Type:      constants.TRANSACTION_TYPE_INCOMING,
+			CreatedAt: createdAt,
+		})
+		assert.Equal(t, createdAt, created)
+		assert.Nil(t, expires)
+		assert.Zero(t, remaining)
+	})
+}
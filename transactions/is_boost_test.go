@@ -0,0 +1,106 @@
+package transactions
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/events"
+	"github.com/getAlby/hub/lnclient"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var mockBoostagramRecord = lnclient.TLVRecord{
+	Type:  BoostagramTlvType,
+	Value: hex.EncodeToString([]byte(`{"action":"boost","value_msat_total":1000,"message":"Go podcasting!"}`)),
+}
+
+func TestSendKeysend_IsBoost(t *testing.T) {
+	ctx := context.TODO()
+
+	for name, testCase := range map[string]struct {
+		customRecords   []lnclient.TLVRecord
+		expectedIsBoost bool
+	}{
+		"with boostagram": {
+			customRecords:   []lnclient.TLVRecord{mockBoostagramRecord},
+			expectedIsBoost: true,
+		},
+		"without boostagram": {
+			customRecords: []lnclient.TLVRecord{{Type: 34349334, Value: hex.EncodeToString([]byte("hello"))}},
+		},
+		"unparseable boostagram": {
+			customRecords: []lnclient.TLVRecord{{Type: BoostagramTlvType, Value: hex.EncodeToString([]byte("not a boostagram"))}},
+		},
+		"null boostagram": {
+			customRecords: []lnclient.TLVRecord{{Type: BoostagramTlvType, Value: hex.EncodeToString([]byte("null"))}},
+		},
+		"array boostagram": {
+			customRecords: []lnclient.TLVRecord{{Type: BoostagramTlvType, Value: hex.EncodeToString([]byte(`[{"action":"boost"}]`))}},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer tests.RemoveTestService()
+			svc, err := tests.CreateTestService()
+			require.NoError(t, err)
+
+			transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+			transaction, err := transactionsService.SendKeysend(ctx, 1000, mockPayee, testCase.customRecords, "", "", svc.LNClient, nil, nil)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.expectedIsBoost, transaction.IsBoost)
+
+			outgoing := constants.TRANSACTION_TYPE_OUTGOING
+			transaction, err = transactionsService.LookupTransaction(ctx, transaction.PaymentHash, &outgoing, svc.LNClient, nil, false)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.expectedIsBoost, transaction.IsBoost)
+		})
+	}
+}
+
+func TestReceiveKeysend_IsBoost(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	receive := func(paymentHash string, customRecords []lnclient.TLVRecord) {
+		transactionsService.ConsumeEvent(ctx, &events.Event{
+			Event: "nwc_lnclient_payment_received",
+			Properties: &lnclient.Transaction{
+				Type:        "incoming",
+				Preimage:    tests.MockLNClientTransaction.Preimage,
+				PaymentHash: paymentHash,
+				Amount:      1000,
+				SettledAt:   &tests.MockTimeUnix,
+				Metadata: map[string]interface{}{
+					"tlv_records": customRecords,
+				},
+			},
+		}, map[string]interface{}{})
+	}
+	receive(tests.MockPaymentHash, []lnclient.TLVRecord{mockBoostagramRecord})
+	receive(tests.MockPaymentHashWithoutDescription, []lnclient.TLVRecord{})
+
+	incoming := constants.TRANSACTION_TYPE_INCOMING
+	transaction, err := transactionsService.LookupTransaction(ctx, tests.MockPaymentHash, &incoming, svc.LNClient, nil, false)
+	require.NoError(t, err)
+	assert.True(t, transaction.IsBoost)
+
+	transaction, err = transactionsService.LookupTransaction(ctx, tests.MockPaymentHashWithoutDescription, &incoming, svc.LNClient, nil, false)
+	require.NoError(t, err)
+	assert.False(t, transaction.IsBoost)
+
+	transactions, err := transactionsService.ListTransactions(ctx, 0, 0, 0, 0, false, false, nil, svc.LNClient, nil, false, ListTransactionsFilter{BoostsOnly: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{tests.MockPaymentHash}, getPaymentHashes(transactions))
+
+	transactions, err = transactionsService.ListTransactions(ctx, 0, 0, 0, 0, false, false, nil, svc.LNClient, nil, false, ListTransactionsFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(transactions))
+}
@@ -2,13 +2,18 @@ package transactions
 
 import (
 	"context"
+	"errors"
 	"testing"
 
+	"github.com/getAlby/hub/config"
 	"github.com/getAlby/hub/constants"
 	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/db/queries"
+	"github.com/getAlby/hub/events"
 	"github.com/getAlby/hub/tests"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
 )
 
 func TestSendPaymentSync_IsolatedApp_NoBalance(t *testing.T) {
@@ -36,7 +41,7 @@ func TestSendPaymentSync_IsolatedApp_NoBalance(t *testing.T) {
 	assert.NoError(t, err)
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
-	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID, SendPaymentOptions{})
 
 	assert.Error(t, err)
 	assert.ErrorIs(t, err, NewInsufficientBalanceError())
@@ -78,7 +83,7 @@ func TestSendPaymentSync_IsolatedApp_BalanceInsufficient(t *testing.T) {
 	svc.EventPublisher.RegisterSubscriber(mockEventConsumer)
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
-	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID, SendPaymentOptions{})
 
 	assert.Error(t, err)
 	assert.ErrorIs(t, err, NewInsufficientBalanceError())
@@ -90,6 +95,12 @@ func TestSendPaymentSync_IsolatedApp_BalanceInsufficient(t *testing.T) {
 	assert.Equal(t, constants.ERROR_INSUFFICIENT_BALANCE, mockEventConsumer.GetConsumedEvents()[0].Properties.(map[string]interface{})["code"])
 	expectedMessage := NewInsufficientBalanceError().Error() + " te" // invoice description is "te" in the mock invoice
 	assert.Equal(t, expectedMessage, mockEventConsumer.GetConsumedEvents()[0].Properties.(map[string]interface{})["message"])
+
+	// the error identifies the app
+	appId, appName, ok := GetPermissionDeniedApp(err)
+	assert.True(t, ok)
+	assert.Equal(t, app.ID, appId)
+	assert.Equal(t, app.Name, appName)
 }
 
 func TestSendPaymentSync_IsolatedApp_BalanceSufficient(t *testing.T) {
@@ -124,7 +135,7 @@ func TestSendPaymentSync_IsolatedApp_BalanceSufficient(t *testing.T) {
 	})
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
-	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID, SendPaymentOptions{})
 
 	assert.NoError(t, err)
 	assert.Equal(t, uint64(123000), transaction.AmountMsat)
@@ -173,7 +184,7 @@ func TestSendPaymentSync_IsolatedApp_BalanceInsufficient_OutstandingPayment(t *t
 	})
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
-	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID, SendPaymentOptions{})
 
 	assert.Error(t, err)
 	assert.ErrorIs(t, err, NewInsufficientBalanceError())
@@ -219,7 +230,7 @@ func TestSendPaymentSync_IsolatedApp_BalanceInsufficient_SettledPayment(t *testi
 	})
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
-	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID, SendPaymentOptions{})
 
 	assert.Error(t, err)
 	assert.ErrorIs(t, err, NewInsufficientBalanceError())
@@ -264,7 +275,7 @@ func TestSendPaymentSync_IsolatedApp_BalanceSufficient_UnrelatedPayment(t *testi
 	})
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
-	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID, SendPaymentOptions{})
 
 	assert.NoError(t, err)
 	assert.Equal(t, uint64(123000), transaction.AmountMsat)
@@ -312,7 +323,7 @@ func TestSendPaymentSync_IsolatedApp_BalanceSufficient_FailedPayment(t *testing.
 	})
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
-	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID, SendPaymentOptions{})
 
 	assert.NoError(t, err)
 	assert.Equal(t, uint64(123000), transaction.AmountMsat)
@@ -321,3 +332,307 @@ func TestSendPaymentSync_IsolatedApp_BalanceSufficient_FailedPayment(t *testing.
 	assert.Equal(t, app.ID, *transaction.AppId)
 	assert.Equal(t, dbRequestEvent.ID, *transaction.RequestEventId)
 }
+
+func TestSendPaymentSync_IsolatedApp_BalanceChangedEvent(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	assert.NoError(t, err)
+	app.Isolated = true
+	svc.DB.Save(&app)
+
+	appPermission := &db.AppPermission{
+		AppId: app.ID,
+		App:   *app,
+		Scope: constants.PAY_INVOICE_SCOPE,
+	}
+	err = svc.DB.Create(appPermission).Error
+	assert.NoError(t, err)
+
+	svc.DB.Create(&db.Transaction{
+		AppId:      &app.ID,
+		State:      constants.TRANSACTION_STATE_SETTLED,
+		Type:       constants.TRANSACTION_TYPE_INCOMING,
+		AmountMsat: 133000,
+	})
+
+	mockEventConsumer := tests.NewMockEventConsumer()
+	svc.EventPublisher.RegisterSubscriber(mockEventConsumer)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	_, err = transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, nil, SendPaymentOptions{})
+	assert.NoError(t, err)
+
+	balanceChangedEvents := getBalanceChangedEvents(mockEventConsumer.GetConsumedEvents())
+	require.Equal(t, 1, len(balanceChangedEvents))
+	properties := balanceChangedEvents[0].Properties.(map[string]interface{})
+	assert.Equal(t, app.ID, properties["app_id"])
+	// the unused fee reserve of 10000 msat is released
+	assert.Equal(t, int64(10000), properties["delta_msat"])
+	assert.Equal(t, uint64(10000), properties["balance_msat"])
+}
+
+func TestSendPaymentSync_IsolatedApp_BalanceChangedEvent_Failed(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	assert.NoError(t, err)
+	app.Isolated = true
+	svc.DB.Save(&app)
+
+	appPermission := &db.AppPermission{
+		AppId: app.ID,
+		App:   *app,
+		Scope: constants.PAY_INVOICE_SCOPE,
+	}
+	err = svc.DB.Create(appPermission).Error
+	assert.NoError(t, err)
+
+	svc.DB.Create(&db.Transaction{
+		AppId:      &app.ID,
+		State:      constants.TRANSACTION_STATE_SETTLED,
+		Type:       constants.TRANSACTION_TYPE_INCOMING,
+		AmountMsat: 133000,
+	})
+
+	svc.LNClient.(*tests.MockLn).PayInvoiceErrors = append(svc.LNClient.(*tests.MockLn).PayInvoiceErrors, errors.New("Some error"))
+	svc.LNClient.(*tests.MockLn).PayInvoiceResponses = append(svc.LNClient.(*tests.MockLn).PayInvoiceResponses, nil)
+
+	mockEventConsumer := tests.NewMockEventConsumer()
+	svc.EventPublisher.RegisterSubscriber(mockEventConsumer)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	_, err = transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, nil, SendPaymentOptions{})
+	assert.Error(t, err)
+
+	balanceChangedEvents := getBalanceChangedEvents(mockEventConsumer.GetConsumedEvents())
+	require.Equal(t, 1, len(balanceChangedEvents))
+	properties := balanceChangedEvents[0].Properties.(map[string]interface{})
+	assert.Equal(t, app.ID, properties["app_id"])
+	// the amount and fee reserve are returned to the app
+	assert.Equal(t, int64(133000), properties["delta_msat"])
+	assert.Equal(t, uint64(133000), properties["balance_msat"])
+}
+
+func TestSendPaymentSync_NonIsolatedApp_NoBalanceChangedEvent(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	assert.NoError(t, err)
+
+	appPermission := &db.AppPermission{
+		AppId: app.ID,
+		App:   *app,
+		Scope: constants.PAY_INVOICE_SCOPE,
+	}
+	err = svc.DB.Create(appPermission).Error
+	assert.NoError(t, err)
+
+	mockEventConsumer := tests.NewMockEventConsumer()
+	svc.EventPublisher.RegisterSubscriber(mockEventConsumer)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	_, err = transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, nil, SendPaymentOptions{})
+	assert.NoError(t, err)
+
+	assert.Empty(t, getBalanceChangedEvents(mockEventConsumer.GetConsumedEvents()))
+}
+
+func TestSendPaymentSync_IsolatedApp_BalanceInsufficient_BackendMinFeeReserve(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	svc.LNClient.(*tests.MockLn).BackendType = config.LDKBackendType
+
+	app, _, err := tests.CreateApp(svc)
+	assert.NoError(t, err)
+	app.Isolated = true
+	svc.DB.Save(&app)
+
+	appPermission := &db.AppPermission{
+		AppId: app.ID,
+		App:   *app,
+		Scope: constants.PAY_INVOICE_SCOPE,
+	}
+	err = svc.DB.Create(appPermission).Error
+	assert.NoError(t, err)
+
+	svc.DB.Create(&db.Transaction{
+		AppId:      &app.ID,
+		State:      constants.TRANSACTION_STATE_SETTLED,
+		Type:       constants.TRANSACTION_TYPE_INCOMING,
+		AmountMsat: 133000, // enough with the default 10 sat fee reserve, but not LDK's 50 sats
+	})
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, nil, SendPaymentOptions{})
+
+	assert.ErrorIs(t, err, NewInsufficientBalanceError())
+	assert.Nil(t, transaction)
+}
+
+func TestSendPaymentSync_IsolatedApp_TopUp(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	assert.NoError(t, err)
+	app.Isolated = true
+	svc.DB.Save(&app)
+
+	fundingApp, _, err := tests.CreateApp(svc)
+	assert.NoError(t, err)
+	fundingApp.Isolated = true
+	svc.DB.Save(&fundingApp)
+
+	err = svc.DB.Create(&db.AppPermission{
+		AppId: app.ID,
+		App:   *app,
+		Scope: constants.PAY_INVOICE_SCOPE,
+	}).Error
+	assert.NoError(t, err)
+
+	svc.DB.Create(&db.Transaction{
+		AppId:      &app.ID,
+		State:      constants.TRANSACTION_STATE_SETTLED,
+		Type:       constants.TRANSACTION_TYPE_INCOMING,
+		AmountMsat: 100000,
+	})
+	svc.DB.Create(&db.Transaction{
+		AppId:      &fundingApp.ID,
+		State:      constants.TRANSACTION_STATE_SETTLED,
+		Type:       constants.TRANSACTION_TYPE_INCOMING,
+		AmountMsat: 500000,
+	})
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	topUpCalls := 0
+	transactionsService.SetTopUpCallback(func(tx *gorm.DB, topUpApp *db.App, shortfallMsat uint64) error {
+		topUpCalls++
+		assert.Equal(t, app.ID, topUpApp.ID)
+		// internal transfer from the funding app
+		err := tx.Create(&db.Transaction{
+			AppId:      &fundingApp.ID,
+			State:      constants.TRANSACTION_STATE_SETTLED,
+			Type:       constants.TRANSACTION_TYPE_OUTGOING,
+			AmountMsat: shortfallMsat,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&db.Transaction{
+			AppId:      &topUpApp.ID,
+			State:      constants.TRANSACTION_STATE_SETTLED,
+			Type:       constants.TRANSACTION_TYPE_INCOMING,
+			AmountMsat: shortfallMsat,
+		}).Error
+	})
+
+	// invoice is 123000 msat + 10000 msat fee reserve
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, nil, SendPaymentOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transaction.State)
+	assert.Equal(t, 1, topUpCalls)
+
+	// topped up by the 33000 msat shortfall; the unused fee reserve is returned after the payment
+	assert.Equal(t, uint64(10000), queries.GetIsolatedBalance(svc.DB, app.ID))
+	assert.Equal(t, uint64(467000), queries.GetIsolatedBalance(svc.DB, fundingApp.ID))
+}
+
+func TestSendPaymentSync_IsolatedApp_TopUpFails(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	assert.NoError(t, err)
+	app.Isolated = true
+	svc.DB.Save(&app)
+
+	err = svc.DB.Create(&db.AppPermission{
+		AppId: app.ID,
+		App:   *app,
+		Scope: constants.PAY_INVOICE_SCOPE,
+	}).Error
+	assert.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	topUpCalls := 0
+	transactionsService.SetTopUpCallback(func(tx *gorm.DB, topUpApp *db.App, shortfallMsat uint64) error {
+		topUpCalls++
+		return errors.New("funding app has insufficient balance")
+	})
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, nil, SendPaymentOptions{})
+	assert.ErrorIs(t, err, NewInsufficientBalanceError())
+	assert.Nil(t, transaction)
+	assert.Equal(t, 1, topUpCalls)
+
+	// a callback that does not top up enough is not retried
+	topUpCalls = 0
+	transactionsService.SetTopUpCallback(func(tx *gorm.DB, topUpApp *db.App, shortfallMsat uint64) error {
+		topUpCalls++
+		return tx.Create(&db.Transaction{
+			AppId:      &topUpApp.ID,
+			State:      constants.TRANSACTION_STATE_SETTLED,
+			Type:       constants.TRANSACTION_TYPE_INCOMING,
+			AmountMsat: shortfallMsat / 2,
+		}).Error
+	})
+	transaction, err = transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, nil, SendPaymentOptions{})
+	assert.ErrorIs(t, err, NewInsufficientBalanceError())
+	assert.Nil(t, transaction)
+	assert.Equal(t, 1, topUpCalls)
+	// the partial top-up is rolled back with the denied payment
+	assert.Equal(t, uint64(0), queries.GetIsolatedBalance(svc.DB, app.ID))
+}
+
+func getBalanceChangedEvents(consumedEvents []*events.Event) []*events.Event {
+	balanceChangedEvents := []*events.Event{}
+	for _, event := range consumedEvents {
+		if event.Event == "nwc_balance_changed" {
+			balanceChangedEvents = append(balanceChangedEvents, event)
+		}
+	}
+	return balanceChangedEvents
+}
+
+func getEventsExcept(consumedEvents []*events.Event, eventName string) []*events.Event {
+	filteredEvents := []*events.Event{}
+	for _, event := range consumedEvents {
+		if event.Event != eventName {
+			filteredEvents = append(filteredEvents, event)
+		}
+	}
+	return filteredEvents
+}
+
+func getEvents(consumedEvents []*events.Event, eventName string) []*events.Event {
+	filteredEvents := []*events.Event{}
+	for _, event := range consumedEvents {
+		if event.Event == eventName {
+			filteredEvents = append(filteredEvents, event)
+		}
+	}
+	return filteredEvents
+}
@@ -0,0 +1,158 @@
+package transactions
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/logger"
+	"github.com/sirupsen/logrus"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// aggregateKeysend accumulates a settled keysend into the app's open aggregated transaction
+// to the same destination, so streaming apps do not store a transaction per payment.
+// If the app has no aggregate that was added to within its aggregation window,
+// the keysend becomes a new aggregated transaction.
+// Once added to an aggregate, the keysend's own transaction is removed and the updated aggregate
+// is returned along with its previous state, so the settlement event can be published for it instead.
+func (svc *transactionsService) aggregateKeysend(tx *gorm.DB, dbTransaction *db.Transaction) (*db.Transaction, *db.Transaction, error) {
+	if dbTransaction.AppId == nil || dbTransaction.SelfPayment {
+		return nil, nil, nil
+	}
+
+	var app db.App
+	result := tx.Limit(1).Find(&app, &db.App{
+		ID: *dbTransaction.AppId,
+	})
+	if result.RowsAffected == 0 || app.KeysendAggregationWindowSeconds == 0 {
+		return nil, nil, nil
+	}
+
+	window := time.Duration(app.KeysendAggregationWindowSeconds) * time.Second
+	var aggregateTransaction db.Transaction
+	result = tx.Limit(1).
+		Where("id != ? AND updated_at > ?", dbTransaction.ID, time.Now().Add(-window)).
+		// keysends of different boost sessions are kept apart
+		Where(boostSessionIdColumn+" == ?", getBoostSessionId(dbTransaction.Metadata)).
+		Order("updated_at desc").
+		Find(&aggregateTransaction, &db.Transaction{
+			AppId:         dbTransaction.AppId,
+			Type:          constants.TRANSACTION_TYPE_OUTGOING,
+			State:         constants.TRANSACTION_STATE_SETTLED,
+			PayeePubkey:   dbTransaction.PayeePubkey,
+			AggregateOpen: true,
+		})
+	if result.Error != nil {
+		return nil, nil, result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		metadata, err := setKeysendCount(dbTransaction.Metadata, 1)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, tx.Model(dbTransaction).Updates(map[string]interface{}{
+			"AggregateOpen": true,
+			"Metadata":      metadata,
+		}).Error
+	}
+
+	previousAggregateTransaction := aggregateTransaction
+	metadata, err := setKeysendCount(aggregateTransaction.Metadata, getKeysendCount(aggregateTransaction.Metadata)+1)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = tx.Model(&aggregateTransaction).Updates(map[string]interface{}{
+		"AmountMsat": gorm.Expr("amount_msat + ?", dbTransaction.AmountMsat),
+		"FeeMsat":    gorm.Expr("fee_msat + ?", dbTransaction.FeeMsat),
+		"SettledAt":  dbTransaction.SettledAt,
+		"Metadata":   metadata,
+	}).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	err = tx.First(&aggregateTransaction, aggregateTransaction.ID).Error
+	if err != nil {
+		return nil, nil, err
+	}
+
+	logger.Logger.WithFields(logrus.Fields{
+		"payment_hash": dbTransaction.PaymentHash,
+		"aggregate_id": aggregateTransaction.ID,
+		"app_id":       *dbTransaction.AppId,
+		"payee_pubkey": dbTransaction.PayeePubkey,
+		"amount_msat":  dbTransaction.AmountMsat,
+		"fee_msat":     dbTransaction.FeeMsat,
+	}).Debug("Added keysend to aggregated transaction")
+
+	err = tx.Unscoped().Delete(dbTransaction).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	return &aggregateTransaction, &previousAggregateTransaction, nil
+}
+
+// FinalizeKeysendAggregate closes the app's open aggregated keysend transaction to the destination,
+// so the next keysend to it starts a new aggregated transaction.
+func (svc *transactionsService) FinalizeKeysendAggregate(ctx context.Context, appId uint, destination string) (*Transaction, error) {
+	var aggregateTransaction db.Transaction
+	result := svc.db.Limit(1).Order("updated_at desc").Find(&aggregateTransaction, &db.Transaction{
+		AppId:         &appId,
+		Type:          constants.TRANSACTION_TYPE_OUTGOING,
+		PayeePubkey:   destination,
+		AggregateOpen: true,
+	})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, NewNotFoundError()
+	}
+
+	// earlier aggregates may also still be marked open if their window expired
+	err := svc.db.Model(&db.Transaction{}).
+		Where(&db.Transaction{
+			AppId:         &appId,
+			Type:          constants.TRANSACTION_TYPE_OUTGOING,
+			PayeePubkey:   destination,
+			AggregateOpen: true,
+		}).
+		Update("aggregate_open", false).Error
+	if err != nil {
+		logger.Logger.WithError(err).WithField("app_id", appId).Error("Failed to finalize aggregated keysend transaction")
+		return nil, err
+	}
+
+	aggregateTransaction.AggregateOpen = false
+	return &aggregateTransaction, nil
+}
+
+func getKeysendCount(metadata datatypes.JSON) uint64 {
+	metadataMap := map[string]interface{}{}
+	if len(metadata) > 0 {
+		if err := json.Unmarshal(metadata, &metadataMap); err != nil {
+			return 0
+		}
+	}
+	keysendCount, _ := metadataMap[constants.KEYSEND_COUNT_METADATA_KEY].(float64)
+	return uint64(keysendCount)
+}
+
+func setKeysendCount(metadata datatypes.JSON, keysendCount uint64) (datatypes.JSON, error) {
+	metadataMap := map[string]interface{}{}
+	if len(metadata) > 0 {
+		if err := json.Unmarshal(metadata, &metadataMap); err != nil {
+			return nil, err
+		}
+	}
+	metadataMap[constants.KEYSEND_COUNT_METADATA_KEY] = keysendCount
+	metadataBytes, err := json.Marshal(metadataMap)
+	if err != nil {
+		return nil, err
+	}
+	return datatypes.JSON(metadataBytes), nil
+}
@@ -0,0 +1,183 @@
+package transactions
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendKeysend_Aggregation(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, err := tests.CreateAppWithPermissions(svc, &db.AppPermission{Scope: constants.PAY_INVOICE_SCOPE})
+	require.NoError(t, err)
+	err = svc.DB.Model(app).Update("keysend_aggregation_window_seconds", 60).Error
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	for i := 0; i < 3; i++ {
+		transaction, err := transactionsService.SendKeysend(ctx, uint64(1000), mockKeysendDestination, nil, "", "", svc.LNClient, &app.ID, nil)
+		assert.NoError(t, err)
+		// each keysend still returns its own result
+		assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transaction.State)
+		assert.Equal(t, uint64(1000), transaction.AmountMsat)
+		assert.NotNil(t, transaction.Preimage)
+	}
+	// a different destination is aggregated separately
+	_, err = transactionsService.SendKeysend(ctx, uint64(5000), otherKeysendDestination, nil, "", "", svc.LNClient, &app.ID, nil)
+	assert.NoError(t, err)
+
+	var transactions []db.Transaction
+	svc.DB.Order("id").Find(&transactions)
+	require.Equal(t, 2, len(transactions))
+
+	assert.Equal(t, mockKeysendDestination, transactions[0].PayeePubkey)
+	assert.Equal(t, uint64(3000), transactions[0].AmountMsat)
+	assert.Equal(t, uint64(3), transactions[0].FeeMsat)
+	assert.True(t, transactions[0].AggregateOpen)
+	assert.Equal(t, float64(3), getMetadata(t, transactions[0])[constants.KEYSEND_COUNT_METADATA_KEY])
+
+	assert.Equal(t, otherKeysendDestination, transactions[1].PayeePubkey)
+	assert.Equal(t, uint64(5000), transactions[1].AmountMsat)
+	assert.Equal(t, float64(1), getMetadata(t, transactions[1])[constants.KEYSEND_COUNT_METADATA_KEY])
+}
+
+func TestSendKeysend_Aggregation_SettledEventForAggregate(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, err := tests.CreateAppWithPermissions(svc, &db.AppPermission{Scope: constants.PAY_INVOICE_SCOPE})
+	require.NoError(t, err)
+	err = svc.DB.Model(app).Update("keysend_aggregation_window_seconds", 60).Error
+	require.NoError(t, err)
+
+	mockEventConsumer := tests.NewMockEventConsumer()
+	svc.EventPublisher.RegisterSubscriber(mockEventConsumer)
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	for i := 0; i < 2; i++ {
+		_, err = transactionsService.SendKeysend(ctx, uint64(1000), mockKeysendDestination, nil, "", "", svc.LNClient, &app.ID, nil)
+		assert.NoError(t, err)
+	}
+
+	var aggregateTransaction db.Transaction
+	require.NoError(t, svc.DB.First(&aggregateTransaction).Error)
+
+	sentAmounts := []uint64{}
+	for _, event := range mockEventConsumer.GetConsumedEvents() {
+		if event.Event == "nwc_payment_sent" {
+			// the second keysend's own transaction was removed, so its event is about the aggregate
+			assert.Equal(t, aggregateTransaction.ID, event.Properties.(*db.Transaction).ID)
+			sentAmounts = append(sentAmounts, event.Properties.(*db.Transaction).AmountMsat)
+		}
+	}
+	assert.ElementsMatch(t, []uint64{1000, 2000}, sentAmounts)
+}
+
+func TestSendKeysend_Aggregation_Finalize(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, err := tests.CreateAppWithPermissions(svc, &db.AppPermission{Scope: constants.PAY_INVOICE_SCOPE})
+	require.NoError(t, err)
+	err = svc.DB.Model(app).Update("keysend_aggregation_window_seconds", 60).Error
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	for i := 0; i < 2; i++ {
+		_, err = transactionsService.SendKeysend(ctx, uint64(1000), mockKeysendDestination, nil, "", "", svc.LNClient, &app.ID, nil)
+		assert.NoError(t, err)
+	}
+
+	aggregateTransaction, err := transactionsService.FinalizeKeysendAggregate(ctx, app.ID, mockKeysendDestination)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2000), aggregateTransaction.AmountMsat)
+	assert.False(t, aggregateTransaction.AggregateOpen)
+
+	_, err = transactionsService.FinalizeKeysendAggregate(ctx, app.ID, mockKeysendDestination)
+	assert.ErrorIs(t, err, NewNotFoundError())
+
+	// the next keysend starts a new aggregate
+	_, err = transactionsService.SendKeysend(ctx, uint64(1000), mockKeysendDestination, nil, "", "", svc.LNClient, &app.ID, nil)
+	assert.NoError(t, err)
+
+	var transactions []db.Transaction
+	svc.DB.Order("id").Find(&transactions)
+	require.Equal(t, 2, len(transactions))
+	assert.Equal(t, uint64(2000), transactions[0].AmountMsat)
+	assert.False(t, transactions[0].AggregateOpen)
+	assert.Equal(t, uint64(1000), transactions[1].AmountMsat)
+	assert.True(t, transactions[1].AggregateOpen)
+}
+
+func TestSendKeysend_Aggregation_WindowExpired(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, err := tests.CreateAppWithPermissions(svc, &db.AppPermission{Scope: constants.PAY_INVOICE_SCOPE})
+	require.NoError(t, err)
+	err = svc.DB.Model(app).Update("keysend_aggregation_window_seconds", 60).Error
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.SendKeysend(ctx, uint64(1000), mockKeysendDestination, nil, "", "", svc.LNClient, &app.ID, nil)
+	assert.NoError(t, err)
+	svc.DB.Model(transaction).UpdateColumn("updated_at", time.Now().Add(-2*time.Minute))
+
+	_, err = transactionsService.SendKeysend(ctx, uint64(1000), mockKeysendDestination, nil, "", "", svc.LNClient, &app.ID, nil)
+	assert.NoError(t, err)
+
+	var count int64
+	svc.DB.Model(&db.Transaction{}).Count(&count)
+	assert.Equal(t, int64(2), count)
+}
+
+func TestSendKeysend_Aggregation_Disabled(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, err := tests.CreateAppWithPermissions(svc, &db.AppPermission{Scope: constants.PAY_INVOICE_SCOPE})
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	for i := 0; i < 2; i++ {
+		_, err = transactionsService.SendKeysend(ctx, uint64(1000), mockKeysendDestination, nil, "", "", svc.LNClient, &app.ID, nil)
+		assert.NoError(t, err)
+	}
+
+	var transactions []db.Transaction
+	svc.DB.Find(&transactions)
+	assert.Equal(t, 2, len(transactions))
+	for _, transaction := range transactions {
+		assert.False(t, transaction.AggregateOpen)
+	}
+}
+
+func getMetadata(t *testing.T, transaction db.Transaction) map[string]interface{} {
+	metadata := map[string]interface{}{}
+	err := json.Unmarshal(transaction.Metadata, &metadata)
+	require.NoError(t, err)
+	return metadata
+}
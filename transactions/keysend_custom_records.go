@@ -0,0 +1,40 @@
+package transactions
+
+import (
+	"fmt"
+
+	"github.com/getAlby/hub/lnclient"
+)
+
+// limits on the custom records of a keysend, which are stored in the transaction's metadata.
+// The onion payload of a payment is limited to 1300 bytes, so larger records cannot be sent anyway
+const (
+	defaultMaxKeysendCustomRecords     = 100
+	defaultMaxKeysendCustomRecordsSize = 1300
+)
+
+// SetKeysendCustomRecordLimits sets the maximum number of custom records of a keysend
+// and their maximum total size in bytes (0 = no limit)
+func (svc *transactionsService) SetKeysendCustomRecordLimits(maxCount int, maxSize int) {
+	svc.maxKeysendCustomRecords = maxCount
+	svc.maxKeysendCustomRecordsSize = maxSize
+}
+
+// validateKeysendCustomRecords rejects keysends with too many or too large custom records
+func (svc *transactionsService) validateKeysendCustomRecords(customRecords []lnclient.TLVRecord) error {
+	if svc.maxKeysendCustomRecords > 0 && len(customRecords) > svc.maxKeysendCustomRecords {
+		return newCustomRecordsLimitExceededErrorWithReason(fmt.Sprintf("%d records exceed the maximum of %d", len(customRecords), svc.maxKeysendCustomRecords))
+	}
+
+	if svc.maxKeysendCustomRecordsSize > 0 {
+		// values are hex-encoded
+		size := 0
+		for _, customRecord := range customRecords {
+			size += len(customRecord.Value) / 2
+		}
+		if size > svc.maxKeysendCustomRecordsSize {
+			return newCustomRecordsLimitExceededErrorWithReason(fmt.Sprintf("%d bytes exceed the maximum of %d", size, svc.maxKeysendCustomRecordsSize))
+		}
+	}
+	return nil
+}
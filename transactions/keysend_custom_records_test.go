@@ -0,0 +1,93 @@
+package transactions
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/lnclient"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makeCustomRecords(count int, valueSize int) []lnclient.TLVRecord {
+	customRecords := []lnclient.TLVRecord{}
+	for i := 0; i < count; i++ {
+		customRecords = append(customRecords, lnclient.TLVRecord{
+			Type:  uint64(65536 + i),
+			Value: strings.Repeat("ab", valueSize),
+		})
+	}
+	return customRecords
+}
+
+func TestSendKeysend_CustomRecordLimits(t *testing.T) {
+	ctx := context.TODO()
+
+	for name, testCase := range map[string]struct {
+		maxCount      int
+		maxSize       int
+		customRecords []lnclient.TLVRecord
+		expectedError string
+	}{
+		"default count limit met": {
+			maxCount:      defaultMaxKeysendCustomRecords,
+			maxSize:       defaultMaxKeysendCustomRecordsSize,
+			customRecords: makeCustomRecords(defaultMaxKeysendCustomRecords, 1),
+		},
+		"default count limit exceeded": {
+			maxCount:      defaultMaxKeysendCustomRecords,
+			maxSize:       defaultMaxKeysendCustomRecordsSize,
+			customRecords: makeCustomRecords(defaultMaxKeysendCustomRecords+1, 1),
+			expectedError: "The custom records exceed the limit: 101 records exceed the maximum of 100",
+		},
+		"count limit met": {
+			maxCount:      2,
+			customRecords: makeCustomRecords(2, 10),
+		},
+		"count limit exceeded": {
+			maxCount:      2,
+			customRecords: makeCustomRecords(3, 10),
+			expectedError: "The custom records exceed the limit: 3 records exceed the maximum of 2",
+		},
+		"size limit met": {
+			maxSize:       30,
+			customRecords: makeCustomRecords(3, 10),
+		},
+		"size limit exceeded": {
+			maxSize:       30,
+			customRecords: append(makeCustomRecords(2, 10), makeCustomRecords(1, 11)...),
+			expectedError: "The custom records exceed the limit: 31 bytes exceed the maximum of 30",
+		},
+		"no limits": {
+			customRecords: makeCustomRecords(200, 10),
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer tests.RemoveTestService()
+			svc, err := tests.CreateTestService()
+			require.NoError(t, err)
+
+			transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+			transactionsService.SetKeysendCustomRecordLimits(testCase.maxCount, testCase.maxSize)
+
+			transaction, err := transactionsService.SendKeysend(ctx, uint64(1000), mockKeysendDestination, testCase.customRecords, "", "", svc.LNClient, nil, nil)
+			if testCase.expectedError != "" {
+				assert.ErrorIs(t, err, NewCustomRecordsLimitExceededError())
+				assert.EqualError(t, err, testCase.expectedError)
+				assert.Nil(t, transaction)
+
+				// no transaction is created
+				var count int64
+				svc.DB.Model(&db.Transaction{}).Count(&count)
+				assert.Zero(t, count)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transaction.State)
+		})
+	}
+}
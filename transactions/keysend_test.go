@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/getAlby/hub/constants"
@@ -16,6 +17,9 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+const mockKeysendDestination = "02c7ae891112df2b233dd9bc38df676bbaddf75bd85789b4dc32405871e3519fc2"
+const otherKeysendDestination = "02ff7c3da0679c37c2914a1f392a88a01a243a0773a1794fba7252e15e4e40f4f3"
+
 func TestSendKeysend(t *testing.T) {
 	ctx := context.TODO()
 
@@ -27,14 +31,14 @@ func TestSendKeysend(t *testing.T) {
 	svc.EventPublisher.RegisterSubscriber(mockEventConsumer)
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
-	transaction, err := transactionsService.SendKeysend(ctx, uint64(1000), "fake destination", nil, "", svc.LNClient, nil, nil)
+	transaction, err := transactionsService.SendKeysend(ctx, uint64(1000), mockKeysendDestination, nil, "", "", svc.LNClient, nil, nil)
 	assert.NoError(t, err)
 
 	var metadata lnclient.Metadata
 	err = json.Unmarshal(transaction.Metadata, &metadata)
 	assert.NoError(t, err)
 
-	assert.Equal(t, "fake destination", metadata["destination"])
+	assert.Equal(t, mockKeysendDestination, metadata["destination"])
 	assert.Nil(t, metadata["tlv_records"])
 	assert.Equal(t, uint64(1000), transaction.AmountMsat)
 	assert.Equal(t, constants.TRANSACTION_TYPE_OUTGOING, transaction.Type)
@@ -57,14 +61,14 @@ func TestSendKeysend_CustomPreimage(t *testing.T) {
 
 	customPreimage := "018465013e2337234a7e5530a21c4a8cf70d84231f4a8ff0b1e2cce3cb2bd03b"
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
-	transaction, err := transactionsService.SendKeysend(ctx, uint64(1000), "fake destination", nil, customPreimage, svc.LNClient, nil, nil)
+	transaction, err := transactionsService.SendKeysend(ctx, uint64(1000), mockKeysendDestination, nil, customPreimage, "", svc.LNClient, nil, nil)
 	assert.NoError(t, err)
 
 	var metadata lnclient.Metadata
 	err = json.Unmarshal(transaction.Metadata, &metadata)
 	assert.NoError(t, err)
 
-	assert.Equal(t, "fake destination", metadata["destination"])
+	assert.Equal(t, mockKeysendDestination, metadata["destination"])
 	assert.Nil(t, metadata["tlv_records"])
 	assert.Equal(t, uint64(1000), transaction.AmountMsat)
 	assert.Equal(t, constants.TRANSACTION_TYPE_OUTGOING, transaction.Type)
@@ -74,6 +78,35 @@ func TestSendKeysend_CustomPreimage(t *testing.T) {
 	assert.Equal(t, customPreimage, *transaction.Preimage)
 }
 
+func TestSendKeysend_CustomPreimage_Duplicate(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	mockEventConsumer := tests.NewMockEventConsumer()
+	svc.EventPublisher.RegisterSubscriber(mockEventConsumer)
+
+	customPreimage := "018465013e2337234a7e5530a21c4a8cf70d84231f4a8ff0b1e2cce3cb2bd03b"
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.SendKeysend(ctx, uint64(1000), mockKeysendDestination, nil, customPreimage, "", svc.LNClient, nil, nil)
+	assert.NoError(t, err)
+
+	duplicateTransaction, err := transactionsService.SendKeysend(ctx, uint64(1000), mockKeysendDestination, nil, customPreimage, "", svc.LNClient, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, transaction.ID, duplicateTransaction.ID)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, duplicateTransaction.State)
+	assert.Equal(t, customPreimage, *duplicateTransaction.Preimage)
+
+	var count int64
+	svc.DB.Model(&db.Transaction{}).Where("type = ?", constants.TRANSACTION_TYPE_OUTGOING).Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	// the keysend was only sent once
+	assert.Equal(t, 1, len(mockEventConsumer.GetConsumedEvents()))
+}
+
 func TestSendKeysend_App_NoPermission(t *testing.T) {
 	ctx := context.TODO()
 
@@ -89,7 +122,7 @@ func TestSendKeysend_App_NoPermission(t *testing.T) {
 	assert.NoError(t, err)
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
-	transaction, err := transactionsService.SendKeysend(ctx, uint64(1000), "fake destination", nil, "", svc.LNClient, &app.ID, &dbRequestEvent.ID)
+	transaction, err := transactionsService.SendKeysend(ctx, uint64(1000), mockKeysendDestination, nil, "", "", svc.LNClient, &app.ID, &dbRequestEvent.ID)
 
 	assert.Error(t, err)
 	assert.Equal(t, "app does not have pay_invoice scope", err.Error())
@@ -119,14 +152,14 @@ func TestSendKeysend_App_WithPermission(t *testing.T) {
 	assert.NoError(t, err)
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
-	transaction, err := transactionsService.SendKeysend(ctx, uint64(1000), "fake destination", nil, "", svc.LNClient, &app.ID, &dbRequestEvent.ID)
+	transaction, err := transactionsService.SendKeysend(ctx, uint64(1000), mockKeysendDestination, nil, "", "", svc.LNClient, &app.ID, &dbRequestEvent.ID)
 	assert.NoError(t, err)
 
 	var metadata lnclient.Metadata
 	err = json.Unmarshal(transaction.Metadata, &metadata)
 	assert.NoError(t, err)
 
-	assert.Equal(t, "fake destination", metadata["destination"])
+	assert.Equal(t, mockKeysendDestination, metadata["destination"])
 	assert.Nil(t, metadata["tlv_records"])
 	assert.Equal(t, uint64(1000), transaction.AmountMsat)
 	assert.Equal(t, constants.TRANSACTION_TYPE_OUTGOING, transaction.Type)
@@ -165,16 +198,20 @@ func TestSendKeysend_App_BudgetExceeded(t *testing.T) {
 	svc.EventPublisher.RegisterSubscriber(mockEventConsumer)
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
-	transaction, err := transactionsService.SendKeysend(ctx, uint64(1000), "fake destination", nil, "", svc.LNClient, &app.ID, &dbRequestEvent.ID)
+	transaction, err := transactionsService.SendKeysend(ctx, uint64(1500), mockKeysendDestination, nil, "", "", svc.LNClient, &app.ID, &dbRequestEvent.ID)
 
 	assert.ErrorIs(t, err, NewQuotaExceededError())
 	assert.Nil(t, transaction)
+	// 1.5 sat payment + 10 sat fee reserve, 10 sat budget
+	assert.Contains(t, err.Error(), "requested 11.5 sat (11500 msat), only 10 sat (10000 msat) remaining")
 
 	assert.Equal(t, 1, len(mockEventConsumer.GetConsumedEvents()))
 	assert.Equal(t, "nwc_permission_denied", mockEventConsumer.GetConsumedEvents()[0].Event)
 	assert.Equal(t, app.Name, mockEventConsumer.GetConsumedEvents()[0].Properties.(map[string]interface{})["app_name"])
 	assert.Equal(t, constants.ERROR_QUOTA_EXCEEDED, mockEventConsumer.GetConsumedEvents()[0].Properties.(map[string]interface{})["code"])
-	assert.Equal(t, NewQuotaExceededError().Error(), mockEventConsumer.GetConsumedEvents()[0].Properties.(map[string]interface{})["message"])
+	assert.Equal(t, err.Error(), mockEventConsumer.GetConsumedEvents()[0].Properties.(map[string]interface{})["message"])
+	assert.Equal(t, uint64(11500), mockEventConsumer.GetConsumedEvents()[0].Properties.(map[string]interface{})["requested_msat"])
+	assert.Equal(t, uint64(10000), mockEventConsumer.GetConsumedEvents()[0].Properties.(map[string]interface{})["remaining_msat"])
 }
 func TestSendKeysend_App_BudgetNotExceeded(t *testing.T) {
 	ctx := context.TODO()
@@ -200,14 +237,14 @@ func TestSendKeysend_App_BudgetNotExceeded(t *testing.T) {
 	assert.NoError(t, err)
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
-	transaction, err := transactionsService.SendKeysend(ctx, uint64(1000), "fake destination", nil, "", svc.LNClient, &app.ID, &dbRequestEvent.ID)
+	transaction, err := transactionsService.SendKeysend(ctx, uint64(1000), mockKeysendDestination, nil, "", "", svc.LNClient, &app.ID, &dbRequestEvent.ID)
 	assert.NoError(t, err)
 
 	var metadata lnclient.Metadata
 	err = json.Unmarshal(transaction.Metadata, &metadata)
 	assert.NoError(t, err)
 
-	assert.Equal(t, "fake destination", metadata["destination"])
+	assert.Equal(t, mockKeysendDestination, metadata["destination"])
 	assert.Nil(t, metadata["tlv_records"])
 	assert.Equal(t, uint64(1000), transaction.AmountMsat)
 	assert.Equal(t, constants.TRANSACTION_TYPE_OUTGOING, transaction.Type)
@@ -251,7 +288,7 @@ func TestSendKeysend_App_BalanceExceeded(t *testing.T) {
 	})
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
-	transaction, err := transactionsService.SendKeysend(ctx, uint64(1000), "fake destination", nil, "", svc.LNClient, &app.ID, &dbRequestEvent.ID)
+	transaction, err := transactionsService.SendKeysend(ctx, uint64(1000), mockKeysendDestination, nil, "", "", svc.LNClient, &app.ID, &dbRequestEvent.ID)
 
 	assert.ErrorIs(t, err, NewInsufficientBalanceError())
 	assert.Nil(t, transaction)
@@ -289,14 +326,14 @@ func TestSendKeysend_App_BalanceSufficient(t *testing.T) {
 	})
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
-	transaction, err := transactionsService.SendKeysend(ctx, uint64(1000), "fake destination", nil, "", svc.LNClient, &app.ID, &dbRequestEvent.ID)
+	transaction, err := transactionsService.SendKeysend(ctx, uint64(1000), mockKeysendDestination, nil, "", "", svc.LNClient, &app.ID, &dbRequestEvent.ID)
 	assert.NoError(t, err)
 
 	var metadata lnclient.Metadata
 	err = json.Unmarshal(transaction.Metadata, &metadata)
 	assert.NoError(t, err)
 
-	assert.Equal(t, "fake destination", metadata["destination"])
+	assert.Equal(t, mockKeysendDestination, metadata["destination"])
 	assert.Nil(t, metadata["tlv_records"])
 	assert.Equal(t, uint64(1000), transaction.AmountMsat)
 	assert.Equal(t, constants.TRANSACTION_TYPE_OUTGOING, transaction.Type)
@@ -316,19 +353,19 @@ func TestSendKeysend_TLVs(t *testing.T) {
 	require.NoError(t, err)
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
-	transaction, err := transactionsService.SendKeysend(ctx, uint64(1000), "fake destination", []lnclient.TLVRecord{
+	transaction, err := transactionsService.SendKeysend(ctx, uint64(1000), mockKeysendDestination, []lnclient.TLVRecord{
 		{
 			Type:  7629169,
 			Value: "7b22616374696f6e223a22626f6f7374222c2276616c75655f6d736174223a313030302c2276616c75655f6d7361745f746f74616c223a313030302c226170705f6e616d65223a22e29aa1205765624c4e2044656d6f222c226170705f76657273696f6e223a22312e30222c22666565644944223a2268747470733a2f2f66656564732e706f6463617374696e6465782e6f72672f706332302e786d6c222c22706f6463617374223a22506f6463617374696e6720322e30222c22657069736f6465223a22457069736f6465203130343a2041204e65772044756d70222c227473223a32312c226e616d65223a22e29aa1205765624c4e2044656d6f222c2273656e6465725f6e616d65223a225361746f736869204e616b616d6f746f222c226d657373616765223a22476f20706f6463617374696e6721227d",
 		},
-	}, "", svc.LNClient, nil, nil)
+	}, "", "", svc.LNClient, nil, nil)
 	assert.NoError(t, err)
 
 	var metadata lnclient.Metadata
 	err = json.Unmarshal(transaction.Metadata, &metadata)
 	assert.NoError(t, err)
 
-	assert.Equal(t, "fake destination", metadata["destination"])
+	assert.Equal(t, mockKeysendDestination, metadata["destination"])
 	assert.NotNil(t, metadata["tlv_records"])
 
 	var boostagram Boostagram
@@ -364,7 +401,7 @@ func TestSendKeysend_IsolatedAppToNoApp(t *testing.T) {
 	require.NoError(t, err)
 
 	// setup for self payment
-	svc.LNClient.(*tests.MockLn).Pubkey = "02a5056398235568fc049a5d563f1adf666041d590b268167e4fa145fbf71aa578"
+	svc.LNClient.(*tests.MockLn).Pubkey = "02ff7c3da0679c37c2914a1f392a88a01a243a0773a1794fba7252e15e4e40f4f3"
 
 	app, _, err := tests.CreateApp(svc)
 	assert.NoError(t, err)
@@ -395,7 +432,7 @@ func TestSendKeysend_IsolatedAppToNoApp(t *testing.T) {
 	mockPreimage := "c8aeb44ae8eb269c8dbfb7ec5c263f0bfa3d755bc0ca641b8ee118673afda657"
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
-	transaction, err := transactionsService.SendKeysend(ctx, 123000, "02a5056398235568fc049a5d563f1adf666041d590b268167e4fa145fbf71aa578", []lnclient.TLVRecord{}, mockPreimage, svc.LNClient, &app.ID, &dbRequestEvent.ID)
+	transaction, err := transactionsService.SendKeysend(ctx, 123000, "02ff7c3da0679c37c2914a1f392a88a01a243a0773a1794fba7252e15e4e40f4f3", []lnclient.TLVRecord{}, mockPreimage, "", svc.LNClient, &app.ID, &dbRequestEvent.ID)
 
 	assert.NoError(t, err)
 	assert.NotNil(t, transaction)
@@ -407,7 +444,7 @@ func TestSendKeysend_IsolatedAppToNoApp(t *testing.T) {
 	assert.True(t, transaction.SelfPayment)
 
 	transactionType := constants.TRANSACTION_TYPE_INCOMING
-	incomingTransaction, err := transactionsService.LookupTransaction(ctx, transaction.PaymentHash, &transactionType, svc.LNClient, nil)
+	incomingTransaction, err := transactionsService.LookupTransaction(ctx, transaction.PaymentHash, &transactionType, svc.LNClient, nil, false)
 	assert.NoError(t, err)
 	assert.Equal(t, uint64(123000), incomingTransaction.AmountMsat)
 	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, incomingTransaction.State)
@@ -421,6 +458,52 @@ func TestSendKeysend_IsolatedAppToNoApp(t *testing.T) {
 	assert.Equal(t, uint64(10000), queries.GetIsolatedBalance(svc.DB, app.ID))
 }
 
+func TestSendKeysend_InvalidDestination(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	for name, destination := range map[string]string{
+		"empty":        "",
+		"too short":    mockKeysendDestination[:64],
+		"too long":     mockKeysendDestination + "00",
+		"not hex":      "02" + strings.Repeat("z", 64),
+		"uncompressed": "04" + mockKeysendDestination[2:],
+	} {
+		t.Run(name, func(t *testing.T) {
+			transaction, err := transactionsService.SendKeysend(ctx, uint64(1000), destination, nil, "", "", svc.LNClient, nil, nil)
+			assert.ErrorIs(t, err, NewInvalidDestinationError())
+			assert.Nil(t, transaction)
+		})
+	}
+
+	var count int64
+	svc.DB.Model(&db.Transaction{}).Count(&count)
+	assert.Zero(t, count)
+}
+
+func TestSendKeysend_SelfPayment_MixedCaseDestination(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	// setup for self payment
+	svc.LNClient.(*tests.MockLn).Pubkey = "02ff7c3da0679c37c2914a1f392a88a01a243a0773a1794fba7252e15e4e40f4f3"
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.SendKeysend(ctx, 123000, strings.ToUpper("02ff7c3da0679c37c2914a1f392a88a01a243a0773a1794fba7252e15e4e40f4f3"), nil, "", "", svc.LNClient, nil, nil)
+	assert.NoError(t, err)
+	assert.True(t, transaction.SelfPayment)
+	assert.Equal(t, "02ff7c3da0679c37c2914a1f392a88a01a243a0773a1794fba7252e15e4e40f4f3", transaction.PayeePubkey)
+	assert.Zero(t, transaction.FeeMsat)
+}
+
 func TestSendKeysend_IsolatedAppToIsolatedApp(t *testing.T) {
 	ctx := context.TODO()
 
@@ -429,7 +512,7 @@ func TestSendKeysend_IsolatedAppToIsolatedApp(t *testing.T) {
 	require.NoError(t, err)
 
 	// setup for self payment
-	svc.LNClient.(*tests.MockLn).Pubkey = "02a5056398235568fc049a5d563f1adf666041d590b268167e4fa145fbf71aa578"
+	svc.LNClient.(*tests.MockLn).Pubkey = "02ff7c3da0679c37c2914a1f392a88a01a243a0773a1794fba7252e15e4e40f4f3"
 
 	app, _, err := tests.CreateApp(svc)
 	assert.NoError(t, err)
@@ -481,7 +564,7 @@ func TestSendKeysend_IsolatedAppToIsolatedApp(t *testing.T) {
 	svc.EventPublisher.RegisterSubscriber(mockEventConsumer)
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
-	transaction, err := transactionsService.SendKeysend(ctx, 123000, "02a5056398235568fc049a5d563f1adf666041d590b268167e4fa145fbf71aa578", tlvRecords, mockPreimage, svc.LNClient, &app.ID, &dbRequestEvent.ID)
+	transaction, err := transactionsService.SendKeysend(ctx, 123000, "02ff7c3da0679c37c2914a1f392a88a01a243a0773a1794fba7252e15e4e40f4f3", tlvRecords, mockPreimage, "", svc.LNClient, &app.ID, &dbRequestEvent.ID)
 
 	assert.NoError(t, err)
 	assert.NotNil(t, transaction)
@@ -493,7 +576,7 @@ func TestSendKeysend_IsolatedAppToIsolatedApp(t *testing.T) {
 	assert.True(t, transaction.SelfPayment)
 
 	transactionType := constants.TRANSACTION_TYPE_INCOMING
-	incomingTransaction, err := transactionsService.LookupTransaction(ctx, transaction.PaymentHash, &transactionType, svc.LNClient, &app2.ID)
+	incomingTransaction, err := transactionsService.LookupTransaction(ctx, transaction.PaymentHash, &transactionType, svc.LNClient, &app2.ID, false)
 	assert.NoError(t, err)
 	assert.Equal(t, uint64(123000), incomingTransaction.AmountMsat)
 	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, incomingTransaction.State)
@@ -516,13 +599,16 @@ func TestSendKeysend_IsolatedAppToIsolatedApp(t *testing.T) {
 	assert.Equal(t, uint64(123000), queries.GetIsolatedBalance(svc.DB, app2.ID))
 
 	// check notifications
-	assert.Equal(t, 2, len(mockEventConsumer.GetConsumedEvents()))
+	consumedEvents := mockEventConsumer.GetConsumedEvents()
+	assert.Equal(t, 2, len(getBalanceChangedEvents(consumedEvents)))
+	paymentEvents := getEventsExcept(consumedEvents, "nwc_balance_changed")
+	assert.Equal(t, 2, len(paymentEvents))
 
-	assert.Equal(t, "nwc_payment_sent", mockEventConsumer.GetConsumedEvents()[1].Event)
-	settledTransaction := mockEventConsumer.GetConsumedEvents()[1].Properties.(*db.Transaction)
+	assert.Equal(t, "nwc_payment_sent", paymentEvents[1].Event)
+	settledTransaction := paymentEvents[1].Properties.(*db.Transaction)
 	assert.Equal(t, transaction.ID, settledTransaction.ID)
 
-	assert.Equal(t, "nwc_payment_received", mockEventConsumer.GetConsumedEvents()[0].Event)
-	receivedTransaction := mockEventConsumer.GetConsumedEvents()[0].Properties.(*db.Transaction)
+	assert.Equal(t, "nwc_payment_received", paymentEvents[0].Event)
+	receivedTransaction := paymentEvents[0].Properties.(*db.Transaction)
 	assert.Equal(t, incomingTransaction.ID, receivedTransaction.ID)
 }
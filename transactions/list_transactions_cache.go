@@ -0,0 +1,112 @@
+package transactions
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/getAlby/hub/logger"
+	"gorm.io/gorm"
+)
+
+// listTransactionsCache holds recent ListTransactions results keyed by their filters.
+// Entries are dropped when they expire or whenever the transactions table is written to.
+type listTransactionsCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]listTransactionsCacheEntry
+	// the database write callbacks that invalidate the cache are registered once it is enabled
+	registerInvalidation sync.Once
+}
+
+type listTransactionsCacheEntry struct {
+	transactions []Transaction
+	expiresAt    time.Time
+}
+
+// SetListTransactionsCacheTTL enables caching of ListTransactions results for the given duration.
+// A zero duration disables the cache (the default).
+func (svc *transactionsService) SetListTransactionsCacheTTL(ttl time.Duration) {
+	if ttl > 0 {
+		svc.listTransactionsCache.registerInvalidation.Do(svc.registerListTransactionsCacheInvalidation)
+	}
+	svc.listTransactionsCache.mu.Lock()
+	defer svc.listTransactionsCache.mu.Unlock()
+	svc.listTransactionsCache.ttl = ttl
+	svc.listTransactionsCache.entries = map[string]listTransactionsCacheEntry{}
+}
+
+// registerListTransactionsCacheInvalidation invalidates the cache after every create, update or delete
+// of transactions is committed, whichever code path makes it. Writes within a database transaction
+// are seen before it commits, so inTransaction invalidates the cache again once committed
+func (svc *transactionsService) registerListTransactionsCacheInvalidation() {
+	invalidate := func(tx *gorm.DB) {
+		if tx.Statement.Table == "transactions" {
+			svc.listTransactionsCache.invalidate()
+		}
+	}
+	// callbacks are shared by every service using the database, so each needs its own name
+	name := fmt.Sprintf("transactions:invalidate_list_transactions_cache_%p", svc)
+	callbacks := svc.db.Callback()
+	for _, err := range []error{
+		callbacks.Create().After("gorm:commit_or_rollback_transaction").Register(name, invalidate),
+		callbacks.Update().After("gorm:commit_or_rollback_transaction").Register(name, invalidate),
+		callbacks.Delete().After("gorm:commit_or_rollback_transaction").Register(name, invalidate),
+	} {
+		if err != nil {
+			logger.Logger.WithError(err).Error("Failed to register list transactions cache invalidation")
+		}
+	}
+}
+
+func (cache *listTransactionsCache) get(key string) ([]Transaction, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.ttl <= 0 {
+		return nil, false
+	}
+	entry, ok := cache.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(cache.entries, key)
+		return nil, false
+	}
+	// callers may modify the returned transactions
+	return slices.Clone(entry.transactions), true
+}
+
+func (cache *listTransactionsCache) set(key string, transactions []Transaction) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.ttl <= 0 {
+		return
+	}
+	cache.entries[key] = listTransactionsCacheEntry{
+		transactions: slices.Clone(transactions),
+		expiresAt:    time.Now().Add(cache.ttl),
+	}
+}
+
+func (cache *listTransactionsCache) invalidate() {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if len(cache.entries) > 0 {
+		cache.entries = map[string]listTransactionsCacheEntry{}
+	}
+}
+
+func listTransactionsCacheKey(from, until, limit, offset uint64, unpaidOutgoing bool, unpaidIncoming bool, transactionType *string, appId *uint, forceFilterByAppId bool, filter ListTransactionsFilter) string {
+	return fmt.Sprintf("%d|%d|%d|%d|%t|%t|%s|%s|%t|%t|%s|%t|%s|%t|%s|%t",
+		from, until, limit, offset, unpaidOutgoing, unpaidIncoming, formatOptional(transactionType), formatOptional(appId),
+		forceFilterByAppId, filter.OmitLargeFields, formatOptional(filter.Environment), filter.IncludeDeleted, formatOptional(filter.PaymentKind), filter.PinnedOnly, formatOptional(filter.IncomingKind), filter.BoostsOnly)
+}
+
+func formatOptional[T any](value *T) string {
+	if value == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%v", *value)
+}
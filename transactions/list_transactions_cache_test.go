@@ -0,0 +1,204 @@
+package transactions
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/events"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListTransactionsCache_Disabled(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	transactions, err := transactionsService.ListTransactions(ctx, 0, 0, 0, 0, false, false, nil, svc.LNClient, nil, false, ListTransactionsFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(transactions))
+
+	createSettledTransaction(svc, "hash1")
+
+	transactions, err = transactionsService.ListTransactions(ctx, 0, 0, 0, 0, false, false, nil, svc.LNClient, nil, false, ListTransactionsFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(transactions))
+}
+
+func TestListTransactionsCache_Hit(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transactionsService.SetListTransactionsCacheTTL(time.Minute)
+
+	createSettledTransaction(svc, "hash1")
+
+	transactions, err := transactionsService.ListTransactions(ctx, 0, 0, 0, 0, false, false, nil, svc.LNClient, nil, false, ListTransactionsFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(transactions))
+
+	// raw SQL bypasses the write callbacks, so the cache is not invalidated
+	insertSettledTransactionRaw(t, svc, "hash2")
+
+	transactions, err = transactionsService.ListTransactions(ctx, 0, 0, 0, 0, false, false, nil, svc.LNClient, nil, false, ListTransactionsFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(transactions))
+
+	// different filters are cached separately
+	transactions, err = transactionsService.ListTransactions(ctx, 0, 0, 10, 0, false, false, nil, svc.LNClient, nil, false, ListTransactionsFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(transactions))
+}
+
+func TestListTransactionsCache_Expiry(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transactionsService.SetListTransactionsCacheTTL(50 * time.Millisecond)
+
+	transactions, err := transactionsService.ListTransactions(ctx, 0, 0, 0, 0, false, false, nil, svc.LNClient, nil, false, ListTransactionsFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(transactions))
+
+	insertSettledTransactionRaw(t, svc, "hash1")
+	time.Sleep(100 * time.Millisecond)
+
+	transactions, err = transactionsService.ListTransactions(ctx, 0, 0, 0, 0, false, false, nil, svc.LNClient, nil, false, ListTransactionsFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(transactions))
+}
+
+func TestListTransactionsCache_InvalidatedOnSettle(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	mockPreimage := tests.MockLNClientTransaction.Preimage
+	svc.DB.Create(&db.Transaction{
+		State:          constants.TRANSACTION_STATE_PENDING,
+		Type:           constants.TRANSACTION_TYPE_INCOMING,
+		PaymentRequest: tests.MockLNClientTransaction.Invoice,
+		PaymentHash:    tests.MockLNClientTransaction.PaymentHash,
+		Preimage:       &mockPreimage,
+		AmountMsat:     123000,
+	})
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transactionsService.SetListTransactionsCacheTTL(time.Minute)
+
+	transactions, err := transactionsService.ListTransactions(ctx, 0, 0, 0, 0, false, false, nil, svc.LNClient, nil, false, ListTransactionsFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(transactions))
+
+	transactionsService.ConsumeEvent(ctx, &events.Event{
+		Event:      "nwc_lnclient_payment_received",
+		Properties: tests.MockLNClientTransaction,
+	}, map[string]interface{}{})
+
+	transactions, err = transactionsService.ListTransactions(ctx, 0, 0, 0, 0, false, false, nil, svc.LNClient, nil, false, ListTransactionsFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(transactions))
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transactions[0].State)
+}
+
+func TestListTransactionsCache_ReconcilesBeforeCachedRead(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	// the backend does not send payment notifications, so pending invoices are checked on each list
+	svc.LNClient.(*tests.MockLn).SupportedNotificationTypes = &[]string{}
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transactionsService.SetListTransactionsCacheTTL(time.Minute)
+
+	transactions, err := transactionsService.ListTransactions(ctx, 0, 0, 0, 0, false, false, nil, svc.LNClient, nil, false, ListTransactionsFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(transactions))
+
+	svc.DB.Create(&db.Transaction{
+		State:          constants.TRANSACTION_STATE_PENDING,
+		Type:           constants.TRANSACTION_TYPE_INCOMING,
+		PaymentRequest: tests.MockLNClientTransaction.Invoice,
+		PaymentHash:    tests.MockLNClientTransaction.PaymentHash,
+		AmountMsat:     123000,
+	})
+
+	transactions, err = transactionsService.ListTransactions(ctx, 0, 0, 0, 0, false, false, nil, svc.LNClient, nil, false, ListTransactionsFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(transactions))
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transactions[0].State)
+}
+
+func TestListTransactionsCache_InvalidatedOnWrite(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transactionsService.SetListTransactionsCacheTTL(time.Minute)
+
+	listUnpaidIncoming := func() []Transaction {
+		transactions, err := transactionsService.ListTransactions(ctx, 0, 0, 0, 0, false, true, nil, svc.LNClient, nil, false, ListTransactionsFilter{})
+		require.NoError(t, err)
+		return transactions
+	}
+
+	assert.Equal(t, 0, len(listUnpaidIncoming()))
+
+	_, err = transactionsService.MakeInvoice(ctx, 1234, "Hello world", "", 0, nil, svc.LNClient, nil, nil, "")
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(listUnpaidIncoming()))
+
+	// written without going through the service
+	createSettledTransaction(svc, "hash1")
+	assert.Equal(t, 2, len(listUnpaidIncoming()))
+
+	var settledTransaction db.Transaction
+	require.NoError(t, svc.DB.First(&settledTransaction, &db.Transaction{PaymentHash: "hash1"}).Error)
+
+	err = transactionsService.SoftDeleteTransaction(ctx, settledTransaction.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(listUnpaidIncoming()))
+
+	err = transactionsService.RestoreTransaction(ctx, settledTransaction.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(listUnpaidIncoming()))
+}
+
+func createSettledTransaction(svc *tests.TestService, paymentHash string) {
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		PaymentHash: paymentHash,
+		AmountMsat:  123000,
+	})
+}
+
+func insertSettledTransactionRaw(t *testing.T, svc *tests.TestService, paymentHash string) {
+	err := svc.DB.Exec("INSERT INTO transactions (state, type, payment_hash, amount_msat, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)",
+		constants.TRANSACTION_STATE_SETTLED, constants.TRANSACTION_TYPE_INCOMING, paymentHash, 123000, time.Now(), time.Now()).Error
+	require.NoError(t, err)
+}
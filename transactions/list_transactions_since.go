@@ -0,0 +1,54 @@
+package transactions
+
+import (
+	"context"
+	"time"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/logger"
+)
+
+// the most transactions returned by one ListTransactionsSince call
+const maxListTransactionsSinceLimit = 1000
+
+// SyncCursor is the position of the last transaction a client received from ListTransactionsSince.
+// The zero value starts from the beginning.
+type SyncCursor struct {
+	UpdatedAt time.Time
+	Id        uint
+}
+
+// ListTransactionsSince returns the settled and failed transactions updated after the cursor,
+// oldest update first, so clients can sync incrementally by passing the updated_at and id of the
+// last transaction they received. A transaction is returned again if it is updated after it was synced,
+// e.g. a payment created before the cursor which completes after it. At most limit transactions are
+// returned (maxListTransactionsSinceLimit if limit is 0 or higher), so clients should repeat the call
+// until fewer are returned.
+func (svc *transactionsService) ListTransactionsSince(ctx context.Context, cursor SyncCursor, limit uint64, appId *uint) ([]Transaction, error) {
+	tx, err := svc.filterTransactions(svc.db, 0, 0, nil, appId, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if limit == 0 || limit > maxListTransactionsSinceLimit {
+		limit = maxListTransactionsSinceLimit
+	}
+
+	// timestamps are stored and compared as text in local time, like the ones gorm sets
+	updatedAt := cursor.UpdatedAt.Local()
+
+	var transactions []Transaction
+	result := tx.
+		// ties on updated_at are broken by id, so a page boundary between them loses nothing
+		Where("updated_at > ? OR (updated_at == ? AND id > ?)", updatedAt, updatedAt, cursor.Id).
+		Where("state IN ?", []string{constants.TRANSACTION_STATE_SETTLED, constants.TRANSACTION_STATE_FAILED}).
+		Order("updated_at asc, id asc").
+		Limit(int(limit)).
+		Find(&transactions)
+	if result.Error != nil {
+		logger.Logger.WithError(result.Error).Error("Failed to list transactions since cursor")
+		return nil, result.Error
+	}
+
+	return transactions, nil
+}
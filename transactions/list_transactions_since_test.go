@@ -0,0 +1,192 @@
+package transactions
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getPaymentHashes(transactions []Transaction) []string {
+	paymentHashes := []string{}
+	for _, transaction := range transactions {
+		paymentHashes = append(paymentHashes, transaction.PaymentHash)
+	}
+	return paymentHashes
+}
+
+// getSyncCursor returns the cursor of the last transaction received
+func getSyncCursor(transactions []Transaction) SyncCursor {
+	lastTransaction := transactions[len(transactions)-1]
+	return SyncCursor{
+		UpdatedAt: lastTransaction.UpdatedAt,
+		Id:        lastTransaction.ID,
+	}
+}
+
+func TestListTransactionsSince(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		PaymentHash: "settled1",
+		AmountMsat:  1000,
+	})
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_PENDING,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		PaymentHash: "pending",
+		AmountMsat:  2000,
+	})
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_FAILED,
+		Type:        constants.TRANSACTION_TYPE_OUTGOING,
+		PaymentHash: "failed",
+		AmountMsat:  3000,
+	})
+
+	transactions, err := transactionsService.ListTransactionsSince(ctx, SyncCursor{}, 0, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"settled1", "failed"}, getPaymentHashes(transactions))
+
+	// the next sync only returns what completed since the last transaction received
+	cursor := getSyncCursor(transactions)
+	transactions, err = transactionsService.ListTransactionsSince(ctx, cursor, 0, nil)
+	require.NoError(t, err)
+	assert.Empty(t, transactions)
+
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_OUTGOING,
+		PaymentHash: "settled2",
+		AmountMsat:  4000,
+	})
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		PaymentHash: "settled3",
+		AmountMsat:  5000,
+	})
+
+	transactions, err = transactionsService.ListTransactionsSince(ctx, cursor, 0, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"settled2", "settled3"}, getPaymentHashes(transactions))
+	assert.Less(t, transactions[0].ID, transactions[1].ID)
+}
+
+func TestListTransactionsSince_CompletedAfterCursor(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	pendingTransaction := db.Transaction{
+		State:       constants.TRANSACTION_STATE_PENDING,
+		Type:        constants.TRANSACTION_TYPE_OUTGOING,
+		PaymentHash: "pending",
+		AmountMsat:  1000,
+	}
+	svc.DB.Create(&pendingTransaction)
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		PaymentHash: "settled",
+		AmountMsat:  2000,
+	})
+
+	transactions, err := transactionsService.ListTransactionsSince(ctx, SyncCursor{}, 0, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"settled"}, getPaymentHashes(transactions))
+	cursor := getSyncCursor(transactions)
+
+	// the payment was created before the cursor, but is returned once it completes
+	err = svc.DB.Model(&pendingTransaction).Update("state", constants.TRANSACTION_STATE_SETTLED).Error
+	require.NoError(t, err)
+
+	transactions, err = transactionsService.ListTransactionsSince(ctx, cursor, 0, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"pending"}, getPaymentHashes(transactions))
+}
+
+func TestListTransactionsSince_Limit(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	updatedAt := time.Now().Add(-time.Minute)
+	for _, paymentHash := range []string{"settled1", "settled2", "settled3"} {
+		// transactions updated at the same time are paged by id
+		svc.DB.Create(&db.Transaction{
+			State:       constants.TRANSACTION_STATE_SETTLED,
+			Type:        constants.TRANSACTION_TYPE_INCOMING,
+			PaymentHash: paymentHash,
+			AmountMsat:  1000,
+			UpdatedAt:   updatedAt,
+		})
+	}
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	transactions, err := transactionsService.ListTransactionsSince(ctx, SyncCursor{}, 2, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"settled1", "settled2"}, getPaymentHashes(transactions))
+
+	// the cursor may be passed back in another time zone
+	cursor := getSyncCursor(transactions)
+	cursor.UpdatedAt = cursor.UpdatedAt.In(time.FixedZone("UTC+2", 2*60*60))
+	transactions, err = transactionsService.ListTransactionsSince(ctx, cursor, 2, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"settled3"}, getPaymentHashes(transactions))
+}
+
+func TestListTransactionsSince_App(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+
+	svc.DB.Create(&db.Transaction{
+		AppId:       &app.ID,
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		PaymentHash: "app",
+		AmountMsat:  1000,
+	})
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		PaymentHash: "node",
+		AmountMsat:  2000,
+	})
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	transactions, err := transactionsService.ListTransactionsSince(ctx, SyncCursor{}, 0, &app.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"app"}, getPaymentHashes(transactions))
+
+	unknownAppId := app.ID + 1
+	_, err = transactionsService.ListTransactionsSince(ctx, SyncCursor{}, 0, &unknownAppId)
+	assert.ErrorIs(t, err, NewNotFoundError())
+}
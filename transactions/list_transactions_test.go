@@ -47,7 +47,7 @@ func TestListTransactions_Paid(t *testing.T) {
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
 
-	incomingTransactions, err := transactionsService.ListTransactions(ctx, 0, 0, 0, 0, false, false, nil, svc.LNClient, nil, false)
+	incomingTransactions, err := transactionsService.ListTransactions(ctx, 0, 0, 0, 0, false, false, nil, svc.LNClient, nil, false, ListTransactionsFilter{})
 	assert.NoError(t, err)
 	assert.Equal(t, 1, len(incomingTransactions))
 	assert.Equal(t, uint64(123000), incomingTransactions[0].AmountMsat)
@@ -112,7 +112,7 @@ func TestListTransactions_UnpaidIncoming(t *testing.T) {
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
 
-	incomingTransactions, err := transactionsService.ListTransactions(ctx, 0, 0, 0, 0, false, true, nil, svc.LNClient, nil, false)
+	incomingTransactions, err := transactionsService.ListTransactions(ctx, 0, 0, 0, 0, false, true, nil, svc.LNClient, nil, false, ListTransactionsFilter{})
 	assert.NoError(t, err)
 	assert.Equal(t, 3, len(incomingTransactions))
 	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, incomingTransactions[0].State)
@@ -179,7 +179,7 @@ func TestListTransactions_UnpaidOutgoing(t *testing.T) {
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
 
-	outgoingTransactions, err := transactionsService.ListTransactions(ctx, 0, 0, 0, 0, true, false, nil, svc.LNClient, nil, false)
+	outgoingTransactions, err := transactionsService.ListTransactions(ctx, 0, 0, 0, 0, true, false, nil, svc.LNClient, nil, false, ListTransactionsFilter{})
 	assert.NoError(t, err)
 	assert.Equal(t, 3, len(outgoingTransactions))
 	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, outgoingTransactions[0].State)
@@ -246,7 +246,7 @@ func TestListTransactions_Unpaid(t *testing.T) {
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
 
-	outgoingTransactions, err := transactionsService.ListTransactions(ctx, 0, 0, 0, 0, true, true, nil, svc.LNClient, nil, false)
+	outgoingTransactions, err := transactionsService.ListTransactions(ctx, 0, 0, 0, 0, true, true, nil, svc.LNClient, nil, false, ListTransactionsFilter{})
 	assert.NoError(t, err)
 	assert.Equal(t, 5, len(outgoingTransactions))
 }
@@ -281,7 +281,7 @@ func TestListTransactions_Limit(t *testing.T) {
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
 
-	incomingTransactions, err := transactionsService.ListTransactions(ctx, 0, 0, 1, 0, false, false, nil, svc.LNClient, nil, false)
+	incomingTransactions, err := transactionsService.ListTransactions(ctx, 0, 0, 1, 0, false, false, nil, svc.LNClient, nil, false, ListTransactionsFilter{})
 	assert.NoError(t, err)
 	assert.Equal(t, 1, len(incomingTransactions))
 	assert.Equal(t, "first", incomingTransactions[0].Description)
@@ -337,7 +337,7 @@ func TestListTransactions_Offset(t *testing.T) {
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
 
-	incomingTransactions, err := transactionsService.ListTransactions(ctx, 0, 0, 1, 2, false, false, nil, svc.LNClient, nil, false)
+	incomingTransactions, err := transactionsService.ListTransactions(ctx, 0, 0, 1, 2, false, false, nil, svc.LNClient, nil, false, ListTransactionsFilter{})
 	assert.NoError(t, err)
 	assert.Equal(t, 1, len(incomingTransactions))
 	assert.Equal(t, "third", incomingTransactions[0].Description)
@@ -387,7 +387,7 @@ func TestListTransactions_FromUntil(t *testing.T) {
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
 
-	incomingTransactions, err := transactionsService.ListTransactions(ctx, uint64(time.Now().Add(4*time.Minute).Unix()), uint64(time.Now().Add(6*time.Minute).Unix()), 0, 0, false, false, nil, svc.LNClient, nil, false)
+	incomingTransactions, err := transactionsService.ListTransactions(ctx, uint64(time.Now().Add(4*time.Minute).Unix()), uint64(time.Now().Add(6*time.Minute).Unix()), 0, 0, false, false, nil, svc.LNClient, nil, false, ListTransactionsFilter{})
 	assert.NoError(t, err)
 	assert.Equal(t, 1, len(incomingTransactions))
 	assert.Equal(t, "second", incomingTransactions[0].Description)
@@ -448,7 +448,7 @@ func TestListTransactions_FromUntilUnpaidOutgoing(t *testing.T) {
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
 
-	incomingTransactions, err := transactionsService.ListTransactions(ctx, uint64(time.Now().Add(4*time.Minute).Unix()), uint64(time.Now().Add(6*time.Minute).Unix()), 0, 0, true, false, nil, svc.LNClient, nil, false)
+	incomingTransactions, err := transactionsService.ListTransactions(ctx, uint64(time.Now().Add(4*time.Minute).Unix()), uint64(time.Now().Add(6*time.Minute).Unix()), 0, 0, true, false, nil, svc.LNClient, nil, false, ListTransactionsFilter{})
 	assert.NoError(t, err)
 	assert.Equal(t, 1, len(incomingTransactions))
 	assert.Equal(t, "second", incomingTransactions[0].Description)
@@ -510,9 +510,135 @@ func TestListTransactions_FromUntilUnpaidIncoming(t *testing.T) {
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
 
-	incomingTransactions, err := transactionsService.ListTransactions(ctx, uint64(time.Now().Add(4*time.Minute).Unix()), uint64(time.Now().Add(6*time.Minute).Unix()), 0, 0, false, true, nil, svc.LNClient, nil, false)
+	incomingTransactions, err := transactionsService.ListTransactions(ctx, uint64(time.Now().Add(4*time.Minute).Unix()), uint64(time.Now().Add(6*time.Minute).Unix()), 0, 0, false, true, nil, svc.LNClient, nil, false, ListTransactionsFilter{})
 	assert.NoError(t, err)
 	assert.Equal(t, 1, len(incomingTransactions))
 	assert.Equal(t, "second", incomingTransactions[0].Description)
 	assert.Equal(t, constants.TRANSACTION_TYPE_INCOMING, incomingTransactions[0].Type)
 }
+
+func TestListTransactions_OmitLargeFields(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		PaymentHash: tests.MockLNClientTransaction.PaymentHash,
+		AmountMsat:  123000,
+		Description: "mock invoice",
+		Metadata:    []byte(`{"a":123}`),
+		Boostagram:  []byte(`{"message":"hello"}`),
+	})
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	transactions, err := transactionsService.ListTransactions(ctx, 0, 0, 0, 0, false, false, nil, svc.LNClient, nil, false, ListTransactionsFilter{OmitLargeFields: true})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(transactions))
+	assert.Equal(t, uint64(123000), transactions[0].AmountMsat)
+	assert.Equal(t, "mock invoice", transactions[0].Description)
+	assert.Nil(t, transactions[0].Metadata)
+	assert.Nil(t, transactions[0].Boostagram)
+
+	transactions, err = transactionsService.ListTransactions(ctx, 0, 0, 0, 0, false, false, nil, svc.LNClient, nil, false, ListTransactionsFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(transactions))
+	assert.JSONEq(t, `{"a":123}`, string(transactions[0].Metadata))
+	assert.JSONEq(t, `{"message":"hello"}`, string(transactions[0].Boostagram))
+}
+
+func TestListTransactions_Environment(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		PaymentHash: "prod",
+		AmountMsat:  1000,
+		Environment: constants.TRANSACTION_ENVIRONMENT_PROD,
+	})
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		PaymentHash: "test",
+		AmountMsat:  2000,
+		Environment: constants.TRANSACTION_ENVIRONMENT_TEST,
+	})
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	transactions, err := transactionsService.ListTransactions(ctx, 0, 0, 0, 0, false, false, nil, svc.LNClient, nil, false, ListTransactionsFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(transactions))
+
+	environment := constants.TRANSACTION_ENVIRONMENT_TEST
+	transactions, err = transactionsService.ListTransactions(ctx, 0, 0, 0, 0, false, false, nil, svc.LNClient, nil, false, ListTransactionsFilter{Environment: &environment})
+	assert.NoError(t, err)
+	require.Equal(t, 1, len(transactions))
+	assert.Equal(t, "test", transactions[0].PaymentHash)
+
+	environment = constants.TRANSACTION_ENVIRONMENT_PROD
+	transactions, err = transactionsService.ListTransactions(ctx, 0, 0, 0, 0, false, false, nil, svc.LNClient, nil, false, ListTransactionsFilter{Environment: &environment})
+	assert.NoError(t, err)
+	require.Equal(t, 1, len(transactions))
+	assert.Equal(t, "prod", transactions[0].PaymentHash)
+}
+
+func TestListTransactions_PaymentKind(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	svc.DB.Create(&db.Transaction{
+		State:          constants.TRANSACTION_STATE_SETTLED,
+		Type:           constants.TRANSACTION_TYPE_OUTGOING,
+		PaymentRequest: tests.MockInvoice,
+		PaymentHash:    "invoice",
+		AmountMsat:     1000,
+	})
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_OUTGOING,
+		PaymentHash: "keysend",
+		AmountMsat:  2000,
+	})
+	// incoming keysend payments also have no payment request
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		PaymentHash: "incoming",
+		AmountMsat:  3000,
+	})
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	transactions, err := transactionsService.ListTransactions(ctx, 0, 0, 0, 0, false, false, nil, svc.LNClient, nil, false, ListTransactionsFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(transactions))
+
+	paymentKind := constants.TRANSACTION_PAYMENT_KIND_KEYSEND
+	transactions, err = transactionsService.ListTransactions(ctx, 0, 0, 0, 0, false, false, nil, svc.LNClient, nil, false, ListTransactionsFilter{PaymentKind: &paymentKind})
+	assert.NoError(t, err)
+	require.Equal(t, 1, len(transactions))
+	assert.Equal(t, "keysend", transactions[0].PaymentHash)
+
+	paymentKind = constants.TRANSACTION_PAYMENT_KIND_INVOICE
+	transactions, err = transactionsService.ListTransactions(ctx, 0, 0, 0, 0, false, false, nil, svc.LNClient, nil, false, ListTransactionsFilter{PaymentKind: &paymentKind})
+	assert.NoError(t, err)
+	require.Equal(t, 1, len(transactions))
+	assert.Equal(t, "invoice", transactions[0].PaymentHash)
+
+	paymentKind = "onchain"
+	_, err = transactionsService.ListTransactions(ctx, 0, 0, 0, 0, false, false, nil, svc.LNClient, nil, false, ListTransactionsFilter{PaymentKind: &paymentKind})
+	assert.EqualError(t, err, "unknown payment kind: onchain")
+}
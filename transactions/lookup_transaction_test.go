@@ -2,6 +2,7 @@ package transactions
 
 import (
 	"context"
+	"errors"
 	"testing"
 
 	"github.com/getAlby/hub/constants"
@@ -30,7 +31,7 @@ func TestLookupTransaction_IncomingPayment(t *testing.T) {
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
 
-	incomingTransaction, err := transactionsService.LookupTransaction(ctx, tests.MockLNClientTransaction.PaymentHash, nil, svc.LNClient, nil)
+	incomingTransaction, err := transactionsService.LookupTransaction(ctx, tests.MockLNClientTransaction.PaymentHash, nil, svc.LNClient, nil, false)
 	assert.NoError(t, err)
 	assert.Equal(t, uint64(123000), incomingTransaction.AmountMsat)
 	assert.Equal(t, constants.TRANSACTION_STATE_PENDING, incomingTransaction.State)
@@ -57,10 +58,125 @@ func TestLookupTransaction_OutgoingPayment(t *testing.T) {
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
 
-	outgoingTransaction, err := transactionsService.LookupTransaction(ctx, tests.MockLNClientTransaction.PaymentHash, nil, svc.LNClient, nil)
+	outgoingTransaction, err := transactionsService.LookupTransaction(ctx, tests.MockLNClientTransaction.PaymentHash, nil, svc.LNClient, nil, false)
 	assert.NoError(t, err)
 	assert.Equal(t, uint64(123000), outgoingTransaction.AmountMsat)
 	assert.Equal(t, constants.TRANSACTION_STATE_PENDING, outgoingTransaction.State)
 	assert.Equal(t, tests.MockLNClientTransaction.Preimage, *outgoingTransaction.Preimage)
 	assert.Zero(t, outgoingTransaction.FeeReserveMsat)
 }
+
+func TestGetPaymentAttempts_FailedThenSucceeded(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	svc.LNClient.(*tests.MockLn).PayInvoiceResponses = append(svc.LNClient.(*tests.MockLn).PayInvoiceResponses, nil)
+	svc.LNClient.(*tests.MockLn).PayInvoiceErrors = append(svc.LNClient.(*tests.MockLn).PayInvoiceErrors, errors.New("no route"))
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	_, err = transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, nil, nil, SendPaymentOptions{})
+	assert.Error(t, err)
+	_, err = transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, nil, nil, SendPaymentOptions{})
+	require.NoError(t, err)
+
+	// an incoming payment with the same hash is not an attempt
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		PaymentHash: tests.MockLNClientTransaction.PaymentHash,
+		AmountMsat:  123000,
+	})
+
+	attempts, err := transactionsService.GetPaymentAttempts(ctx, tests.MockLNClientTransaction.PaymentHash, nil)
+	require.NoError(t, err)
+	require.Len(t, attempts, 2)
+	assert.Equal(t, constants.TRANSACTION_STATE_FAILED, attempts[0].State)
+	assert.Equal(t, "no route", attempts[0].FailureReason)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, attempts[1].State)
+	assert.Equal(t, constants.TRANSACTION_TYPE_OUTGOING, attempts[1].Type)
+
+	// the single-row lookup still returns the successful attempt
+	transaction, err := transactionsService.LookupTransaction(ctx, tests.MockLNClientTransaction.PaymentHash, nil, svc.LNClient, nil, false)
+	require.NoError(t, err)
+	assert.Equal(t, attempts[1].ID, transaction.ID)
+}
+
+func TestGetPaymentAttempts_IsolatedApp(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+	app.Isolated = true
+	svc.DB.Save(app)
+
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_FAILED,
+		Type:        constants.TRANSACTION_TYPE_OUTGOING,
+		PaymentHash: tests.MockLNClientTransaction.PaymentHash,
+		AmountMsat:  123000,
+	})
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_OUTGOING,
+		PaymentHash: tests.MockLNClientTransaction.PaymentHash,
+		AmountMsat:  123000,
+		AppId:       &app.ID,
+	})
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	attempts, err := transactionsService.GetPaymentAttempts(ctx, tests.MockLNClientTransaction.PaymentHash, &app.ID)
+	require.NoError(t, err)
+	require.Len(t, attempts, 1)
+	assert.Equal(t, &app.ID, attempts[0].AppId)
+
+	attempts, err = transactionsService.GetPaymentAttempts(ctx, tests.MockLNClientTransaction.PaymentHash, nil)
+	require.NoError(t, err)
+	assert.Len(t, attempts, 2)
+
+	attempts, err = transactionsService.GetPaymentAttempts(ctx, "unknown", nil)
+	require.NoError(t, err)
+	assert.Empty(t, attempts)
+}
+
+func TestLookupTransactionByPreimage(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	// the preimage is not stored, so the transaction can only be matched by the computed hash
+	paymentHash := "ae4277b7be3ca1420cafd24c143866190f52b996856b0e4164763f936e61ea1b"
+	dbTransaction := db.Transaction{
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_OUTGOING,
+		PaymentHash: paymentHash,
+		AmountMsat:  2000,
+	}
+	err = svc.DB.Create(&dbTransaction).Error
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	transaction, err := transactionsService.LookupTransactionByPreimage(ctx, "9f59b18f80a77c2930deb8be5ff1143eacdd1891c63c23d61bc9f99c64e57325", nil)
+	require.NoError(t, err)
+	assert.Equal(t, dbTransaction.ID, transaction.ID)
+	assert.Equal(t, paymentHash, transaction.PaymentHash)
+
+	// a valid preimage of another payment
+	transaction, err = transactionsService.LookupTransactionByPreimage(ctx, "0000000000000000000000000000000000000000000000000000000000000000", nil)
+	assert.ErrorIs(t, err, NewNotFoundError())
+	assert.Nil(t, transaction)
+
+	transaction, err = transactionsService.LookupTransactionByPreimage(ctx, "123preimage", nil)
+	assert.ErrorIs(t, err, NewInvalidPreimageError())
+	assert.Nil(t, transaction)
+}
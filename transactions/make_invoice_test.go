@@ -6,9 +6,11 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/getAlby/hub/constants"
 	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/lnclient"
 	"github.com/getAlby/hub/tests"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -25,7 +27,7 @@ func TestMakeInvoice_NoApp(t *testing.T) {
 	txMetadata["randomkey"] = strings.Repeat("a", constants.INVOICE_METADATA_MAX_LENGTH-16) // json encoding adds 16 characters - {"randomkey":""}
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
-	transaction, err := transactionsService.MakeInvoice(ctx, 1234, "Hello world", "", 0, txMetadata, svc.LNClient, nil, nil)
+	transaction, err := transactionsService.MakeInvoice(ctx, 1234, "Hello world", "", 0, txMetadata, svc.LNClient, nil, nil, "")
 	assert.NoError(t, err)
 
 	var metadata map[string]interface{}
@@ -49,7 +51,7 @@ func TestMakeInvoice_MetadataTooLarge(t *testing.T) {
 	metadata["randomkey"] = strings.Repeat("a", constants.INVOICE_METADATA_MAX_LENGTH-15) // json encoding adds 16 characters
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
-	transaction, err := transactionsService.MakeInvoice(ctx, 1234, "Hello world", "", 0, metadata, svc.LNClient, nil, nil)
+	transaction, err := transactionsService.MakeInvoice(ctx, 1234, "Hello world", "", 0, metadata, svc.LNClient, nil, nil, "")
 
 	assert.Error(t, err)
 	assert.Equal(t, fmt.Sprintf("encoded invoice metadata provided is too large. Limit: %d Received: %d", constants.INVOICE_METADATA_MAX_LENGTH, constants.INVOICE_METADATA_MAX_LENGTH+1), err.Error())
@@ -66,12 +68,19 @@ func TestMakeInvoice_App(t *testing.T) {
 	app, _, err := tests.CreateApp(svc)
 	assert.NoError(t, err)
 
+	err = svc.DB.Create(&db.AppPermission{
+		AppId: app.ID,
+		App:   *app,
+		Scope: constants.MAKE_INVOICE_SCOPE,
+	}).Error
+	assert.NoError(t, err)
+
 	dbRequestEvent := &db.RequestEvent{}
 	err = svc.DB.Create(&dbRequestEvent).Error
 	assert.NoError(t, err)
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
-	transaction, err := transactionsService.MakeInvoice(ctx, 1234, "Hello world", "", 0, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID)
+	transaction, err := transactionsService.MakeInvoice(ctx, 1234, "Hello world", "", 0, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID, "")
 
 	assert.NoError(t, err)
 	assert.Equal(t, uint64(tests.MockLNClientTransaction.Amount), transaction.AmountMsat)
@@ -80,3 +89,543 @@ func TestMakeInvoice_App(t *testing.T) {
 	assert.Equal(t, app.ID, *transaction.AppId)
 	assert.Equal(t, dbRequestEvent.ID, *transaction.RequestEventId)
 }
+
+func TestMakeInvoice_App_NoMakeInvoiceScope(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	assert.NoError(t, err)
+
+	dbRequestEvent := &db.RequestEvent{}
+	err = svc.DB.Create(&dbRequestEvent).Error
+	assert.NoError(t, err)
+
+	mockEventConsumer := tests.NewMockEventConsumer()
+	svc.EventPublisher.RegisterSubscriber(mockEventConsumer)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.MakeInvoice(ctx, 1234, "Hello world", "", 0, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID, "")
+
+	assert.Error(t, err)
+	assert.Equal(t, "app does not have make_invoice scope", err.Error())
+	assert.Nil(t, transaction)
+
+	assert.Equal(t, 1, len(mockEventConsumer.GetConsumedEvents()))
+	assert.Equal(t, "nwc_permission_denied", mockEventConsumer.GetConsumedEvents()[0].Event)
+	assert.Equal(t, app.Name, mockEventConsumer.GetConsumedEvents()[0].Properties.(map[string]interface{})["app_name"])
+	assert.Equal(t, constants.ERROR_RESTRICTED, mockEventConsumer.GetConsumedEvents()[0].Properties.(map[string]interface{})["code"])
+}
+
+func TestMakeInvoice_App_ReceiveLimitExceeded(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	assert.NoError(t, err)
+	app.MaxReceiveAmountSat = 1
+	svc.DB.Save(&app)
+
+	// the app budget (copied to every permission) does not limit receiving
+	err = svc.DB.Create(&db.AppPermission{
+		AppId:        app.ID,
+		App:          *app,
+		Scope:        constants.MAKE_INVOICE_SCOPE,
+		MaxAmountSat: 1000,
+	}).Error
+	assert.NoError(t, err)
+
+	dbRequestEvent := &db.RequestEvent{}
+	err = svc.DB.Create(&dbRequestEvent).Error
+	assert.NoError(t, err)
+
+	mockEventConsumer := tests.NewMockEventConsumer()
+	svc.EventPublisher.RegisterSubscriber(mockEventConsumer)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.MakeInvoice(ctx, 2000, "Hello world", "", 0, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID, "")
+
+	assert.ErrorIs(t, err, NewReceiveLimitExceededError())
+	assert.Nil(t, transaction)
+
+	assert.Equal(t, 1, len(mockEventConsumer.GetConsumedEvents()))
+	assert.Equal(t, "nwc_permission_denied", mockEventConsumer.GetConsumedEvents()[0].Event)
+	assert.Equal(t, constants.ERROR_RESTRICTED, mockEventConsumer.GetConsumedEvents()[0].Properties.(map[string]interface{})["code"])
+	assert.Equal(t, NewReceiveLimitExceededError().Error()+" Hello world", mockEventConsumer.GetConsumedEvents()[0].Properties.(map[string]interface{})["message"])
+
+	// within the limit
+	transaction, err = transactionsService.MakeInvoice(ctx, 1000, "Hello world", "", 0, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID, "")
+	assert.NoError(t, err)
+	assert.NotNil(t, transaction)
+}
+
+func TestMakeInvoice_App_NoRequestEvent(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	assert.NoError(t, err)
+
+	// e.g. isolated app top-up created by the hub, the app does not need make_invoice scope
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.MakeInvoice(ctx, 1234, "top up", "", 0, nil, svc.LNClient, &app.ID, nil, "")
+	assert.NoError(t, err)
+	assert.Equal(t, app.ID, *transaction.AppId)
+}
+
+func TestMakeInvoice_App_RequireDescription(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	assert.NoError(t, err)
+	app.RequireDescription = true
+	svc.DB.Save(&app)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.MakeInvoice(ctx, 1234, "", "", 0, nil, svc.LNClient, &app.ID, nil, "")
+	assert.ErrorIs(t, err, NewDescriptionRequiredError())
+	assert.Nil(t, transaction)
+
+	transaction, err = transactionsService.MakeInvoice(ctx, 1234, "Hello world", "", 0, nil, svc.LNClient, &app.ID, nil, "")
+	assert.NoError(t, err)
+	assert.NotNil(t, transaction)
+
+	transaction, err = transactionsService.MakeInvoice(ctx, 1234, "", "3cf1c7f9a1c7e3a1aeee5aa6b4e8c1b4f3bb2d1e3b4a0e6c2e0e7c2d52b3a1f9", 0, nil, svc.LNClient, &app.ID, nil, "")
+	assert.NoError(t, err)
+	assert.NotNil(t, transaction)
+}
+
+func TestMakeInvoice_App_DescriptionNotRequired(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	assert.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.MakeInvoice(ctx, 1234, "", "", 0, nil, svc.LNClient, &app.ID, nil, "")
+	assert.NoError(t, err)
+	assert.NotNil(t, transaction)
+}
+
+func TestMakeInvoice_App_DefaultDescription(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+	app.DefaultInvoiceDescription = "Donation"
+	app.RequireDescription = true
+	svc.DB.Save(&app)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	// amountless invoice without a description
+	transaction, err := transactionsService.MakeInvoice(ctx, 0, "", "", 0, nil, svc.LNClient, &app.ID, nil, "")
+	require.NoError(t, err)
+	assert.Equal(t, "Donation", transaction.Description)
+
+	// the caller's description is used instead
+	transaction, err = transactionsService.MakeInvoice(ctx, 0, "Thanks for the podcast", "", 0, nil, svc.LNClient, &app.ID, nil, "")
+	require.NoError(t, err)
+	assert.Equal(t, "Thanks for the podcast", transaction.Description)
+
+	// the description hash commits to another description
+	transaction, err = transactionsService.MakeInvoice(ctx, 0, "", "3cf1c7f9a1c7e3a1aeee5aa6b4e8c1b4f3bb2d1e3b4a0e6c2e0e7c2d52b3a1f9", 0, nil, svc.LNClient, &app.ID, nil, "")
+	require.NoError(t, err)
+	assert.Empty(t, transaction.Description)
+
+	// invoices not created by the app
+	transaction, err = transactionsService.MakeInvoice(ctx, 0, "", "", 0, nil, svc.LNClient, nil, nil, "")
+	require.NoError(t, err)
+	assert.Empty(t, transaction.Description)
+}
+
+func TestMakeInvoice_App_DefaultMetadataLimit(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	assert.NoError(t, err)
+
+	metadata := make(map[string]interface{})
+	metadata["randomkey"] = strings.Repeat("a", constants.INVOICE_METADATA_MAX_LENGTH-15) // json encoding adds 16 characters
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.MakeInvoice(ctx, 1234, "Hello world", "", 0, metadata, svc.LNClient, &app.ID, nil, "")
+
+	assert.Error(t, err)
+	assert.Equal(t, fmt.Sprintf("encoded invoice metadata provided is too large. Limit: %d Received: %d", constants.INVOICE_METADATA_MAX_LENGTH, constants.INVOICE_METADATA_MAX_LENGTH+1), err.Error())
+	assert.Nil(t, transaction)
+}
+
+func TestMakeInvoice_App_RaisedMetadataLimit(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	assert.NoError(t, err)
+	app.MaxMetadataLength = 8192
+	svc.DB.Save(&app)
+
+	metadata := make(map[string]interface{})
+	metadata["randomkey"] = strings.Repeat("a", 8192-16) // json encoding adds 16 characters
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.MakeInvoice(ctx, 1234, "Hello world", "", 0, metadata, svc.LNClient, &app.ID, nil, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 8192, len(transaction.Metadata))
+
+	metadata["randomkey"] = strings.Repeat("a", 8192-15)
+	transaction, err = transactionsService.MakeInvoice(ctx, 1234, "Hello world", "", 0, metadata, svc.LNClient, &app.ID, nil, "")
+	assert.Error(t, err)
+	assert.Equal(t, "encoded invoice metadata provided is too large. Limit: 8192 Received: 8193", err.Error())
+	assert.Nil(t, transaction)
+}
+
+func TestMakeInvoice_App_MetadataLimitCappedByHardMax(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	assert.NoError(t, err)
+	app.MaxMetadataLength = constants.INVOICE_METADATA_HARD_MAX_LENGTH * 2
+	svc.DB.Save(&app)
+
+	metadata := make(map[string]interface{})
+	metadata["randomkey"] = strings.Repeat("a", constants.INVOICE_METADATA_HARD_MAX_LENGTH-15) // json encoding adds 16 characters
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.MakeInvoice(ctx, 1234, "Hello world", "", 0, metadata, svc.LNClient, &app.ID, nil, "")
+
+	assert.Error(t, err)
+	assert.Equal(t, fmt.Sprintf("encoded invoice metadata provided is too large. Limit: %d Received: %d", constants.INVOICE_METADATA_HARD_MAX_LENGTH, constants.INVOICE_METADATA_HARD_MAX_LENGTH+1), err.Error())
+	assert.Nil(t, transaction)
+}
+
+func TestMakeInvoice_BackendOmitsExpiry(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.MakeInvoice(ctx, 1234, "Hello world", "", 3600, nil, svc.LNClient, nil, nil, "")
+	assert.NoError(t, err)
+	// the mock backend does not return an expiry
+	assert.NotNil(t, transaction.ExpiresAt)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), *transaction.ExpiresAt, 5*time.Second)
+}
+
+func TestMakeInvoice_BackendOmitsExpiry_DefaultExpiry(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.MakeInvoice(ctx, 1234, "Hello world", "", 0, nil, svc.LNClient, nil, nil, "")
+	assert.NoError(t, err)
+	assert.NotNil(t, transaction.ExpiresAt)
+	assert.WithinDuration(t, time.Now().Add(lnclient.DEFAULT_INVOICE_EXPIRY*time.Second), *transaction.ExpiresAt, 5*time.Second)
+}
+
+func TestMakeInvoice_Environment(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.MakeInvoice(ctx, 1234, "Hello world", "", 0, nil, svc.LNClient, nil, nil, "")
+	assert.NoError(t, err)
+	assert.Equal(t, constants.TRANSACTION_ENVIRONMENT_PROD, transaction.Environment)
+
+	metadata := map[string]interface{}{
+		constants.ENVIRONMENT_METADATA_KEY: constants.TRANSACTION_ENVIRONMENT_TEST,
+	}
+	transaction, err = transactionsService.MakeInvoice(ctx, 1234, "Hello world", "", 0, metadata, svc.LNClient, nil, nil, "")
+	assert.NoError(t, err)
+	assert.Equal(t, constants.TRANSACTION_ENVIRONMENT_TEST, transaction.Environment)
+}
+
+func TestMakeInvoice_InvalidEnvironment(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	metadata := map[string]interface{}{
+		constants.ENVIRONMENT_METADATA_KEY: "staging",
+	}
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.MakeInvoice(ctx, 1234, "Hello world", "", 0, metadata, svc.LNClient, nil, nil, "")
+	assert.EqualError(t, err, "invalid transaction environment: staging")
+	assert.Nil(t, transaction)
+}
+
+func TestMakeInvoice_App_UniqueDescriptionHash_Reuse(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	assert.NoError(t, err)
+	app.UniqueDescriptionHash = true
+	svc.DB.Save(&app)
+
+	descriptionHash := "3cf1c7f9a1c7e3a1aeee5aa6b4e8c1b4f3bb2d1e3b4a0e6c2e0e7c2d52b3a1f9"
+	amount := uint64(tests.MockLNClientTransaction.Amount)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.MakeInvoice(ctx, amount, "", descriptionHash, 0, nil, svc.LNClient, &app.ID, nil, "")
+	assert.NoError(t, err)
+
+	existingTransaction, err := transactionsService.MakeInvoice(ctx, amount, "", descriptionHash, 0, nil, svc.LNClient, &app.ID, nil, "")
+	assert.NoError(t, err)
+	assert.Equal(t, transaction.ID, existingTransaction.ID)
+
+	// only one open invoice per description hash, regardless of amount
+	differentAmountTransaction, err := transactionsService.MakeInvoice(ctx, amount+1000, "", descriptionHash, 0, nil, svc.LNClient, &app.ID, nil, "")
+	assert.ErrorIs(t, err, NewDescriptionHashInUseError())
+	assert.Nil(t, differentAmountTransaction)
+
+	var count int64
+	svc.DB.Model(&db.Transaction{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestMakeInvoice_App_UniqueDescriptionHash_DistinctHash(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	assert.NoError(t, err)
+	app.UniqueDescriptionHash = true
+	svc.DB.Save(&app)
+
+	amount := uint64(tests.MockLNClientTransaction.Amount)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction1, err := transactionsService.MakeInvoice(ctx, amount, "", "3cf1c7f9a1c7e3a1aeee5aa6b4e8c1b4f3bb2d1e3b4a0e6c2e0e7c2d52b3a1f9", 0, nil, svc.LNClient, &app.ID, nil, "")
+	assert.NoError(t, err)
+	transaction2, err := transactionsService.MakeInvoice(ctx, amount, "", "9f1a3b25d2c7e0e2c6e0a4b3e1d2bb3f4b1c8e4b6aa5eeaea1e3c7a1f9c7f1c3", 0, nil, svc.LNClient, &app.ID, nil, "")
+	assert.NoError(t, err)
+	assert.NotEqual(t, transaction1.ID, transaction2.ID)
+}
+
+func TestMakeInvoice_App_UniqueDescriptionHash_ExpiredInvoice(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	assert.NoError(t, err)
+	app.UniqueDescriptionHash = true
+	svc.DB.Save(&app)
+
+	descriptionHash := "3cf1c7f9a1c7e3a1aeee5aa6b4e8c1b4f3bb2d1e3b4a0e6c2e0e7c2d52b3a1f9"
+	amount := uint64(tests.MockLNClientTransaction.Amount)
+
+	expiresAt := time.Now().Add(-time.Minute)
+	expiredTransaction := db.Transaction{
+		AppId:           &app.ID,
+		State:           constants.TRANSACTION_STATE_PENDING,
+		Type:            constants.TRANSACTION_TYPE_INCOMING,
+		DescriptionHash: descriptionHash,
+		AmountMsat:      amount,
+		ExpiresAt:       &expiresAt,
+	}
+	svc.DB.Create(&expiredTransaction)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.MakeInvoice(ctx, amount, "", descriptionHash, 0, nil, svc.LNClient, &app.ID, nil, "")
+	assert.NoError(t, err)
+	assert.NotEqual(t, expiredTransaction.ID, transaction.ID)
+}
+
+func TestMakeInvoice_App_UniqueDescriptionHash_NotEnabled(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	assert.NoError(t, err)
+
+	descriptionHash := "3cf1c7f9a1c7e3a1aeee5aa6b4e8c1b4f3bb2d1e3b4a0e6c2e0e7c2d52b3a1f9"
+	amount := uint64(tests.MockLNClientTransaction.Amount)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction1, err := transactionsService.MakeInvoice(ctx, amount, "", descriptionHash, 0, nil, svc.LNClient, &app.ID, nil, "")
+	assert.NoError(t, err)
+	transaction2, err := transactionsService.MakeInvoice(ctx, amount, "", descriptionHash, 0, nil, svc.LNClient, &app.ID, nil, "")
+	assert.NoError(t, err)
+	assert.NotEqual(t, transaction1.ID, transaction2.ID)
+}
+
+func TestMakeInvoice_App_RateLimit(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	assert.NoError(t, err)
+	app.InvoiceRateLimit = 2
+	app.InvoiceRateLimitWindowSeconds = 60
+	svc.DB.Save(&app)
+
+	err = svc.DB.Create(&db.AppPermission{
+		AppId: app.ID,
+		App:   *app,
+		Scope: constants.MAKE_INVOICE_SCOPE,
+	}).Error
+	assert.NoError(t, err)
+
+	dbRequestEvent := &db.RequestEvent{}
+	err = svc.DB.Create(&dbRequestEvent).Error
+	assert.NoError(t, err)
+
+	// two invoices created just inside the window
+	oldestInvoice := db.Transaction{
+		AppId:          &app.ID,
+		Type:           constants.TRANSACTION_TYPE_INCOMING,
+		State:          constants.TRANSACTION_STATE_PENDING,
+		PaymentRequest: tests.MockInvoice,
+		PaymentHash:    tests.MockPaymentHash,
+		AmountMsat:     1000,
+		RequestEventId: &dbRequestEvent.ID,
+		CreatedAt:      time.Now().Add(-59 * time.Second),
+	}
+	err = svc.DB.Create(&oldestInvoice).Error
+	require.NoError(t, err)
+	err = svc.DB.Create(&db.Transaction{
+		AppId:          &app.ID,
+		Type:           constants.TRANSACTION_TYPE_INCOMING,
+		State:          constants.TRANSACTION_STATE_SETTLED,
+		PaymentRequest: tests.MockInvoice,
+		PaymentHash:    tests.MockPaymentHash,
+		AmountMsat:     1000,
+		RequestEventId: &dbRequestEvent.ID,
+		CreatedAt:      time.Now().Add(-30 * time.Second),
+	}).Error
+	require.NoError(t, err)
+
+	// a received keysend was not created by the app
+	err = svc.DB.Create(&db.Transaction{
+		AppId:       &app.ID,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		PaymentHash: "ae4277b7be3ca1420cafd24c143866190f52b996856b0e4164763f936e61ea1b",
+		AmountMsat:  1000,
+	}).Error
+	require.NoError(t, err)
+
+	mockEventConsumer := tests.NewMockEventConsumer()
+	svc.EventPublisher.RegisterSubscriber(mockEventConsumer)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.MakeInvoice(ctx, 1234, "Hello world", "", 0, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID, "")
+	assert.ErrorIs(t, err, NewInvoiceRateLimitExceededError())
+	assert.Nil(t, transaction)
+
+	assert.Equal(t, 1, len(mockEventConsumer.GetConsumedEvents()))
+	assert.Equal(t, "nwc_permission_denied", mockEventConsumer.GetConsumedEvents()[0].Event)
+	assert.Equal(t, constants.ERROR_RATE_LIMITED, mockEventConsumer.GetConsumedEvents()[0].Properties.(map[string]interface{})["code"])
+
+	// invoices created on behalf of the app are not rate limited
+	_, err = transactionsService.MakeInvoice(ctx, 1234, "Hello world", "", 0, nil, svc.LNClient, &app.ID, nil, "")
+	require.NoError(t, err)
+
+	// the oldest invoice moves just outside the window
+	err = svc.DB.Model(&oldestInvoice).Update("created_at", time.Now().Add(-61*time.Second)).Error
+	require.NoError(t, err)
+
+	transaction, err = transactionsService.MakeInvoice(ctx, 1234, "Hello world", "", 0, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID, "")
+	require.NoError(t, err)
+	assert.Equal(t, app.ID, *transaction.AppId)
+
+	// the new invoice counts towards the limit
+	transaction, err = transactionsService.MakeInvoice(ctx, 1234, "Hello world", "", 0, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID, "")
+	assert.ErrorIs(t, err, NewInvoiceRateLimitExceededError())
+	assert.Nil(t, transaction)
+}
+
+func TestMakeInvoice_NotifyUrl(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	for _, notifyUrl := range []string{
+		"not a url",
+		"ftp://example.com/paid",
+		"/paid",
+		"http://example.com/paid",
+		"https://localhost/paid",
+		"https://127.0.0.1:8080/paid",
+		"https://10.0.0.1/paid",
+		"https://192.168.1.1/paid",
+		"https://169.254.169.254/latest/meta-data",
+		"https://[::1]/paid",
+		"https://[fe80::1]/paid",
+	} {
+		transaction, err := transactionsService.MakeInvoice(ctx, 1234, "Hello world", "", 0, nil, svc.LNClient, nil, nil, notifyUrl)
+		assert.ErrorIs(t, err, NewInvalidNotifyUrlError())
+		assert.Nil(t, transaction)
+	}
+
+	transaction, err := transactionsService.MakeInvoice(ctx, 1234, "Hello world", "", 0, nil, svc.LNClient, nil, nil, "https://example.com/paid?order=1")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/paid?order=1", transaction.NotifyUrl)
+
+	transaction, err = transactionsService.LookupTransaction(ctx, transaction.PaymentHash, nil, svc.LNClient, nil, false)
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/paid?order=1", transaction.NotifyUrl)
+}
@@ -0,0 +1,90 @@
+package transactions
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/db/queries"
+	"github.com/getAlby/hub/lnclient"
+	"github.com/getAlby/hub/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// GetMaxPayableAmount returns the largest amount in msat a single payment of the app can currently be for,
+// so clients do not have to guess. It is limited by the app's remaining budget, its balance if it is isolated,
+// and the node's spendable balance (less the node balance reserve for non-isolated apps),
+// and leaves room for the fee reserve as when the payment is sent.
+// The dynamic fee reserve is not taken into account, as it depends on the payee.
+// An isolated app with a top up callback may be able to pay more than its balance.
+func (svc *transactionsService) GetMaxPayableAmount(ctx context.Context, appId uint, lnClient lnclient.LNClient) (uint64, error) {
+	var app db.App
+	result := svc.db.Limit(1).Find(&app, &db.App{
+		ID: appId,
+	})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return 0, NewNotFoundError()
+	}
+
+	if app.Paused {
+		return 0, NewAppPausedError()
+	}
+
+	var appPermission db.AppPermission
+	result = svc.db.Limit(1).Find(&appPermission, &db.AppPermission{
+		AppId: appId,
+		Scope: constants.PAY_INVOICE_SCOPE,
+	})
+	if result.RowsAffected == 0 {
+		return 0, errors.New("app does not have pay_invoice scope")
+	}
+
+	err := svc.applyFiatBudget(&appPermission)
+	if err != nil {
+		return 0, err
+	}
+
+	balances, err := lnClient.GetBalances(ctx)
+	if err != nil {
+		logger.Logger.WithFields(logrus.Fields{
+			"app_id": appId,
+		}).WithError(err).Error("Failed to get balances")
+		return 0, err
+	}
+	limitMsat := uint64(max(balances.Lightning.TotalSpendable, 0))
+
+	if app.Isolated {
+		limitMsat = min(limitMsat, queries.GetIsolatedBalance(svc.db, appId))
+	} else {
+		limitMsat -= min(limitMsat, svc.nodeBalanceReserveMsat)
+	}
+
+	maxAmountSat, _, budgetUsageSat := queries.GetAppBudget(svc.db, &app, &appPermission)
+	if maxAmountSat > 0 {
+		var remainingMsat uint64
+		if uint64(maxAmountSat) > budgetUsageSat {
+			remainingMsat = (uint64(maxAmountSat) - budgetUsageSat) * 1000
+		}
+		limitMsat = min(limitMsat, remainingMsat)
+	}
+
+	return getMaxAmountWithFeeReserveMsat(limitMsat, svc.getMinFeeReserveMsat(&appId, lnClient), svc.feeReserveRounding), nil
+}
+
+// getMaxAmountWithFeeReserveMsat returns the largest amount which, together with its fee reserve,
+// is within the limit
+func getMaxAmountWithFeeReserveMsat(limitMsat uint64, minFeeReserveMsat uint64, rounding FeeReserveRounding) uint64 {
+	// the amount plus its fee reserve increases with the amount, so the first amount over the limit is found
+	exceeded := sort.Search(int(limitMsat)+1, func(amount int) bool {
+		return uint64(amount)+calculateStaticFeeReserveMsat(uint64(amount), minFeeReserveMsat, rounding) > limitMsat
+	})
+	if exceeded == 0 {
+		return 0
+	}
+	return uint64(exceeded - 1)
+}
@@ -0,0 +1,195 @@
+package transactions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetMaxPayableAmount(t *testing.T) {
+	ctx := context.TODO()
+
+	for name, testCase := range map[string]struct {
+		nodeSpendableMsat int64
+		isolated          bool
+		receivedMsat      uint64
+		maxAmountSat      int
+		spentMsat         uint64
+		expectedMsat      uint64
+	}{
+		"node balance": {
+			nodeSpendableMsat: 100_000,
+			expectedMsat:      90_000,
+		},
+		"node balance with a budget": {
+			nodeSpendableMsat: 100_000,
+			maxAmountSat:      1000,
+			expectedMsat:      90_000,
+		},
+		"isolated balance": {
+			nodeSpendableMsat: 1_000_000_000,
+			isolated:          true,
+			receivedMsat:      50_000,
+			maxAmountSat:      1000,
+			expectedMsat:      40_000,
+		},
+		"isolated balance after payments": {
+			nodeSpendableMsat: 1_000_000_000,
+			isolated:          true,
+			receivedMsat:      100_000,
+			spentMsat:         30_000,
+			expectedMsat:      60_000,
+		},
+		"remaining budget": {
+			nodeSpendableMsat: 1_000_000_000,
+			isolated:          true,
+			receivedMsat:      500_000,
+			maxAmountSat:      100,
+			spentMsat:         40_000,
+			expectedMsat:      50_000,
+		},
+		"budget used up": {
+			nodeSpendableMsat: 1_000_000_000,
+			maxAmountSat:      100,
+			spentMsat:         100_000,
+			expectedMsat:      0,
+		},
+		"balance below the minimum fee reserve": {
+			nodeSpendableMsat: 1_000_000_000,
+			isolated:          true,
+			receivedMsat:      5_000,
+			expectedMsat:      0,
+		},
+		"percentage fee reserve": {
+			nodeSpendableMsat: 10_100_000,
+			expectedMsat:      10_000_000,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer tests.RemoveTestService()
+			svc, err := tests.CreateTestService()
+			require.NoError(t, err)
+
+			mockBalances := tests.MockLNClientBalances
+			defer func() { tests.MockLNClientBalances = mockBalances }()
+			tests.MockLNClientBalances.Lightning.TotalSpendable = testCase.nodeSpendableMsat
+
+			app, _, err := tests.CreateApp(svc)
+			require.NoError(t, err)
+			app.Isolated = testCase.isolated
+			svc.DB.Save(&app)
+
+			err = svc.DB.Create(&db.AppPermission{
+				AppId:         app.ID,
+				App:           *app,
+				Scope:         constants.PAY_INVOICE_SCOPE,
+				MaxAmountSat:  testCase.maxAmountSat,
+				BudgetRenewal: constants.BUDGET_RENEWAL_MONTHLY,
+			}).Error
+			require.NoError(t, err)
+
+			if testCase.receivedMsat > 0 {
+				svc.DB.Create(&db.Transaction{
+					AppId:       &app.ID,
+					State:       constants.TRANSACTION_STATE_SETTLED,
+					Type:        constants.TRANSACTION_TYPE_INCOMING,
+					PaymentHash: "received",
+					AmountMsat:  testCase.receivedMsat,
+				})
+			}
+			if testCase.spentMsat > 0 {
+				svc.DB.Create(&db.Transaction{
+					AppId:       &app.ID,
+					State:       constants.TRANSACTION_STATE_SETTLED,
+					Type:        constants.TRANSACTION_TYPE_OUTGOING,
+					PaymentHash: "spent",
+					AmountMsat:  testCase.spentMsat,
+				})
+			}
+
+			transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+			maxPayableAmount, err := transactionsService.GetMaxPayableAmount(ctx, app.ID, svc.LNClient)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.expectedMsat, maxPayableAmount)
+		})
+	}
+}
+
+func TestGetMaxPayableAmount_CanPay(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	mockBalances := tests.MockLNClientBalances
+	defer func() { tests.MockLNClientBalances = mockBalances }()
+	tests.MockLNClientBalances.Lightning.TotalSpendable = 1_000_000_000
+
+	app, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+	app.Isolated = true
+	svc.DB.Save(&app)
+
+	err = svc.DB.Create(&db.AppPermission{
+		AppId: app.ID,
+		App:   *app,
+		Scope: constants.PAY_INVOICE_SCOPE,
+	}).Error
+	require.NoError(t, err)
+
+	svc.DB.Create(&db.Transaction{
+		AppId:       &app.ID,
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		PaymentHash: "received",
+		AmountMsat:  3_000_000,
+	})
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	maxPayableAmount, err := transactionsService.GetMaxPayableAmount(ctx, app.ID, svc.LNClient)
+	require.NoError(t, err)
+
+	// the max payable amount passes the same checks as a payment, and any more does not
+	err = transactionsService.validateCanPay(svc.DB, &app.ID, maxPayableAmount, transactionsService.calculateFeeReserveMsat(maxPayableAmount, "", &app.ID, svc.LNClient), "", svc.LNClient, nil)
+	assert.NoError(t, err)
+	err = transactionsService.validateCanPay(svc.DB, &app.ID, maxPayableAmount+1, transactionsService.calculateFeeReserveMsat(maxPayableAmount+1, "", &app.ID, svc.LNClient), "", svc.LNClient, nil)
+	assert.ErrorIs(t, err, NewInsufficientBalanceError())
+}
+
+func TestGetMaxPayableAmount_Paused(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, err := tests.CreateAppWithPermissions(svc, &db.AppPermission{Scope: constants.PAY_INVOICE_SCOPE})
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	require.NoError(t, transactionsService.PauseApp(ctx, app.ID))
+
+	_, err = transactionsService.GetMaxPayableAmount(ctx, app.ID, svc.LNClient)
+	assert.ErrorIs(t, err, NewAppPausedError())
+}
+
+func TestGetMaxPayableAmount_NoPermission(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	_, err = transactionsService.GetMaxPayableAmount(ctx, app.ID, svc.LNClient)
+	assert.EqualError(t, err, "app does not have pay_invoice scope")
+}
@@ -0,0 +1,78 @@
+package transactions
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+)
+
+// getMetadataValue decodes the transaction's metadata and returns the value of a top-level key.
+// Numbers are decoded as json.Number so large integers keep their precision.
+func getMetadataValue(transaction *Transaction, key string) (interface{}, bool) {
+	if len(transaction.Metadata) == 0 {
+		return nil, false
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(transaction.Metadata))
+	decoder.UseNumber()
+	var metadata map[string]interface{}
+	if err := decoder.Decode(&metadata); err != nil {
+		return nil, false
+	}
+
+	value, ok := metadata[key]
+	return value, ok && value != nil
+}
+
+// GetMetadataString returns a string value from the transaction's metadata.
+// ok is false if the key is missing or its value is not a string.
+func GetMetadataString(transaction *Transaction, key string) (value string, ok bool) {
+	rawValue, ok := getMetadataValue(transaction, key)
+	if !ok {
+		return "", false
+	}
+	value, ok = rawValue.(string)
+	return value, ok
+}
+
+// GetMetadataInt returns an integer value from the transaction's metadata. Whole numbers
+// and strings containing an integer (e.g. "21") are accepted.
+// ok is false if the key is missing or its value is not an integer.
+func GetMetadataInt(transaction *Transaction, key string) (value int64, ok bool) {
+	rawValue, ok := getMetadataValue(transaction, key)
+	if !ok {
+		return 0, false
+	}
+
+	var number string
+	switch rawValue := rawValue.(type) {
+	case json.Number:
+		number = rawValue.String()
+	case string:
+		number = rawValue
+	default:
+		return 0, false
+	}
+
+	value, err := strconv.ParseInt(number, 10, 64)
+	if err == nil {
+		return value, true
+	}
+	// whole numbers written with an exponent or decimal point, e.g. 1e3 or 21.0
+	floatValue, err := strconv.ParseFloat(number, 64)
+	if err != nil || floatValue != float64(int64(floatValue)) {
+		return 0, false
+	}
+	return int64(floatValue), true
+}
+
+// GetMetadataBool returns a boolean value from the transaction's metadata.
+// ok is false if the key is missing or its value is not a boolean.
+func GetMetadataBool(transaction *Transaction, key string) (value bool, ok bool) {
+	rawValue, ok := getMetadataValue(transaction, key)
+	if !ok {
+		return false, false
+	}
+	value, ok = rawValue.(bool)
+	return value, ok
+}
@@ -0,0 +1,72 @@
+package transactions
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/datatypes"
+)
+
+func TestGetMetadataAccessors(t *testing.T) {
+	transaction := &Transaction{
+		Metadata: datatypes.JSON(`{
+			"comment": "hello",
+			"amount": 21,
+			"amount_string": "42",
+			"big": 9007199254740993,
+			"fraction": 1.5,
+			"whole_float": 21.0,
+			"bool": true,
+			"null": null,
+			"nested": {"key": "value"}
+		}`),
+	}
+
+	for name, testCase := range map[string]struct {
+		key            string
+		expectedString string
+		expectedInt    int64
+		expectedBool   bool
+		stringOk       bool
+		intOk          bool
+		boolOk         bool
+	}{
+		"string":         {key: "comment", expectedString: "hello", stringOk: true},
+		"number":         {key: "amount", expectedInt: 21, intOk: true},
+		"numeric string": {key: "amount_string", expectedString: "42", stringOk: true, expectedInt: 42, intOk: true},
+		"large number":   {key: "big", expectedInt: 9007199254740993, intOk: true},
+		"fraction":       {key: "fraction"},
+		"whole float":    {key: "whole_float", expectedInt: 21, intOk: true},
+		"bool":           {key: "bool", expectedBool: true, boolOk: true},
+		"null":           {key: "null"},
+		"object":         {key: "nested"},
+		"missing":        {key: "missing"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			stringValue, ok := GetMetadataString(transaction, testCase.key)
+			assert.Equal(t, testCase.stringOk, ok)
+			assert.Equal(t, testCase.expectedString, stringValue)
+
+			intValue, ok := GetMetadataInt(transaction, testCase.key)
+			assert.Equal(t, testCase.intOk, ok)
+			assert.Equal(t, testCase.expectedInt, intValue)
+
+			boolValue, ok := GetMetadataBool(transaction, testCase.key)
+			assert.Equal(t, testCase.boolOk, ok)
+			assert.Equal(t, testCase.expectedBool, boolValue)
+		})
+	}
+}
+
+func TestGetMetadataAccessors_NoMetadata(t *testing.T) {
+	for _, metadata := range []datatypes.JSON{nil, datatypes.JSON(`not json`), datatypes.JSON(`[1, 2]`)} {
+		transaction := &Transaction{Metadata: metadata}
+
+		_, ok := GetMetadataString(transaction, "comment")
+		assert.False(t, ok)
+		_, ok = GetMetadataInt(transaction, "amount")
+		assert.False(t, ok)
+		_, ok = GetMetadataBool(transaction, "bool")
+		assert.False(t, ok)
+	}
+}
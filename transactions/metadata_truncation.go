@@ -0,0 +1,78 @@
+package transactions
+
+import (
+	"encoding/json"
+	"maps"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// truncateMetadata shortens the app's designated metadata field so the encoded metadata
+// fits within maxLength, marking the metadata as truncated.
+// It returns false if the app rejects oversized metadata (the default) or the metadata
+// cannot be made to fit by truncating that field.
+func (svc *transactionsService) truncateMetadata(metadata map[string]interface{}, maxLength int, appId *uint) ([]byte, bool) {
+	if appId == nil {
+		return nil, false
+	}
+
+	var app db.App
+	result := svc.db.Limit(1).Find(&app, &db.App{
+		ID: *appId,
+	})
+	if result.RowsAffected == 0 || app.MetadataTruncateField == "" {
+		return nil, false
+	}
+
+	value, ok := metadata[app.MetadataTruncateField].(string)
+	if !ok {
+		return nil, false
+	}
+
+	metadata = maps.Clone(metadata)
+	metadata[constants.METADATA_TRUNCATED_METADATA_KEY] = true
+	runes := []rune(value)
+
+	encode := func(length int) []byte {
+		metadata[app.MetadataTruncateField] = string(runes[:length])
+		metadataBytes, err := json.Marshal(metadata)
+		if err != nil {
+			logger.Logger.WithError(err).Error("Failed to serialize metadata")
+			return nil
+		}
+		return metadataBytes
+	}
+
+	// find the longest prefix of the field that fits. The encoded length of a prefix
+	// is not simply its byte length as characters may need escaping.
+	metadataBytes := encode(0)
+	if metadataBytes == nil || len(metadataBytes) > maxLength {
+		return nil, false
+	}
+	low, high := 0, len(runes)
+	for low < high {
+		mid := (low + high + 1) / 2
+		candidate := encode(mid)
+		if candidate == nil {
+			return nil, false
+		}
+		if len(candidate) <= maxLength {
+			low = mid
+			metadataBytes = candidate
+		} else {
+			high = mid - 1
+		}
+	}
+
+	logger.Logger.WithFields(logrus.Fields{
+		"app_id":           *appId,
+		"field":            app.MetadataTruncateField,
+		"original_length":  len(runes),
+		"truncated_length": low,
+	}).Info("Truncated oversized metadata")
+
+	return metadataBytes, true
+}
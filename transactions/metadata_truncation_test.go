@@ -0,0 +1,200 @@
+package transactions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMakeInvoice_MetadataTruncation_AtLimit(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, err := tests.CreateAppWithPermissions(svc)
+	require.NoError(t, err)
+	err = svc.DB.Model(app).Update("metadata_truncate_field", "comment").Error
+	require.NoError(t, err)
+
+	metadata := map[string]interface{}{
+		"comment": strings.Repeat("a", constants.INVOICE_METADATA_MAX_LENGTH-14), // json encoding adds 14 characters
+	}
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.MakeInvoice(ctx, 1234, "Hello world", "", 0, metadata, svc.LNClient, &app.ID, nil, "")
+	require.NoError(t, err)
+
+	// metadata within the limit is not truncated
+	var storedMetadata map[string]interface{}
+	require.NoError(t, json.Unmarshal(transaction.Metadata, &storedMetadata))
+	assert.Equal(t, metadata["comment"], storedMetadata["comment"])
+	assert.NotContains(t, storedMetadata, constants.METADATA_TRUNCATED_METADATA_KEY)
+}
+
+func TestMakeInvoice_MetadataTruncation_OverLimit(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, err := tests.CreateAppWithPermissions(svc)
+	require.NoError(t, err)
+	err = svc.DB.Model(app).Update("metadata_truncate_field", "comment").Error
+	require.NoError(t, err)
+
+	metadata := map[string]interface{}{
+		"comment": strings.Repeat("a", constants.INVOICE_METADATA_MAX_LENGTH-13),
+	}
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.MakeInvoice(ctx, 1234, "Hello world", "", 0, metadata, svc.LNClient, &app.ID, nil, "")
+	require.NoError(t, err)
+	assert.Equal(t, constants.INVOICE_METADATA_MAX_LENGTH, len(transaction.Metadata))
+
+	var storedMetadata map[string]interface{}
+	require.NoError(t, json.Unmarshal(transaction.Metadata, &storedMetadata))
+	assert.Equal(t, true, storedMetadata[constants.METADATA_TRUNCATED_METADATA_KEY])
+	// json encoding adds 40 characters including the truncation marker
+	assert.Equal(t, strings.Repeat("a", constants.INVOICE_METADATA_MAX_LENGTH-40), storedMetadata["comment"])
+
+	// the caller's metadata is left untouched
+	assert.Equal(t, strings.Repeat("a", constants.INVOICE_METADATA_MAX_LENGTH-13), metadata["comment"])
+	assert.NotContains(t, metadata, constants.METADATA_TRUNCATED_METADATA_KEY)
+}
+
+func TestMakeInvoice_MetadataTruncation_EscapedCharacters(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, err := tests.CreateAppWithPermissions(svc)
+	require.NoError(t, err)
+	err = svc.DB.Model(app).Update("metadata_truncate_field", "comment").Error
+	require.NoError(t, err)
+
+	metadata := map[string]interface{}{
+		"comment": strings.Repeat("\"⚡<", constants.INVOICE_METADATA_MAX_LENGTH),
+		"payer":   "satoshi",
+	}
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.MakeInvoice(ctx, 1234, "Hello world", "", 0, metadata, svc.LNClient, &app.ID, nil, "")
+	require.NoError(t, err)
+	assert.LessOrEqual(t, len(transaction.Metadata), constants.INVOICE_METADATA_MAX_LENGTH)
+
+	var storedMetadata map[string]interface{}
+	require.NoError(t, json.Unmarshal(transaction.Metadata, &storedMetadata))
+	assert.Equal(t, true, storedMetadata[constants.METADATA_TRUNCATED_METADATA_KEY])
+	assert.Equal(t, "satoshi", storedMetadata["payer"])
+	assert.True(t, strings.HasPrefix(metadata["comment"].(string), storedMetadata["comment"].(string)))
+	assert.NotEmpty(t, storedMetadata["comment"])
+}
+
+func TestMakeInvoice_MetadataTruncation_Rejected(t *testing.T) {
+	testCases := []struct {
+		name          string
+		truncateField string
+		metadata      map[string]interface{}
+	}{
+		{
+			name:          "reject policy",
+			truncateField: "",
+			metadata: map[string]interface{}{
+				"comment": strings.Repeat("a", constants.INVOICE_METADATA_MAX_LENGTH-13),
+			},
+		},
+		{
+			name:          "field not present",
+			truncateField: "comment",
+			metadata: map[string]interface{}{
+				"other": strings.Repeat("a", constants.INVOICE_METADATA_MAX_LENGTH-11),
+			},
+		},
+		{
+			name:          "field not a string",
+			truncateField: "comment",
+			metadata: map[string]interface{}{
+				"comment": []string{strings.Repeat("a", constants.INVOICE_METADATA_MAX_LENGTH)},
+			},
+		},
+		{
+			name:          "other fields over the limit",
+			truncateField: "comment",
+			metadata: map[string]interface{}{
+				"comment": "hello",
+				"other":   strings.Repeat("a", constants.INVOICE_METADATA_MAX_LENGTH),
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			ctx := context.TODO()
+
+			defer tests.RemoveTestService()
+			svc, err := tests.CreateTestService()
+			require.NoError(t, err)
+
+			app, err := tests.CreateAppWithPermissions(svc)
+			require.NoError(t, err)
+			err = svc.DB.Model(app).Update("metadata_truncate_field", testCase.truncateField).Error
+			require.NoError(t, err)
+
+			metadataBytes, err := json.Marshal(testCase.metadata)
+			require.NoError(t, err)
+
+			transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+			transaction, err := transactionsService.MakeInvoice(ctx, 1234, "Hello world", "", 0, testCase.metadata, svc.LNClient, &app.ID, nil, "")
+			assert.EqualError(t, err, fmt.Sprintf("encoded invoice metadata provided is too large. Limit: %d Received: %d", constants.INVOICE_METADATA_MAX_LENGTH, len(metadataBytes)))
+			assert.Nil(t, transaction)
+		})
+	}
+}
+
+func TestSendPaymentSync_MetadataTruncation(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, err := tests.CreateAppWithPermissions(svc)
+	require.NoError(t, err)
+	err = svc.DB.Model(app).Update("metadata_truncate_field", "comment").Error
+	require.NoError(t, err)
+
+	err = svc.DB.Create(&db.AppPermission{
+		AppId: app.ID,
+		App:   *app,
+		Scope: constants.PAY_INVOICE_SCOPE,
+	}).Error
+	require.NoError(t, err)
+
+	metadata := map[string]interface{}{
+		"comment": strings.Repeat("a", constants.INVOICE_METADATA_MAX_LENGTH-13),
+	}
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, metadata, svc.LNClient, &app.ID, nil, SendPaymentOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transaction.State)
+	assert.Equal(t, constants.INVOICE_METADATA_MAX_LENGTH, len(transaction.Metadata))
+
+	var storedMetadata map[string]interface{}
+	require.NoError(t, json.Unmarshal(transaction.Metadata, &storedMetadata))
+	assert.Equal(t, true, storedMetadata[constants.METADATA_TRUNCATED_METADATA_KEY])
+	assert.Equal(t, strings.Repeat("a", constants.INVOICE_METADATA_MAX_LENGTH-40), storedMetadata["comment"])
+}
@@ -0,0 +1,110 @@
+package transactions
+
+import (
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"math"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/lnclient"
+)
+
+// metadata key holding the TLV records of a keysend payment
+const tlvRecordsMetadataKey = "tlv_records"
+
+// normalizeMetadata validates the shape of the reserved keys in caller-provided metadata.
+// TLV records that were decoded from JSON are converted to lnclient.TLVRecord,
+// so they are not silently dropped when read back. The metadata is copied rather than modified.
+func normalizeMetadata(metadata map[string]interface{}) (map[string]interface{}, error) {
+	if metadata == nil {
+		return nil, nil
+	}
+
+	if _, ok := metadata[constants.SELF_PAYMENT_DEPTH_METADATA_KEY]; ok {
+		if _, ok := getMetadataUint(metadata[constants.SELF_PAYMENT_DEPTH_METADATA_KEY]); !ok {
+			return nil, newInvalidMetadataErrorWithReason(constants.SELF_PAYMENT_DEPTH_METADATA_KEY + " must be a non-negative integer")
+		}
+	}
+	if _, ok := metadata[constants.KEYSEND_COUNT_METADATA_KEY]; ok {
+		if _, ok := getMetadataUint(metadata[constants.KEYSEND_COUNT_METADATA_KEY]); !ok {
+			return nil, newInvalidMetadataErrorWithReason(constants.KEYSEND_COUNT_METADATA_KEY + " must be a non-negative integer")
+		}
+	}
+	if _, ok := metadata[constants.METADATA_TRUNCATED_METADATA_KEY]; ok {
+		if _, ok := metadata[constants.METADATA_TRUNCATED_METADATA_KEY].(bool); !ok {
+			return nil, newInvalidMetadataErrorWithReason(constants.METADATA_TRUNCATED_METADATA_KEY + " must be a boolean")
+		}
+	}
+	if _, ok := metadata[constants.ENVIRONMENT_METADATA_KEY]; ok {
+		if _, ok := metadata[constants.ENVIRONMENT_METADATA_KEY].(string); !ok {
+			return nil, newInvalidMetadataErrorWithReason(constants.ENVIRONMENT_METADATA_KEY + " must be a string")
+		}
+	}
+	if _, ok := metadata[constants.ATTESTATIONS_METADATA_KEY]; ok {
+		// attestations are verified when they are added, so they cannot be provided with a payment or invoice
+		return nil, newInvalidMetadataErrorWithReason(constants.ATTESTATIONS_METADATA_KEY + " cannot be set directly")
+	}
+
+	normalizedMetadata := maps.Clone(metadata)
+	if _, ok := metadata[tlvRecordsMetadataKey]; ok {
+		tlvRecords, err := getTLVRecords(metadata[tlvRecordsMetadataKey])
+		if err != nil {
+			return nil, newInvalidMetadataErrorWithReason(tlvRecordsMetadataKey + " " + err.Error())
+		}
+		normalizedMetadata[tlvRecordsMetadataKey] = tlvRecords
+	}
+	return normalizedMetadata, nil
+}
+
+// getTLVRecords returns the TLV records stored in transaction metadata, either as set by
+// the LN backends or as decoded from JSON. A missing value has no records.
+func getTLVRecords(value interface{}) ([]lnclient.TLVRecord, error) {
+	switch value := value.(type) {
+	case nil:
+		return nil, nil
+	case []lnclient.TLVRecord:
+		return value, nil
+	case []interface{}:
+		tlvRecords := make([]lnclient.TLVRecord, 0, len(value))
+		for i, item := range value {
+			record, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("record %d must be an object", i)
+			}
+			tlvType, ok := getMetadataUint(record["type"])
+			if !ok {
+				return nil, fmt.Errorf("record %d must have a non-negative integer type", i)
+			}
+			tlvValue, ok := record["value"].(string)
+			if !ok {
+				return nil, fmt.Errorf("record %d must have a string value", i)
+			}
+			if _, err := hex.DecodeString(tlvValue); err != nil {
+				return nil, fmt.Errorf("record %d must have a hex-encoded value", i)
+			}
+			tlvRecords = append(tlvRecords, lnclient.TLVRecord{
+				Type:  tlvType,
+				Value: tlvValue,
+			})
+		}
+		return tlvRecords, nil
+	default:
+		return nil, fmt.Errorf("must be an array of records")
+	}
+}
+
+// getMetadataUint returns a non-negative integer metadata value,
+// which is a float64 if the metadata was decoded from JSON
+func getMetadataUint(value interface{}) (uint64, bool) {
+	switch value := value.(type) {
+	case int:
+		return uint64(value), value >= 0
+	case uint64:
+		return value, true
+	case float64:
+		return uint64(value), value >= 0 && value == math.Trunc(value) && value <= math.MaxUint64
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,128 @@
+package transactions
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/events"
+	"github.com/getAlby/hub/lnclient"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMakeInvoice_Metadata_TLVRecordsFromJSON(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	var metadata map[string]interface{}
+	err = json.Unmarshal([]byte(`{"tlv_records":[{"type":7629169,"value":"7b7d"}],"randomkey":"a"}`), &metadata)
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.MakeInvoice(ctx, 1234, "Hello world", "", 0, metadata, svc.LNClient, nil, nil, "")
+	require.NoError(t, err)
+
+	var storedMetadata struct {
+		TLVRecords []lnclient.TLVRecord `json:"tlv_records"`
+		RandomKey  string               `json:"randomkey"`
+	}
+	require.NoError(t, json.Unmarshal(transaction.Metadata, &storedMetadata))
+	assert.Equal(t, []lnclient.TLVRecord{{Type: 7629169, Value: "7b7d"}}, storedMetadata.TLVRecords)
+	assert.Equal(t, "a", storedMetadata.RandomKey)
+
+	// the caller's metadata is not modified
+	assert.IsType(t, []interface{}{}, metadata["tlv_records"])
+}
+
+func TestMakeInvoice_Metadata_MalformedReservedKeys(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	for _, metadataJson := range []string{
+		`{"tlv_records":"7b7d"}`,
+		`{"tlv_records":{"type":7629169,"value":"7b7d"}}`,
+		`{"tlv_records":[1]}`,
+		`{"tlv_records":[{"type":-1,"value":"7b7d"}]}`,
+		`{"tlv_records":[{"type":1.5,"value":"7b7d"}]}`,
+		`{"tlv_records":[{"type":"7629169","value":"7b7d"}]}`,
+		`{"tlv_records":[{"type":7629169}]}`,
+		`{"tlv_records":[{"type":7629169,"value":"not hex"}]}`,
+		`{"self_payment_depth":"1"}`,
+		`{"self_payment_depth":-1}`,
+		`{"keysend_count":1.5}`,
+		`{"metadata_truncated":"yes"}`,
+		`{"environment":1}`,
+	} {
+		var metadata map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(metadataJson), &metadata))
+
+		transaction, err := transactionsService.MakeInvoice(ctx, 1234, "Hello world", "", 0, metadata, svc.LNClient, nil, nil, "")
+		assert.ErrorIs(t, err, NewInvalidMetadataError(), metadataJson)
+		assert.Nil(t, transaction)
+	}
+}
+
+func TestSendPaymentSync_Metadata_MalformedReservedKeys(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	metadata := map[string]interface{}{
+		"tlv_records": "7b7d",
+	}
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, metadata, svc.LNClient, nil, nil, SendPaymentOptions{})
+	assert.ErrorIs(t, err, NewInvalidMetadataError())
+	assert.EqualError(t, err, "The metadata is invalid: tlv_records must be an array of records")
+	assert.Nil(t, transaction)
+}
+
+func TestNotifications_ReceivedKeysend_TLVRecordsFromJSON(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	// a boostagram with message "hi", as decoded from JSON rather than set by the LN backend
+	var metadata map[string]interface{}
+	err = json.Unmarshal([]byte(`{"tlv_records":[{"type":7629169,"value":"7b226d657373616765223a226869227d"}]}`), &metadata)
+	require.NoError(t, err)
+
+	transactionsService.ConsumeEvent(ctx, &events.Event{
+		Event: "nwc_lnclient_payment_received",
+		Properties: &lnclient.Transaction{
+			Type:        "incoming",
+			Invoice:     tests.MockInvoice,
+			Preimage:    tests.MockLNClientTransaction.Preimage,
+			PaymentHash: tests.MockLNClientTransaction.PaymentHash,
+			Amount:      2000,
+			SettledAt:   &tests.MockTimeUnix,
+			Metadata:    metadata,
+		},
+	}, map[string]interface{}{})
+
+	transactionType := constants.TRANSACTION_TYPE_INCOMING
+	incomingTransaction, err := transactionsService.LookupTransaction(ctx, tests.MockLNClientTransaction.PaymentHash, &transactionType, svc.LNClient, nil, false)
+	require.NoError(t, err)
+
+	var boostagram Boostagram
+	require.NoError(t, json.Unmarshal(incomingTransaction.Boostagram, &boostagram))
+	assert.Equal(t, "hi", boostagram.Message)
+}
@@ -0,0 +1,41 @@
+package transactions
+
+import (
+	"context"
+
+	"github.com/getAlby/hub/lnclient"
+	"github.com/getAlby/hub/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// SetNodeBalanceReserve sets an amount of the node's spendable balance which payments
+// cannot spend, e.g. to keep funds for fee bumping channel closes. Only payments of the node
+// and non-isolated apps are limited, as isolated apps can only spend their own balance.
+// 0 (the default) disables the reserve.
+func (svc *transactionsService) SetNodeBalanceReserve(reserveMsat uint64) {
+	svc.nodeBalanceReserveMsat = reserveMsat
+}
+
+// validateNodeBalanceReserve rejects payments which would take the node's spendable balance below the reserve
+func (svc *transactionsService) validateNodeBalanceReserve(amountWithFeeReserve uint64, lnClient lnclient.LNClient) error {
+	if svc.nodeBalanceReserveMsat == 0 || lnClient == nil {
+		return nil
+	}
+
+	balances, err := lnClient.GetBalances(context.Background())
+	if err != nil {
+		logger.Logger.WithError(err).Error("Failed to get balances to check the node balance reserve")
+		return err
+	}
+
+	spendableMsat := uint64(max(balances.Lightning.TotalSpendable, 0))
+	if amountWithFeeReserve+svc.nodeBalanceReserveMsat > spendableMsat {
+		logger.Logger.WithFields(logrus.Fields{
+			"amount_msat":    amountWithFeeReserve,
+			"reserve_msat":   svc.nodeBalanceReserveMsat,
+			"spendable_msat": spendableMsat,
+		}).Warn("Payment would take the node balance below the reserve")
+		return NewInsufficientBalanceError()
+	}
+	return nil
+}
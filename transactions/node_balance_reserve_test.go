@@ -0,0 +1,153 @@
+package transactions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendPaymentSync_NodeBalanceReserve(t *testing.T) {
+	ctx := context.TODO()
+
+	// the mock invoice is 123 sats, with a fee reserve of 10 sats
+	for name, testCase := range map[string]struct {
+		spendableMsat int64
+		reserveMsat   uint64
+		expectedError error
+	}{
+		"no reserve": {
+			spendableMsat: 133_000,
+			reserveMsat:   0,
+		},
+		"reserve not binding": {
+			spendableMsat: 1_000_000,
+			reserveMsat:   500_000,
+		},
+		"reserve exactly met": {
+			spendableMsat: 633_000,
+			reserveMsat:   500_000,
+		},
+		"reserve binding": {
+			spendableMsat: 632_999,
+			reserveMsat:   500_000,
+			expectedError: NewInsufficientBalanceError(),
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer tests.RemoveTestService()
+			svc, err := tests.CreateTestService()
+			require.NoError(t, err)
+
+			mockBalances := tests.MockLNClientBalances
+			defer func() { tests.MockLNClientBalances = mockBalances }()
+			tests.MockLNClientBalances.Lightning.TotalSpendable = testCase.spendableMsat
+
+			transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+			transactionsService.SetNodeBalanceReserve(testCase.reserveMsat)
+
+			transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, nil, nil, SendPaymentOptions{})
+			if testCase.expectedError != nil {
+				assert.ErrorIs(t, err, testCase.expectedError)
+				assert.Nil(t, transaction)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transaction.State)
+		})
+	}
+}
+
+func TestSendKeysend_NodeBalanceReserve(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	mockBalances := tests.MockLNClientBalances
+	defer func() { tests.MockLNClientBalances = mockBalances }()
+	tests.MockLNClientBalances.Lightning.TotalSpendable = 100_000
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transactionsService.SetNodeBalanceReserve(90_000)
+
+	transaction, err := transactionsService.SendKeysend(ctx, 1000, mockPayee, nil, "", "", svc.LNClient, nil, nil)
+	assert.ErrorIs(t, err, NewInsufficientBalanceError())
+	// the node's reserve is not specific to an app
+	_, _, ok := GetPermissionDeniedApp(err)
+	assert.False(t, ok)
+	assert.Nil(t, transaction)
+}
+
+func TestSendPaymentSync_NodeBalanceReserve_IsolatedApp(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	mockBalances := tests.MockLNClientBalances
+	defer func() { tests.MockLNClientBalances = mockBalances }()
+	tests.MockLNClientBalances.Lightning.TotalSpendable = 200_000
+
+	app, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+	app.Isolated = true
+	svc.DB.Save(&app)
+
+	err = svc.DB.Create(&db.AppPermission{
+		AppId: app.ID,
+		App:   *app,
+		Scope: constants.PAY_INVOICE_SCOPE,
+	}).Error
+	require.NoError(t, err)
+
+	svc.DB.Create(&db.Transaction{
+		AppId:       &app.ID,
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		PaymentHash: "received",
+		AmountMsat:  200_000,
+	})
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transactionsService.SetNodeBalanceReserve(150_000)
+
+	// the isolated app can spend its own balance regardless of the reserve
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, nil, SendPaymentOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transaction.State)
+}
+
+func TestGetMaxPayableAmount_NodeBalanceReserve(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	mockBalances := tests.MockLNClientBalances
+	defer func() { tests.MockLNClientBalances = mockBalances }()
+	tests.MockLNClientBalances.Lightning.TotalSpendable = 600_000
+
+	app, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+	err = svc.DB.Create(&db.AppPermission{
+		AppId: app.ID,
+		App:   *app,
+		Scope: constants.PAY_INVOICE_SCOPE,
+	}).Error
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transactionsService.SetNodeBalanceReserve(500_000)
+
+	maxPayableAmount, err := transactionsService.GetMaxPayableAmount(ctx, app.ID, svc.LNClient)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(90_000), maxPayableAmount)
+}
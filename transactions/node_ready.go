@@ -0,0 +1,32 @@
+package transactions
+
+import (
+	"context"
+
+	"github.com/getAlby/hub/lnclient"
+	"github.com/getAlby/hub/logger"
+)
+
+// SetNodeReadyCheck enables rejecting payments and invoices while the node reports it is still syncing,
+// instead of attempting them and failing unpredictably. Disabled by default.
+func (svc *transactionsService) SetNodeReadyCheck(enabled bool) {
+	svc.nodeReadyCheck = enabled
+}
+
+// validateNodeReady rejects payments and invoices if the node is not ready to process them
+func (svc *transactionsService) validateNodeReady(ctx context.Context, lnClient lnclient.LNClient) error {
+	if !svc.nodeReadyCheck {
+		return nil
+	}
+
+	nodeStatus, err := lnClient.GetNodeStatus(ctx)
+	if err != nil {
+		logger.Logger.WithError(err).Error("Failed to get node status")
+		return newNodeNotReadyErrorWithReason("failed to get node status")
+	}
+	if nodeStatus != nil && nodeStatus.Syncing {
+		logger.Logger.Warn("Rejecting request while the node is syncing")
+		return newNodeNotReadyErrorWithReason("the node is syncing")
+	}
+	return nil
+}
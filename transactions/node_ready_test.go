@@ -0,0 +1,97 @@
+package transactions
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var nodeReadyTestCases = map[string]struct {
+	checkEnabled    bool
+	nodeSyncing     bool
+	nodeStatusError error
+	expectedError   error
+}{
+	"synced": {
+		checkEnabled: true,
+	},
+	"syncing": {
+		checkEnabled:  true,
+		nodeSyncing:   true,
+		expectedError: NewNodeNotReadyError(),
+	},
+	"node status unavailable": {
+		checkEnabled:    true,
+		nodeStatusError: errors.New("node is starting"),
+		expectedError:   NewNodeNotReadyError(),
+	},
+	"syncing with check disabled": {
+		checkEnabled: false,
+		nodeSyncing:  true,
+	},
+}
+
+func TestSendPaymentSync_NodeReady(t *testing.T) {
+	ctx := context.TODO()
+
+	for name, testCase := range nodeReadyTestCases {
+		t.Run(name, func(t *testing.T) {
+			defer tests.RemoveTestService()
+			svc, err := tests.CreateTestService()
+			require.NoError(t, err)
+
+			svc.LNClient.(*tests.MockLn).NodeSyncing = testCase.nodeSyncing
+			svc.LNClient.(*tests.MockLn).NodeStatusError = testCase.nodeStatusError
+
+			transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+			transactionsService.SetNodeReadyCheck(testCase.checkEnabled)
+
+			transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, nil, nil, SendPaymentOptions{})
+			if testCase.expectedError != nil {
+				assert.ErrorIs(t, err, testCase.expectedError)
+				assert.Nil(t, transaction)
+
+				// the payment is not attempted
+				var count int64
+				svc.DB.Model(&db.Transaction{}).Count(&count)
+				assert.Zero(t, count)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transaction.State)
+		})
+	}
+}
+
+func TestMakeInvoice_NodeReady(t *testing.T) {
+	ctx := context.TODO()
+
+	for name, testCase := range nodeReadyTestCases {
+		t.Run(name, func(t *testing.T) {
+			defer tests.RemoveTestService()
+			svc, err := tests.CreateTestService()
+			require.NoError(t, err)
+
+			svc.LNClient.(*tests.MockLn).NodeSyncing = testCase.nodeSyncing
+			svc.LNClient.(*tests.MockLn).NodeStatusError = testCase.nodeStatusError
+
+			transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+			transactionsService.SetNodeReadyCheck(testCase.checkEnabled)
+
+			transaction, err := transactionsService.MakeInvoice(ctx, 1234, "Hello world", "", 0, nil, svc.LNClient, nil, nil, "")
+			if testCase.expectedError != nil {
+				assert.ErrorIs(t, err, testCase.expectedError)
+				assert.Nil(t, transaction)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, constants.TRANSACTION_STATE_PENDING, transaction.State)
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/getAlby/hub/constants"
 	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/db/queries"
 	"github.com/getAlby/hub/events"
 	"github.com/getAlby/hub/lnclient"
 	"github.com/getAlby/hub/tests"
@@ -38,7 +39,7 @@ func TestNotifications_ReceivedKnownPayment(t *testing.T) {
 		Properties: tests.MockLNClientTransaction,
 	}, map[string]interface{}{})
 
-	incomingTransaction, err := transactionsService.LookupTransaction(ctx, tests.MockLNClientTransaction.PaymentHash, nil, svc.LNClient, nil)
+	incomingTransaction, err := transactionsService.LookupTransaction(ctx, tests.MockLNClientTransaction.PaymentHash, nil, svc.LNClient, nil, false)
 	assert.NoError(t, err)
 	assert.Equal(t, uint64(123000), incomingTransaction.AmountMsat)
 	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, incomingTransaction.State)
@@ -65,7 +66,7 @@ func TestNotifications_ReceivedUnknownPayment(t *testing.T) {
 	}, map[string]interface{}{})
 
 	transactionType := constants.TRANSACTION_TYPE_INCOMING
-	incomingTransaction, err := transactionsService.LookupTransaction(ctx, tests.MockLNClientTransaction.PaymentHash, &transactionType, svc.LNClient, nil)
+	incomingTransaction, err := transactionsService.LookupTransaction(ctx, tests.MockLNClientTransaction.PaymentHash, &transactionType, svc.LNClient, nil, false)
 	assert.NoError(t, err)
 	assert.Equal(t, uint64(tests.MockLNClientTransaction.Amount), incomingTransaction.AmountMsat)
 	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, incomingTransaction.State)
@@ -114,7 +115,7 @@ func TestNotifications_ReceivedKeysend(t *testing.T) {
 	}, map[string]interface{}{})
 
 	transactionType := constants.TRANSACTION_TYPE_INCOMING
-	incomingTransaction, err := transactionsService.LookupTransaction(ctx, tests.MockLNClientTransaction.PaymentHash, &transactionType, svc.LNClient, nil)
+	incomingTransaction, err := transactionsService.LookupTransaction(ctx, tests.MockLNClientTransaction.PaymentHash, &transactionType, svc.LNClient, nil, false)
 	assert.NoError(t, err)
 	assert.Equal(t, uint64(2000), incomingTransaction.AmountMsat)
 	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, incomingTransaction.State)
@@ -167,7 +168,7 @@ func TestNotifications_SentKnownPayment(t *testing.T) {
 	}, map[string]interface{}{})
 
 	transactionType := constants.TRANSACTION_TYPE_OUTGOING
-	outgoingTransaction, err := transactionsService.LookupTransaction(ctx, tests.MockLNClientTransaction.PaymentHash, &transactionType, svc.LNClient, nil)
+	outgoingTransaction, err := transactionsService.LookupTransaction(ctx, tests.MockLNClientTransaction.PaymentHash, &transactionType, svc.LNClient, nil, false)
 	assert.NoError(t, err)
 	assert.Equal(t, uint64(123000), outgoingTransaction.AmountMsat)
 	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, outgoingTransaction.State)
@@ -198,7 +199,7 @@ func TestNotifications_SentUnknownPayment(t *testing.T) {
 	}, map[string]interface{}{})
 
 	transactionType := constants.TRANSACTION_TYPE_OUTGOING
-	outgoingTransaction, err := transactionsService.LookupTransaction(ctx, tests.MockLNClientTransaction.PaymentHash, &transactionType, svc.LNClient, nil)
+	outgoingTransaction, err := transactionsService.LookupTransaction(ctx, tests.MockLNClientTransaction.PaymentHash, &transactionType, svc.LNClient, nil, false)
 	assert.Nil(t, outgoingTransaction)
 	assert.ErrorIs(t, err, NewNotFoundError())
 }
@@ -230,7 +231,7 @@ func TestNotifications_FailedKnownPayment(t *testing.T) {
 	}, map[string]interface{}{})
 
 	transactionType := constants.TRANSACTION_TYPE_OUTGOING
-	outgoingTransaction, err := transactionsService.LookupTransaction(ctx, tests.MockLNClientTransaction.PaymentHash, &transactionType, svc.LNClient, nil)
+	outgoingTransaction, err := transactionsService.LookupTransaction(ctx, tests.MockLNClientTransaction.PaymentHash, &transactionType, svc.LNClient, nil, false)
 	assert.NoError(t, err)
 	assert.Equal(t, constants.TRANSACTION_STATE_FAILED, outgoingTransaction.State)
 	assert.Nil(t, outgoingTransaction.Preimage)
@@ -240,3 +241,308 @@ func TestNotifications_FailedKnownPayment(t *testing.T) {
 	result := svc.DB.Find(&transactions)
 	assert.Equal(t, int64(1), result.RowsAffected)
 }
+
+func TestNotifications_ReceivedPaymentInboundChannel(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	lnClientTransaction := *tests.MockLNClientTransaction
+	lnClientTransaction.InboundChannelId = "123456789"
+
+	transactionsService.ConsumeEvent(ctx, &events.Event{
+		Event:      "nwc_lnclient_payment_received",
+		Properties: &lnClientTransaction,
+	}, map[string]interface{}{})
+
+	// the backend does not report the channel for this payment
+	unknownChannelPaymentHash := "ae4277b7be3ca1420cafd24c143866190f52b996856b0e4164763f936e61ea1b"
+	transactionsService.ConsumeEvent(ctx, &events.Event{
+		Event: "nwc_lnclient_payment_received",
+		Properties: &lnclient.Transaction{
+			Type:        "incoming",
+			Preimage:    "9f59b18f80a77c2930deb8be5ff1143eacdd1891c63c23d61bc9f99c64e57325",
+			PaymentHash: unknownChannelPaymentHash,
+			Amount:      2000,
+		},
+	}, map[string]interface{}{})
+
+	transactionType := constants.TRANSACTION_TYPE_INCOMING
+	incomingTransaction, err := transactionsService.LookupTransaction(ctx, tests.MockLNClientTransaction.PaymentHash, &transactionType, svc.LNClient, nil, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "123456789", incomingTransaction.InboundChannelId)
+
+	unknownChannelTransaction, err := transactionsService.LookupTransaction(ctx, unknownChannelPaymentHash, &transactionType, svc.LNClient, nil, false)
+	assert.NoError(t, err)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, unknownChannelTransaction.State)
+	assert.Empty(t, unknownChannelTransaction.InboundChannelId)
+
+	channelVolumes, err := queries.GetReceivedVolumeByChannel(svc.DB)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(channelVolumes))
+	assert.Equal(t, "123456789", channelVolumes[0].InboundChannelId)
+	assert.Equal(t, uint64(tests.MockLNClientTransaction.Amount), channelVolumes[0].AmountMsat)
+	assert.Equal(t, uint64(1), channelVolumes[0].Count)
+}
+
+func TestNotifications_ReceivedKnownPaymentInboundChannel(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	transaction, err := transactionsService.MakeInvoice(ctx, 1234, "Hello world", "", 0, nil, svc.LNClient, nil, nil, "")
+	require.NoError(t, err)
+	assert.Empty(t, transaction.InboundChannelId)
+
+	lnClientTransaction := *tests.MockLNClientTransaction
+	lnClientTransaction.InboundChannelId = "123456789"
+
+	transactionsService.ConsumeEvent(ctx, &events.Event{
+		Event:      "nwc_lnclient_payment_received",
+		Properties: &lnClientTransaction,
+	}, map[string]interface{}{})
+
+	var incomingTransaction db.Transaction
+	err = svc.DB.First(&incomingTransaction, transaction.ID).Error
+	assert.NoError(t, err)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, incomingTransaction.State)
+	assert.Equal(t, "123456789", incomingTransaction.InboundChannelId)
+
+	transactions := []db.Transaction{}
+	result := svc.DB.Find(&transactions)
+	assert.Equal(t, int64(1), result.RowsAffected)
+}
+
+func TestNotifications_ReceivedPaymentChannelOpenFee(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	lnClientTransaction := *tests.MockLNClientTransaction
+	lnClientTransaction.ChannelOpenFeeMsat = 2_500_000
+
+	transactionsService.ConsumeEvent(ctx, &events.Event{
+		Event:      "nwc_lnclient_payment_received",
+		Properties: &lnClientTransaction,
+	}, map[string]interface{}{})
+
+	// no channel was opened to receive this payment
+	noChannelOpenPaymentHash := "ae4277b7be3ca1420cafd24c143866190f52b996856b0e4164763f936e61ea1b"
+	transactionsService.ConsumeEvent(ctx, &events.Event{
+		Event: "nwc_lnclient_payment_received",
+		Properties: &lnclient.Transaction{
+			Type:        "incoming",
+			Preimage:    "9f59b18f80a77c2930deb8be5ff1143eacdd1891c63c23d61bc9f99c64e57325",
+			PaymentHash: noChannelOpenPaymentHash,
+			Amount:      2000,
+		},
+	}, map[string]interface{}{})
+
+	transactionType := constants.TRANSACTION_TYPE_INCOMING
+	incomingTransaction, err := transactionsService.LookupTransaction(ctx, tests.MockLNClientTransaction.PaymentHash, &transactionType, svc.LNClient, nil, false)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2_500_000), incomingTransaction.ChannelOpenFeeMsat)
+
+	noChannelOpenTransaction, err := transactionsService.LookupTransaction(ctx, noChannelOpenPaymentHash, &transactionType, svc.LNClient, nil, false)
+	assert.NoError(t, err)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, noChannelOpenTransaction.State)
+	assert.Equal(t, uint64(0), noChannelOpenTransaction.ChannelOpenFeeMsat)
+}
+
+func TestNotifications_ReceivedKnownPaymentChannelOpenFee(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	transaction, err := transactionsService.MakeInvoice(ctx, 1234, "Hello world", "", 0, nil, svc.LNClient, nil, nil, "")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), transaction.ChannelOpenFeeMsat)
+
+	lnClientTransaction := *tests.MockLNClientTransaction
+	lnClientTransaction.ChannelOpenFeeMsat = 2_500_000
+
+	transactionsService.ConsumeEvent(ctx, &events.Event{
+		Event:      "nwc_lnclient_payment_received",
+		Properties: &lnClientTransaction,
+	}, map[string]interface{}{})
+
+	var incomingTransaction db.Transaction
+	err = svc.DB.First(&incomingTransaction, transaction.ID).Error
+	assert.NoError(t, err)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, incomingTransaction.State)
+	assert.Equal(t, uint64(2_500_000), incomingTransaction.ChannelOpenFeeMsat)
+	assert.Empty(t, incomingTransaction.InboundChannelId)
+}
+
+func TestNotifications_ReceivedPaymentInParts(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	mockEventConsumer := tests.NewMockEventConsumer()
+	svc.EventPublisher.RegisterSubscriber(mockEventConsumer)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	invoice, err := transactionsService.MakeInvoice(ctx, 123000, "Hello world", "", 0, nil, svc.LNClient, nil, nil, "")
+	require.NoError(t, err)
+	require.Equal(t, uint64(123000), invoice.AmountMsat)
+
+	for _, partAmount := range []int64{50000, 60000} {
+		// parts are reported before the backend has settled the payment
+		part := *tests.MockLNClientTransaction
+		part.Amount = partAmount
+		part.SettledAt = nil
+		transactionsService.ConsumeEvent(ctx, &events.Event{
+			Event:      "nwc_lnclient_payment_received",
+			Properties: &part,
+		}, map[string]interface{}{})
+	}
+
+	var incomingTransaction db.Transaction
+	err = svc.DB.First(&incomingTransaction, invoice.ID).Error
+	require.NoError(t, err)
+	assert.Equal(t, constants.TRANSACTION_STATE_ACCEPTED, incomingTransaction.State)
+	assert.Equal(t, uint64(110000), incomingTransaction.ReceivedAmountMsat)
+	assert.Nil(t, incomingTransaction.SettledAt)
+	assert.Empty(t, getEvents(mockEventConsumer.GetConsumedEvents(), "nwc_payment_received"))
+
+	lastPart := *tests.MockLNClientTransaction
+	lastPart.Amount = 13000
+	lastPart.SettledAt = nil
+	transactionsService.ConsumeEvent(ctx, &events.Event{
+		Event:      "nwc_lnclient_payment_received",
+		Properties: &lastPart,
+	}, map[string]interface{}{})
+
+	err = svc.DB.First(&incomingTransaction, invoice.ID).Error
+	require.NoError(t, err)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, incomingTransaction.State)
+	assert.Equal(t, uint64(123000), incomingTransaction.ReceivedAmountMsat)
+	assert.Equal(t, uint64(123000), incomingTransaction.AmountMsat)
+	assert.NotNil(t, incomingTransaction.SettledAt)
+	assert.Equal(t, 1, len(getEvents(mockEventConsumer.GetConsumedEvents(), "nwc_payment_received")))
+
+	transactions := []db.Transaction{}
+	result := svc.DB.Find(&transactions)
+	assert.Equal(t, int64(1), result.RowsAffected)
+}
+
+func TestNotifications_ReceivedPaymentInOnePart(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	invoice, err := transactionsService.MakeInvoice(ctx, 123000, "Hello world", "", 0, nil, svc.LNClient, nil, nil, "")
+	require.NoError(t, err)
+
+	transactionsService.ConsumeEvent(ctx, &events.Event{
+		Event:      "nwc_lnclient_payment_received",
+		Properties: tests.MockLNClientTransaction,
+	}, map[string]interface{}{})
+
+	var incomingTransaction db.Transaction
+	err = svc.DB.First(&incomingTransaction, invoice.ID).Error
+	require.NoError(t, err)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, incomingTransaction.State)
+	assert.Equal(t, uint64(123000), incomingTransaction.ReceivedAmountMsat)
+
+	// a repeated notification for a settled payment is not counted again
+	transactionsService.ConsumeEvent(ctx, &events.Event{
+		Event:      "nwc_lnclient_payment_received",
+		Properties: tests.MockLNClientTransaction,
+	}, map[string]interface{}{})
+
+	err = svc.DB.First(&incomingTransaction, invoice.ID).Error
+	require.NoError(t, err)
+	assert.Equal(t, uint64(123000), incomingTransaction.ReceivedAmountMsat)
+}
+
+func TestNotifications_ReceivedPaymentNetOfChannelOpenFee(t *testing.T) {
+	for name, tc := range map[string]struct {
+		settledAt *int64
+	}{
+		"settled by backend":      {settledAt: &tests.MockTimeUnix},
+		"not reported as settled": {settledAt: nil},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.TODO()
+
+			defer tests.RemoveTestService()
+			svc, err := tests.CreateTestService()
+			require.NoError(t, err)
+
+			transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+			invoice, err := transactionsService.MakeInvoice(ctx, 123000, "Hello world", "", 0, nil, svc.LNClient, nil, nil, "")
+			require.NoError(t, err)
+
+			// like phoenixd, the amount received is reported net of the fee for the channel opened to receive it
+			lnClientTransaction := *tests.MockLNClientTransaction
+			lnClientTransaction.Amount = 120500
+			lnClientTransaction.ChannelOpenFeeMsat = 2500
+			lnClientTransaction.SettledAt = tc.settledAt
+			transactionsService.ConsumeEvent(ctx, &events.Event{
+				Event:      "nwc_lnclient_payment_received",
+				Properties: &lnClientTransaction,
+			}, map[string]interface{}{})
+
+			var incomingTransaction db.Transaction
+			err = svc.DB.First(&incomingTransaction, invoice.ID).Error
+			require.NoError(t, err)
+			assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, incomingTransaction.State)
+			assert.Equal(t, uint64(120500), incomingTransaction.ReceivedAmountMsat)
+			assert.Equal(t, uint64(2500), incomingTransaction.ChannelOpenFeeMsat)
+			assert.NotNil(t, incomingTransaction.SettledAt)
+		})
+	}
+}
+
+func TestNotifications_ReceivedPaymentLessThanInvoiceAmountSettledByBackend(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	invoice, err := transactionsService.MakeInvoice(ctx, 123000, "Hello world", "", 0, nil, svc.LNClient, nil, nil, "")
+	require.NoError(t, err)
+
+	// a backend may deduct a fee it does not report; the payment is settled as the backend reports it settled
+	lnClientTransaction := *tests.MockLNClientTransaction
+	lnClientTransaction.Amount = 100000
+	transactionsService.ConsumeEvent(ctx, &events.Event{
+		Event:      "nwc_lnclient_payment_received",
+		Properties: &lnClientTransaction,
+	}, map[string]interface{}{})
+
+	var incomingTransaction db.Transaction
+	err = svc.DB.First(&incomingTransaction, invoice.ID).Error
+	require.NoError(t, err)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, incomingTransaction.State)
+	assert.Equal(t, uint64(100000), incomingTransaction.ReceivedAmountMsat)
+}
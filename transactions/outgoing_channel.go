@@ -0,0 +1,55 @@
+package transactions
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/getAlby/hub/lnclient"
+	"github.com/getAlby/hub/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// validateOutgoingChannel checks a payment of amountMsat (including the fee reserve) can be sent
+// through the given channel, so the payment is not recorded if it is bound to fail
+func validateOutgoingChannel(ctx context.Context, outgoingChannelId string, amountMsat uint64, lnClient lnclient.LNClient) error {
+	if _, ok := lnClient.(lnclient.OutgoingChannelPayer); !ok {
+		return NewOutgoingChannelNotSupportedError()
+	}
+
+	channels, err := lnClient.ListChannels(ctx)
+	if err != nil {
+		logger.Logger.WithError(err).Error("Failed to list channels")
+		return err
+	}
+
+	for _, channel := range channels {
+		if channel.Id != outgoingChannelId {
+			continue
+		}
+		if !channel.Active {
+			return newInvalidOutgoingChannelErrorWithReason("channel is not active")
+		}
+		if channel.LocalSpendableBalance < 0 || uint64(channel.LocalSpendableBalance) < amountMsat {
+			logger.Logger.WithFields(logrus.Fields{
+				"channel_id":              outgoingChannelId,
+				"amount_msat":             amountMsat,
+				"local_spendable_balance": channel.LocalSpendableBalance,
+			}).Warn("Outgoing channel does not have enough capacity")
+			return newInvalidOutgoingChannelErrorWithReason(fmt.Sprintf("channel can send at most %d msat", channel.LocalSpendableBalance))
+		}
+		return nil
+	}
+	return newInvalidOutgoingChannelErrorWithReason("channel not found")
+}
+
+// sendPayment pays an invoice through the LNClient, through the given channel if one is set
+func sendPayment(ctx context.Context, payReq string, outgoingChannelId string, lnClient lnclient.LNClient) (*lnclient.PayInvoiceResponse, error) {
+	if outgoingChannelId == "" {
+		return lnClient.SendPaymentSync(ctx, payReq)
+	}
+	payer, ok := lnClient.(lnclient.OutgoingChannelPayer)
+	if !ok {
+		return nil, NewOutgoingChannelNotSupportedError()
+	}
+	return payer.SendPaymentSyncWithOutgoingChannel(ctx, payReq, outgoingChannelId)
+}
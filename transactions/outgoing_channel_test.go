@@ -0,0 +1,102 @@
+package transactions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/lnclient"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// hides the optional interfaces implemented by the mock, like a backend without channel selection
+type mockLnWithoutOutgoingChannel struct {
+	lnclient.LNClient
+}
+
+var mockOutgoingChannels = []lnclient.Channel{
+	{Id: "123", Active: true, LocalSpendableBalance: 200_000},
+	{Id: "456", Active: false, LocalSpendableBalance: 200_000},
+	// the invoice needs 123000 msat plus a 10000 msat fee reserve
+	{Id: "789", Active: true, LocalSpendableBalance: 130_000},
+}
+
+func TestSendPaymentSync_OutgoingChannel(t *testing.T) {
+	ctx := context.TODO()
+
+	for name, testCase := range map[string]struct {
+		outgoingChannelId string
+		expectedError     error
+	}{
+		"no channel": {
+			outgoingChannelId: "",
+		},
+		"channel": {
+			outgoingChannelId: "123",
+		},
+		"unknown channel": {
+			outgoingChannelId: "999",
+			expectedError:     NewInvalidOutgoingChannelError(),
+		},
+		"inactive channel": {
+			outgoingChannelId: "456",
+			expectedError:     NewInvalidOutgoingChannelError(),
+		},
+		"not enough capacity": {
+			outgoingChannelId: "789",
+			expectedError:     NewInvalidOutgoingChannelError(),
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer tests.RemoveTestService()
+			svc, err := tests.CreateTestService()
+			require.NoError(t, err)
+
+			mockLn := svc.LNClient.(*tests.MockLn)
+			mockLn.Channels = mockOutgoingChannels
+
+			transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+			transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, nil, nil, SendPaymentOptions{OutgoingChannelId: testCase.outgoingChannelId})
+			if testCase.expectedError != nil {
+				assert.ErrorIs(t, err, testCase.expectedError)
+				assert.Nil(t, transaction)
+
+				// the payment is not attempted
+				var count int64
+				svc.DB.Model(&db.Transaction{}).Count(&count)
+				assert.Zero(t, count)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transaction.State)
+			assert.Equal(t, testCase.outgoingChannelId, mockLn.OutgoingChannelId)
+		})
+	}
+}
+
+func TestSendPaymentSync_OutgoingChannelNotSupported(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+	svc.LNClient.(*tests.MockLn).Channels = mockOutgoingChannels
+	lnClient := &mockLnWithoutOutgoingChannel{svc.LNClient}
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, lnClient, nil, nil, SendPaymentOptions{OutgoingChannelId: "123"})
+	assert.ErrorIs(t, err, NewOutgoingChannelNotSupportedError())
+	assert.Nil(t, transaction)
+
+	var count int64
+	svc.DB.Model(&db.Transaction{}).Count(&count)
+	assert.Zero(t, count)
+
+	// payments without a channel still work
+	transaction, err = transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, lnClient, nil, nil, SendPaymentOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transaction.State)
+}
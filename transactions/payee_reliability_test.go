@@ -0,0 +1,127 @@
+package transactions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const mockPayee = "02ff7c3da0679c37c2914a1f392a88a01a243a0773a1794fba7252e15e4e40f4f3" // payee of tests.MockInvoice
+
+func TestGetPayeeReliability(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	for _, state := range []string{
+		constants.TRANSACTION_STATE_SETTLED,
+		constants.TRANSACTION_STATE_SETTLED,
+		constants.TRANSACTION_STATE_SETTLED,
+		constants.TRANSACTION_STATE_FAILED,
+		constants.TRANSACTION_STATE_PENDING, // not completed
+	} {
+		svc.DB.Create(&db.Transaction{
+			State:       state,
+			Type:        constants.TRANSACTION_TYPE_OUTGOING,
+			PayeePubkey: mockPayee,
+		})
+	}
+	// other payee
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_FAILED,
+		Type:        constants.TRANSACTION_TYPE_OUTGOING,
+		PayeePubkey: "other payee",
+	})
+	// self payment
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_FAILED,
+		Type:        constants.TRANSACTION_TYPE_OUTGOING,
+		PayeePubkey: mockPayee,
+		SelfPayment: true,
+	})
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	stat, err := transactionsService.GetPayeeReliability(ctx, mockPayee, false)
+	assert.NoError(t, err)
+	assert.Equal(t, mockPayee, stat.Payee)
+	assert.Equal(t, uint64(3), stat.SettledCount)
+	assert.Equal(t, uint64(1), stat.FailedCount)
+	assert.Equal(t, 0.75, stat.SuccessRate)
+}
+
+func TestGetPayeeReliability_NoHistory(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	stat, err := transactionsService.GetPayeeReliability(ctx, mockPayee, false)
+	assert.NoError(t, err)
+	assert.Zero(t, stat.SettledCount)
+	assert.Zero(t, stat.FailedCount)
+	assert.Zero(t, stat.SuccessRate)
+}
+
+func TestGetPayeeReliability_StoresPayee(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, nil, nil, SendPaymentOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, mockPayee, transaction.PayeePubkey)
+
+	transaction, err = transactionsService.SendKeysend(ctx, uint64(1000), mockKeysendDestination, nil, "", "", svc.LNClient, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, mockKeysendDestination, transaction.PayeePubkey)
+
+	stat, err := transactionsService.GetPayeeReliability(ctx, mockPayee, false)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), stat.SettledCount)
+	assert.Equal(t, 1.0, stat.SuccessRate)
+}
+
+func TestGetPayeeReliability_ExcludeTestTransactions(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_OUTGOING,
+		PayeePubkey: mockPayee,
+		Environment: constants.TRANSACTION_ENVIRONMENT_PROD,
+	})
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_FAILED,
+		Type:        constants.TRANSACTION_TYPE_OUTGOING,
+		PayeePubkey: mockPayee,
+		Environment: constants.TRANSACTION_ENVIRONMENT_TEST,
+	})
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	stat, err := transactionsService.GetPayeeReliability(ctx, mockPayee, false)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), stat.SettledCount)
+	assert.Equal(t, uint64(1), stat.FailedCount)
+
+	stat, err = transactionsService.GetPayeeReliability(ctx, mockPayee, true)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), stat.SettledCount)
+	assert.Equal(t, uint64(0), stat.FailedCount)
+	assert.Equal(t, float64(1), stat.SuccessRate)
+}
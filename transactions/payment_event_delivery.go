@@ -0,0 +1,32 @@
+package transactions
+
+import (
+	"time"
+
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/events"
+	"github.com/getAlby/hub/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// trackNotification records when every subscriber has consumed the settlement event of a transaction,
+// so transactions whose notifications may have been lost can be found by their unset NotifiedAt
+func (svc *transactionsService) trackNotification(event *events.Event) *events.Event {
+	transaction, ok := event.Properties.(*db.Transaction)
+	if !ok {
+		return event
+	}
+
+	transactionId := transaction.ID
+	event.OnConsumed = func() {
+		// the update does not change UpdatedAt, as the transaction itself did not change
+		err := svc.db.Model(&db.Transaction{}).Where("id = ?", transactionId).UpdateColumn("notified_at", time.Now()).Error
+		if err != nil {
+			logger.Logger.WithFields(logrus.Fields{
+				"transaction_id": transactionId,
+				"event":          event.Event,
+			}).WithError(err).Error("Failed to record transaction notification")
+		}
+	}
+	return event
+}
@@ -0,0 +1,127 @@
+package transactions
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/events"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingEventConsumer does not finish consuming payment events until released
+type blockingEventConsumer struct {
+	release chan struct{}
+}
+
+func (consumer *blockingEventConsumer) ConsumeEvent(ctx context.Context, event *events.Event, globalProperties map[string]interface{}) {
+	if event.Event == "nwc_payment_received" || event.Event == "nwc_payment_sent" {
+		<-consumer.release
+	}
+}
+
+func getNotifiedAt(t *testing.T, svc *tests.TestService, paymentHash string, transactionType string) *time.Time {
+	var transaction db.Transaction
+	result := svc.DB.Limit(1).Find(&transaction, &db.Transaction{
+		PaymentHash: paymentHash,
+		Type:        transactionType,
+	})
+	require.NoError(t, result.Error)
+	require.Equal(t, int64(1), result.RowsAffected)
+	return transaction.NotifiedAt
+}
+
+func TestNotifiedAt_ReceivedPayment(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	svc.EventPublisher.RegisterSubscriber(tests.NewMockEventConsumer())
+
+	mockPreimage := tests.MockLNClientTransaction.Preimage
+	svc.DB.Create(&db.Transaction{
+		State:          constants.TRANSACTION_STATE_PENDING,
+		Type:           constants.TRANSACTION_TYPE_INCOMING,
+		PaymentRequest: tests.MockLNClientTransaction.Invoice,
+		PaymentHash:    tests.MockLNClientTransaction.PaymentHash,
+		Preimage:       &mockPreimage,
+		AmountMsat:     123000,
+	})
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transactionsService.ConsumeEvent(ctx, &events.Event{
+		Event:      "nwc_lnclient_payment_received",
+		Properties: tests.MockLNClientTransaction,
+	}, map[string]interface{}{})
+
+	assert.Eventually(t, func() bool {
+		return getNotifiedAt(t, svc, tests.MockLNClientTransaction.PaymentHash, constants.TRANSACTION_TYPE_INCOMING) != nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestNotifiedAt_SentPayment(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	svc.EventPublisher.RegisterSubscriber(tests.NewMockEventConsumer())
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, nil, nil, SendPaymentOptions{})
+	require.NoError(t, err)
+	// the returned transaction is from before the event was consumed
+	assert.Nil(t, transaction.NotifiedAt)
+
+	assert.Eventually(t, func() bool {
+		return getNotifiedAt(t, svc, tests.MockLNClientTransaction.PaymentHash, constants.TRANSACTION_TYPE_OUTGOING) != nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestNotifiedAt_NotConsumed(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	blockingConsumer := &blockingEventConsumer{release: make(chan struct{})}
+	svc.EventPublisher.RegisterSubscriber(blockingConsumer)
+	svc.EventPublisher.RegisterSubscriber(tests.NewMockEventConsumer())
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	_, err = transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, nil, nil, SendPaymentOptions{})
+	require.NoError(t, err)
+
+	// one subscriber has not consumed the event yet
+	assert.Never(t, func() bool {
+		return getNotifiedAt(t, svc, tests.MockLNClientTransaction.PaymentHash, constants.TRANSACTION_TYPE_OUTGOING) != nil
+	}, 100*time.Millisecond, 10*time.Millisecond)
+
+	close(blockingConsumer.release)
+	assert.Eventually(t, func() bool {
+		return getNotifiedAt(t, svc, tests.MockLNClientTransaction.PaymentHash, constants.TRANSACTION_TYPE_OUTGOING) != nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestNotifiedAt_PendingInvoice(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	_, err = transactionsService.MakeInvoice(ctx, 1234, "Hello world", "", 0, nil, svc.LNClient, nil, nil, "")
+	require.NoError(t, err)
+
+	// only settled transactions are notified
+	assert.Nil(t, getNotifiedAt(t, svc, tests.MockLNClientTransaction.PaymentHash, constants.TRANSACTION_TYPE_INCOMING))
+}
@@ -0,0 +1,191 @@
+package transactions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/lnclient"
+	"github.com/getAlby/hub/logger"
+	decodepay "github.com/nbd-wtf/ln-decodepay"
+	"github.com/sirupsen/logrus"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// CreatePaymentIntent reserves up to amountMsat + toleranceMsat of the app's budget (and balance,
+// if isolated) for a payment that is made later by fulfilling the intent with a matching invoice.
+// The reservation is released when the intent is fulfilled or expires.
+func (svc *transactionsService) CreatePaymentIntent(ctx context.Context, appId uint, amountMsat uint64, toleranceMsat uint64, allowedDestinations []string, expiry uint64) (*PaymentIntent, error) {
+	if amountMsat == 0 {
+		return nil, errors.New("a payment intent requires an amount")
+	}
+	if toleranceMsat > amountMsat {
+		return nil, errors.New("the tolerance cannot be more than the amount")
+	}
+	if expiry == 0 {
+		return nil, errors.New("a payment intent requires an expiry")
+	}
+
+	// pubkeys are compared in lowercase
+	destinations := make([]string, 0, len(allowedDestinations))
+	for _, destination := range allowedDestinations {
+		destination = strings.ToLower(destination)
+		err := validateKeysendDestination(destination)
+		if err != nil {
+			return nil, err
+		}
+		destinations = append(destinations, destination)
+	}
+	allowedDestinationsBytes, err := json.Marshal(destinations)
+	if err != nil {
+		logger.Logger.WithError(err).Error("Failed to serialize allowed destinations")
+		return nil, err
+	}
+
+	var paymentIntent db.PaymentIntent
+	err = svc.db.Transaction(func(tx *gorm.DB) error {
+		// the node balance reserve is checked when the intent is fulfilled
+		err := svc.validateCanPay(tx, &appId, amountMsat+toleranceMsat, 0, "", nil, nil)
+		if err != nil {
+			return err
+		}
+
+		paymentIntent = db.PaymentIntent{
+			AppId:               appId,
+			State:               constants.PAYMENT_INTENT_STATE_OPEN,
+			AmountMsat:          amountMsat,
+			ToleranceMsat:       toleranceMsat,
+			AllowedDestinations: datatypes.JSON(allowedDestinationsBytes),
+			ExpiresAt:           time.Now().Add(time.Duration(expiry) * time.Second),
+		}
+		return tx.Create(&paymentIntent).Error
+	})
+	if err != nil {
+		logger.Logger.WithFields(logrus.Fields{
+			"app_id":      appId,
+			"amount_msat": amountMsat,
+		}).WithError(err).Error("Failed to create payment intent")
+		return nil, err
+	}
+
+	return &paymentIntent, nil
+}
+
+// FulfillPaymentIntent pays an invoice matching the payment intent: the invoice amount must be
+// within the intent's tolerance and its payee one of the intent's allowed destinations.
+// If the payment fails the intent stays open and can be fulfilled with another invoice.
+func (svc *transactionsService) FulfillPaymentIntent(ctx context.Context, id uint, payReq string, lnClient lnclient.LNClient, appId uint) (*Transaction, error) {
+	payReq = strings.ToLower(payReq)
+	paymentRequest, err := decodepay.Decodepay(payReq)
+	if err != nil {
+		logger.Logger.WithFields(logrus.Fields{
+			"bolt11": payReq,
+		}).Errorf("Failed to decode bolt11 invoice: %v", err)
+
+		return nil, err
+	}
+
+	var paymentIntent db.PaymentIntent
+	expired := false
+	err = svc.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Limit(1).Find(&paymentIntent, &db.PaymentIntent{
+			ID:    id,
+			AppId: appId,
+		})
+		if result.RowsAffected == 0 {
+			return NewNotFoundError()
+		}
+
+		switch {
+		case paymentIntent.State == constants.PAYMENT_INTENT_STATE_EXPIRED:
+			return NewPaymentIntentExpiredError()
+		case paymentIntent.State != constants.PAYMENT_INTENT_STATE_OPEN:
+			return NewPaymentIntentNotOpenError()
+		case !paymentIntent.ExpiresAt.After(time.Now()):
+			expired = true
+			return tx.Model(&paymentIntent).Update("state", constants.PAYMENT_INTENT_STATE_EXPIRED).Error
+		}
+
+		return validatePaymentIntentInvoice(&paymentIntent, &paymentRequest)
+	})
+	if err == nil && expired {
+		err = NewPaymentIntentExpiredError()
+	}
+	if err != nil {
+		logger.Logger.WithFields(logrus.Fields{
+			"payment_intent_id": id,
+			"bolt11":            payReq,
+		}).WithError(err).Error("Failed to fulfill payment intent")
+		return nil, err
+	}
+
+	// the amount was agreed when the intent was created, so it does not need to be confirmed again
+	transaction, paymentErr := svc.SendPaymentSync(ctx, payReq, nil, lnClient, &appId, nil, SendPaymentOptions{
+		ConfirmLargeAmount: true,
+		paymentIntentId:    &paymentIntent.ID,
+	})
+	if paymentErr != nil {
+		// the intent is only reopened if its payment failed. A payment that timed out may still
+		// succeed, so the intent stays fulfilled by it
+		result := svc.db.Model(&db.PaymentIntent{}).
+			Where("id = ? AND state = ?", paymentIntent.ID, constants.PAYMENT_INTENT_STATE_FULFILLED).
+			Where("transaction_id IN (?)", svc.db.Model(&db.Transaction{}).Select("id").Where("state = ?", constants.TRANSACTION_STATE_FAILED)).
+			Updates(map[string]interface{}{
+				"state":          constants.PAYMENT_INTENT_STATE_OPEN,
+				"transaction_id": nil,
+			})
+		if result.Error != nil {
+			logger.Logger.WithField("payment_intent_id", id).WithError(result.Error).Error("Failed to reopen payment intent")
+		}
+		return nil, paymentErr
+	}
+
+	return transaction, nil
+}
+
+// fulfillPaymentIntent releases the reservation of an open payment intent, within the
+// database transaction that records the payment fulfilling it, so it does not count twice
+func fulfillPaymentIntent(tx *gorm.DB, paymentIntentId uint) error {
+	result := tx.Model(&db.PaymentIntent{}).
+		Where("id = ? AND state = ?", paymentIntentId, constants.PAYMENT_INTENT_STATE_OPEN).
+		Update("state", constants.PAYMENT_INTENT_STATE_FULFILLED)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		// fulfilled concurrently with another invoice
+		return NewPaymentIntentNotOpenError()
+	}
+	return nil
+}
+
+func validatePaymentIntentInvoice(paymentIntent *db.PaymentIntent, paymentRequest *decodepay.Bolt11) error {
+	amountMsat := uint64(paymentRequest.MSatoshi)
+	if amountMsat == 0 {
+		return newPaymentIntentMismatchErrorWithReason("the invoice has no amount")
+	}
+	if amountMsat < paymentIntent.AmountMsat-paymentIntent.ToleranceMsat || amountMsat > paymentIntent.AmountMsat+paymentIntent.ToleranceMsat {
+		return newPaymentIntentMismatchErrorWithReason(fmt.Sprintf("amount %s is not within %s of %s",
+			formatMsat(amountMsat), formatMsat(paymentIntent.ToleranceMsat), formatMsat(paymentIntent.AmountMsat)))
+	}
+
+	var allowedDestinations []string
+	if len(paymentIntent.AllowedDestinations) > 0 {
+		err := json.Unmarshal(paymentIntent.AllowedDestinations, &allowedDestinations)
+		if err != nil {
+			return err
+		}
+	}
+	if len(allowedDestinations) > 0 && !slices.Contains(allowedDestinations, strings.ToLower(paymentRequest.Payee)) {
+		return newPaymentIntentMismatchErrorWithReason("destination " + paymentRequest.Payee + " is not allowed")
+	}
+
+	return nil
+}
@@ -0,0 +1,383 @@
+package transactions
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/db/queries"
+	"github.com/getAlby/hub/lnclient"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// payee of tests.MockLNClientTransaction.Invoice
+const mockInvoicePayee = "02ff7c3da0679c37c2914a1f392a88a01a243a0773a1794fba7252e15e4e40f4f3"
+
+func TestFulfillPaymentIntent_Matching(t *testing.T) {
+	testCases := []struct {
+		name                string
+		amountMsat          uint64
+		toleranceMsat       uint64
+		allowedDestinations []string
+	}{
+		{
+			name:       "exact amount, any destination",
+			amountMsat: 123000,
+		},
+		{
+			name:          "amount within tolerance",
+			amountMsat:    124000,
+			toleranceMsat: 1000,
+		},
+		{
+			name:                "allowed destination",
+			amountMsat:          123000,
+			allowedDestinations: []string{mockKeysendDestination, strings.ToUpper(mockInvoicePayee)},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			ctx := context.TODO()
+
+			defer tests.RemoveTestService()
+			svc, err := tests.CreateTestService()
+			require.NoError(t, err)
+
+			// invoice is 123 sats, but we also calculate fee reserves max of(10 sats or 1%)
+			appPermission := &db.AppPermission{
+				Scope:         constants.PAY_INVOICE_SCOPE,
+				MaxAmountSat:  135,
+				BudgetRenewal: constants.BUDGET_RENEWAL_NEVER,
+			}
+			app, err := tests.CreateAppWithPermissions(svc, appPermission)
+			require.NoError(t, err)
+
+			transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+			paymentIntent, err := transactionsService.CreatePaymentIntent(ctx, app.ID, testCase.amountMsat, testCase.toleranceMsat, testCase.allowedDestinations, 3600)
+			require.NoError(t, err)
+			assert.Equal(t, constants.PAYMENT_INTENT_STATE_OPEN, paymentIntent.State)
+			assert.Equal(t, (testCase.amountMsat+testCase.toleranceMsat)/1000, queries.GetBudgetUsageSat(svc.DB, appPermission))
+
+			transaction, err := transactionsService.FulfillPaymentIntent(ctx, paymentIntent.ID, tests.MockLNClientTransaction.Invoice, svc.LNClient, app.ID)
+			require.NoError(t, err)
+			assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transaction.State)
+			assert.Equal(t, &app.ID, transaction.AppId)
+
+			var storedPaymentIntent db.PaymentIntent
+			svc.DB.First(&storedPaymentIntent, paymentIntent.ID)
+			assert.Equal(t, constants.PAYMENT_INTENT_STATE_FULFILLED, storedPaymentIntent.State)
+			assert.Equal(t, &transaction.ID, storedPaymentIntent.TransactionId)
+
+			// only the payment counts towards the budget
+			assert.Equal(t, uint64(123), queries.GetBudgetUsageSat(svc.DB, appPermission))
+
+			_, err = transactionsService.FulfillPaymentIntent(ctx, paymentIntent.ID, tests.MockLNClientTransaction.Invoice, svc.LNClient, app.ID)
+			assert.ErrorIs(t, err, NewPaymentIntentNotOpenError())
+		})
+	}
+}
+
+func TestFulfillPaymentIntent_Mismatching(t *testing.T) {
+	testCases := []struct {
+		name                string
+		amountMsat          uint64
+		toleranceMsat       uint64
+		allowedDestinations []string
+		expectedError       string
+	}{
+		{
+			name:          "amount below tolerance",
+			amountMsat:    125000,
+			toleranceMsat: 1000,
+			expectedError: "The invoice does not match the payment intent: amount 123 sat (123000 msat) is not within 1 sat (1000 msat) of 125 sat (125000 msat)",
+		},
+		{
+			name:          "amount above tolerance",
+			amountMsat:    120000,
+			toleranceMsat: 2999,
+			expectedError: "The invoice does not match the payment intent: amount 123 sat (123000 msat) is not within 2.999 sat (2999 msat) of 120 sat (120000 msat)",
+		},
+		{
+			name:                "destination not allowed",
+			amountMsat:          123000,
+			allowedDestinations: []string{mockKeysendDestination},
+			expectedError:       "The invoice does not match the payment intent: destination " + mockInvoicePayee + " is not allowed",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			ctx := context.TODO()
+
+			defer tests.RemoveTestService()
+			svc, err := tests.CreateTestService()
+			require.NoError(t, err)
+
+			appPermission := &db.AppPermission{
+				Scope:         constants.PAY_INVOICE_SCOPE,
+				MaxAmountSat:  1000,
+				BudgetRenewal: constants.BUDGET_RENEWAL_NEVER,
+			}
+			app, err := tests.CreateAppWithPermissions(svc, appPermission)
+			require.NoError(t, err)
+
+			transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+			paymentIntent, err := transactionsService.CreatePaymentIntent(ctx, app.ID, testCase.amountMsat, testCase.toleranceMsat, testCase.allowedDestinations, 3600)
+			require.NoError(t, err)
+
+			transaction, err := transactionsService.FulfillPaymentIntent(ctx, paymentIntent.ID, tests.MockLNClientTransaction.Invoice, svc.LNClient, app.ID)
+			assert.ErrorIs(t, err, NewPaymentIntentMismatchError())
+			assert.EqualError(t, err, testCase.expectedError)
+			assert.Nil(t, transaction)
+
+			// nothing was paid and the intent still holds its reservation
+			var count int64
+			svc.DB.Model(&db.Transaction{}).Count(&count)
+			assert.Zero(t, count)
+
+			var storedPaymentIntent db.PaymentIntent
+			svc.DB.First(&storedPaymentIntent, paymentIntent.ID)
+			assert.Equal(t, constants.PAYMENT_INTENT_STATE_OPEN, storedPaymentIntent.State)
+			assert.Nil(t, storedPaymentIntent.TransactionId)
+			assert.Equal(t, (testCase.amountMsat+testCase.toleranceMsat)/1000, queries.GetBudgetUsageSat(svc.DB, appPermission))
+		})
+	}
+}
+
+func TestCreatePaymentIntent_ExceedsBudget(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, err := tests.CreateAppWithPermissions(svc, &db.AppPermission{
+		Scope:         constants.PAY_INVOICE_SCOPE,
+		MaxAmountSat:  200,
+		BudgetRenewal: constants.BUDGET_RENEWAL_NEVER,
+	})
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	_, err = transactionsService.CreatePaymentIntent(ctx, app.ID, 150000, 0, nil, 3600)
+	require.NoError(t, err)
+
+	// the first intent's reservation leaves only 50 sats of the budget
+	paymentIntent, err := transactionsService.CreatePaymentIntent(ctx, app.ID, 60000, 0, nil, 3600)
+	assert.ErrorIs(t, err, NewQuotaExceededError())
+	assert.Nil(t, paymentIntent)
+}
+
+func TestCreatePaymentIntent_IsolatedAppReservesBalance(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, err := tests.CreateAppWithPermissions(svc, &db.AppPermission{
+		Scope:         constants.PAY_INVOICE_SCOPE,
+		MaxAmountSat:  0,
+		BudgetRenewal: constants.BUDGET_RENEWAL_NEVER,
+	})
+	require.NoError(t, err)
+	app.Isolated = true
+	svc.DB.Save(app)
+
+	svc.DB.Create(&db.Transaction{
+		AppId:      &app.ID,
+		State:      constants.TRANSACTION_STATE_SETTLED,
+		Type:       constants.TRANSACTION_TYPE_INCOMING,
+		AmountMsat: 200000,
+	})
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	_, err = transactionsService.CreatePaymentIntent(ctx, app.ID, 150000, 10000, nil, 3600)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(40000), queries.GetIsolatedBalance(svc.DB, app.ID))
+
+	_, err = transactionsService.CreatePaymentIntent(ctx, app.ID, 50000, 0, nil, 3600)
+	assert.ErrorIs(t, err, NewInsufficientBalanceError())
+}
+
+func TestFulfillPaymentIntent_Expired(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	appPermission := &db.AppPermission{
+		Scope:         constants.PAY_INVOICE_SCOPE,
+		MaxAmountSat:  1000,
+		BudgetRenewal: constants.BUDGET_RENEWAL_NEVER,
+	}
+	app, err := tests.CreateAppWithPermissions(svc, appPermission)
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	paymentIntent, err := transactionsService.CreatePaymentIntent(ctx, app.ID, 123000, 0, nil, 60)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(123), queries.GetBudgetUsageSat(svc.DB, appPermission))
+
+	svc.DB.Model(paymentIntent).Update("expires_at", time.Now().Add(-time.Second))
+
+	// the reservation is released as soon as the intent expires
+	assert.Zero(t, queries.GetBudgetUsageSat(svc.DB, appPermission))
+
+	transaction, err := transactionsService.FulfillPaymentIntent(ctx, paymentIntent.ID, tests.MockLNClientTransaction.Invoice, svc.LNClient, app.ID)
+	assert.ErrorIs(t, err, NewPaymentIntentExpiredError())
+	assert.Nil(t, transaction)
+
+	var storedPaymentIntent db.PaymentIntent
+	svc.DB.First(&storedPaymentIntent, paymentIntent.ID)
+	assert.Equal(t, constants.PAYMENT_INTENT_STATE_EXPIRED, storedPaymentIntent.State)
+
+	_, err = transactionsService.FulfillPaymentIntent(ctx, paymentIntent.ID, tests.MockLNClientTransaction.Invoice, svc.LNClient, app.ID)
+	assert.ErrorIs(t, err, NewPaymentIntentExpiredError())
+}
+
+func TestFulfillPaymentIntent_PaymentFailed(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	appPermission := &db.AppPermission{
+		Scope:         constants.PAY_INVOICE_SCOPE,
+		MaxAmountSat:  1000,
+		BudgetRenewal: constants.BUDGET_RENEWAL_NEVER,
+	}
+	app, err := tests.CreateAppWithPermissions(svc, appPermission)
+	require.NoError(t, err)
+
+	svc.LNClient.(*tests.MockLn).PayInvoiceResponses = append(svc.LNClient.(*tests.MockLn).PayInvoiceResponses, nil)
+	svc.LNClient.(*tests.MockLn).PayInvoiceErrors = append(svc.LNClient.(*tests.MockLn).PayInvoiceErrors, errors.New("no route"))
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	paymentIntent, err := transactionsService.CreatePaymentIntent(ctx, app.ID, 123000, 0, nil, 3600)
+	require.NoError(t, err)
+
+	_, err = transactionsService.FulfillPaymentIntent(ctx, paymentIntent.ID, tests.MockLNClientTransaction.Invoice, svc.LNClient, app.ID)
+	assert.EqualError(t, err, "no route")
+
+	// the intent can be fulfilled again
+	var storedPaymentIntent db.PaymentIntent
+	svc.DB.First(&storedPaymentIntent, paymentIntent.ID)
+	assert.Equal(t, constants.PAYMENT_INTENT_STATE_OPEN, storedPaymentIntent.State)
+	assert.Nil(t, storedPaymentIntent.TransactionId)
+	assert.Equal(t, uint64(123), queries.GetBudgetUsageSat(svc.DB, appPermission))
+
+	transaction, err := transactionsService.FulfillPaymentIntent(ctx, paymentIntent.ID, tests.MockLNClientTransaction.Invoice, svc.LNClient, app.ID)
+	require.NoError(t, err)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transaction.State)
+}
+
+func TestFulfillPaymentIntent_PaymentTimedOut(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	appPermission := &db.AppPermission{
+		Scope:         constants.PAY_INVOICE_SCOPE,
+		MaxAmountSat:  1000,
+		BudgetRenewal: constants.BUDGET_RENEWAL_NEVER,
+	}
+	app, err := tests.CreateAppWithPermissions(svc, appPermission)
+	require.NoError(t, err)
+
+	svc.LNClient.(*tests.MockLn).PayInvoiceResponses = append(svc.LNClient.(*tests.MockLn).PayInvoiceResponses, nil)
+	svc.LNClient.(*tests.MockLn).PayInvoiceErrors = append(svc.LNClient.(*tests.MockLn).PayInvoiceErrors, lnclient.NewTimeoutError())
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	paymentIntent, err := transactionsService.CreatePaymentIntent(ctx, app.ID, 123000, 0, nil, 3600)
+	require.NoError(t, err)
+
+	_, err = transactionsService.FulfillPaymentIntent(ctx, paymentIntent.ID, tests.MockLNClientTransaction.Invoice, svc.LNClient, app.ID)
+	assert.ErrorIs(t, err, lnclient.NewTimeoutError())
+
+	// the payment may still succeed, so the intent stays fulfilled by it
+	var pendingTransaction db.Transaction
+	require.NoError(t, svc.DB.First(&pendingTransaction, &db.Transaction{PaymentHash: tests.MockPaymentHash}).Error)
+	assert.Equal(t, constants.TRANSACTION_STATE_PENDING, pendingTransaction.State)
+
+	var storedPaymentIntent db.PaymentIntent
+	svc.DB.First(&storedPaymentIntent, paymentIntent.ID)
+	assert.Equal(t, constants.PAYMENT_INTENT_STATE_FULFILLED, storedPaymentIntent.State)
+	assert.Equal(t, &pendingTransaction.ID, storedPaymentIntent.TransactionId)
+	// only the pending payment counts towards the budget
+	assert.Equal(t, uint64(133), queries.GetBudgetUsageSat(svc.DB, appPermission))
+}
+
+func TestFulfillPaymentIntent_PaymentRejected(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	appPermission := &db.AppPermission{
+		Scope:         constants.PAY_INVOICE_SCOPE,
+		MaxAmountSat:  1000,
+		BudgetRenewal: constants.BUDGET_RENEWAL_NEVER,
+	}
+	app, err := tests.CreateAppWithPermissions(svc, appPermission)
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	paymentIntent, err := transactionsService.CreatePaymentIntent(ctx, app.ID, 123000, 0, nil, 3600)
+	require.NoError(t, err)
+
+	require.NoError(t, svc.DB.Model(app).Update("paused", true).Error)
+
+	_, err = transactionsService.FulfillPaymentIntent(ctx, paymentIntent.ID, tests.MockLNClientTransaction.Invoice, svc.LNClient, app.ID)
+	assert.ErrorIs(t, err, NewAppPausedError())
+
+	// no payment was recorded, so the intent is still open and keeps its reservation
+	var storedPaymentIntent db.PaymentIntent
+	svc.DB.First(&storedPaymentIntent, paymentIntent.ID)
+	assert.Equal(t, constants.PAYMENT_INTENT_STATE_OPEN, storedPaymentIntent.State)
+	assert.Nil(t, storedPaymentIntent.TransactionId)
+	assert.Equal(t, uint64(123), queries.GetBudgetUsageSat(svc.DB, appPermission))
+	var transactionCount int64
+	svc.DB.Model(&db.Transaction{}).Count(&transactionCount)
+	assert.Equal(t, int64(0), transactionCount)
+}
+
+func TestFulfillPaymentIntent_OtherApp(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, err := tests.CreateAppWithPermissions(svc, &db.AppPermission{
+		Scope:         constants.PAY_INVOICE_SCOPE,
+		MaxAmountSat:  1000,
+		BudgetRenewal: constants.BUDGET_RENEWAL_NEVER,
+	})
+	require.NoError(t, err)
+	otherApp, err := tests.CreateAppWithPermissions(svc, &db.AppPermission{
+		Scope:         constants.PAY_INVOICE_SCOPE,
+		MaxAmountSat:  1000,
+		BudgetRenewal: constants.BUDGET_RENEWAL_NEVER,
+	})
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	paymentIntent, err := transactionsService.CreatePaymentIntent(ctx, app.ID, 123000, 0, nil, 3600)
+	require.NoError(t, err)
+
+	_, err = transactionsService.FulfillPaymentIntent(ctx, paymentIntent.ID, tests.MockLNClientTransaction.Invoice, svc.LNClient, otherApp.ID)
+	assert.ErrorIs(t, err, NewNotFoundError())
+}
@@ -0,0 +1,45 @@
+package transactions
+
+import (
+	"encoding/json"
+
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/lnclient"
+	"github.com/getAlby/hub/logger"
+	"github.com/sirupsen/logrus"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// recordPaymentRoute stores the route a payment took on its transaction.
+// The route is informational only, so failing to store it does not fail the payment.
+func (svc *transactionsService) recordPaymentRoute(tx *gorm.DB, dbTransaction *db.Transaction, route []lnclient.RouteHop) {
+	if len(route) == 0 {
+		return
+	}
+
+	routeBytes, err := json.Marshal(route)
+	if err == nil {
+		err = tx.Model(dbTransaction).UpdateColumn("route", datatypes.JSON(routeBytes)).Error
+	}
+	if err != nil {
+		logger.Logger.WithFields(logrus.Fields{
+			"payment_hash": dbTransaction.PaymentHash,
+		}).WithError(err).Warn("Failed to store payment route")
+		return
+	}
+	dbTransaction.Route = datatypes.JSON(routeBytes)
+}
+
+// GetPaymentRoute returns the hops of the route a payment took, from the first hop to the payee,
+// or nil if the backend did not return the route
+func GetPaymentRoute(transaction *Transaction) ([]lnclient.RouteHop, error) {
+	if len(transaction.Route) == 0 {
+		return nil, nil
+	}
+	var route []lnclient.RouteHop
+	if err := json.Unmarshal(transaction.Route, &route); err != nil {
+		return nil, err
+	}
+	return route, nil
+}
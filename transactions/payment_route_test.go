@@ -0,0 +1,61 @@
+package transactions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/lnclient"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendPaymentSync_Route(t *testing.T) {
+	ctx := context.TODO()
+
+	route := []lnclient.RouteHop{
+		{Pubkey: "02aaaa", ChannelId: "123"},
+		{Pubkey: "03bbbb", ChannelId: "456"},
+	}
+
+	for name, testCase := range map[string]struct {
+		route []lnclient.RouteHop
+	}{
+		"with route": {
+			route: route,
+		},
+		"without route": {
+			route: nil,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer tests.RemoveTestService()
+			svc, err := tests.CreateTestService()
+			require.NoError(t, err)
+
+			mockLn := svc.LNClient.(*tests.MockLn)
+			mockLn.PayInvoiceResponses = []*lnclient.PayInvoiceResponse{{
+				Preimage: "123preimage",
+				Route:    testCase.route,
+			}}
+			mockLn.PayInvoiceErrors = []error{nil}
+
+			transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+			transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, nil, nil, SendPaymentOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transaction.State)
+
+			paymentRoute, err := GetPaymentRoute(transaction)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.route, paymentRoute)
+
+			// the route is stored with the transaction
+			storedTransaction, err := transactionsService.LookupTransaction(ctx, transaction.PaymentHash, nil, svc.LNClient, nil, false)
+			require.NoError(t, err)
+			paymentRoute, err = GetPaymentRoute(storedTransaction)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.route, paymentRoute)
+		})
+	}
+}
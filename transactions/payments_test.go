@@ -9,6 +9,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/getAlby/hub/config"
 	"github.com/getAlby/hub/constants"
 	"github.com/getAlby/hub/db"
 	"github.com/getAlby/hub/lnclient"
@@ -30,13 +31,14 @@ func TestSendPaymentSync_NoApp(t *testing.T) {
 	}
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
-	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, metadata, svc.LNClient, nil, nil)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, metadata, svc.LNClient, nil, nil, SendPaymentOptions{})
 
 	assert.NoError(t, err)
 	assert.Equal(t, uint64(123000), transaction.AmountMsat)
 	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transaction.State)
 	assert.Zero(t, transaction.FeeReserveMsat)
 	assert.Equal(t, "123preimage", *transaction.Preimage)
+	assert.Equal(t, uint(40), transaction.MinFinalCltvExpiry)
 
 	type dummyMetadata struct {
 		A int `json:"a"`
@@ -58,13 +60,32 @@ func TestSendPaymentSync_MetadataTooLarge(t *testing.T) {
 	metadata["randomkey"] = strings.Repeat("a", constants.INVOICE_METADATA_MAX_LENGTH-15) // json encoding adds 16 characters
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
-	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, metadata, svc.LNClient, nil, nil)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, metadata, svc.LNClient, nil, nil, SendPaymentOptions{})
 
 	assert.Error(t, err)
 	assert.Equal(t, fmt.Sprintf("encoded payment metadata provided is too large. Limit: %d Received: %d", constants.INVOICE_METADATA_MAX_LENGTH, constants.INVOICE_METADATA_MAX_LENGTH+1), err.Error())
 	assert.Nil(t, transaction)
 }
 
+func TestSendPaymentSync_ExpiredInvoice(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	// the payment would succeed if it was attempted
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockExpiredInvoice, nil, svc.LNClient, nil, nil, SendPaymentOptions{})
+
+	assert.ErrorIs(t, err, NewInvoiceExpiredError())
+	assert.Nil(t, transaction)
+
+	var count int64
+	svc.DB.Model(&db.Transaction{}).Count(&count)
+	assert.Zero(t, count)
+}
+
 func TestSendPaymentSync_Duplicate(t *testing.T) {
 	ctx := context.TODO()
 
@@ -80,13 +101,66 @@ func TestSendPaymentSync_Duplicate(t *testing.T) {
 	})
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
-	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, nil, nil)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, nil, nil, SendPaymentOptions{})
 
-	assert.Error(t, err)
+	assert.ErrorIs(t, err, NewInvoiceAlreadyPaidError())
 	assert.Equal(t, "this invoice has already been paid", err.Error())
 	assert.Nil(t, transaction)
 }
 
+func TestSendPaymentSync_DuplicateAcrossApps(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+	otherApp, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_OUTGOING,
+		PaymentHash: tests.MockLNClientTransaction.PaymentHash,
+		AmountMsat:  123000,
+		AppId:       &app.ID,
+	})
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	for name, testCase := range map[string]struct {
+		appId           *uint
+		expectedMessage string
+	}{
+		"same app": {
+			appId:           &app.ID,
+			expectedMessage: "this invoice has already been paid",
+		},
+		// paying the same invoice twice is still blocked, as the payee would be paid twice
+		"other app": {
+			appId:           &otherApp.ID,
+			expectedMessage: "this invoice has already been paid by another app",
+		},
+		"node": {
+			appId:           nil,
+			expectedMessage: "this invoice has already been paid by another app",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, testCase.appId, nil, SendPaymentOptions{})
+			assert.ErrorIs(t, err, NewInvoiceAlreadyPaidError())
+			assert.EqualError(t, err, testCase.expectedMessage)
+			assert.Nil(t, transaction)
+		})
+	}
+
+	var count int64
+	svc.DB.Model(&db.Transaction{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+}
+
 func TestMarkSettled_Sent(t *testing.T) {
 	defer tests.RemoveTestService()
 	svc, err := tests.CreateTestService()
@@ -104,7 +178,7 @@ func TestMarkSettled_Sent(t *testing.T) {
 	svc.EventPublisher.RegisterSubscriber(mockEventConsumer)
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
 	err = svc.DB.Transaction(func(tx *gorm.DB) error {
-		_, err = transactionsService.markTransactionSettled(tx, &dbTransaction, "test", 0, false)
+		_, err = transactionsService.markTransactionSettled(tx, &dbTransaction, "test", 0, false, nil)
 		return err
 	})
 
@@ -114,6 +188,51 @@ func TestMarkSettled_Sent(t *testing.T) {
 	assert.Equal(t, "nwc_payment_sent", mockEventConsumer.GetConsumedEvents()[0].Event)
 	settledTransaction := mockEventConsumer.GetConsumedEvents()[0].Properties.(*db.Transaction)
 	assert.Equal(t, &dbTransaction, settledTransaction)
+	previousTransaction := mockEventConsumer.GetConsumedEvents()[0].PreviousProperties.(*db.Transaction)
+	assert.Equal(t, constants.TRANSACTION_STATE_PENDING, previousTransaction.State)
+	assert.Nil(t, previousTransaction.Preimage)
+	assert.Nil(t, previousTransaction.SettledAt)
+}
+
+func TestSettle_WithoutEventPublisher(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, nil)
+
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, nil, nil, SendPaymentOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transaction.State)
+
+	dbTransaction := db.Transaction{
+		State:       constants.TRANSACTION_STATE_PENDING,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		PaymentHash: tests.MockLNClientTransaction.PaymentHash,
+		AmountMsat:  123000,
+	}
+	svc.DB.Create(&dbTransaction)
+	err = svc.DB.Transaction(func(tx *gorm.DB) error {
+		_, err = transactionsService.markTransactionSettled(tx, &dbTransaction, "test", 0, false, nil)
+		return err
+	})
+	require.NoError(t, err)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, dbTransaction.State)
+
+	// denied payments also publish events
+	app, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+	err = svc.DB.Create(&db.AppPermission{
+		AppId:        app.ID,
+		App:          *app,
+		Scope:        constants.PAY_INVOICE_SCOPE,
+		MaxAmountSat: 1,
+	}).Error
+	require.NoError(t, err)
+	_, err = transactionsService.SendPaymentSync(ctx, tests.MockInvoiceWithoutDescription, nil, svc.LNClient, &app.ID, nil, SendPaymentOptions{})
+	assert.ErrorIs(t, err, NewQuotaExceededError())
 }
 
 func TestMarkSettled_Received(t *testing.T) {
@@ -133,7 +252,7 @@ func TestMarkSettled_Received(t *testing.T) {
 	svc.EventPublisher.RegisterSubscriber(mockEventConsumer)
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
 	err = svc.DB.Transaction(func(tx *gorm.DB) error {
-		_, err = transactionsService.markTransactionSettled(tx, &dbTransaction, "test", 0, false)
+		_, err = transactionsService.markTransactionSettled(tx, &dbTransaction, "test", 0, false, nil)
 		return err
 	})
 
@@ -164,7 +283,7 @@ func TestDoNotMarkSettledTwice(t *testing.T) {
 	svc.EventPublisher.RegisterSubscriber(mockEventConsumer)
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
 	err = svc.DB.Transaction(func(tx *gorm.DB) error {
-		_, err = transactionsService.markTransactionSettled(tx, &dbTransaction, "test", 0, false)
+		_, err = transactionsService.markTransactionSettled(tx, &dbTransaction, "test", 0, false, nil)
 		return err
 	})
 
@@ -189,7 +308,7 @@ func TestMarkFailed(t *testing.T) {
 	svc.EventPublisher.RegisterSubscriber(mockEventConsumer)
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
 	err = svc.DB.Transaction(func(tx *gorm.DB) error {
-		return transactionsService.markPaymentFailed(tx, &dbTransaction, "some routing error")
+		return transactionsService.markPaymentFailed(tx, &dbTransaction, "some routing error", nil)
 	})
 
 	assert.NoError(t, err)
@@ -199,6 +318,9 @@ func TestMarkFailed(t *testing.T) {
 	settledTransaction := mockEventConsumer.GetConsumedEvents()[0].Properties.(*db.Transaction)
 	assert.Equal(t, &dbTransaction, settledTransaction)
 	assert.Equal(t, "some routing error", settledTransaction.FailureReason)
+	previousTransaction := mockEventConsumer.GetConsumedEvents()[0].PreviousProperties.(*db.Transaction)
+	assert.Equal(t, constants.TRANSACTION_STATE_PENDING, previousTransaction.State)
+	assert.Empty(t, previousTransaction.FailureReason)
 }
 
 func TestDoNotMarkFailedTwice(t *testing.T) {
@@ -220,7 +342,7 @@ func TestDoNotMarkFailedTwice(t *testing.T) {
 	svc.EventPublisher.RegisterSubscriber(mockEventConsumer)
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
 	err = svc.DB.Transaction(func(tx *gorm.DB) error {
-		return transactionsService.markPaymentFailed(tx, &dbTransaction, "some routing error")
+		return transactionsService.markPaymentFailed(tx, &dbTransaction, "some routing error", nil)
 	})
 
 	assert.NoError(t, err)
@@ -242,13 +364,13 @@ func TestSendPaymentSync_FailedRemovesFeeReserve(t *testing.T) {
 	svc.EventPublisher.RegisterSubscriber(mockEventConsumer)
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
-	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, nil, nil)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, nil, nil, SendPaymentOptions{})
 
 	assert.Error(t, err)
 	assert.Nil(t, transaction)
 
 	transactionType := constants.TRANSACTION_TYPE_OUTGOING
-	transaction, err = transactionsService.LookupTransaction(ctx, tests.MockLNClientTransaction.PaymentHash, &transactionType, svc.LNClient, nil)
+	transaction, err = transactionsService.LookupTransaction(ctx, tests.MockLNClientTransaction.PaymentHash, &transactionType, svc.LNClient, nil, false)
 	assert.NoError(t, err)
 
 	assert.Equal(t, uint64(123000), transaction.AmountMsat)
@@ -272,13 +394,13 @@ func TestSendPaymentSync_PendingHasFeeReserve(t *testing.T) {
 	svc.LNClient.(*tests.MockLn).PayInvoiceResponses = append(svc.LNClient.(*tests.MockLn).PayInvoiceResponses, nil)
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
-	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, nil, nil)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, nil, nil, SendPaymentOptions{})
 
 	assert.Error(t, err)
 	assert.Nil(t, transaction)
 
 	transactionType := constants.TRANSACTION_TYPE_OUTGOING
-	transaction, err = transactionsService.LookupTransaction(ctx, tests.MockLNClientTransaction.PaymentHash, &transactionType, svc.LNClient, nil)
+	transaction, err = transactionsService.LookupTransaction(ctx, tests.MockLNClientTransaction.PaymentHash, &transactionType, svc.LNClient, nil, false)
 	assert.NoError(t, err)
 
 	assert.Equal(t, uint64(123000), transaction.AmountMsat)
@@ -286,3 +408,103 @@ func TestSendPaymentSync_PendingHasFeeReserve(t *testing.T) {
 	assert.Equal(t, uint64(10000), transaction.FeeReserveMsat)
 	assert.Nil(t, transaction.Preimage)
 }
+
+func TestSendPaymentSync_PendingHasBackendMinFeeReserve(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	svc.LNClient.(*tests.MockLn).BackendType = config.LDKBackendType
+
+	// timeout will leave the payment as pending
+	svc.LNClient.(*tests.MockLn).PayInvoiceErrors = append(svc.LNClient.(*tests.MockLn).PayInvoiceErrors, lnclient.NewTimeoutError())
+	svc.LNClient.(*tests.MockLn).PayInvoiceResponses = append(svc.LNClient.(*tests.MockLn).PayInvoiceResponses, nil)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, nil, nil, SendPaymentOptions{})
+
+	assert.Error(t, err)
+	assert.Nil(t, transaction)
+
+	transactionType := constants.TRANSACTION_TYPE_OUTGOING
+	transaction, err = transactionsService.LookupTransaction(ctx, tests.MockLNClientTransaction.PaymentHash, &transactionType, svc.LNClient, nil, false)
+	assert.NoError(t, err)
+
+	assert.Equal(t, constants.TRANSACTION_STATE_PENDING, transaction.State)
+	assert.Equal(t, uint64(50000), transaction.FeeReserveMsat)
+}
+
+func TestSendPaymentSync_ExternalRef(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, nil, nil, SendPaymentOptions{ExternalRef: "order-123"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transaction.State)
+	assert.Equal(t, "order-123", transaction.ExternalRef)
+
+	// the same external reference cannot be used to pay another invoice
+	transaction, err = transactionsService.SendPaymentSync(ctx, tests.MockInvoiceWithoutDescription, nil, svc.LNClient, nil, nil, SendPaymentOptions{ExternalRef: "order-123"})
+	assert.ErrorIs(t, err, NewExternalRefConflictError())
+	assert.Nil(t, transaction)
+
+	var count int64
+	svc.DB.Model(&db.Transaction{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	// payments without an external reference are not affected
+	transaction, err = transactionsService.SendPaymentSync(ctx, tests.MockInvoiceWithoutDescription, nil, svc.LNClient, nil, nil, SendPaymentOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "", transaction.ExternalRef)
+}
+
+func TestSendPaymentSync_ExternalRefReusedAfterFailure(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	svc.LNClient.(*tests.MockLn).PayInvoiceErrors = append(svc.LNClient.(*tests.MockLn).PayInvoiceErrors, errors.New("Some error"))
+	svc.LNClient.(*tests.MockLn).PayInvoiceResponses = append(svc.LNClient.(*tests.MockLn).PayInvoiceResponses, nil)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, nil, nil, SendPaymentOptions{ExternalRef: "order-123"})
+	assert.Error(t, err)
+	assert.Nil(t, transaction)
+
+	// a failed payment does not reserve the external reference
+	transaction, err = transactionsService.SendPaymentSync(ctx, tests.MockInvoiceWithoutDescription, nil, svc.LNClient, nil, nil, SendPaymentOptions{ExternalRef: "order-123"})
+	assert.NoError(t, err)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transaction.State)
+	assert.Equal(t, "order-123", transaction.ExternalRef)
+}
+
+func TestExternalRefUniqueConstraint(t *testing.T) {
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	err = svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_PENDING,
+		Type:        constants.TRANSACTION_TYPE_OUTGOING,
+		PaymentHash: "hash1",
+		ExternalRef: "order-123",
+	}).Error
+	assert.NoError(t, err)
+
+	err = svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_PENDING,
+		Type:        constants.TRANSACTION_TYPE_OUTGOING,
+		PaymentHash: "hash2",
+		ExternalRef: "order-123",
+	}).Error
+	assert.ErrorIs(t, err, gorm.ErrDuplicatedKey)
+}
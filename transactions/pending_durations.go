@@ -0,0 +1,52 @@
+package transactions
+
+import (
+	"context"
+	"time"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db/queries"
+	"github.com/getAlby/hub/logger"
+)
+
+// PendingDurationStats are percentiles of how long outgoing payments were pending
+// before they settled or failed
+type PendingDurationStats struct {
+	Settled LatencyPercentiles
+	Failed  LatencyPercentiles
+}
+
+// GetPendingDuration returns how long a transaction was pending before it settled or failed.
+// ok is false if the transaction is still pending, or failed before the failure time was recorded.
+func GetPendingDuration(transaction *Transaction) (duration time.Duration, ok bool) {
+	var completedAt *time.Time
+	switch transaction.State {
+	case constants.TRANSACTION_STATE_SETTLED:
+		completedAt = transaction.SettledAt
+	case constants.TRANSACTION_STATE_FAILED:
+		completedAt = transaction.FailedAt
+	}
+	if completedAt == nil {
+		return 0, false
+	}
+	return max(completedAt.Sub(transaction.CreatedAt), 0), true
+}
+
+// GetPendingDurationStats returns percentiles of the time outgoing payments which settled or failed
+// between from and until (unix seconds, 0 = unbounded) were pending
+func (svc *transactionsService) GetPendingDurationStats(ctx context.Context, from, until uint64) (*PendingDurationStats, error) {
+	stats := &PendingDurationStats{}
+	for _, state := range []string{constants.TRANSACTION_STATE_SETTLED, constants.TRANSACTION_STATE_FAILED} {
+		durations, err := queries.GetPendingDurations(svc.db, state, from, until)
+		if err != nil {
+			logger.Logger.WithError(err).WithField("state", state).Error("Failed to get pending durations")
+			return nil, err
+		}
+		if state == constants.TRANSACTION_STATE_SETTLED {
+			stats.Settled = getLatencyPercentiles(durations)
+		} else {
+			stats.Failed = getLatencyPercentiles(durations)
+		}
+	}
+	return stats, nil
+}
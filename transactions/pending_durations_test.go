@@ -0,0 +1,115 @@
+package transactions
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetPendingDuration(t *testing.T) {
+	createdAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+	settledAt := createdAt.Add(3 * time.Second)
+	failedAt := createdAt.Add(5 * time.Second)
+
+	duration, ok := GetPendingDuration(&Transaction{State: constants.TRANSACTION_STATE_SETTLED, CreatedAt: createdAt, SettledAt: &settledAt})
+	assert.True(t, ok)
+	assert.Equal(t, 3*time.Second, duration)
+
+	duration, ok = GetPendingDuration(&Transaction{State: constants.TRANSACTION_STATE_FAILED, CreatedAt: createdAt, FailedAt: &failedAt})
+	assert.True(t, ok)
+	assert.Equal(t, 5*time.Second, duration)
+
+	_, ok = GetPendingDuration(&Transaction{State: constants.TRANSACTION_STATE_PENDING, CreatedAt: createdAt})
+	assert.False(t, ok)
+
+	// failed before the failure time was recorded
+	_, ok = GetPendingDuration(&Transaction{State: constants.TRANSACTION_STATE_FAILED, CreatedAt: createdAt})
+	assert.False(t, ok)
+}
+
+func TestSendPaymentSync_RecordsPendingDuration(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, nil, nil, SendPaymentOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transaction.State)
+
+	duration, ok := GetPendingDuration(transaction)
+	assert.True(t, ok)
+	assert.GreaterOrEqual(t, duration, time.Duration(0))
+	assert.Equal(t, transaction.SettledAt.Sub(transaction.CreatedAt), duration)
+}
+
+func TestGetPendingDurationStats(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	completedAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+	createCompleted := func(state string, duration time.Duration, selfPayment bool) {
+		transactionCompletedAt := completedAt
+		transaction := &db.Transaction{
+			Type:        constants.TRANSACTION_TYPE_OUTGOING,
+			State:       state,
+			AmountMsat:  1000,
+			SelfPayment: selfPayment,
+			CreatedAt:   completedAt.Add(-duration),
+		}
+		if state == constants.TRANSACTION_STATE_SETTLED {
+			transaction.SettledAt = &transactionCompletedAt
+		} else {
+			transaction.FailedAt = &transactionCompletedAt
+		}
+		svc.DB.Create(transaction)
+	}
+
+	for i := 1; i <= 10; i++ {
+		createCompleted(constants.TRANSACTION_STATE_SETTLED, time.Duration(i)*time.Second, false)
+	}
+	createCompleted(constants.TRANSACTION_STATE_FAILED, 30*time.Second, false)
+	createCompleted(constants.TRANSACTION_STATE_FAILED, 10*time.Second, false)
+
+	// not included
+	createCompleted(constants.TRANSACTION_STATE_SETTLED, time.Hour, true)
+	svc.DB.Create(&db.Transaction{
+		Type:       constants.TRANSACTION_TYPE_OUTGOING,
+		State:      constants.TRANSACTION_STATE_FAILED,
+		AmountMsat: 1000,
+		CreatedAt:  completedAt.Add(-time.Hour),
+	})
+	svc.DB.Create(&db.Transaction{
+		Type:       constants.TRANSACTION_TYPE_OUTGOING,
+		State:      constants.TRANSACTION_STATE_PENDING,
+		AmountMsat: 1000,
+		CreatedAt:  completedAt.Add(-time.Hour),
+	})
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	stats, err := transactionsService.GetPendingDurationStats(ctx, 0, 0)
+	require.NoError(t, err)
+
+	assert.Equal(t, uint64(10), stats.Settled.Count)
+	assert.Equal(t, 5*time.Second, stats.Settled.P50)
+	assert.Equal(t, 10*time.Second, stats.Settled.P99)
+	assert.Equal(t, uint64(2), stats.Failed.Count)
+	assert.Equal(t, 30*time.Second, stats.Failed.P99)
+
+	// outside of the time range
+	stats, err = transactionsService.GetPendingDurationStats(ctx, uint64(completedAt.Add(time.Minute).Unix()), 0)
+	require.NoError(t, err)
+	assert.Zero(t, stats.Settled.Count)
+	assert.Zero(t, stats.Failed.Count)
+}
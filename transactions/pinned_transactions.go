@@ -0,0 +1,41 @@
+package transactions
+
+import (
+	"context"
+
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// PinTransaction marks a transaction for quick access, e.g. a payment that is repeated regularly.
+// Apps can only pin their own transactions.
+func (svc *transactionsService) PinTransaction(ctx context.Context, id uint, appId *uint) error {
+	return svc.setTransactionPinned(id, appId, true)
+}
+
+// UnpinTransaction removes a transaction from the pinned transactions
+func (svc *transactionsService) UnpinTransaction(ctx context.Context, id uint, appId *uint) error {
+	return svc.setTransactionPinned(id, appId, false)
+}
+
+func (svc *transactionsService) setTransactionPinned(id uint, appId *uint, pinned bool) error {
+	tx := svc.db.Model(&db.Transaction{}).Where("id = ?", id)
+	if appId != nil {
+		tx = tx.Where("app_id = ?", *appId)
+	}
+	// pinning does not change the transaction, so it keeps its position in transaction lists
+	result := tx.UpdateColumn("pinned", pinned)
+	if result.Error != nil {
+		logger.Logger.WithFields(logrus.Fields{
+			"id":     id,
+			"app_id": appId,
+			"pinned": pinned,
+		}).WithError(result.Error).Error("Failed to update transaction pinned state")
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return NewNotFoundError()
+	}
+	return nil
+}
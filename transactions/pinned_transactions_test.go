@@ -0,0 +1,105 @@
+package transactions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListTransactions_Pinned(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	rent := db.Transaction{
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_OUTGOING,
+		PaymentHash: "rent",
+		AmountMsat:  1000,
+	}
+	svc.DB.Create(&rent)
+	coffee := db.Transaction{
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_OUTGOING,
+		PaymentHash: "coffee",
+		AmountMsat:  2000,
+	}
+	svc.DB.Create(&coffee)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	transactions, err := transactionsService.ListTransactions(ctx, 0, 0, 0, 0, false, false, nil, svc.LNClient, nil, false, ListTransactionsFilter{PinnedOnly: true})
+	assert.NoError(t, err)
+	assert.Empty(t, transactions)
+
+	err = transactionsService.PinTransaction(ctx, rent.ID, nil)
+	require.NoError(t, err)
+
+	transactions, err = transactionsService.ListTransactions(ctx, 0, 0, 0, 0, false, false, nil, svc.LNClient, nil, false, ListTransactionsFilter{PinnedOnly: true})
+	assert.NoError(t, err)
+	require.Equal(t, 1, len(transactions))
+	assert.Equal(t, "rent", transactions[0].PaymentHash)
+	assert.True(t, transactions[0].Pinned)
+
+	// without the filter all transactions are listed
+	transactions, err = transactionsService.ListTransactions(ctx, 0, 0, 0, 0, false, false, nil, svc.LNClient, nil, false, ListTransactionsFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(transactions))
+
+	err = transactionsService.UnpinTransaction(ctx, rent.ID, nil)
+	require.NoError(t, err)
+
+	transactions, err = transactionsService.ListTransactions(ctx, 0, 0, 0, 0, false, false, nil, svc.LNClient, nil, false, ListTransactionsFilter{PinnedOnly: true})
+	assert.NoError(t, err)
+	assert.Empty(t, transactions)
+}
+
+func TestPinTransaction_App(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+	otherApp, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+
+	transaction := db.Transaction{
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_OUTGOING,
+		PaymentHash: "rent",
+		AmountMsat:  1000,
+		AppId:       &app.ID,
+	}
+	svc.DB.Create(&transaction)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	// apps cannot pin each other's transactions
+	err = transactionsService.PinTransaction(ctx, transaction.ID, &otherApp.ID)
+	assert.ErrorIs(t, err, NewNotFoundError())
+
+	err = transactionsService.PinTransaction(ctx, transaction.ID, &app.ID)
+	require.NoError(t, err)
+
+	transactions, err := transactionsService.ListTransactions(ctx, 0, 0, 0, 0, false, false, nil, svc.LNClient, &app.ID, true, ListTransactionsFilter{PinnedOnly: true})
+	assert.NoError(t, err)
+	require.Equal(t, 1, len(transactions))
+	assert.Equal(t, transaction.ID, transactions[0].ID)
+
+	transactions, err = transactionsService.ListTransactions(ctx, 0, 0, 0, 0, false, false, nil, svc.LNClient, &otherApp.ID, true, ListTransactionsFilter{PinnedOnly: true})
+	assert.NoError(t, err)
+	assert.Empty(t, transactions)
+
+	err = transactionsService.PinTransaction(ctx, 1000, nil)
+	assert.ErrorIs(t, err, NewNotFoundError())
+}
@@ -0,0 +1,34 @@
+package transactions
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// verifyPreimageMatchesPaymentHash checks the stored preimage of a settled transaction is the proof of
+// payment for its stored payment hash, which would not be the case if either value was corrupted.
+// Returns nil for transactions without a preimage to verify.
+func verifyPreimageMatchesPaymentHash(transaction *Transaction) *bool {
+	if transaction.State != constants.TRANSACTION_STATE_SETTLED || transaction.Preimage == nil || *transaction.Preimage == "" {
+		return nil
+	}
+
+	matches := false
+	preimageBytes, err := hex.DecodeString(*transaction.Preimage)
+	if err == nil {
+		paymentHash := sha256.Sum256(preimageBytes)
+		matches = hex.EncodeToString(paymentHash[:]) == strings.ToLower(transaction.PaymentHash)
+	}
+	if !matches {
+		logger.Logger.WithFields(logrus.Fields{
+			"id":           transaction.ID,
+			"payment_hash": transaction.PaymentHash,
+		}).Error("Stored preimage does not match the payment hash")
+	}
+	return &matches
+}
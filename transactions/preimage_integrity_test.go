@@ -0,0 +1,83 @@
+package transactions
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupTransaction_VerifyIntegrity(t *testing.T) {
+	ctx := context.TODO()
+
+	preimage := strings.Repeat("01", 32)
+	preimageBytes, err := hex.DecodeString(preimage)
+	require.NoError(t, err)
+	paymentHashBytes := sha256.Sum256(preimageBytes)
+	paymentHash := hex.EncodeToString(paymentHashBytes[:])
+	otherPreimage := strings.Repeat("02", 32)
+	invalidPreimage := "not hex"
+
+	matches := true
+	mismatches := false
+
+	for name, testCase := range map[string]struct {
+		state           string
+		preimage        *string
+		verifyIntegrity bool
+		expected        *bool
+	}{
+		"matching": {
+			state:           constants.TRANSACTION_STATE_SETTLED,
+			preimage:        &preimage,
+			verifyIntegrity: true,
+			expected:        &matches,
+		},
+		"mismatching": {
+			state:           constants.TRANSACTION_STATE_SETTLED,
+			preimage:        &otherPreimage,
+			verifyIntegrity: true,
+			expected:        &mismatches,
+		},
+		"invalid preimage": {
+			state:           constants.TRANSACTION_STATE_SETTLED,
+			preimage:        &invalidPreimage,
+			verifyIntegrity: true,
+			expected:        &mismatches,
+		},
+		"no preimage": {
+			state:           constants.TRANSACTION_STATE_FAILED,
+			verifyIntegrity: true,
+		},
+		"not requested": {
+			state:    constants.TRANSACTION_STATE_SETTLED,
+			preimage: &otherPreimage,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer tests.RemoveTestService()
+			svc, err := tests.CreateTestService()
+			require.NoError(t, err)
+
+			svc.DB.Create(&db.Transaction{
+				State:       testCase.state,
+				Type:        constants.TRANSACTION_TYPE_OUTGOING,
+				PaymentHash: paymentHash,
+				Preimage:    testCase.preimage,
+				AmountMsat:  1000,
+			})
+
+			transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+			transaction, err := transactionsService.LookupTransaction(ctx, paymentHash, nil, svc.LNClient, nil, testCase.verifyIntegrity)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.expected, transaction.PreimageMatchesPaymentHash)
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package transactions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/logger"
+)
+
+const (
+	ReceiptFormatJSON = "json"
+)
+
+// Receipt is a shareable proof of a settled payment
+type Receipt struct {
+	Type        string    `json:"type"`
+	AmountMsat  uint64    `json:"amount_msat"`
+	FeeMsat     uint64    `json:"fee_msat"`
+	SettledAt   time.Time `json:"settled_at"`
+	Description string    `json:"description"`
+	PaymentHash string    `json:"payment_hash"`
+	Preimage    string    `json:"preimage"`
+	AppName     string    `json:"app_name,omitempty"`
+}
+
+// GenerateReceipt returns a receipt of a settled transaction the app can access, in the given format
+func (svc *transactionsService) GenerateReceipt(ctx context.Context, id uint, appId *uint, format string) ([]byte, error) {
+	if format != ReceiptFormatJSON {
+		return nil, fmt.Errorf("unsupported receipt format: %s", format)
+	}
+
+	// receipts can also be generated for hidden (soft-deleted) transactions
+	tx, err := svc.scopeToApp(svc.db.Unscoped(), appId)
+	if err != nil {
+		return nil, err
+	}
+
+	var transaction db.Transaction
+	result := tx.Limit(1).Find(&transaction, &db.Transaction{
+		ID: id,
+	})
+	if result.Error != nil {
+		logger.Logger.WithError(result.Error).Error("Failed to find transaction for receipt")
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, NewNotFoundError()
+	}
+
+	if transaction.State != constants.TRANSACTION_STATE_SETTLED || transaction.SettledAt == nil || transaction.Preimage == nil {
+		return nil, fmt.Errorf("cannot generate a receipt for a transaction in state %s", transaction.State)
+	}
+
+	receipt := Receipt{
+		Type:        transaction.Type,
+		AmountMsat:  transaction.AmountMsat,
+		FeeMsat:     transaction.FeeMsat,
+		SettledAt:   transaction.SettledAt.UTC(),
+		Description: transaction.Description,
+		PaymentHash: transaction.PaymentHash,
+		Preimage:    *transaction.Preimage,
+	}
+	if transaction.AppId != nil {
+		var app db.App
+		if svc.db.Limit(1).Find(&app, &db.App{ID: *transaction.AppId}).RowsAffected > 0 {
+			receipt.AppName = app.Name
+		}
+	}
+
+	return json.Marshal(receipt)
+}
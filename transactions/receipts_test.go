@@ -0,0 +1,112 @@
+package transactions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateReceipt_JSON(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+
+	settledAt := time.Date(2024, 12, 27, 12, 0, 0, 0, time.UTC)
+	mockPreimage := tests.MockLNClientTransaction.Preimage
+	dbTransaction := db.Transaction{
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_OUTGOING,
+		PaymentHash: tests.MockLNClientTransaction.PaymentHash,
+		Preimage:    &mockPreimage,
+		Description: "mock invoice",
+		AmountMsat:  123000,
+		FeeMsat:     1000,
+		SettledAt:   &settledAt,
+		AppId:       &app.ID,
+	}
+	svc.DB.Create(&dbTransaction)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	receiptJson, err := transactionsService.GenerateReceipt(ctx, dbTransaction.ID, &app.ID, ReceiptFormatJSON)
+	require.NoError(t, err)
+
+	var receipt map[string]interface{}
+	require.NoError(t, json.Unmarshal(receiptJson, &receipt))
+	assert.Equal(t, constants.TRANSACTION_TYPE_OUTGOING, receipt["type"])
+	assert.Equal(t, float64(123000), receipt["amount_msat"])
+	assert.Equal(t, float64(1000), receipt["fee_msat"])
+	assert.Equal(t, "2024-12-27T12:00:00Z", receipt["settled_at"])
+	assert.Equal(t, "mock invoice", receipt["description"])
+	assert.Equal(t, tests.MockLNClientTransaction.PaymentHash, receipt["payment_hash"])
+	assert.Equal(t, tests.MockLNClientTransaction.Preimage, receipt["preimage"])
+	assert.Equal(t, app.Name, receipt["app_name"])
+}
+
+func TestGenerateReceipt_IsolatedApp(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+	app.Isolated = true
+	svc.DB.Save(app)
+
+	settledAt := time.Now()
+	mockPreimage := tests.MockLNClientTransaction.Preimage
+	dbTransaction := db.Transaction{
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_OUTGOING,
+		PaymentHash: tests.MockLNClientTransaction.PaymentHash,
+		Preimage:    &mockPreimage,
+		AmountMsat:  123000,
+		SettledAt:   &settledAt,
+	}
+	svc.DB.Create(&dbTransaction)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	_, err = transactionsService.GenerateReceipt(ctx, dbTransaction.ID, &app.ID, ReceiptFormatJSON)
+	assert.True(t, errors.Is(err, NewNotFoundError()))
+
+	// the hub itself can access every transaction
+	_, err = transactionsService.GenerateReceipt(ctx, dbTransaction.ID, nil, ReceiptFormatJSON)
+	assert.NoError(t, err)
+}
+
+func TestGenerateReceipt_NotSettled(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	dbTransaction := db.Transaction{
+		State:       constants.TRANSACTION_STATE_PENDING,
+		Type:        constants.TRANSACTION_TYPE_OUTGOING,
+		PaymentHash: tests.MockLNClientTransaction.PaymentHash,
+		AmountMsat:  123000,
+	}
+	svc.DB.Create(&dbTransaction)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	_, err = transactionsService.GenerateReceipt(ctx, dbTransaction.ID, nil, ReceiptFormatJSON)
+	assert.EqualError(t, err, "cannot generate a receipt for a transaction in state PENDING")
+
+	_, err = transactionsService.GenerateReceipt(ctx, dbTransaction.ID, nil, "pdf")
+	assert.EqualError(t, err, "unsupported receipt format: pdf")
+}
@@ -54,7 +54,7 @@ func TestReceiveKeysendWithCustomKey(t *testing.T) {
 	}
 	transactionsService.ConsumeEvent(ctx, &event, map[string]interface{}{})
 
-	transaction, err := transactionsService.LookupTransaction(ctx, tx.PaymentHash, nil, svc.LNClient, nil)
+	transaction, err := transactionsService.LookupTransaction(ctx, tx.PaymentHash, nil, svc.LNClient, nil, false)
 	assert.NoError(t, err)
 	assert.Equal(t, app.ID, *transaction.AppId)
 	assert.Equal(t, uint(1), app.ID)
@@ -78,7 +78,7 @@ func TestReceiveKeysend(t *testing.T) {
 	}
 	transactionsService.ConsumeEvent(ctx, &event, map[string]interface{}{})
 
-	transaction, err := transactionsService.LookupTransaction(ctx, tx.PaymentHash, nil, svc.LNClient, nil)
+	transaction, err := transactionsService.LookupTransaction(ctx, tx.PaymentHash, nil, svc.LNClient, nil, false)
 	assert.NoError(t, err)
 	assert.Nil(t, transaction.AppId)
 }
@@ -0,0 +1,186 @@
+package transactions
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/lnclient"
+	"github.com/getAlby/hub/logger"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// the number of most recent settled invoices and payments fetched from the backend to reconcile against
+const reconcileBackendTransactionLimit = 1000
+
+type ReconcileReport struct {
+	// settled transactions listed by the backend
+	BackendTransactions int
+	// payment hashes of pending transactions settled as the backend settled them
+	Settled []string
+	// payment hashes of pending payments failed as the backend failed them
+	Failed []string
+	// payment hashes of incoming payments the backend received which we had no record of
+	Created []string
+	// differences which cannot be resolved automatically and need to be reviewed
+	Discrepancies []ReconcileDiscrepancy
+}
+
+type ReconcileDiscrepancy struct {
+	PaymentHash string
+	Type        string
+	Reason      string
+}
+
+// ReconcileAgainstBackend reconciles the transactions with the backend's recent invoices and payments
+// in one pass, e.g. after recovering from a period in which the backend processed payments
+// without the hub. Pending transactions the backend settled are settled, pending payments
+// the backend failed are failed, and received payments we have no record of are created.
+// Unlike checkUnsettledTransactions, every pending payment is checked regardless of its age
+// or whether the backend supports payment notifications.
+func (svc *transactionsService) ReconcileAgainstBackend(ctx context.Context, lnClient lnclient.LNClient) (*ReconcileReport, error) {
+	backendTransactions, err := lnClient.ListTransactions(ctx, 0, 0, reconcileBackendTransactionLimit, 0, false, "")
+	if err != nil {
+		logger.Logger.WithError(err).Error("Failed to list backend transactions to reconcile")
+		return nil, err
+	}
+
+	report := &ReconcileReport{
+		Settled:       []string{},
+		Failed:        []string{},
+		Created:       []string{},
+		Discrepancies: []ReconcileDiscrepancy{},
+	}
+
+	settledOutgoingPaymentHashes := map[string]bool{}
+	for i := range backendTransactions {
+		backendTransaction := &backendTransactions[i]
+		if backendTransaction.SettledAt == nil {
+			continue
+		}
+		report.BackendTransactions++
+		if backendTransaction.Type == constants.TRANSACTION_TYPE_OUTGOING {
+			settledOutgoingPaymentHashes[backendTransaction.PaymentHash] = true
+		}
+
+		err := svc.reconcileSettledTransaction(backendTransaction, report)
+		if err != nil {
+			logger.Logger.WithFields(logrus.Fields{
+				"payment_hash": backendTransaction.PaymentHash,
+				"type":         backendTransaction.Type,
+			}).WithError(err).Error("Failed to reconcile transaction")
+			report.addDiscrepancy(backendTransaction.PaymentHash, backendTransaction.Type, fmt.Sprintf("failed to reconcile: %v", err))
+		}
+	}
+
+	// pending payments not settled by the backend may have failed
+	var pendingPayments []db.Transaction
+	result := svc.db.Where("type = ? AND state = ?", constants.TRANSACTION_TYPE_OUTGOING, constants.TRANSACTION_STATE_PENDING).Find(&pendingPayments)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	for i := range pendingPayments {
+		if settledOutgoingPaymentHashes[pendingPayments[i].PaymentHash] {
+			continue
+		}
+		svc.reconcilePendingPayment(ctx, &pendingPayments[i], lnClient, report)
+	}
+
+	logger.Logger.WithFields(logrus.Fields{
+		"backend_transactions": report.BackendTransactions,
+		"settled":              len(report.Settled),
+		"failed":               len(report.Failed),
+		"created":              len(report.Created),
+		"discrepancies":        len(report.Discrepancies),
+	}).Info("Reconciled transactions against the backend")
+
+	return report, nil
+}
+
+// reconcileSettledTransaction applies a transaction the backend settled
+func (svc *transactionsService) reconcileSettledTransaction(backendTransaction *lnclient.Transaction, report *ReconcileReport) error {
+	var dbTransaction db.Transaction
+	result := svc.db.Unscoped().Limit(1).Where("split_from_id IS NULL").Find(&dbTransaction, &db.Transaction{
+		Type:        backendTransaction.Type,
+		PaymentHash: backendTransaction.PaymentHash,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		if backendTransaction.Type == constants.TRANSACTION_TYPE_OUTGOING {
+			// payments made from outside the hub cannot be associated with an app
+			report.addDiscrepancy(backendTransaction.PaymentHash, backendTransaction.Type, "payment settled on the backend has no transaction")
+			return nil
+		}
+		err := svc.inTransaction(func(tx *gorm.DB, balanceChanges *[]balanceChange) error {
+			return svc.recordReceivedPayment(tx, backendTransaction, balanceChanges)
+		})
+		if err != nil {
+			return err
+		}
+		report.Created = append(report.Created, backendTransaction.PaymentHash)
+		return nil
+	}
+
+	switch dbTransaction.State {
+	case constants.TRANSACTION_STATE_SETTLED:
+		if dbTransaction.Type == constants.TRANSACTION_TYPE_INCOMING && backendTransaction.Amount > 0 && uint64(backendTransaction.Amount) < dbTransaction.AmountMsat {
+			report.addDiscrepancy(backendTransaction.PaymentHash, backendTransaction.Type,
+				fmt.Sprintf("settled for %d msat but the backend received %d msat", dbTransaction.AmountMsat, backendTransaction.Amount))
+		}
+		return nil
+	case constants.TRANSACTION_STATE_FAILED:
+		// the balances of apps may have been spent since, so this is not reversed automatically
+		report.addDiscrepancy(backendTransaction.PaymentHash, backendTransaction.Type, "transaction is failed but was settled on the backend")
+		return nil
+	}
+
+	err := svc.inTransaction(func(tx *gorm.DB, balanceChanges *[]balanceChange) error {
+		_, err := svc.markTransactionSettled(tx, &dbTransaction, backendTransaction.Preimage, uint64(backendTransaction.FeesPaid), false, balanceChanges)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	report.Settled = append(report.Settled, backendTransaction.PaymentHash)
+	return nil
+}
+
+// reconcilePendingPayment fails a pending payment if the backend failed it
+func (svc *transactionsService) reconcilePendingPayment(ctx context.Context, dbTransaction *db.Transaction, lnClient lnclient.LNClient, report *ReconcileReport) {
+	paymentStatus, err := lnClient.LookupPayment(ctx, dbTransaction.PaymentHash)
+	if err != nil {
+		report.addDiscrepancy(dbTransaction.PaymentHash, dbTransaction.Type, fmt.Sprintf("failed to look up payment: %v", err))
+		return
+	}
+
+	switch paymentStatus {
+	case lnclient.PAYMENT_STATUS_FAILED:
+		err := svc.inTransaction(func(tx *gorm.DB, balanceChanges *[]balanceChange) error {
+			return svc.markPaymentFailed(tx, dbTransaction, "payment failed on the backend", balanceChanges)
+		})
+		if err != nil {
+			report.addDiscrepancy(dbTransaction.PaymentHash, dbTransaction.Type, fmt.Sprintf("failed to reconcile: %v", err))
+			return
+		}
+		report.Failed = append(report.Failed, dbTransaction.PaymentHash)
+	case lnclient.PAYMENT_STATUS_SUCCEEDED:
+		// the preimage and fee are only known from the backend's transaction list
+		report.addDiscrepancy(dbTransaction.PaymentHash, dbTransaction.Type, "payment succeeded on the backend but is not in its recent transactions")
+	case lnclient.PAYMENT_STATUS_NOT_FOUND:
+		// the payment can be failed with ForceFailPayment once it is confirmed it was never sent
+		report.addDiscrepancy(dbTransaction.PaymentHash, dbTransaction.Type, "the backend has no record of the pending payment")
+	}
+}
+
+func (report *ReconcileReport) addDiscrepancy(paymentHash string, transactionType string, reason string) {
+	report.Discrepancies = append(report.Discrepancies, ReconcileDiscrepancy{
+		PaymentHash: paymentHash,
+		Type:        transactionType,
+		Reason:      reason,
+	})
+}
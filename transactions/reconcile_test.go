@@ -0,0 +1,208 @@
+package transactions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/db/queries"
+	"github.com/getAlby/hub/lnclient"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setMockBackendTransactions(t *testing.T, backendTransactions []lnclient.Transaction) {
+	mockTransactions := tests.MockLNClientTransactions
+	t.Cleanup(func() { tests.MockLNClientTransactions = mockTransactions })
+	tests.MockLNClientTransactions = backendTransactions
+}
+
+func findReconciledTransaction(t *testing.T, svc *tests.TestService, paymentHash string, transactionType string) *db.Transaction {
+	var transaction db.Transaction
+	result := svc.DB.Limit(1).Find(&transaction, &db.Transaction{
+		PaymentHash: paymentHash,
+		Type:        transactionType,
+	})
+	require.NoError(t, result.Error)
+	require.Equal(t, int64(1), result.RowsAffected)
+	return &transaction
+}
+
+func TestReconcileAgainstBackend_SettledInvoices(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+	app.Isolated = true
+	svc.DB.Save(&app)
+
+	// invoices settled while the hub was down
+	svc.DB.Create(&db.Transaction{
+		AppId:       &app.ID,
+		State:       constants.TRANSACTION_STATE_PENDING,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		PaymentHash: "invoice1",
+		AmountMsat:  123000,
+	})
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_PENDING,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		PaymentHash: "invoice2",
+		AmountMsat:  2000,
+	})
+	// an invoice that is still open
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_PENDING,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		PaymentHash: "invoice3",
+		AmountMsat:  3000,
+	})
+
+	setMockBackendTransactions(t, []lnclient.Transaction{
+		{Type: "incoming", PaymentHash: "invoice1", Preimage: "preimage1", Amount: 123000, SettledAt: &tests.MockTimeUnix},
+		{Type: "incoming", PaymentHash: "invoice2", Preimage: "preimage2", Amount: 2000, SettledAt: &tests.MockTimeUnix},
+		{Type: "incoming", PaymentHash: "invoice3", Amount: 3000},
+	})
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	report, err := transactionsService.ReconcileAgainstBackend(ctx, svc.LNClient)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, report.BackendTransactions)
+	assert.ElementsMatch(t, []string{"invoice1", "invoice2"}, report.Settled)
+	assert.Empty(t, report.Failed)
+	assert.Empty(t, report.Created)
+	assert.Empty(t, report.Discrepancies)
+
+	transaction := findReconciledTransaction(t, svc, "invoice1", constants.TRANSACTION_TYPE_INCOMING)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transaction.State)
+	assert.Equal(t, "preimage1", *transaction.Preimage)
+	assert.Equal(t, uint64(123000), queries.GetIsolatedBalance(svc.DB, app.ID))
+
+	transaction = findReconciledTransaction(t, svc, "invoice3", constants.TRANSACTION_TYPE_INCOMING)
+	assert.Equal(t, constants.TRANSACTION_STATE_PENDING, transaction.State)
+
+	// reconciling again changes nothing
+	report, err = transactionsService.ReconcileAgainstBackend(ctx, svc.LNClient)
+	require.NoError(t, err)
+	assert.Empty(t, report.Settled)
+	assert.Empty(t, report.Discrepancies)
+	assert.Equal(t, uint64(123000), queries.GetIsolatedBalance(svc.DB, app.ID))
+}
+
+func TestReconcileAgainstBackend_MissingIncomingPayment(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	setMockBackendTransactions(t, []lnclient.Transaction{
+		{Type: "incoming", PaymentHash: "keysend1", Preimage: "preimage1", Amount: 5000, SettledAt: &tests.MockTimeUnix, Description: "received while down"},
+	})
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	report, err := transactionsService.ReconcileAgainstBackend(ctx, svc.LNClient)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"keysend1"}, report.Created)
+
+	transaction := findReconciledTransaction(t, svc, "keysend1", constants.TRANSACTION_TYPE_INCOMING)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transaction.State)
+	assert.Equal(t, uint64(5000), transaction.AmountMsat)
+	assert.Equal(t, "received while down", transaction.Description)
+}
+
+func TestReconcileAgainstBackend_Payments(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	svc.DB.Create(&db.Transaction{
+		State:          constants.TRANSACTION_STATE_PENDING,
+		Type:           constants.TRANSACTION_TYPE_OUTGOING,
+		PaymentHash:    "payment1",
+		AmountMsat:     10000,
+		FeeReserveMsat: 10000,
+	})
+	svc.DB.Create(&db.Transaction{
+		State:          constants.TRANSACTION_STATE_PENDING,
+		Type:           constants.TRANSACTION_TYPE_OUTGOING,
+		PaymentHash:    "payment2",
+		AmountMsat:     20000,
+		FeeReserveMsat: 10000,
+	})
+
+	setMockBackendTransactions(t, []lnclient.Transaction{
+		{Type: "outgoing", PaymentHash: "payment1", Preimage: "preimage1", Amount: 10000, FeesPaid: 12, SettledAt: &tests.MockTimeUnix},
+	})
+	svc.LNClient.(*tests.MockLn).PaymentStatus = lnclient.PAYMENT_STATUS_FAILED
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	report, err := transactionsService.ReconcileAgainstBackend(ctx, svc.LNClient)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"payment1"}, report.Settled)
+	assert.Equal(t, []string{"payment2"}, report.Failed)
+	assert.Empty(t, report.Discrepancies)
+
+	transaction := findReconciledTransaction(t, svc, "payment1", constants.TRANSACTION_TYPE_OUTGOING)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transaction.State)
+	assert.Equal(t, uint64(12), transaction.FeeMsat)
+	assert.Zero(t, transaction.FeeReserveMsat)
+
+	transaction = findReconciledTransaction(t, svc, "payment2", constants.TRANSACTION_TYPE_OUTGOING)
+	assert.Equal(t, constants.TRANSACTION_STATE_FAILED, transaction.State)
+	assert.Equal(t, "payment failed on the backend", transaction.FailureReason)
+}
+
+func TestReconcileAgainstBackend_Discrepancies(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	// a payment we failed which the backend settled
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_FAILED,
+		Type:        constants.TRANSACTION_TYPE_OUTGOING,
+		PaymentHash: "payment1",
+		AmountMsat:  10000,
+	})
+	// a pending payment the backend does not know about
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_PENDING,
+		Type:        constants.TRANSACTION_TYPE_OUTGOING,
+		PaymentHash: "payment2",
+		AmountMsat:  10000,
+	})
+
+	setMockBackendTransactions(t, []lnclient.Transaction{
+		{Type: "outgoing", PaymentHash: "payment1", Preimage: "preimage1", Amount: 10000, SettledAt: &tests.MockTimeUnix},
+		// a payment made from outside the hub
+		{Type: "outgoing", PaymentHash: "payment3", Preimage: "preimage3", Amount: 10000, SettledAt: &tests.MockTimeUnix},
+	})
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	report, err := transactionsService.ReconcileAgainstBackend(ctx, svc.LNClient)
+	require.NoError(t, err)
+	assert.Empty(t, report.Settled)
+	assert.Empty(t, report.Failed)
+	assert.Empty(t, report.Created)
+	assert.ElementsMatch(t, []ReconcileDiscrepancy{
+		{PaymentHash: "payment1", Type: "outgoing", Reason: "transaction is failed but was settled on the backend"},
+		{PaymentHash: "payment3", Type: "outgoing", Reason: "payment settled on the backend has no transaction"},
+		{PaymentHash: "payment2", Type: "outgoing", Reason: "the backend has no record of the pending payment"},
+	}, report.Discrepancies)
+
+	// nothing is changed
+	assert.Equal(t, constants.TRANSACTION_STATE_FAILED, findReconciledTransaction(t, svc, "payment1", constants.TRANSACTION_TYPE_OUTGOING).State)
+	assert.Equal(t, constants.TRANSACTION_STATE_PENDING, findReconciledTransaction(t, svc, "payment2", constants.TRANSACTION_TYPE_OUTGOING).State)
+}
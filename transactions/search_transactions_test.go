@@ -0,0 +1,239 @@
+package transactions
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchTransactions_CombinedFilters(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	now := time.Now()
+	lastWeek := now.Add(-7 * 24 * time.Hour)
+
+	// match
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		Description: "Coffee order #42",
+		PaymentHash: "hash1",
+		AmountMsat:  5000,
+		CreatedAt:   now,
+	})
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		Description: "coffee order #43",
+		PaymentHash: "hash2",
+		AmountMsat:  7000,
+		CreatedAt:   now,
+	})
+	// amount too large
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		Description: "Coffee order #44",
+		PaymentHash: "hash3",
+		AmountMsat:  50000,
+		CreatedAt:   now,
+	})
+	// too old
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		Description: "Coffee order #1",
+		PaymentHash: "hash4",
+		AmountMsat:  5000,
+		CreatedAt:   lastWeek,
+	})
+	// wrong type
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_OUTGOING,
+		Description: "Coffee beans",
+		PaymentHash: "hash5",
+		AmountMsat:  5000,
+		CreatedAt:   now,
+	})
+	// wrong state
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_PENDING,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		Description: "Coffee order #45",
+		PaymentHash: "hash6",
+		AmountMsat:  5000,
+		CreatedAt:   now,
+	})
+	// text does not match
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		Description: "Tea",
+		PaymentHash: "hash7",
+		AmountMsat:  5000,
+		CreatedAt:   now,
+	})
+
+	transactionType := constants.TRANSACTION_TYPE_INCOMING
+	state := constants.TRANSACTION_STATE_SETTLED
+	query := SearchQuery{
+		Text:          "coffee",
+		MinAmountMsat: 1000,
+		MaxAmountMsat: 10000,
+		From:          uint64(now.Add(-time.Hour).Unix()),
+		Type:          &transactionType,
+		State:         &state,
+	}
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transactions, totalCount, err := transactionsService.SearchTransactions(ctx, query, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), totalCount)
+	assert.Equal(t, 2, len(transactions))
+
+	// the total count ignores pagination
+	query.Limit = 1
+	query.Offset = 1
+	transactions, totalCount, err = transactionsService.SearchTransactions(ctx, query, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), totalCount)
+	assert.Equal(t, 1, len(transactions))
+
+	// the text also matches payment hashes
+	transactions, totalCount, err = transactionsService.SearchTransactions(ctx, SearchQuery{Text: "hash7"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), totalCount)
+	assert.Equal(t, "Tea", transactions[0].Description)
+}
+
+func TestSearchTransactions_EscapesText(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		Description: "100% refund",
+		PaymentHash: "hash1",
+	})
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		Description: "1000 refund",
+		PaymentHash: "hash2",
+	})
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transactions, totalCount, err := transactionsService.SearchTransactions(ctx, SearchQuery{Text: "0%"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), totalCount)
+	assert.Equal(t, "100% refund", transactions[0].Description)
+}
+
+func TestSearchTransactions_App(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	assert.NoError(t, err)
+
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		Description: "app payment",
+		PaymentHash: "hash1",
+		AppId:       &app.ID,
+	})
+	svc.DB.Create(&db.Transaction{
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		Description: "other payment",
+		PaymentHash: "hash2",
+	})
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transactions, totalCount, err := transactionsService.SearchTransactions(ctx, SearchQuery{Text: "payment"}, &app.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), totalCount)
+	assert.Equal(t, "app payment", transactions[0].Description)
+
+	unknownAppId := uint(999)
+	_, _, err = transactionsService.SearchTransactions(ctx, SearchQuery{}, &unknownAppId)
+	assert.ErrorIs(t, err, NewNotFoundError())
+}
+
+func TestSearchTransactions_RelayUrl(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	assert.NoError(t, err)
+	err = svc.DB.Create(&db.AppPermission{
+		AppId: app.ID,
+		App:   *app,
+		Scope: constants.PAY_INVOICE_SCOPE,
+	}).Error
+	assert.NoError(t, err)
+	err = svc.DB.Create(&db.AppPermission{
+		AppId: app.ID,
+		App:   *app,
+		Scope: constants.MAKE_INVOICE_SCOPE,
+	}).Error
+	assert.NoError(t, err)
+
+	relayUrl := "wss://relay1.example.com"
+	otherRelayUrl := "wss://relay2.example.com"
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	payRequestEvent := &db.RequestEvent{NostrId: "event1", RelayUrl: relayUrl}
+	err = svc.DB.Create(payRequestEvent).Error
+	assert.NoError(t, err)
+	outgoingTransaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, &app.ID, &payRequestEvent.ID, SendPaymentOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, relayUrl, outgoingTransaction.RelayUrl)
+
+	makeInvoiceRequestEvent := &db.RequestEvent{NostrId: "event2", RelayUrl: otherRelayUrl}
+	err = svc.DB.Create(makeInvoiceRequestEvent).Error
+	assert.NoError(t, err)
+	incomingTransaction, err := transactionsService.MakeInvoice(ctx, 1000, "Hello world", "", 0, nil, svc.LNClient, &app.ID, &makeInvoiceRequestEvent.ID, "")
+	assert.NoError(t, err)
+	assert.Equal(t, otherRelayUrl, incomingTransaction.RelayUrl)
+
+	// transactions not requested over NWC have no relay
+	transaction, err := transactionsService.MakeInvoice(ctx, 1000, "Hello world", "", 0, nil, svc.LNClient, nil, nil, "")
+	assert.NoError(t, err)
+	assert.Empty(t, transaction.RelayUrl)
+
+	transactions, total, err := transactionsService.SearchTransactions(ctx, SearchQuery{RelayUrl: &relayUrl}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), total)
+	require.Equal(t, 1, len(transactions))
+	assert.Equal(t, outgoingTransaction.ID, transactions[0].ID)
+
+	transactions, total, err = transactionsService.SearchTransactions(ctx, SearchQuery{RelayUrl: &otherRelayUrl}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), total)
+	require.Equal(t, 1, len(transactions))
+	assert.Equal(t, incomingTransaction.ID, transactions[0].ID)
+}
@@ -0,0 +1,46 @@
+package transactions
+
+import (
+	"strings"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/lnclient"
+	decodepay "github.com/nbd-wtf/ln-decodepay"
+)
+
+// SetSelfPaymentDetection sets whether payments to our own node are settled internally.
+// It should be disabled when the node is shared, e.g. by a custodial service,
+// as payments to other users of the node have the same payee and must be sent through the network.
+// Enabled by default.
+func (svc *transactionsService) SetSelfPaymentDetection(enabled bool) {
+	svc.selfPaymentDetectionDisabled = !enabled
+}
+
+// isSelfPayment returns whether a payment to the payee is to our own node and should be
+// settled internally rather than sent through the network
+func (svc *transactionsService) isSelfPayment(payee string, lnClient lnclient.LNClient) bool {
+	if svc.selfPaymentDetectionDisabled {
+		return false
+	}
+	return payee != "" && payee == strings.ToLower(lnClient.GetPubkey())
+}
+
+// isSelfInvoice returns whether an invoice is ours and should be settled internally.
+// An invoice without a payee is ours if it matches one of our pending invoices,
+// so it is not sent through the network only to come back to us.
+func (svc *transactionsService) isSelfInvoice(paymentRequest *decodepay.Bolt11, lnClient lnclient.LNClient) bool {
+	if svc.selfPaymentDetectionDisabled {
+		return false
+	}
+	if paymentRequest.Payee != "" {
+		return svc.isSelfPayment(paymentRequest.Payee, lnClient)
+	}
+
+	var count int64
+	svc.db.Model(&db.Transaction{}).
+		Where("type = ? AND state = ? AND payment_hash = ? AND split_from_id IS NULL",
+			constants.TRANSACTION_TYPE_INCOMING, constants.TRANSACTION_STATE_PENDING, paymentRequest.PaymentHash).
+		Count(&count)
+	return count > 0
+}
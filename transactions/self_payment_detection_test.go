@@ -0,0 +1,132 @@
+package transactions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/tests"
+	decodepay "github.com/nbd-wtf/ln-decodepay"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendPaymentSync_SelfPaymentDetection(t *testing.T) {
+	for name, enabled := range map[string]bool{
+		"enabled":  true,
+		"disabled": false,
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.TODO()
+
+			defer tests.RemoveTestService()
+			svc, err := tests.CreateTestService()
+			require.NoError(t, err)
+
+			// pubkey matches mock invoice
+			svc.LNClient.(*tests.MockLn).Pubkey = mockPayee
+
+			mockPreimage := "123preimage"
+			svc.DB.Create(&db.Transaction{
+				State:          constants.TRANSACTION_STATE_PENDING,
+				Type:           constants.TRANSACTION_TYPE_INCOMING,
+				PaymentRequest: tests.MockInvoice,
+				PaymentHash:    tests.MockPaymentHash,
+				Preimage:       &mockPreimage,
+				AmountMsat:     123000,
+			})
+
+			transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+			transactionsService.SetSelfPaymentDetection(enabled)
+			transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockInvoice, nil, svc.LNClient, nil, nil, SendPaymentOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transaction.State)
+			assert.Equal(t, enabled, transaction.SelfPayment)
+
+			// the invoice is only settled internally if self payments are detected,
+			// otherwise it is settled once the payment is received through the network
+			var incomingTransaction db.Transaction
+			svc.DB.Find(&incomingTransaction, &db.Transaction{
+				Type:        constants.TRANSACTION_TYPE_INCOMING,
+				PaymentHash: tests.MockPaymentHash,
+			})
+			if enabled {
+				assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, incomingTransaction.State)
+			} else {
+				assert.Equal(t, constants.TRANSACTION_STATE_PENDING, incomingTransaction.State)
+			}
+			assert.Equal(t, enabled, incomingTransaction.SelfPayment)
+		})
+	}
+}
+
+func TestSendKeysend_SelfPaymentDetection(t *testing.T) {
+	for name, enabled := range map[string]bool{
+		"enabled":  true,
+		"disabled": false,
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.TODO()
+
+			defer tests.RemoveTestService()
+			svc, err := tests.CreateTestService()
+			require.NoError(t, err)
+
+			svc.LNClient.(*tests.MockLn).Pubkey = mockPayee
+
+			transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+			transactionsService.SetSelfPaymentDetection(enabled)
+			transaction, err := transactionsService.SendKeysend(ctx, 1000, mockPayee, nil, "", "", svc.LNClient, nil, nil)
+			require.NoError(t, err)
+			assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transaction.State)
+			assert.Equal(t, enabled, transaction.SelfPayment)
+
+			// an incoming transaction is only created for keysends settled internally
+			var incomingCount int64
+			svc.DB.Model(&db.Transaction{}).Where("type = ?", constants.TRANSACTION_TYPE_INCOMING).Count(&incomingCount)
+			if enabled {
+				assert.Equal(t, int64(1), incomingCount)
+				assert.Zero(t, transaction.FeeMsat)
+			} else {
+				assert.Zero(t, incomingCount)
+				// fee of the mock network send
+				assert.Equal(t, uint64(1), transaction.FeeMsat)
+			}
+		})
+	}
+}
+
+func TestIsSelfInvoice_NoPayee(t *testing.T) {
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	mockPreimage := "123preimage"
+	dbTransaction := db.Transaction{
+		State:          constants.TRANSACTION_STATE_PENDING,
+		Type:           constants.TRANSACTION_TYPE_INCOMING,
+		PaymentRequest: tests.MockInvoice,
+		PaymentHash:    tests.MockPaymentHash,
+		Preimage:       &mockPreimage,
+		AmountMsat:     123000,
+	}
+	svc.DB.Create(&dbTransaction)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+
+	// a payee-less invoice matching one of our pending invoices
+	assert.True(t, transactionsService.isSelfInvoice(&decodepay.Bolt11{PaymentHash: tests.MockPaymentHash}, svc.LNClient))
+	// a payee-less invoice that is not ours
+	assert.False(t, transactionsService.isSelfInvoice(&decodepay.Bolt11{PaymentHash: "other payment hash"}, svc.LNClient))
+	// an invoice with another payee is never ours, even if the payment hash matches
+	assert.False(t, transactionsService.isSelfInvoice(&decodepay.Bolt11{PaymentHash: tests.MockPaymentHash, Payee: mockPayee}, svc.LNClient))
+
+	transactionsService.SetSelfPaymentDetection(false)
+	assert.False(t, transactionsService.isSelfInvoice(&decodepay.Bolt11{PaymentHash: tests.MockPaymentHash}, svc.LNClient))
+	transactionsService.SetSelfPaymentDetection(true)
+
+	// invoices that are already settled are not matched
+	svc.DB.Model(&dbTransaction).Update("state", constants.TRANSACTION_STATE_SETTLED)
+	assert.False(t, transactionsService.isSelfInvoice(&decodepay.Bolt11{PaymentHash: tests.MockPaymentHash}, svc.LNClient))
+}
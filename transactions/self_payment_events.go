@@ -0,0 +1,80 @@
+package transactions
+
+import (
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/events"
+)
+
+// SelfPaymentEventOrder is the order in which the two settlement events of a self payment are published.
+// A self payment settles an incoming and an outgoing transaction on our own node, and subscribers
+// receive both events in this order, so a timeline built from the events is consistent.
+type SelfPaymentEventOrder string
+
+const (
+	// nwc_payment_received is published before nwc_payment_sent: the recipient is credited
+	// before the payer is debited. This is the default.
+	SelfPaymentEventOrderIncomingFirst SelfPaymentEventOrder = "incoming_first"
+	// nwc_payment_sent is published before nwc_payment_received
+	SelfPaymentEventOrderOutgoingFirst SelfPaymentEventOrder = "outgoing_first"
+)
+
+// SetSelfPaymentEventOrder sets the order in which the settlement events of self payments are published
+func (svc *transactionsService) SetSelfPaymentEventOrder(order SelfPaymentEventOrder) {
+	svc.selfPaymentEventOrder = order
+}
+
+// publishSelfPaymentEvents publishes the settlement events of both sides of a self payment
+// in the configured order. Either event may be nil if that side was not settled.
+func (svc *transactionsService) publishSelfPaymentEvents(incomingEvent *events.Event, outgoingEvent *events.Event) {
+	orderedEvents := []*events.Event{incomingEvent, outgoingEvent}
+	if svc.selfPaymentEventOrder == SelfPaymentEventOrderOutgoingFirst {
+		orderedEvents = []*events.Event{outgoingEvent, incomingEvent}
+	}
+
+	paymentEvents := []*events.Event{}
+	for _, event := range orderedEvents {
+		if event != nil {
+			paymentEvents = append(paymentEvents, svc.trackNotification(event))
+		}
+	}
+
+	// each event is only published once every subscriber has consumed the one before it,
+	// so subscribers receive them in order without blocking the event publisher
+	for i := len(paymentEvents) - 2; i >= 0; i-- {
+		onConsumed := paymentEvents[i].OnConsumed
+		nextEvent := paymentEvents[i+1]
+		paymentEvents[i].OnConsumed = func() {
+			if onConsumed != nil {
+				onConsumed()
+			}
+			svc.eventPublisher.Publish(nextEvent)
+		}
+	}
+	if len(paymentEvents) > 0 {
+		svc.eventPublisher.Publish(paymentEvents[0])
+	}
+}
+
+// selfPaymentSettledEvent returns the settlement event of one side of a self payment,
+// or nil if it was not settled
+func selfPaymentSettledEvent(settledTransaction *db.Transaction, previousTransaction *db.Transaction) *events.Event {
+	if settledTransaction == nil {
+		return nil
+	}
+	return paymentSettledEvent(settledTransaction, previousTransaction)
+}
+
+// paymentSettledEvent returns the settlement event of a transaction, along with the transaction
+// as it was before it was settled so subscribers can see what changed
+func paymentSettledEvent(dbTransaction *db.Transaction, previousTransaction *db.Transaction) *events.Event {
+	event := "nwc_payment_sent"
+	if dbTransaction.Type == constants.TRANSACTION_TYPE_INCOMING {
+		event = "nwc_payment_received"
+	}
+	return &events.Event{
+		Event:              event,
+		Properties:         dbTransaction,
+		PreviousProperties: previousTransaction,
+	}
+}
@@ -2,11 +2,14 @@ package transactions
 
 import (
 	"context"
+	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/getAlby/hub/constants"
 	"github.com/getAlby/hub/db"
 	"github.com/getAlby/hub/db/queries"
+	"github.com/getAlby/hub/lnclient"
 	"github.com/getAlby/hub/tests"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -20,7 +23,7 @@ func TestSendPaymentSync_SelfPayment_NoAppToNoApp(t *testing.T) {
 	require.NoError(t, err)
 
 	// pubkey matches mock invoice = self payment
-	svc.LNClient.(*tests.MockLn).Pubkey = "02a5056398235568fc049a5d563f1adf666041d590b268167e4fa145fbf71aa578"
+	svc.LNClient.(*tests.MockLn).Pubkey = "02ff7c3da0679c37c2914a1f392a88a01a243a0773a1794fba7252e15e4e40f4f3"
 
 	mockPreimage := "123preimage"
 	svc.DB.Create(&db.Transaction{
@@ -33,7 +36,7 @@ func TestSendPaymentSync_SelfPayment_NoAppToNoApp(t *testing.T) {
 	})
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
-	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockInvoice, nil, svc.LNClient, nil, nil)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockInvoice, nil, svc.LNClient, nil, nil, SendPaymentOptions{})
 
 	assert.NoError(t, err)
 	assert.Equal(t, uint64(123000), transaction.AmountMsat)
@@ -42,7 +45,7 @@ func TestSendPaymentSync_SelfPayment_NoAppToNoApp(t *testing.T) {
 	assert.True(t, transaction.SelfPayment)
 
 	transactionType := constants.TRANSACTION_TYPE_INCOMING
-	incomingTransaction, err := transactionsService.LookupTransaction(ctx, tests.MockPaymentHash, &transactionType, svc.LNClient, nil)
+	incomingTransaction, err := transactionsService.LookupTransaction(ctx, tests.MockPaymentHash, &transactionType, svc.LNClient, nil, false)
 	assert.NoError(t, err)
 	assert.Equal(t, uint64(123000), incomingTransaction.AmountMsat)
 	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, incomingTransaction.State)
@@ -62,7 +65,7 @@ func TestSendPaymentSync_SelfPayment_NoAppToIsolatedApp(t *testing.T) {
 	require.NoError(t, err)
 
 	// pubkey matches mock invoice = self payment
-	svc.LNClient.(*tests.MockLn).Pubkey = "02a5056398235568fc049a5d563f1adf666041d590b268167e4fa145fbf71aa578"
+	svc.LNClient.(*tests.MockLn).Pubkey = "02ff7c3da0679c37c2914a1f392a88a01a243a0773a1794fba7252e15e4e40f4f3"
 
 	app, _, err := tests.CreateApp(svc)
 	assert.NoError(t, err)
@@ -85,7 +88,7 @@ func TestSendPaymentSync_SelfPayment_NoAppToIsolatedApp(t *testing.T) {
 	})
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
-	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockInvoice, nil, svc.LNClient, nil, nil)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockInvoice, nil, svc.LNClient, nil, nil, SendPaymentOptions{})
 
 	assert.NoError(t, err)
 	assert.Equal(t, uint64(123000), transaction.AmountMsat)
@@ -94,7 +97,7 @@ func TestSendPaymentSync_SelfPayment_NoAppToIsolatedApp(t *testing.T) {
 	assert.True(t, transaction.SelfPayment)
 
 	transactionType := constants.TRANSACTION_TYPE_INCOMING
-	incomingTransaction, err := transactionsService.LookupTransaction(ctx, tests.MockPaymentHash, &transactionType, svc.LNClient, nil)
+	incomingTransaction, err := transactionsService.LookupTransaction(ctx, tests.MockPaymentHash, &transactionType, svc.LNClient, nil, false)
 	assert.NoError(t, err)
 	assert.Equal(t, uint64(123000), incomingTransaction.AmountMsat)
 	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, incomingTransaction.State)
@@ -117,7 +120,7 @@ func TestSendPaymentSync_SelfPayment_NoAppToApp(t *testing.T) {
 	require.NoError(t, err)
 
 	// pubkey matches mock invoice = self payment
-	svc.LNClient.(*tests.MockLn).Pubkey = "02a5056398235568fc049a5d563f1adf666041d590b268167e4fa145fbf71aa578"
+	svc.LNClient.(*tests.MockLn).Pubkey = "02ff7c3da0679c37c2914a1f392a88a01a243a0773a1794fba7252e15e4e40f4f3"
 
 	app, _, err := tests.CreateApp(svc)
 	assert.NoError(t, err)
@@ -138,7 +141,7 @@ func TestSendPaymentSync_SelfPayment_NoAppToApp(t *testing.T) {
 	})
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
-	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockInvoice, nil, svc.LNClient, nil, nil)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockInvoice, nil, svc.LNClient, nil, nil, SendPaymentOptions{})
 
 	assert.NoError(t, err)
 	assert.Equal(t, uint64(123000), transaction.AmountMsat)
@@ -147,7 +150,7 @@ func TestSendPaymentSync_SelfPayment_NoAppToApp(t *testing.T) {
 	assert.True(t, transaction.SelfPayment)
 
 	transactionType := constants.TRANSACTION_TYPE_INCOMING
-	incomingTransaction, err := transactionsService.LookupTransaction(ctx, tests.MockPaymentHash, &transactionType, svc.LNClient, nil)
+	incomingTransaction, err := transactionsService.LookupTransaction(ctx, tests.MockPaymentHash, &transactionType, svc.LNClient, nil, false)
 	assert.NoError(t, err)
 	assert.Equal(t, uint64(123000), incomingTransaction.AmountMsat)
 	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, incomingTransaction.State)
@@ -168,7 +171,7 @@ func TestSendPaymentSync_SelfPayment_IsolatedAppToNoApp(t *testing.T) {
 	require.NoError(t, err)
 
 	// pubkey matches mock invoice = self payment
-	svc.LNClient.(*tests.MockLn).Pubkey = "02a5056398235568fc049a5d563f1adf666041d590b268167e4fa145fbf71aa578"
+	svc.LNClient.(*tests.MockLn).Pubkey = "02ff7c3da0679c37c2914a1f392a88a01a243a0773a1794fba7252e15e4e40f4f3"
 
 	app, _, err := tests.CreateApp(svc)
 	assert.NoError(t, err)
@@ -207,7 +210,7 @@ func TestSendPaymentSync_SelfPayment_IsolatedAppToNoApp(t *testing.T) {
 	})
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
-	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockInvoice, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockInvoice, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID, SendPaymentOptions{})
 
 	assert.NoError(t, err)
 	assert.Equal(t, uint64(123000), transaction.AmountMsat)
@@ -218,7 +221,7 @@ func TestSendPaymentSync_SelfPayment_IsolatedAppToNoApp(t *testing.T) {
 	assert.True(t, transaction.SelfPayment)
 
 	transactionType := constants.TRANSACTION_TYPE_INCOMING
-	incomingTransaction, err := transactionsService.LookupTransaction(ctx, tests.MockPaymentHash, &transactionType, svc.LNClient, nil)
+	incomingTransaction, err := transactionsService.LookupTransaction(ctx, tests.MockPaymentHash, &transactionType, svc.LNClient, nil, false)
 	assert.NoError(t, err)
 	assert.Equal(t, uint64(123000), incomingTransaction.AmountMsat)
 	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, incomingTransaction.State)
@@ -240,7 +243,7 @@ func TestSendPaymentSync_SelfPayment_IsolatedAppToApp(t *testing.T) {
 	require.NoError(t, err)
 
 	// pubkey matches mock invoice = self payment
-	svc.LNClient.(*tests.MockLn).Pubkey = "02a5056398235568fc049a5d563f1adf666041d590b268167e4fa145fbf71aa578"
+	svc.LNClient.(*tests.MockLn).Pubkey = "02ff7c3da0679c37c2914a1f392a88a01a243a0773a1794fba7252e15e4e40f4f3"
 
 	app, _, err := tests.CreateApp(svc)
 	assert.NoError(t, err)
@@ -282,7 +285,7 @@ func TestSendPaymentSync_SelfPayment_IsolatedAppToApp(t *testing.T) {
 	})
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
-	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockInvoice, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockInvoice, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID, SendPaymentOptions{})
 
 	assert.NoError(t, err)
 	assert.Equal(t, uint64(123000), transaction.AmountMsat)
@@ -293,7 +296,7 @@ func TestSendPaymentSync_SelfPayment_IsolatedAppToApp(t *testing.T) {
 	assert.True(t, transaction.SelfPayment)
 
 	transactionType := constants.TRANSACTION_TYPE_INCOMING
-	incomingTransaction, err := transactionsService.LookupTransaction(ctx, tests.MockPaymentHash, &transactionType, svc.LNClient, nil)
+	incomingTransaction, err := transactionsService.LookupTransaction(ctx, tests.MockPaymentHash, &transactionType, svc.LNClient, nil, false)
 	assert.NoError(t, err)
 	assert.Equal(t, uint64(123000), incomingTransaction.AmountMsat)
 	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, incomingTransaction.State)
@@ -316,7 +319,7 @@ func TestSendPaymentSync_SelfPayment_IsolatedAppToIsolatedApp(t *testing.T) {
 	require.NoError(t, err)
 
 	// pubkey matches mock invoice = self payment
-	svc.LNClient.(*tests.MockLn).Pubkey = "02a5056398235568fc049a5d563f1adf666041d590b268167e4fa145fbf71aa578"
+	svc.LNClient.(*tests.MockLn).Pubkey = "02ff7c3da0679c37c2914a1f392a88a01a243a0773a1794fba7252e15e4e40f4f3"
 
 	app, _, err := tests.CreateApp(svc)
 	assert.NoError(t, err)
@@ -364,7 +367,7 @@ func TestSendPaymentSync_SelfPayment_IsolatedAppToIsolatedApp(t *testing.T) {
 	svc.EventPublisher.RegisterSubscriber(mockEventConsumer)
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
-	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockInvoice, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockInvoice, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID, SendPaymentOptions{})
 
 	assert.NoError(t, err)
 	assert.Equal(t, uint64(123000), transaction.AmountMsat)
@@ -375,7 +378,7 @@ func TestSendPaymentSync_SelfPayment_IsolatedAppToIsolatedApp(t *testing.T) {
 	assert.True(t, transaction.SelfPayment)
 
 	transactionType := constants.TRANSACTION_TYPE_INCOMING
-	incomingTransaction, err := transactionsService.LookupTransaction(ctx, tests.MockPaymentHash, &transactionType, svc.LNClient, nil)
+	incomingTransaction, err := transactionsService.LookupTransaction(ctx, tests.MockPaymentHash, &transactionType, svc.LNClient, nil, false)
 	assert.NoError(t, err)
 	assert.Equal(t, uint64(123000), incomingTransaction.AmountMsat)
 	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, incomingTransaction.State)
@@ -390,14 +393,17 @@ func TestSendPaymentSync_SelfPayment_IsolatedAppToIsolatedApp(t *testing.T) {
 	assert.Equal(t, uint64(10000), queries.GetIsolatedBalance(svc.DB, app.ID))
 
 	// check notifications
-	assert.Equal(t, 2, len(mockEventConsumer.GetConsumedEvents()))
+	consumedEvents := mockEventConsumer.GetConsumedEvents()
+	assert.Equal(t, 2, len(getBalanceChangedEvents(consumedEvents)))
+	paymentEvents := getEventsExcept(consumedEvents, "nwc_balance_changed")
+	assert.Equal(t, 2, len(paymentEvents))
 
-	assert.Equal(t, "nwc_payment_sent", mockEventConsumer.GetConsumedEvents()[1].Event)
-	settledTransaction := mockEventConsumer.GetConsumedEvents()[1].Properties.(*db.Transaction)
+	assert.Equal(t, "nwc_payment_sent", paymentEvents[1].Event)
+	settledTransaction := paymentEvents[1].Properties.(*db.Transaction)
 	assert.Equal(t, transaction.ID, settledTransaction.ID)
 
-	assert.Equal(t, "nwc_payment_received", mockEventConsumer.GetConsumedEvents()[0].Event)
-	receivedTransaction := mockEventConsumer.GetConsumedEvents()[0].Properties.(*db.Transaction)
+	assert.Equal(t, "nwc_payment_received", paymentEvents[0].Event)
+	receivedTransaction := paymentEvents[0].Properties.(*db.Transaction)
 	assert.Equal(t, incomingTransaction.ID, receivedTransaction.ID)
 }
 
@@ -409,7 +415,7 @@ func TestSendPaymentSync_SelfPayment_IsolatedAppToSelf(t *testing.T) {
 	require.NoError(t, err)
 
 	// pubkey matches mock invoice = self payment
-	svc.LNClient.(*tests.MockLn).Pubkey = "02a5056398235568fc049a5d563f1adf666041d590b268167e4fa145fbf71aa578"
+	svc.LNClient.(*tests.MockLn).Pubkey = "02ff7c3da0679c37c2914a1f392a88a01a243a0773a1794fba7252e15e4e40f4f3"
 
 	app, _, err := tests.CreateApp(svc)
 	assert.NoError(t, err)
@@ -449,7 +455,7 @@ func TestSendPaymentSync_SelfPayment_IsolatedAppToSelf(t *testing.T) {
 	})
 
 	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
-	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockInvoice, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockInvoice, nil, svc.LNClient, &app.ID, &dbRequestEvent.ID, SendPaymentOptions{})
 
 	assert.NoError(t, err)
 	assert.Equal(t, uint64(123000), transaction.AmountMsat)
@@ -460,7 +466,7 @@ func TestSendPaymentSync_SelfPayment_IsolatedAppToSelf(t *testing.T) {
 	assert.True(t, transaction.SelfPayment)
 
 	transactionType := constants.TRANSACTION_TYPE_INCOMING
-	incomingTransaction, err := transactionsService.LookupTransaction(ctx, tests.MockPaymentHash, &transactionType, svc.LNClient, nil)
+	incomingTransaction, err := transactionsService.LookupTransaction(ctx, tests.MockPaymentHash, &transactionType, svc.LNClient, nil, false)
 	assert.NoError(t, err)
 	assert.Equal(t, uint64(123000), incomingTransaction.AmountMsat)
 	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, incomingTransaction.State)
@@ -475,3 +481,368 @@ func TestSendPaymentSync_SelfPayment_IsolatedAppToSelf(t *testing.T) {
 	// expect balance to be unchanged
 	assert.Equal(t, uint64(133000), queries.GetIsolatedBalance(svc.DB, app.ID))
 }
+
+func TestSendPaymentSync_SelfPayment_NoPreimage(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	// pubkey matches mock invoice = self payment
+	svc.LNClient.(*tests.MockLn).Pubkey = "02ff7c3da0679c37c2914a1f392a88a01a243a0773a1794fba7252e15e4e40f4f3"
+
+	// the backend did not return a preimage when the invoice was created,
+	// but can return it when the invoice is looked up
+	mockPreimage := "123preimage"
+	svc.LNClient.(*tests.MockLn).MockTransaction = &lnclient.Transaction{
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		Invoice:     tests.MockInvoice,
+		PaymentHash: tests.MockPaymentHash,
+		Preimage:    mockPreimage,
+		Amount:      123000,
+	}
+
+	svc.DB.Create(&db.Transaction{
+		State:          constants.TRANSACTION_STATE_PENDING,
+		Type:           constants.TRANSACTION_TYPE_INCOMING,
+		PaymentRequest: tests.MockInvoice,
+		PaymentHash:    tests.MockPaymentHash,
+		AmountMsat:     123000,
+	})
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockInvoice, nil, svc.LNClient, nil, nil, SendPaymentOptions{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transaction.State)
+	assert.Equal(t, mockPreimage, *transaction.Preimage)
+	assert.True(t, transaction.SelfPayment)
+
+	transactionType := constants.TRANSACTION_TYPE_INCOMING
+	incomingTransaction, err := transactionsService.LookupTransaction(ctx, tests.MockPaymentHash, &transactionType, svc.LNClient, nil, false)
+	assert.NoError(t, err)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, incomingTransaction.State)
+	assert.Equal(t, mockPreimage, *incomingTransaction.Preimage)
+}
+
+func TestSendPaymentSync_SelfPayment_NoPreimageFromBackend(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	// pubkey matches mock invoice = self payment
+	svc.LNClient.(*tests.MockLn).Pubkey = "02ff7c3da0679c37c2914a1f392a88a01a243a0773a1794fba7252e15e4e40f4f3"
+	svc.LNClient.(*tests.MockLn).MockTransaction = &lnclient.Transaction{
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		Invoice:     tests.MockInvoice,
+		PaymentHash: tests.MockPaymentHash,
+		Amount:      123000,
+	}
+
+	svc.DB.Create(&db.Transaction{
+		State:          constants.TRANSACTION_STATE_PENDING,
+		Type:           constants.TRANSACTION_TYPE_INCOMING,
+		PaymentRequest: tests.MockInvoice,
+		PaymentHash:    tests.MockPaymentHash,
+		AmountMsat:     123000,
+	})
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockInvoice, nil, svc.LNClient, nil, nil, SendPaymentOptions{})
+
+	assert.ErrorIs(t, err, NewSelfPaymentPreimageNotSetError())
+	assert.Equal(t, "preimage is not set on transaction. Self payments not supported", err.Error())
+	assert.Nil(t, transaction)
+}
+
+func TestSendPaymentSync_SelfPayment_NoMatchingInvoice(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	// pubkey matches mock invoice = self payment
+	svc.LNClient.(*tests.MockLn).Pubkey = "02ff7c3da0679c37c2914a1f392a88a01a243a0773a1794fba7252e15e4e40f4f3"
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockInvoice, nil, svc.LNClient, nil, nil, SendPaymentOptions{})
+
+	assert.ErrorIs(t, err, NewSelfPaymentInvoiceNotFoundError())
+	assert.Nil(t, transaction)
+}
+
+func TestSendPaymentSync_SelfPayment_InvoiceExpired(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	// pubkey matches mock invoice = self payment
+	svc.LNClient.(*tests.MockLn).Pubkey = "02ff7c3da0679c37c2914a1f392a88a01a243a0773a1794fba7252e15e4e40f4f3"
+
+	mockPreimage := "123preimage"
+	expiresAt := time.Now().Add(-time.Minute)
+	svc.DB.Create(&db.Transaction{
+		State:          constants.TRANSACTION_STATE_PENDING,
+		Type:           constants.TRANSACTION_TYPE_INCOMING,
+		PaymentRequest: tests.MockInvoice,
+		PaymentHash:    tests.MockPaymentHash,
+		Preimage:       &mockPreimage,
+		AmountMsat:     123000,
+		ExpiresAt:      &expiresAt,
+	})
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockInvoice, nil, svc.LNClient, nil, nil, SendPaymentOptions{})
+
+	assert.ErrorIs(t, err, NewSelfPaymentInvoiceExpiredError())
+	assert.Nil(t, transaction)
+
+	var incomingTransaction db.Transaction
+	svc.DB.First(&incomingTransaction, &db.Transaction{PaymentHash: tests.MockPaymentHash, Type: constants.TRANSACTION_TYPE_INCOMING})
+	assert.Equal(t, constants.TRANSACTION_STATE_PENDING, incomingTransaction.State)
+}
+
+func TestSendPaymentSync_SelfPayment_AlreadySettled(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	// pubkey matches mock invoice = self payment
+	svc.LNClient.(*tests.MockLn).Pubkey = "02ff7c3da0679c37c2914a1f392a88a01a243a0773a1794fba7252e15e4e40f4f3"
+
+	mockPreimage := "123preimage"
+	svc.DB.Create(&db.Transaction{
+		State:          constants.TRANSACTION_STATE_SETTLED,
+		Type:           constants.TRANSACTION_TYPE_INCOMING,
+		PaymentRequest: tests.MockInvoice,
+		PaymentHash:    tests.MockPaymentHash,
+		Preimage:       &mockPreimage,
+		AmountMsat:     123000,
+	})
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockInvoice, nil, svc.LNClient, nil, nil, SendPaymentOptions{})
+
+	assert.ErrorIs(t, err, NewSelfPaymentAlreadySettledError())
+	assert.Nil(t, transaction)
+}
+
+func TestSendPaymentSync_SelfPayment_Loop(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	appA, appB, transactionsService := setupSelfPaymentLoop(t, svc)
+	appB.MaxSelfPaymentDepth = 1
+	svc.DB.Save(&appB)
+
+	// hop 1: app A pays app B
+	svc.LNClient.(*tests.MockLn).Pubkey = "02ff7c3da0679c37c2914a1f392a88a01a243a0773a1794fba7252e15e4e40f4f3"
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockInvoice, nil, svc.LNClient, &appA.ID, nil, SendPaymentOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transaction.State)
+
+	// hop 2: app B automatically forwards the payment back to app A
+	forwardMetadata := getReceivedMetadata(t, svc, tests.MockPaymentHash)
+	assert.Equal(t, float64(1), forwardMetadata[constants.SELF_PAYMENT_DEPTH_METADATA_KEY])
+
+	svc.LNClient.(*tests.MockLn).Pubkey = "02c7ae891112df2b233dd9bc38df676bbaddf75bd85789b4dc32405871e3519fc2"
+	transaction, err = transactionsService.SendPaymentSync(ctx, tests.MockInvoiceWithoutDescription, forwardMetadata, svc.LNClient, &appB.ID, nil, SendPaymentOptions{})
+	assert.ErrorIs(t, err, NewSelfPaymentLoopError())
+	assert.Nil(t, transaction)
+
+	// app A's invoice was not paid
+	var incomingTransaction db.Transaction
+	svc.DB.First(&incomingTransaction, &db.Transaction{PaymentHash: tests.MockPaymentHashWithoutDescription, Type: constants.TRANSACTION_TYPE_INCOMING})
+	assert.Equal(t, constants.TRANSACTION_STATE_PENDING, incomingTransaction.State)
+}
+
+func TestSendPaymentSync_SelfPayment_LoopWithinDefaultDepth(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	appA, appB, transactionsService := setupSelfPaymentLoop(t, svc)
+
+	svc.LNClient.(*tests.MockLn).Pubkey = "02ff7c3da0679c37c2914a1f392a88a01a243a0773a1794fba7252e15e4e40f4f3"
+	_, err = transactionsService.SendPaymentSync(ctx, tests.MockInvoice, nil, svc.LNClient, &appA.ID, nil, SendPaymentOptions{})
+	assert.NoError(t, err)
+
+	forwardMetadata := getReceivedMetadata(t, svc, tests.MockPaymentHash)
+	svc.LNClient.(*tests.MockLn).Pubkey = "02c7ae891112df2b233dd9bc38df676bbaddf75bd85789b4dc32405871e3519fc2"
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockInvoiceWithoutDescription, forwardMetadata, svc.LNClient, &appB.ID, nil, SendPaymentOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transaction.State)
+
+	receivedMetadata := getReceivedMetadata(t, svc, tests.MockPaymentHashWithoutDescription)
+	assert.Equal(t, float64(2), receivedMetadata[constants.SELF_PAYMENT_DEPTH_METADATA_KEY])
+}
+
+func setupSelfPaymentLoop(t *testing.T, svc *tests.TestService) (*db.App, *db.App, *transactionsService) {
+	appA, _, err := tests.CreateApp(svc)
+	assert.NoError(t, err)
+	appB, _, err := tests.CreateApp(svc)
+	assert.NoError(t, err)
+
+	for _, app := range []*db.App{appA, appB} {
+		err = svc.DB.Create(&db.AppPermission{
+			AppId: app.ID,
+			App:   *app,
+			Scope: constants.PAY_INVOICE_SCOPE,
+		}).Error
+		assert.NoError(t, err)
+	}
+
+	// invoice created by app B
+	mockPreimage := "123preimage"
+	svc.DB.Create(&db.Transaction{
+		AppId:          &appB.ID,
+		State:          constants.TRANSACTION_STATE_PENDING,
+		Type:           constants.TRANSACTION_TYPE_INCOMING,
+		PaymentRequest: tests.MockInvoice,
+		PaymentHash:    tests.MockPaymentHash,
+		Preimage:       &mockPreimage,
+		AmountMsat:     123000,
+	})
+	// invoice created by app A
+	svc.DB.Create(&db.Transaction{
+		AppId:          &appA.ID,
+		State:          constants.TRANSACTION_STATE_PENDING,
+		Type:           constants.TRANSACTION_TYPE_INCOMING,
+		PaymentRequest: tests.MockInvoiceWithoutDescription,
+		PaymentHash:    tests.MockPaymentHashWithoutDescription,
+		Preimage:       &mockPreimage,
+		AmountMsat:     123000,
+	})
+
+	return appA, appB, NewTransactionsService(svc.DB, svc.EventPublisher)
+}
+
+func getReceivedMetadata(t *testing.T, svc *tests.TestService, paymentHash string) map[string]interface{} {
+	var incomingTransaction db.Transaction
+	result := svc.DB.First(&incomingTransaction, &db.Transaction{PaymentHash: paymentHash, Type: constants.TRANSACTION_TYPE_INCOMING})
+	assert.NoError(t, result.Error)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, incomingTransaction.State)
+
+	metadata := map[string]interface{}{}
+	err := json.Unmarshal(incomingTransaction.Metadata, &metadata)
+	assert.NoError(t, err)
+	return metadata
+}
+
+func TestSendPaymentSync_SelfPayment_EventOrder(t *testing.T) {
+	for _, tc := range []struct {
+		order          SelfPaymentEventOrder
+		expectedEvents []string
+	}{
+		{SelfPaymentEventOrderIncomingFirst, []string{"nwc_payment_received", "nwc_payment_sent"}},
+		{SelfPaymentEventOrderOutgoingFirst, []string{"nwc_payment_sent", "nwc_payment_received"}},
+	} {
+		t.Run(string(tc.order), func(t *testing.T) {
+			ctx := context.TODO()
+
+			defer tests.RemoveTestService()
+			svc, err := tests.CreateTestService()
+			require.NoError(t, err)
+
+			// pubkey matches mock invoice = self payment
+			svc.LNClient.(*tests.MockLn).Pubkey = "02ff7c3da0679c37c2914a1f392a88a01a243a0773a1794fba7252e15e4e40f4f3"
+
+			mockPreimage := "123preimage"
+			svc.DB.Create(&db.Transaction{
+				State:          constants.TRANSACTION_STATE_PENDING,
+				Type:           constants.TRANSACTION_TYPE_INCOMING,
+				PaymentRequest: tests.MockInvoice,
+				PaymentHash:    tests.MockPaymentHash,
+				Preimage:       &mockPreimage,
+				AmountMsat:     123000,
+			})
+
+			mockEventConsumer := tests.NewMockEventConsumer()
+			svc.EventPublisher.RegisterSubscriber(mockEventConsumer)
+
+			transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+			transactionsService.SetSelfPaymentEventOrder(tc.order)
+			transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockInvoice, nil, svc.LNClient, nil, nil, SendPaymentOptions{})
+			require.NoError(t, err)
+
+			paymentEvents := getEventsExcept(mockEventConsumer.GetConsumedEvents(), "nwc_balance_changed")
+			require.Equal(t, 2, len(paymentEvents))
+			assert.Equal(t, tc.expectedEvents, []string{paymentEvents[0].Event, paymentEvents[1].Event})
+
+			for _, event := range paymentEvents {
+				eventTransaction := event.Properties.(*db.Transaction)
+				assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, eventTransaction.State)
+				if event.Event == "nwc_payment_sent" {
+					assert.Equal(t, transaction.ID, eventTransaction.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestLookupTransaction_SelfPayment_NoType(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	// pubkey matches mock invoice = self payment
+	svc.LNClient.(*tests.MockLn).Pubkey = "02ff7c3da0679c37c2914a1f392a88a01a243a0773a1794fba7252e15e4e40f4f3"
+
+	app, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+
+	mockPreimage := "123preimage"
+	svc.DB.Create(&db.Transaction{
+		State:          constants.TRANSACTION_STATE_PENDING,
+		Type:           constants.TRANSACTION_TYPE_INCOMING,
+		PaymentRequest: tests.MockInvoice,
+		PaymentHash:    tests.MockPaymentHash,
+		Preimage:       &mockPreimage,
+		AmountMsat:     123000,
+		AppId:          &app.ID,
+	})
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	outgoingTransaction, err := transactionsService.SendPaymentSync(ctx, tests.MockInvoice, nil, svc.LNClient, nil, nil, SendPaymentOptions{})
+	require.NoError(t, err)
+
+	// the direction is preferred regardless of which side settled last
+	err = svc.DB.Model(&db.Transaction{}).
+		Where("type = ? AND payment_hash = ?", constants.TRANSACTION_TYPE_INCOMING, tests.MockPaymentHash).
+		Update("settled_at", time.Now().Add(time.Minute)).Error
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		transaction, err := transactionsService.LookupTransaction(ctx, tests.MockPaymentHash, nil, svc.LNClient, nil, false)
+		require.NoError(t, err)
+		assert.Equal(t, outgoingTransaction.ID, transaction.ID)
+		assert.Equal(t, constants.TRANSACTION_TYPE_OUTGOING, transaction.Type)
+	}
+
+	// the recipient app gets its own side of the payment
+	transaction, err := transactionsService.LookupTransaction(ctx, tests.MockPaymentHash, nil, svc.LNClient, &app.ID, false)
+	require.NoError(t, err)
+	assert.Equal(t, constants.TRANSACTION_TYPE_INCOMING, transaction.Type)
+	assert.Equal(t, app.ID, *transaction.AppId)
+
+	// a requested type is always returned
+	transactionType := constants.TRANSACTION_TYPE_INCOMING
+	transaction, err = transactionsService.LookupTransaction(ctx, tests.MockPaymentHash, &transactionType, svc.LNClient, nil, false)
+	require.NoError(t, err)
+	assert.Equal(t, constants.TRANSACTION_TYPE_INCOMING, transaction.Type)
+}
@@ -0,0 +1,96 @@
+package transactions
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetSettlementLatencyStats(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	settledAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+	createSettled := func(transactionType string, latency time.Duration, paymentRequest string, selfPayment bool) {
+		transactionSettledAt := settledAt
+		svc.DB.Create(&db.Transaction{
+			Type:           transactionType,
+			State:          constants.TRANSACTION_STATE_SETTLED,
+			PaymentRequest: paymentRequest,
+			AmountMsat:     1000,
+			SelfPayment:    selfPayment,
+			CreatedAt:      settledAt.Add(-latency),
+			SettledAt:      &transactionSettledAt,
+		})
+	}
+
+	for i := 1; i <= 10; i++ {
+		createSettled(constants.TRANSACTION_TYPE_OUTGOING, time.Duration(i)*time.Second, tests.MockInvoice, false)
+	}
+	createSettled(constants.TRANSACTION_TYPE_INCOMING, 6*time.Second, tests.MockInvoice, false)
+	createSettled(constants.TRANSACTION_TYPE_INCOMING, 2*time.Second, tests.MockInvoice, false)
+	createSettled(constants.TRANSACTION_TYPE_INCOMING, 4*time.Second, tests.MockInvoice, false)
+
+	// not included
+	createSettled(constants.TRANSACTION_TYPE_OUTGOING, time.Hour, tests.MockInvoice, true)
+	createSettled(constants.TRANSACTION_TYPE_INCOMING, time.Hour, "", false)
+	svc.DB.Create(&db.Transaction{
+		Type:       constants.TRANSACTION_TYPE_OUTGOING,
+		State:      constants.TRANSACTION_STATE_PENDING,
+		AmountMsat: 1000,
+		CreatedAt:  settledAt.Add(-time.Hour),
+	})
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	stats, err := transactionsService.GetSettlementLatencyStats(ctx, 0, 0)
+	assert.NoError(t, err)
+
+	assert.Equal(t, LatencyPercentiles{
+		Count: 10,
+		P50:   5 * time.Second,
+		P90:   9 * time.Second,
+		P99:   10 * time.Second,
+	}, stats.Outgoing)
+	assert.Equal(t, LatencyPercentiles{
+		Count: 3,
+		P50:   4 * time.Second,
+		P90:   6 * time.Second,
+		P99:   6 * time.Second,
+	}, stats.Incoming)
+}
+
+func TestGetSettlementLatencyStats_TimeRange(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	now := time.Now().Truncate(time.Second)
+	for _, settledAt := range []time.Time{now.Add(-2 * time.Hour), now.Add(-30 * time.Minute)} {
+		transactionSettledAt := settledAt
+		svc.DB.Create(&db.Transaction{
+			Type:       constants.TRANSACTION_TYPE_OUTGOING,
+			State:      constants.TRANSACTION_STATE_SETTLED,
+			AmountMsat: 1000,
+			CreatedAt:  settledAt.Add(-30 * time.Second),
+			SettledAt:  &transactionSettledAt,
+		})
+	}
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	stats, err := transactionsService.GetSettlementLatencyStats(ctx, uint64(now.Add(-time.Hour).Unix()), uint64(now.Unix()))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), stats.Outgoing.Count)
+	assert.Equal(t, 30*time.Second, stats.Outgoing.P50)
+	assert.Equal(t, LatencyPercentiles{}, stats.Incoming)
+}
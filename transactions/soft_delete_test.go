@@ -0,0 +1,114 @@
+package transactions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/db/queries"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSoftDeleteTransaction(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	assert.NoError(t, err)
+	app.Isolated = true
+	svc.DB.Save(&app)
+
+	transaction := &db.Transaction{
+		AppId:       &app.ID,
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		PaymentHash: "hash1",
+		AmountMsat:  1000,
+	}
+	svc.DB.Create(transaction)
+	svc.DB.Create(&db.Transaction{
+		AppId:       &app.ID,
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		PaymentHash: "hash2",
+		AmountMsat:  2000,
+	})
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	err = transactionsService.SoftDeleteTransaction(ctx, transaction.ID)
+	assert.NoError(t, err)
+
+	transactions, err := transactionsService.ListTransactions(ctx, 0, 0, 0, 0, false, false, nil, svc.LNClient, &app.ID, false, ListTransactionsFilter{})
+	assert.NoError(t, err)
+	require.Equal(t, 1, len(transactions))
+	assert.Equal(t, "hash2", transactions[0].PaymentHash)
+
+	transactions, err = transactionsService.ListTransactions(ctx, 0, 0, 0, 0, false, false, nil, svc.LNClient, &app.ID, false, ListTransactionsFilter{IncludeDeleted: true})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(transactions))
+
+	// hidden transactions still count towards the balance and can be looked up directly
+	assert.Equal(t, uint64(3000), queries.GetIsolatedBalance(svc.DB, app.ID))
+	lookedUpTransaction, err := transactionsService.LookupTransaction(ctx, "hash1", nil, svc.LNClient, &app.ID, false)
+	assert.NoError(t, err)
+	assert.Equal(t, transaction.ID, lookedUpTransaction.ID)
+
+	err = transactionsService.RestoreTransaction(ctx, transaction.ID)
+	assert.NoError(t, err)
+
+	transactions, err = transactionsService.ListTransactions(ctx, 0, 0, 0, 0, false, false, nil, svc.LNClient, &app.ID, false, ListTransactionsFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(transactions))
+
+	// already restored
+	err = transactionsService.RestoreTransaction(ctx, transaction.ID)
+	assert.ErrorIs(t, err, NewNotFoundError())
+}
+
+func TestSoftDeleteTransaction_Pending(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transaction := &db.Transaction{
+		State:       constants.TRANSACTION_STATE_PENDING,
+		Type:        constants.TRANSACTION_TYPE_OUTGOING,
+		PaymentHash: "hash1",
+		AmountMsat:  1000,
+	}
+	svc.DB.Create(transaction)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	err = transactionsService.SoftDeleteTransaction(ctx, transaction.ID)
+	assert.EqualError(t, err, "pending transactions cannot be deleted")
+
+	err = transactionsService.SoftDeleteTransaction(ctx, transaction.ID+1)
+	assert.ErrorIs(t, err, NewNotFoundError())
+}
+
+func TestSoftDeleteTransaction_StillPreventsDuplicatePayment(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transaction, err := transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, nil, nil, SendPaymentOptions{})
+	require.NoError(t, err)
+
+	err = transactionsService.SoftDeleteTransaction(ctx, transaction.ID)
+	assert.NoError(t, err)
+
+	transaction, err = transactionsService.SendPaymentSync(ctx, tests.MockLNClientTransaction.Invoice, nil, svc.LNClient, nil, nil, SendPaymentOptions{})
+	assert.EqualError(t, err, "this invoice has already been paid")
+	assert.Nil(t, transaction)
+}
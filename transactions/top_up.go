@@ -0,0 +1,44 @@
+package transactions
+
+import (
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/db/queries"
+	"github.com/getAlby/hub/logger"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// TopUpCallback tops up an isolated app's balance by at least shortfallMsat,
+// e.g. with an internal transfer from a funding app.
+// It runs in the same database transaction as the payment being validated,
+// so any transactions it creates are rolled back if the payment is not made.
+// It must be idempotent, as it is called again for every payment that falls short.
+type TopUpCallback func(tx *gorm.DB, app *db.App, shortfallMsat uint64) error
+
+// SetTopUpCallback sets the callback used to automatically top up isolated apps
+// with insufficient balance for a payment. A nil callback disables automatic top-ups.
+func (svc *transactionsService) SetTopUpCallback(topUpCallback TopUpCallback) {
+	svc.topUpCallback = topUpCallback
+}
+
+// topUpIsolatedBalance invokes the top-up callback once and returns the app's new balance.
+// The callback is only tried once per payment so a callback that never tops up enough
+// cannot cause a loop. Budgets are spending limits so they are never topped up.
+func (svc *transactionsService) topUpIsolatedBalance(tx *gorm.DB, app *db.App, shortfallMsat uint64, balance uint64) uint64 {
+	err := svc.topUpCallback(tx, app, shortfallMsat)
+	if err != nil {
+		logger.Logger.WithFields(logrus.Fields{
+			"app_id":         app.ID,
+			"shortfall_msat": shortfallMsat,
+		}).WithError(err).Error("Failed to top up isolated app balance")
+		return balance
+	}
+
+	newBalance := queries.GetIsolatedBalance(tx, app.ID)
+	logger.Logger.WithFields(logrus.Fields{
+		"app_id":         app.ID,
+		"shortfall_msat": shortfallMsat,
+		"balance_msat":   newBalance,
+	}).Info("Topped up isolated app balance")
+	return newBalance
+}
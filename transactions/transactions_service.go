@@ -1,6 +1,7 @@
 package transactions
 
 import (
+	"cmp"
 	"context"
 	"crypto/rand"
 	"crypto/sha256"
@@ -8,12 +9,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
 	"math"
 	"slices"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/getAlby/hub/config"
 	"github.com/getAlby/hub/constants"
 	"github.com/getAlby/hub/db"
 	"github.com/getAlby/hub/db/queries"
@@ -27,19 +30,105 @@ import (
 )
 
 type transactionsService struct {
-	db             *gorm.DB
-	eventPublisher events.EventPublisher
+	db                           *gorm.DB
+	eventPublisher               events.EventPublisher
+	descriptionExtractors        []descriptionExtractorRegistration
+	appIdResolvers               []AppIdResolver
+	topUpCallback                TopUpCallback
+	listTransactionsCache        *listTransactionsCache
+	selfPaymentEventOrder        SelfPaymentEventOrder
+	priceSource                  PriceSource
+	bitcoinPriceCache            *bitcoinPriceCache
+	nodeNetworkCache             *nodeNetworkCache
+	dynamicFeeReserve            bool
+	selfPaymentDetectionDisabled bool
+	nodeBalanceReserveMsat       uint64
+	anomalousAmountCheck         bool
+	nodeReadyCheck               bool
+	maxKeysendCustomRecords      int
+	maxKeysendCustomRecordsSize  int
+	feeReserveRounding           FeeReserveRounding
+	amountlessInvoiceExpiry      uint64
+	fixedAmountInvoiceExpiry     uint64
+	budgetGraceMsat              uint64
+	unknownPaymentPolicy         UnknownPaymentPolicy
 }
 
 type TransactionsService interface {
 	events.EventSubscriber
-	MakeInvoice(ctx context.Context, amount uint64, description string, descriptionHash string, expiry uint64, metadata map[string]interface{}, lnClient lnclient.LNClient, appId *uint, requestEventId *uint) (*Transaction, error)
-	LookupTransaction(ctx context.Context, paymentHash string, transactionType *string, lnClient lnclient.LNClient, appId *uint) (*Transaction, error)
-	ListTransactions(ctx context.Context, from, until, limit, offset uint64, unpaidOutgoing bool, unpaidIncoming bool, transactionType *string, lnClient lnclient.LNClient, appId *uint, forceFilterByAppId bool) (transactions []Transaction, err error)
-	SendPaymentSync(ctx context.Context, payReq string, metadata map[string]interface{}, lnClient lnclient.LNClient, appId *uint, requestEventId *uint) (*Transaction, error)
-	SendKeysend(ctx context.Context, amount uint64, destination string, customRecords []lnclient.TLVRecord, preimage string, lnClient lnclient.LNClient, appId *uint, requestEventId *uint) (*Transaction, error)
+	MakeInvoice(ctx context.Context, amount uint64, description string, descriptionHash string, expiry uint64, metadata map[string]interface{}, lnClient lnclient.LNClient, appId *uint, requestEventId *uint, notifyUrl string) (*Transaction, error)
+	LookupTransaction(ctx context.Context, paymentHash string, transactionType *string, lnClient lnclient.LNClient, appId *uint, verifyIntegrity bool) (*Transaction, error)
+	LookupTransactionByPreimage(ctx context.Context, preimage string, appId *uint) (*Transaction, error)
+	GetPaymentAttempts(ctx context.Context, paymentHash string, appId *uint) ([]Transaction, error)
+	ListActivity(ctx context.Context, limit uint64, appId *uint) ([]ActivityItem, error)
+	GenerateReceipt(ctx context.Context, id uint, appId *uint, format string) ([]byte, error)
+	ClaimOrphanTransaction(ctx context.Context, paymentHash string, appId uint) error
+	ListTransactions(ctx context.Context, from, until, limit, offset uint64, unpaidOutgoing bool, unpaidIncoming bool, transactionType *string, lnClient lnclient.LNClient, appId *uint, forceFilterByAppId bool, filter ListTransactionsFilter) (transactions []Transaction, err error)
+	ListTransactionsWithBoostagrams(ctx context.Context, from, until, limit, offset uint64, unpaidOutgoing bool, unpaidIncoming bool, transactionType *string, lnClient lnclient.LNClient, appId *uint, forceFilterByAppId bool) ([]TransactionWithBoostagram, error)
+	ListTopBoostagrams(ctx context.Context, from, until uint64, limit int) ([]TransactionWithBoostagram, error)
+	GetBoostagramStats(ctx context.Context, feedId string, from, until uint64) (*BoostStats, error)
+	ListBoostSessions(ctx context.Context, appId *uint, from, until uint64) ([]BoostSession, error)
+	SearchTransactions(ctx context.Context, query SearchQuery, appId *uint) ([]Transaction, uint64, error)
+	ListTransactionsSince(ctx context.Context, cursor SyncCursor, limit uint64, appId *uint) ([]Transaction, error)
+	ListActiveInvoices(ctx context.Context, appId *uint) ([]Transaction, error)
+	GetNextExpiringInvoice(ctx context.Context, appId *uint) (*Transaction, error)
+	SendPaymentSync(ctx context.Context, payReq string, metadata map[string]interface{}, lnClient lnclient.LNClient, appId *uint, requestEventId *uint, options SendPaymentOptions) (*Transaction, error)
+	ExtendInvoiceExpiry(ctx context.Context, paymentHash string, newExpiry uint64, lnClient lnclient.LNClient, appId *uint) (*Transaction, error)
+	GetFeeReserve(amountMsat uint64, payee string, appId *uint, lnClient lnclient.LNClient) uint64
+	GetPayeeReliability(ctx context.Context, payee string, excludeTestTransactions bool) (*ReliabilityStat, error)
+	GetSettlementLatencyStats(ctx context.Context, from, until uint64) (*SettlementLatencyStats, error)
+	GetPendingDurationStats(ctx context.Context, from, until uint64) (*PendingDurationStats, error)
+	ListPendingBudgetReservations(ctx context.Context, appId uint) ([]Transaction, error)
+	SendKeysend(ctx context.Context, amount uint64, destination string, customRecords []lnclient.TLVRecord, preimage string, sessionId string, lnClient lnclient.LNClient, appId *uint, requestEventId *uint) (*Transaction, error)
+	RegisterDescriptionExtractor(tlvType uint64, priority int, extract DescriptionExtractor)
+	RegisterAppIdResolver(resolve AppIdResolver)
+	SoftDeleteTransaction(ctx context.Context, id uint) error
+	SetInvoiceSplitRule(ctx context.Context, paymentHash string, splitRule []SplitRuleShare) error
+	SetTopUpCallback(topUpCallback TopUpCallback)
+	SetListTransactionsCacheTTL(ttl time.Duration)
+	SetSelfPaymentEventOrder(order SelfPaymentEventOrder)
+	SetSelfPaymentDetection(enabled bool)
+	SetPriceSource(priceSource PriceSource)
+	SetDynamicFeeReserve(enabled bool)
+	SetFeeReserveRounding(rounding FeeReserveRounding)
+	SetDefaultInvoiceExpiry(amountlessExpiry uint64, fixedAmountExpiry uint64)
+	SetBudgetGrace(graceMsat uint64)
+	SetUnknownPaymentPolicy(policy UnknownPaymentPolicy)
+	ApproveQuarantinedPayment(ctx context.Context, id uint) (*Transaction, error)
+	SendPaymentBatch(ctx context.Context, payReqs []string, mode BatchMode, lnClient lnclient.LNClient, appId *uint, requestEventId *uint, progress BatchProgressCallback) ([]BatchPaymentResult, error)
+	RestoreTransaction(ctx context.Context, id uint) error
+	ForceFailPayment(ctx context.Context, id uint, reason string, lnClient lnclient.LNClient) error
+	FinalizeKeysendAggregate(ctx context.Context, appId uint, destination string) (*Transaction, error)
+	CreatePaymentIntent(ctx context.Context, appId uint, amountMsat uint64, toleranceMsat uint64, allowedDestinations []string, expiry uint64) (*PaymentIntent, error)
+	FulfillPaymentIntent(ctx context.Context, id uint, payReq string, lnClient lnclient.LNClient, appId uint) (*Transaction, error)
+	SetNodeBalanceReserve(reserveMsat uint64)
+	SetAnomalousAmountCheck(enabled bool)
+	SetNodeReadyCheck(enabled bool)
+	SetKeysendCustomRecordLimits(maxCount int, maxSize int)
+	GetMaxPayableAmount(ctx context.Context, appId uint, lnClient lnclient.LNClient) (uint64, error)
+	ReconcileAgainstBackend(ctx context.Context, lnClient lnclient.LNClient) (*ReconcileReport, error)
+	AddTransactionAttestation(ctx context.Context, id uint, appId uint, pubkey string, content string, signature string) (*Transaction, error)
+	PinTransaction(ctx context.Context, id uint, appId *uint) error
+	UnpinTransaction(ctx context.Context, id uint, appId *uint) error
+	PauseApp(ctx context.Context, appId uint) error
+	ResumeApp(ctx context.Context, appId uint) error
 }
 
+// JSON columns that can be left out when listing transactions
+var largeTransactionColumns = []string{"metadata", "boostagram", "decoded_invoice"}
+
+// how long after expiry an invoice can still be extended
+const invoiceExpiryExtensionGracePeriod = 10 * time.Minute
+
+// how long after expiry an invoice is still attempted to be paid, to allow for clock differences with the payee
+const invoiceExpiryPaymentGracePeriod = 30 * time.Second
+
+// how long pending transactions are checked for, unless the invoice's min final CLTV expiry is longer
+const unsettledTransactionCheckWindow = 24 * time.Hour
+
+// average time between blocks, used to estimate how long a CLTV expiry delta lasts
+const averageBlockInterval = 10 * time.Minute
+
 const (
 	BoostagramTlvType = 7629169
 	WhatsatTlvType    = 34349334
@@ -48,6 +137,72 @@ const (
 
 type Transaction = db.Transaction
 
+type PaymentIntent = db.PaymentIntent
+
+type ReliabilityStat struct {
+	Payee        string
+	SettledCount uint64
+	FailedCount  uint64
+	// settled / (settled + failed), 0 if no payments have completed
+	SuccessRate float64
+}
+
+type LatencyPercentiles struct {
+	Count uint64
+	P50   time.Duration
+	P90   time.Duration
+	P99   time.Duration
+}
+
+type SettlementLatencyStats struct {
+	Incoming LatencyPercentiles
+	Outgoing LatencyPercentiles
+}
+
+// SendPaymentOptions are the optional settings of a payment made with SendPaymentSync
+type SendPaymentOptions struct {
+	// the caller's reference for the payment, which must be unique (see NewExternalRefConflictError)
+	ExternalRef string
+	// pay amounts above the large payment threshold without asking for confirmation
+	ConfirmLargeAmount bool
+	// the channel to send the payment through, if not chosen by the node
+	OutgoingChannelId string
+	// the payment intent fulfilled by the payment. Its reservation is released and the intent
+	// linked to the payment in the same database transaction that records the payment
+	paymentIntentId *uint
+}
+
+// ListTransactionsFilter narrows down the transactions returned by ListTransactions.
+// The zero value applies no further filters.
+type ListTransactionsFilter struct {
+	// leave out metadata, boostagrams and other large fields, for list views that do not show them
+	OmitLargeFields bool
+	Environment     *string
+	// include soft-deleted transactions
+	IncludeDeleted bool
+	// only outgoing payments of this kind (see constants.TRANSACTION_PAYMENT_KIND_*)
+	PaymentKind *string
+	PinnedOnly  bool
+	// only incoming payments of this kind (see GetIncomingKind)
+	IncomingKind *string
+	BoostsOnly   bool
+}
+
+type SearchQuery struct {
+	// matches the description, payment hash or invoice
+	Text          string
+	MinAmountMsat uint64
+	MaxAmountMsat uint64
+	From          uint64
+	Until         uint64
+	Type          *string
+	State         *string
+	// only transactions requested through this NWC relay
+	RelayUrl *string
+	Limit    uint64
+	Offset   uint64
+}
+
 type Boostagram struct {
 	AppName        string         `json:"app_name"`
 	Name           string         `json:"name"`
@@ -100,36 +255,683 @@ func (err *notFoundError) Error() string {
 	return "The transaction requested was not found"
 }
 
+// permissionDeniedApp identifies the app a payment was denied for, if any
+type permissionDeniedApp struct {
+	appId   *uint
+	appName string
+}
+
+func newPermissionDeniedApp(app *db.App) permissionDeniedApp {
+	return permissionDeniedApp{
+		appId:   &app.ID,
+		appName: app.Name,
+	}
+}
+
 type insufficientBalanceError struct {
+	permissionDeniedApp
 }
 
 func NewInsufficientBalanceError() error {
 	return &insufficientBalanceError{}
 }
 
+func newInsufficientBalanceErrorForApp(app *db.App) error {
+	return &insufficientBalanceError{
+		permissionDeniedApp: newPermissionDeniedApp(app),
+	}
+}
+
 func (err *insufficientBalanceError) Error() string {
 	return "Insufficient balance remaining to make the requested payment"
 }
 
+// Is matches any insufficient balance error, regardless of the app
+func (err *insufficientBalanceError) Is(target error) bool {
+	_, ok := target.(*insufficientBalanceError)
+	return ok
+}
+
 type quotaExceededError struct {
+	permissionDeniedApp
+	requestedMsat uint64
+	remainingMsat uint64
 }
 
 func NewQuotaExceededError() error {
 	return &quotaExceededError{}
 }
 
+func newQuotaExceededErrorWithAmounts(app *db.App, requestedMsat uint64, remainingMsat uint64) error {
+	return &quotaExceededError{
+		permissionDeniedApp: newPermissionDeniedApp(app),
+		requestedMsat:       requestedMsat,
+		remainingMsat:       remainingMsat,
+	}
+}
+
 func (err *quotaExceededError) Error() string {
-	return "Your app does not have enough budget remaining to make this payment. Please review this app in the connections page of your Alby Hub."
+	if err.requestedMsat == 0 {
+		return "Your app does not have enough budget remaining to make this payment. Please review this app in the connections page of your Alby Hub."
+	}
+	return fmt.Sprintf("Your app does not have enough budget remaining to make this payment: requested %s, only %s remaining. Please review this app in the connections page of your Alby Hub.",
+		formatMsat(err.requestedMsat), formatMsat(err.remainingMsat))
 }
 
-func NewTransactionsService(db *gorm.DB, eventPublisher events.EventPublisher) *transactionsService {
-	return &transactionsService{
-		db:             db,
-		eventPublisher: eventPublisher,
+// Is matches any quota exceeded error, regardless of the app and amounts it carries
+func (err *quotaExceededError) Is(target error) bool {
+	_, ok := target.(*quotaExceededError)
+	return ok
+}
+
+// GetPermissionDeniedApp returns the id and name of the app an insufficient balance
+// or quota exceeded error was returned for. ok is false if the error has no app.
+func GetPermissionDeniedApp(err error) (appId uint, appName string, ok bool) {
+	var deniedApp permissionDeniedApp
+	var insufficientBalanceErr *insufficientBalanceError
+	var quotaExceededErr *quotaExceededError
+	switch {
+	case errors.As(err, &insufficientBalanceErr):
+		deniedApp = insufficientBalanceErr.permissionDeniedApp
+	case errors.As(err, &quotaExceededErr):
+		deniedApp = quotaExceededErr.permissionDeniedApp
+	}
+	if deniedApp.appId == nil {
+		return 0, "", false
+	}
+	return *deniedApp.appId, deniedApp.appName, true
+}
+
+// formatMsat formats an amount as sats (with fractional sats where needed) and msats
+func formatMsat(amountMsat uint64) string {
+	return fmt.Sprintf("%s sat (%d msat)", strconv.FormatFloat(float64(amountMsat)/1000, 'f', -1, 64), amountMsat)
+}
+
+type receiveLimitExceededError struct {
+}
+
+func NewReceiveLimitExceededError() error {
+	return &receiveLimitExceededError{}
+}
+
+func (err *receiveLimitExceededError) Error() string {
+	return "The requested amount exceeds the maximum amount this app is allowed to receive in a single invoice. Please review this app in the connections page of your Alby Hub."
+}
+
+type appPausedError struct {
+}
+
+func NewAppPausedError() error {
+	return &appPausedError{}
+}
+
+func (err *appPausedError) Error() string {
+	return "This app is paused and cannot make payments or create invoices. Please review this app in the connections page of your Alby Hub."
+}
+
+type tooManyInFlightPaymentsError struct {
+}
+
+func NewTooManyInFlightPaymentsError() error {
+	return &tooManyInFlightPaymentsError{}
+}
+
+func (err *tooManyInFlightPaymentsError) Error() string {
+	return "This app has too many payments in flight. Please wait for a pending payment to complete and try again."
+}
+
+type priceUnavailableError struct {
+}
+
+func NewPriceUnavailableError() error {
+	return &priceUnavailableError{}
+}
+
+func (err *priceUnavailableError) Error() string {
+	return "No bitcoin price is available to convert this app's fiat budget to sats. Please try again later."
+}
+
+type invoiceRateLimitExceededError struct {
+}
+
+func NewInvoiceRateLimitExceededError() error {
+	return &invoiceRateLimitExceededError{}
+}
+
+func (err *invoiceRateLimitExceededError) Error() string {
+	return "This app has created too many invoices recently. Please try again later."
+}
+
+type externalRefConflictError struct {
+}
+
+func NewExternalRefConflictError() error {
+	return &externalRefConflictError{}
+}
+
+func (err *externalRefConflictError) Error() string {
+	return "A payment with this external reference has already been made"
+}
+
+type invoiceAlreadyPaidError struct {
+	byOtherApp bool
+}
+
+func NewInvoiceAlreadyPaidError() error {
+	return &invoiceAlreadyPaidError{}
+}
+
+func newInvoiceAlreadyPaidErrorForApp(byOtherApp bool) error {
+	return &invoiceAlreadyPaidError{
+		byOtherApp: byOtherApp,
+	}
+}
+
+func (err *invoiceAlreadyPaidError) Error() string {
+	if err.byOtherApp {
+		// the other app is not named, as apps should not learn about each other's payments
+		return "this invoice has already been paid by another app"
+	}
+	return "this invoice has already been paid"
+}
+
+// Is matches any invoice already paid error, whichever app paid it
+func (err *invoiceAlreadyPaidError) Is(target error) bool {
+	_, ok := target.(*invoiceAlreadyPaidError)
+	return ok
+}
+
+type selfPaymentLoopError struct {
+}
+
+func NewSelfPaymentLoopError() error {
+	return &selfPaymentLoopError{}
+}
+
+func (err *selfPaymentLoopError) Error() string {
+	return "This payment exceeds the maximum number of chained internal payments and may be part of a payment loop"
+}
+
+type descriptionRequiredError struct {
+}
+
+func NewDescriptionRequiredError() error {
+	return &descriptionRequiredError{}
+}
+
+func (err *descriptionRequiredError) Error() string {
+	return "This app requires a description or description hash for every invoice"
+}
+
+type selfPaymentInvoiceNotFoundError struct {
+}
+
+func NewSelfPaymentInvoiceNotFoundError() error {
+	return &selfPaymentInvoiceNotFoundError{}
+}
+
+func (err *selfPaymentInvoiceNotFoundError) Error() string {
+	return "No matching invoice was found on this node for the self payment"
+}
+
+type selfPaymentInvoiceExpiredError struct {
+}
+
+func NewSelfPaymentInvoiceExpiredError() error {
+	return &selfPaymentInvoiceExpiredError{}
+}
+
+func (err *selfPaymentInvoiceExpiredError) Error() string {
+	return "The invoice for the self payment has expired"
+}
+
+type selfPaymentAlreadySettledError struct {
+}
+
+func NewSelfPaymentAlreadySettledError() error {
+	return &selfPaymentAlreadySettledError{}
+}
+
+func (err *selfPaymentAlreadySettledError) Error() string {
+	return "The invoice for the self payment has already been paid"
+}
+
+type selfPaymentPreimageNotSetError struct {
+}
+
+func NewSelfPaymentPreimageNotSetError() error {
+	return &selfPaymentPreimageNotSetError{}
+}
+
+func (err *selfPaymentPreimageNotSetError) Error() string {
+	return "preimage is not set on transaction. Self payments not supported"
+}
+
+type descriptionHashInUseError struct {
+}
+
+func NewDescriptionHashInUseError() error {
+	return &descriptionHashInUseError{}
+}
+
+func (err *descriptionHashInUseError) Error() string {
+	return "An open invoice for a different amount already exists with this description hash"
+}
+
+type paymentInFlightError struct {
+}
+
+func NewPaymentInFlightError() error {
+	return &paymentInFlightError{}
+}
+
+func (err *paymentInFlightError) Error() string {
+	return "The payment is still in flight and cannot be marked as failed"
+}
+
+type invalidDestinationError struct {
+}
+
+func NewInvalidDestinationError() error {
+	return &invalidDestinationError{}
+}
+
+func (err *invalidDestinationError) Error() string {
+	return "The destination must be a compressed public key (66 hex characters starting with 02 or 03)"
+}
+
+type customRecordsLimitExceededError struct {
+	reason string
+}
+
+func NewCustomRecordsLimitExceededError() error {
+	return &customRecordsLimitExceededError{}
+}
+
+func newCustomRecordsLimitExceededErrorWithReason(reason string) error {
+	return &customRecordsLimitExceededError{
+		reason: reason,
+	}
+}
+
+func (err *customRecordsLimitExceededError) Error() string {
+	if err.reason == "" {
+		return "The custom records exceed the limit"
+	}
+	return "The custom records exceed the limit: " + err.reason
+}
+
+// Is matches any custom records limit error, regardless of the reason
+func (err *customRecordsLimitExceededError) Is(target error) bool {
+	_, ok := target.(*customRecordsLimitExceededError)
+	return ok
+}
+
+type paymentIntentExpiredError struct {
+}
+
+func NewPaymentIntentExpiredError() error {
+	return &paymentIntentExpiredError{}
+}
+
+func (err *paymentIntentExpiredError) Error() string {
+	return "The payment intent has expired"
+}
+
+type paymentIntentNotOpenError struct {
+}
+
+func NewPaymentIntentNotOpenError() error {
+	return &paymentIntentNotOpenError{}
+}
+
+func (err *paymentIntentNotOpenError) Error() string {
+	return "The payment intent has already been fulfilled"
+}
+
+type paymentIntentMismatchError struct {
+	reason string
+}
+
+func NewPaymentIntentMismatchError() error {
+	return &paymentIntentMismatchError{}
+}
+
+func newPaymentIntentMismatchErrorWithReason(reason string) error {
+	return &paymentIntentMismatchError{
+		reason: reason,
+	}
+}
+
+func (err *paymentIntentMismatchError) Error() string {
+	if err.reason == "" {
+		return "The invoice does not match the payment intent"
+	}
+	return "The invoice does not match the payment intent: " + err.reason
+}
+
+// Is matches any payment intent mismatch error, regardless of the reason
+func (err *paymentIntentMismatchError) Is(target error) bool {
+	_, ok := target.(*paymentIntentMismatchError)
+	return ok
+}
+
+type invoiceExpiredError struct {
+}
+
+func NewInvoiceExpiredError() error {
+	return &invoiceExpiredError{}
+}
+
+func (err *invoiceExpiredError) Error() string {
+	return "The invoice has expired"
+}
+
+type invalidPreimageError struct {
+}
+
+func NewInvalidPreimageError() error {
+	return &invalidPreimageError{}
+}
+
+func (err *invalidPreimageError) Error() string {
+	return "The preimage must be 64 hex characters"
+}
+
+type invalidMetadataError struct {
+	reason string
+}
+
+func NewInvalidMetadataError() error {
+	return &invalidMetadataError{}
+}
+
+func newInvalidMetadataErrorWithReason(reason string) error {
+	return &invalidMetadataError{
+		reason: reason,
+	}
+}
+
+func (err *invalidMetadataError) Error() string {
+	if err.reason == "" {
+		return "The metadata is invalid"
+	}
+	return "The metadata is invalid: " + err.reason
+}
+
+// Is matches any invalid metadata error, regardless of the reason
+func (err *invalidMetadataError) Is(target error) bool {
+	_, ok := target.(*invalidMetadataError)
+	return ok
+}
+
+type invalidNotifyUrlError struct {
+}
+
+func NewInvalidNotifyUrlError() error {
+	return &invalidNotifyUrlError{}
+}
+
+func (err *invalidNotifyUrlError) Error() string {
+	return "The notify URL must be an absolute http or https URL"
+}
+
+type invalidAttestationError struct {
+	reason string
+}
+
+func NewInvalidAttestationError() error {
+	return &invalidAttestationError{}
+}
+
+func newInvalidAttestationErrorWithReason(reason string) error {
+	return &invalidAttestationError{
+		reason: reason,
+	}
+}
+
+func (err *invalidAttestationError) Error() string {
+	if err.reason == "" {
+		return "The attestation is invalid"
+	}
+	return "The attestation is invalid: " + err.reason
+}
+
+// Is matches any invalid attestation error, regardless of the reason
+func (err *invalidAttestationError) Is(target error) bool {
+	_, ok := target.(*invalidAttestationError)
+	return ok
+}
+
+type networkMismatchError struct {
+	invoiceNetwork string
+	nodeNetwork    string
+}
+
+func NewNetworkMismatchError() error {
+	return &networkMismatchError{}
+}
+
+func newNetworkMismatchErrorWithNetworks(invoiceNetwork string, nodeNetwork string) error {
+	return &networkMismatchError{
+		invoiceNetwork: invoiceNetwork,
+		nodeNetwork:    nodeNetwork,
+	}
+}
+
+func (err *networkMismatchError) Error() string {
+	if err.invoiceNetwork == "" {
+		return "The invoice is for a different network than the node"
+	}
+	return fmt.Sprintf("The invoice is for %s but the node is on %s", err.invoiceNetwork, err.nodeNetwork)
+}
+
+// Is matches any network mismatch error, regardless of the networks
+func (err *networkMismatchError) Is(target error) bool {
+	_, ok := target.(*networkMismatchError)
+	return ok
+}
+
+type anomalousAmountWarning struct {
+	amountMsat    uint64
+	p95AmountMsat uint64
+}
+
+func NewAnomalousAmountWarning() error {
+	return &anomalousAmountWarning{}
+}
+
+func newAnomalousAmountWarningWithAmounts(amountMsat uint64, p95AmountMsat uint64) error {
+	return &anomalousAmountWarning{
+		amountMsat:    amountMsat,
+		p95AmountMsat: p95AmountMsat,
+	}
+}
+
+func (err *anomalousAmountWarning) Error() string {
+	if err.amountMsat == 0 {
+		return "The amount is unusually high compared to recent payments"
+	}
+	return fmt.Sprintf("The amount of %d msat is unusually high compared to recent payments (95th percentile: %d msat). Confirm the amount to pay anyway", err.amountMsat, err.p95AmountMsat)
+}
+
+// Is matches any anomalous amount warning, regardless of the amounts
+func (err *anomalousAmountWarning) Is(target error) bool {
+	_, ok := target.(*anomalousAmountWarning)
+	return ok
+}
+
+type nodeNotReadyError struct {
+	reason string
+}
+
+func NewNodeNotReadyError() error {
+	return &nodeNotReadyError{}
+}
+
+func newNodeNotReadyErrorWithReason(reason string) error {
+	return &nodeNotReadyError{
+		reason: reason,
+	}
+}
+
+func (err *nodeNotReadyError) Error() string {
+	if err.reason == "" {
+		return "The node is not ready"
+	}
+	return "The node is not ready: " + err.reason
+}
+
+// Is matches any node not ready error, regardless of the reason
+func (err *nodeNotReadyError) Is(target error) bool {
+	_, ok := target.(*nodeNotReadyError)
+	return ok
+}
+
+type outgoingChannelNotSupportedError struct {
+}
+
+func NewOutgoingChannelNotSupportedError() error {
+	return &outgoingChannelNotSupportedError{}
+}
+
+func (err *outgoingChannelNotSupportedError) Error() string {
+	return "The node backend does not support choosing the outgoing channel"
+}
+
+type invalidOutgoingChannelError struct {
+	reason string
+}
+
+func NewInvalidOutgoingChannelError() error {
+	return &invalidOutgoingChannelError{}
+}
+
+func newInvalidOutgoingChannelErrorWithReason(reason string) error {
+	return &invalidOutgoingChannelError{
+		reason: reason,
+	}
+}
+
+func (err *invalidOutgoingChannelError) Error() string {
+	if err.reason == "" {
+		return "Invalid outgoing channel"
 	}
+	return "Invalid outgoing channel: " + err.reason
+}
+
+// Is matches any invalid outgoing channel error, regardless of the reason
+func (err *invalidOutgoingChannelError) Is(target error) bool {
+	_, ok := target.(*invalidOutgoingChannelError)
+	return ok
+}
+
+type invoiceDecodeError struct {
+	category InvoiceDecodeErrorCategory
+	err      error
+}
+
+func NewInvoiceDecodeError() error {
+	return &invoiceDecodeError{}
+}
+
+func newInvoiceDecodeErrorWithCategory(category InvoiceDecodeErrorCategory, err error) error {
+	return &invoiceDecodeError{
+		category: category,
+		err:      err,
+	}
+}
+
+func (err *invoiceDecodeError) Error() string {
+	message := "Failed to decode invoice"
+	if err.category != "" {
+		message += " (" + string(err.category) + ")"
+	}
+	if err.err != nil {
+		message += ": " + err.err.Error()
+	}
+	return message
+}
+
+func (err *invoiceDecodeError) Unwrap() error {
+	return err.err
+}
+
+// Is matches any invoice decode error, regardless of the category
+func (err *invoiceDecodeError) Is(target error) bool {
+	_, ok := target.(*invoiceDecodeError)
+	return ok
+}
+
+type transactionAlreadyClaimedError struct {
+}
+
+func NewTransactionAlreadyClaimedError() error {
+	return &transactionAlreadyClaimedError{}
+}
+
+func (err *transactionAlreadyClaimedError) Error() string {
+	return "The transaction already belongs to an app"
+}
+
+// noEventPublisher drops all events, so the service can be used for database operations only
+type noEventPublisher struct {
+}
+
+func (publisher *noEventPublisher) RegisterSubscriber(eventListener events.EventSubscriber) {
+}
+
+func (publisher *noEventPublisher) RemoveSubscriber(eventListener events.EventSubscriber) {
 }
 
-func (svc *transactionsService) MakeInvoice(ctx context.Context, amount uint64, description string, descriptionHash string, expiry uint64, metadata map[string]interface{}, lnClient lnclient.LNClient, appId *uint, requestEventId *uint) (*Transaction, error) {
+func (publisher *noEventPublisher) Publish(event *events.Event) {
+}
+
+func (publisher *noEventPublisher) PublishSync(event *events.Event) {
+}
+
+func (publisher *noEventPublisher) SetGlobalProperty(key string, value interface{}) {
+}
+
+// NewTransactionsService creates the transactions service. Without an event publisher
+// no events are published, e.g. when embedding the service for database operations only.
+func NewTransactionsService(db *gorm.DB, eventPublisher events.EventPublisher) *transactionsService {
+	if eventPublisher == nil {
+		eventPublisher = &noEventPublisher{}
+	}
+	svc := &transactionsService{
+		db:                          db,
+		eventPublisher:              eventPublisher,
+		listTransactionsCache:       &listTransactionsCache{},
+		selfPaymentEventOrder:       SelfPaymentEventOrderIncomingFirst,
+		bitcoinPriceCache:           &bitcoinPriceCache{prices: map[string]float64{}},
+		nodeNetworkCache:            &nodeNetworkCache{},
+		maxKeysendCustomRecords:     defaultMaxKeysendCustomRecords,
+		maxKeysendCustomRecordsSize: defaultMaxKeysendCustomRecordsSize,
+		feeReserveRounding:          FeeReserveRoundingCeil,
+		unknownPaymentPolicy:        UnknownPaymentPolicyAccept,
+	}
+	svc.registerDefaultDescriptionExtractors()
+	svc.registerDefaultAppIdResolvers()
+	return svc
+}
+
+func (svc *transactionsService) MakeInvoice(ctx context.Context, amount uint64, description string, descriptionHash string, expiry uint64, metadata map[string]interface{}, lnClient lnclient.LNClient, appId *uint, requestEventId *uint, notifyUrl string) (*Transaction, error) {
+	metadata, err := normalizeMetadata(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validateNotifyUrl(notifyUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	if description == "" && descriptionHash == "" {
+		description = svc.getDefaultInvoiceDescription(appId)
+	}
+	description, metadata = svc.applyInvoiceDescriptionPrefix(appId, description, descriptionHash, metadata)
+
 	var metadataBytes []byte
 	if metadata != nil {
 		var err error
@@ -138,11 +940,68 @@ func (svc *transactionsService) MakeInvoice(ctx context.Context, amount uint64,
 			logger.Logger.WithError(err).Error("Failed to serialize metadata")
 			return nil, err
 		}
-		if len(metadataBytes) > constants.INVOICE_METADATA_MAX_LENGTH {
-			return nil, fmt.Errorf("encoded invoice metadata provided is too large. Limit: %d Received: %d", constants.INVOICE_METADATA_MAX_LENGTH, len(metadataBytes))
+		maxMetadataLength := svc.getMaxMetadataLength(appId)
+		if len(metadataBytes) > maxMetadataLength {
+			truncatedMetadataBytes, ok := svc.truncateMetadata(metadata, maxMetadataLength, appId)
+			if !ok {
+				return nil, fmt.Errorf("encoded invoice metadata provided is too large. Limit: %d Received: %d", maxMetadataLength, len(metadataBytes))
+			}
+			metadataBytes = truncatedMetadataBytes
 		}
 	}
 
+	environment, err := getEnvironment(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	err = svc.validateDescription(svc.db, appId, description, descriptionHash)
+	if err != nil {
+		return nil, err
+	}
+
+	err = svc.validateAppNotPaused(svc.db, appId)
+	if err != nil {
+		return nil, err
+	}
+
+	err = svc.validateNodeReady(ctx, lnClient)
+	if err != nil {
+		return nil, err
+	}
+
+	// invoices created by the node itself (no request event) skip the receive permission check and the rate limit
+	if requestEventId != nil {
+		err := svc.validateCanReceive(svc.db, appId, amount, description)
+		if err != nil {
+			return nil, err
+		}
+		err = svc.validateInvoiceRateLimit(svc.db, appId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	existingTransaction, err := svc.findOpenInvoiceWithDescriptionHash(svc.db, appId, descriptionHash)
+	if err != nil {
+		return nil, err
+	}
+	if existingTransaction != nil {
+		if existingTransaction.AmountMsat != amount {
+			return nil, NewDescriptionHashInUseError()
+		}
+		logger.Logger.WithFields(logrus.Fields{
+			"app_id":           *appId,
+			"description_hash": descriptionHash,
+			"payment_hash":     existingTransaction.PaymentHash,
+		}).Info("Returning existing open invoice with the same description hash")
+		return existingTransaction, nil
+	}
+
+	if expiry == 0 {
+		expiry = svc.getDefaultInvoiceExpiry(amount)
+	}
+
 	lnClientTransaction, err := lnClient.MakeInvoice(ctx, int64(amount), description, descriptionHash, int64(expiry))
 	if err != nil {
 		logger.Logger.WithError(err).Error("Failed to create transaction")
@@ -158,6 +1017,13 @@ func (svc *transactionsService) MakeInvoice(ctx context.Context, amount uint64,
 	if lnClientTransaction.ExpiresAt != nil {
 		expiresAtValue := time.Unix(*lnClientTransaction.ExpiresAt, 0)
 		expiresAt = &expiresAtValue
+	} else {
+		// not all backends return the expiry, so assume the requested one was used
+		if expiry == 0 {
+			expiry = lnclient.DEFAULT_INVOICE_EXPIRY
+		}
+		expiresAtValue := time.Now().Add(time.Duration(expiry) * time.Second)
+		expiresAt = &expiresAtValue
 	}
 
 	dbTransaction := db.Transaction{
@@ -173,6 +1039,9 @@ func (svc *transactionsService) MakeInvoice(ctx context.Context, amount uint64,
 		ExpiresAt:       expiresAt,
 		Preimage:        preimage,
 		Metadata:        datatypes.JSON(metadataBytes),
+		Environment:     environment,
+		RelayUrl:        getRequestRelayUrl(svc.db, requestEventId),
+		NotifyUrl:       notifyUrl,
 	}
 	err = svc.db.Create(&dbTransaction).Error
 	if err != nil {
@@ -182,46 +1051,236 @@ func (svc *transactionsService) MakeInvoice(ctx context.Context, amount uint64,
 	return &dbTransaction, nil
 }
 
-func (svc *transactionsService) SendPaymentSync(ctx context.Context, payReq string, metadata map[string]interface{}, lnClient lnclient.LNClient, appId *uint, requestEventId *uint) (*Transaction, error) {
+// ExtendInvoiceExpiry gives the payer more time to pay a pending invoice.
+// The expiry is part of the signed invoice, so no backend can extend a live invoice:
+// instead a new invoice for the same amount and description is issued, linked to the
+// original through ReissuedFromId. The original invoice remains payable until it expires.
+func (svc *transactionsService) ExtendInvoiceExpiry(ctx context.Context, paymentHash string, newExpiry uint64, lnClient lnclient.LNClient, appId *uint) (*Transaction, error) {
+	if newExpiry == 0 {
+		return nil, errors.New("new expiry must be greater than zero")
+	}
+
+	transactionType := constants.TRANSACTION_TYPE_INCOMING
+	transaction, err := svc.LookupTransaction(ctx, paymentHash, &transactionType, lnClient, appId, false)
+	if err != nil {
+		return nil, err
+	}
+	// apps can only extend their own invoices
+	if appId != nil && (transaction.AppId == nil || *transaction.AppId != *appId) {
+		return nil, NewNotFoundError()
+	}
+
+	if transaction.State != constants.TRANSACTION_STATE_PENDING {
+		return nil, fmt.Errorf("cannot extend invoice in state %s", transaction.State)
+	}
+	if transaction.ExpiresAt != nil && time.Now().After(transaction.ExpiresAt.Add(invoiceExpiryExtensionGracePeriod)) {
+		return nil, errors.New("invoice expired too long ago to be extended")
+	}
+
+	lnClientTransaction, err := lnClient.MakeInvoice(ctx, int64(transaction.AmountMsat), transaction.Description, transaction.DescriptionHash, int64(newExpiry))
+	if err != nil {
+		logger.Logger.WithError(err).WithField("payment_hash", paymentHash).Error("Failed to reissue invoice")
+		return nil, err
+	}
+
+	var preimage *string
+	if lnClientTransaction.Preimage != "" {
+		preimage = &lnClientTransaction.Preimage
+	}
+
+	var expiresAt *time.Time
+	if lnClientTransaction.ExpiresAt != nil {
+		expiresAtValue := time.Unix(*lnClientTransaction.ExpiresAt, 0)
+		expiresAt = &expiresAtValue
+	}
+
+	dbTransaction := db.Transaction{
+		AppId:           transaction.AppId,
+		Type:            lnClientTransaction.Type,
+		State:           constants.TRANSACTION_STATE_PENDING,
+		AmountMsat:      uint64(lnClientTransaction.Amount),
+		Description:     transaction.Description,
+		DescriptionHash: transaction.DescriptionHash,
+		PaymentRequest:  lnClientTransaction.Invoice,
+		PaymentHash:     lnClientTransaction.PaymentHash,
+		ExpiresAt:       expiresAt,
+		Preimage:        preimage,
+		Metadata:        transaction.Metadata,
+		ReissuedFromId:  &transaction.ID,
+		Environment:     transaction.Environment,
+		NotifyUrl:       transaction.NotifyUrl,
+	}
+	err = svc.db.Create(&dbTransaction).Error
+	if err != nil {
+		logger.Logger.WithError(err).Error("Failed to create DB transaction")
+		return nil, err
+	}
+
+	logger.Logger.WithFields(logrus.Fields{
+		"payment_hash":          paymentHash,
+		"reissued_payment_hash": dbTransaction.PaymentHash,
+	}).Info("Reissued invoice with extended expiry")
+
+	return &dbTransaction, nil
+}
+
+func (svc *transactionsService) SendPaymentSync(ctx context.Context, payReq string, metadata map[string]interface{}, lnClient lnclient.LNClient, appId *uint, requestEventId *uint, options SendPaymentOptions) (*Transaction, error) {
+	payReq = strings.ToLower(payReq)
+	paymentRequest, err := decodeInvoice(payReq)
+	if err != nil {
+		logger.Logger.WithFields(logrus.Fields{
+			"bolt11": payReq,
+		}).Errorf("Failed to decode bolt11 invoice: %v", err)
+
+		return nil, err
+	}
+
+	err = validateInvoiceNotExpired(&paymentRequest)
+	if err != nil {
+		logger.Logger.WithFields(logrus.Fields{
+			"bolt11": payReq,
+		}).WithError(err).Error("Refusing to pay expired invoice")
+		return nil, err
+	}
+
+	err = svc.validateInvoiceNetwork(ctx, &paymentRequest, lnClient)
+	if err != nil {
+		logger.Logger.WithFields(logrus.Fields{
+			"bolt11": payReq,
+		}).WithError(err).Error("Refusing to pay invoice for another network")
+		return nil, err
+	}
+
+	if !options.ConfirmLargeAmount {
+		err = svc.validateAmountNotAnomalous(appId, uint64(paymentRequest.MSatoshi))
+		if err != nil {
+			logger.Logger.WithFields(logrus.Fields{
+				"bolt11": payReq,
+			}).WithError(err).Warn("Refusing to pay unconfirmed anomalous amount")
+			return nil, err
+		}
+	}
+
+	metadata, err = normalizeMetadata(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	selfPayment := svc.isSelfInvoice(&paymentRequest, lnClient)
+
+	// self payments are settled by the hub without using the node
+	if !selfPayment {
+		err = svc.validateNodeReady(ctx, lnClient)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var selfPaymentDepth int
+	if selfPayment {
+		// this payment is one more hop in a chain of internal transfers
+		selfPaymentDepth = getSelfPaymentDepth(metadata) + 1
+		metadata = maps.Clone(metadata)
+		if metadata == nil {
+			metadata = map[string]interface{}{}
+		}
+		metadata[constants.SELF_PAYMENT_DEPTH_METADATA_KEY] = selfPaymentDepth
+	}
+
+	environment, err := getEnvironment(metadata)
+	if err != nil {
+		return nil, err
+	}
+
 	var metadataBytes []byte
 	if metadata != nil {
-		var err error
 		metadataBytes, err = json.Marshal(metadata)
 		if err != nil {
 			logger.Logger.WithError(err).Error("Failed to serialize metadata")
 			return nil, err
 		}
-		if len(metadataBytes) > constants.INVOICE_METADATA_MAX_LENGTH {
-			return nil, fmt.Errorf("encoded payment metadata provided is too large. Limit: %d Received: %d", constants.INVOICE_METADATA_MAX_LENGTH, len(metadataBytes))
+		maxMetadataLength := svc.getMaxMetadataLength(appId)
+		if len(metadataBytes) > maxMetadataLength {
+			truncatedMetadataBytes, ok := svc.truncateMetadata(metadata, maxMetadataLength, appId)
+			if !ok {
+				return nil, fmt.Errorf("encoded payment metadata provided is too large. Limit: %d Received: %d", maxMetadataLength, len(metadataBytes))
+			}
+			metadataBytes = truncatedMetadataBytes
 		}
 	}
 
-	payReq = strings.ToLower(payReq)
-	paymentRequest, err := decodepay.Decodepay(payReq)
-	if err != nil {
-		logger.Logger.WithFields(logrus.Fields{
-			"bolt11": payReq,
-		}).Errorf("Failed to decode bolt11 invoice: %v", err)
+	feeReserveMsat := svc.calculateFeeReserveMsat(uint64(paymentRequest.MSatoshi), paymentRequest.Payee, appId, lnClient)
 
-		return nil, err
+	if options.OutgoingChannelId != "" {
+		if selfPayment {
+			err = newInvalidOutgoingChannelErrorWithReason("self payments do not use a channel")
+		} else {
+			err = validateOutgoingChannel(ctx, options.OutgoingChannelId, uint64(paymentRequest.MSatoshi)+feeReserveMsat, lnClient)
+		}
+		if err != nil {
+			logger.Logger.WithFields(logrus.Fields{
+				"bolt11":              payReq,
+				"outgoing_channel_id": options.OutgoingChannelId,
+			}).WithError(err).Error("Refusing to pay through outgoing channel")
+			return nil, err
+		}
 	}
 
-	selfPayment := paymentRequest.Payee != "" && paymentRequest.Payee == lnClient.GetPubkey()
+	var dbTransaction db.Transaction
+	budgetEvents := []*events.Event{}
+
+	err = svc.inTransaction(func(tx *gorm.DB, balanceChanges *[]balanceChange) error {
+		var existingSettledTransaction db.Transaction
+		if tx.Unscoped().Limit(1).Where("split_from_id IS NULL").Find(&existingSettledTransaction, &db.Transaction{
+			Type:        constants.TRANSACTION_TYPE_OUTGOING,
+			PaymentHash: paymentRequest.PaymentHash,
+			State:       constants.TRANSACTION_STATE_SETTLED,
+		}).RowsAffected > 0 {
+			// an invoice can only be paid once, so a payment by another app (or the node itself) also blocks it
+			byOtherApp := !sameAppId(existingSettledTransaction.AppId, appId)
+			logger.Logger.WithFields(logrus.Fields{
+				"payment_hash": paymentRequest.PaymentHash,
+				"by_other_app": byOtherApp,
+			}).Info("this invoice has already been paid")
+			return newInvoiceAlreadyPaidErrorForApp(byOtherApp)
+		}
+
+		if options.ExternalRef != "" {
+			var existingExternalRefTransaction db.Transaction
+			if tx.Unscoped().Limit(1).Where("state != ?", constants.TRANSACTION_STATE_FAILED).Find(&existingExternalRefTransaction, &db.Transaction{
+				Type:        constants.TRANSACTION_TYPE_OUTGOING,
+				ExternalRef: options.ExternalRef,
+			}).RowsAffected > 0 {
+				logger.Logger.WithField("external_ref", options.ExternalRef).Info("a payment with this external reference has already been made")
+				return NewExternalRefConflictError()
+			}
+		}
+
+		if options.paymentIntentId != nil {
+			err := fulfillPaymentIntent(tx, *options.paymentIntentId)
+			if err != nil {
+				return err
+			}
+		}
+
+		err := svc.validateDescription(tx, appId, paymentRequest.Description, paymentRequest.DescriptionHash)
+		if err != nil {
+			return err
+		}
 
-	var dbTransaction db.Transaction
+		if selfPayment {
+			err = svc.validateSelfPaymentDepth(tx, appId, selfPaymentDepth)
+			if err != nil {
+				return err
+			}
+		}
 
-	err = svc.db.Transaction(func(tx *gorm.DB) error {
-		var existingSettledTransaction db.Transaction
-		if tx.Limit(1).Find(&existingSettledTransaction, &db.Transaction{
-			Type:        constants.TRANSACTION_TYPE_OUTGOING,
-			PaymentHash: paymentRequest.PaymentHash,
-			State:       constants.TRANSACTION_STATE_SETTLED,
-		}).RowsAffected > 0 {
-			logger.Logger.WithField("payment_hash", dbTransaction.PaymentHash).Info("this invoice has already been paid")
-			return errors.New("this invoice has already been paid")
+		err = svc.validateCanPay(tx, appId, uint64(paymentRequest.MSatoshi), feeReserveMsat, paymentRequest.Description, lnClient, &budgetEvents)
+		if err != nil {
+			return err
 		}
 
-		err := svc.validateCanPay(tx, appId, uint64(paymentRequest.MSatoshi), paymentRequest.Description)
+		decodedInvoice, err := svc.getDecodedInvoiceToStore(tx, appId, &paymentRequest)
 		if err != nil {
 			return err
 		}
@@ -232,22 +1291,39 @@ func (svc *transactionsService) SendPaymentSync(ctx context.Context, payReq stri
 			expiresAt = &expiresAtValue
 		}
 		dbTransaction = db.Transaction{
-			AppId:           appId,
-			RequestEventId:  requestEventId,
-			Type:            constants.TRANSACTION_TYPE_OUTGOING,
-			State:           constants.TRANSACTION_STATE_PENDING,
-			FeeReserveMsat:  svc.calculateFeeReserveMsat(uint64(paymentRequest.MSatoshi)),
-			AmountMsat:      uint64(paymentRequest.MSatoshi),
-			PaymentRequest:  payReq,
-			PaymentHash:     paymentRequest.PaymentHash,
-			Description:     paymentRequest.Description,
-			DescriptionHash: paymentRequest.DescriptionHash,
-			ExpiresAt:       expiresAt,
-			SelfPayment:     selfPayment,
-			Metadata:        datatypes.JSON(metadataBytes),
+			AppId:              appId,
+			RequestEventId:     requestEventId,
+			Type:               constants.TRANSACTION_TYPE_OUTGOING,
+			State:              constants.TRANSACTION_STATE_PENDING,
+			FeeReserveMsat:     feeReserveMsat,
+			AmountMsat:         uint64(paymentRequest.MSatoshi),
+			PaymentRequest:     payReq,
+			PaymentHash:        paymentRequest.PaymentHash,
+			Description:        paymentRequest.Description,
+			DescriptionHash:    paymentRequest.DescriptionHash,
+			ExpiresAt:          expiresAt,
+			SelfPayment:        selfPayment,
+			Metadata:           datatypes.JSON(metadataBytes),
+			ExternalRef:        options.ExternalRef,
+			PayeePubkey:        paymentRequest.Payee,
+			Environment:        environment,
+			DecodedInvoice:     decodedInvoice,
+			RelayUrl:           getRequestRelayUrl(tx, requestEventId),
+			MinFinalCltvExpiry: uint(paymentRequest.MinFinalCLTVExpiry),
 		}
 		err = tx.Create(&dbTransaction).Error
-		return err
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			// a concurrent payment with the same external reference was recorded first
+			return NewExternalRefConflictError()
+		}
+		if err != nil {
+			return err
+		}
+
+		if options.paymentIntentId != nil {
+			return tx.Model(&db.PaymentIntent{}).Where("id = ?", *options.paymentIntentId).Update("transaction_id", dbTransaction.ID).Error
+		}
+		return nil
 	})
 
 	if err != nil {
@@ -256,12 +1332,14 @@ func (svc *transactionsService) SendPaymentSync(ctx context.Context, payReq stri
 		}).WithError(err).Error("Failed to create DB transaction")
 		return nil, err
 	}
+	svc.publishEvents(budgetEvents)
 
 	var response *lnclient.PayInvoiceResponse
+	var incomingSettledEvent *events.Event
 	if selfPayment {
-		response, err = svc.interceptSelfPayment(paymentRequest.PaymentHash)
+		response, incomingSettledEvent, err = svc.interceptSelfPayment(ctx, paymentRequest.PaymentHash, selfPaymentDepth, lnClient)
 	} else {
-		response, err = lnClient.SendPaymentSync(ctx, payReq)
+		response, err = svc.sendPaymentWithAppTimeout(ctx, payReq, options.OutgoingChannelId, appId, lnClient)
 	}
 
 	if err != nil {
@@ -279,19 +1357,24 @@ func (svc *transactionsService) SendPaymentSync(ctx context.Context, payReq stri
 		}
 
 		// As the LNClient did not return a timeout error, we assume the payment definitely failed
-		svc.db.Transaction(func(tx *gorm.DB) error {
-			return svc.markPaymentFailed(tx, &dbTransaction, err.Error())
+		svc.inTransaction(func(tx *gorm.DB, balanceChanges *[]balanceChange) error {
+			return svc.markPaymentFailed(tx, &dbTransaction, err.Error(), balanceChanges)
 		})
 
 		return nil, err
 	}
 
 	// the payment definitely succeeded
+	previousTransaction := dbTransaction
 	var settledTransaction *db.Transaction
-	err = svc.db.Transaction(func(tx *gorm.DB) error {
-		settledTransaction, err = svc.markTransactionSettled(tx, &dbTransaction, response.Preimage, response.Fee, selfPayment)
+	err = svc.inTransaction(func(tx *gorm.DB, balanceChanges *[]balanceChange) error {
+		svc.recordPaymentRoute(tx, &dbTransaction, response.Route)
+		settledTransaction, err = svc.markTransactionSettled(tx, &dbTransaction, response.Preimage, response.Fee, selfPayment, balanceChanges)
 		return err
 	})
+	if selfPayment {
+		svc.publishSelfPaymentEvents(incomingSettledEvent, selfPaymentSettledEvent(settledTransaction, &previousTransaction))
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -299,7 +1382,21 @@ func (svc *transactionsService) SendPaymentSync(ctx context.Context, payReq stri
 	return settledTransaction, nil
 }
 
-func (svc *transactionsService) SendKeysend(ctx context.Context, amount uint64, destination string, customRecords []lnclient.TLVRecord, preimage string, lnClient lnclient.LNClient, appId *uint, requestEventId *uint) (*Transaction, error) {
+func (svc *transactionsService) SendKeysend(ctx context.Context, amount uint64, destination string, customRecords []lnclient.TLVRecord, preimage string, sessionId string, lnClient lnclient.LNClient, appId *uint, requestEventId *uint) (*Transaction, error) {
+	// pubkeys are compared and stored in lowercase
+	destination = strings.ToLower(destination)
+	err := validateKeysendDestination(destination)
+	if err != nil {
+		logger.Logger.WithField("destination", destination).WithError(err).Error("Invalid keysend destination")
+		return nil, err
+	}
+
+	err = svc.validateKeysendCustomRecords(customRecords)
+	if err != nil {
+		logger.Logger.WithField("destination", destination).WithError(err).Error("Invalid keysend custom records")
+		return nil, err
+	}
+
 	if preimage == "" {
 		preImageBytes, err := makePreimageHex()
 		if err != nil {
@@ -325,7 +1422,10 @@ func (svc *transactionsService) SendKeysend(ctx context.Context, amount uint64,
 
 	metadata["destination"] = destination
 
-	metadata["tlv_records"] = customRecords
+	metadata[tlvRecordsMetadataKey] = customRecords
+	if sessionId != "" {
+		metadata[constants.BOOST_SESSION_ID_METADATA_KEY] = sessionId
+	}
 	metadataBytes, err := json.Marshal(metadata)
 	if err != nil {
 		logger.Logger.WithError(err).Error("Failed to serialize transaction metadata")
@@ -335,10 +1435,27 @@ func (svc *transactionsService) SendKeysend(ctx context.Context, amount uint64,
 
 	var dbTransaction db.Transaction
 
-	selfPayment := destination == lnClient.GetPubkey()
+	selfPayment := svc.isSelfPayment(destination, lnClient)
+	feeReserveMsat := svc.calculateFeeReserveMsat(amount, destination, appId, lnClient)
+
+	var existingSettledTransaction *db.Transaction
+	budgetEvents := []*events.Event{}
+	err = svc.inTransaction(func(tx *gorm.DB, balanceChanges *[]balanceChange) error {
+		// a keysend with a caller-supplied preimage that was already sent by the same app
+		// has the same payment hash, so return the earlier payment rather than paying twice
+		query := tx.Unscoped().Where("type = ? AND payment_hash = ? AND state = ? AND split_from_id IS NULL", constants.TRANSACTION_TYPE_OUTGOING, paymentHash, constants.TRANSACTION_STATE_SETTLED)
+		if appId != nil {
+			query = query.Where("app_id = ?", *appId)
+		} else {
+			query = query.Where("app_id IS NULL")
+		}
+		var existingTransaction db.Transaction
+		if query.Limit(1).Find(&existingTransaction).RowsAffected > 0 {
+			existingSettledTransaction = &existingTransaction
+			return nil
+		}
 
-	err = svc.db.Transaction(func(tx *gorm.DB) error {
-		err := svc.validateCanPay(tx, appId, amount, "")
+		err := svc.validateCanPay(tx, appId, amount, feeReserveMsat, "", lnClient, &budgetEvents)
 		if err != nil {
 			return err
 		}
@@ -349,13 +1466,17 @@ func (svc *transactionsService) SendKeysend(ctx context.Context, amount uint64,
 			RequestEventId: requestEventId,
 			Type:           constants.TRANSACTION_TYPE_OUTGOING,
 			State:          constants.TRANSACTION_STATE_PENDING,
-			FeeReserveMsat: svc.calculateFeeReserveMsat(uint64(amount)),
+			FeeReserveMsat: feeReserveMsat,
 			AmountMsat:     amount,
 			Metadata:       datatypes.JSON(metadataBytes),
 			Boostagram:     datatypes.JSON(boostagramBytes),
+			IsBoost:        isBoost(boostagramBytes),
 			PaymentHash:    paymentHash,
 			Preimage:       &preimage,
 			SelfPayment:    selfPayment,
+			PayeePubkey:    destination,
+			Environment:    constants.TRANSACTION_ENVIRONMENT_PROD,
+			RelayUrl:       getRequestRelayUrl(tx, requestEventId),
 		}
 		err = tx.Create(&dbTransaction).Error
 
@@ -369,12 +1490,19 @@ func (svc *transactionsService) SendKeysend(ctx context.Context, amount uint64,
 		}).WithError(err).Error("Failed to create DB transaction")
 		return nil, err
 	}
+	svc.publishEvents(budgetEvents)
+
+	if existingSettledTransaction != nil {
+		logger.Logger.WithField("payment_hash", paymentHash).Info("this keysend has already been sent, returning the existing payment")
+		return existingSettledTransaction, nil
+	}
 
 	var payKeysendResponse *lnclient.PayKeysendResponse
+	var incomingSettledEvent *events.Event
 
 	if selfPayment {
 		// for keysend self-payments we need to create an incoming payment at the time of the payment
-		recipientAppId := svc.getAppIdFromCustomRecords(customRecords)
+		recipientAppId := svc.resolveAppId(customRecords, metadata, boostagramBytes)
 		dbTransaction := db.Transaction{
 			AppId:          recipientAppId,
 			RequestEventId: nil, // it is related to this request but for a different app
@@ -386,7 +1514,9 @@ func (svc *transactionsService) SendKeysend(ctx context.Context, amount uint64,
 			Description:    svc.getDescriptionFromCustomRecords(customRecords),
 			Metadata:       datatypes.JSON(metadataBytes),
 			Boostagram:     datatypes.JSON(boostagramBytes),
+			IsBoost:        isBoost(boostagramBytes),
 			SelfPayment:    true,
+			Environment:    constants.TRANSACTION_ENVIRONMENT_PROD,
 		}
 		err = svc.db.Create(&dbTransaction).Error
 		if err != nil {
@@ -394,137 +1524,523 @@ func (svc *transactionsService) SendKeysend(ctx context.Context, amount uint64,
 			return nil, err
 		}
 
-		_, err = svc.interceptSelfPayment(paymentHash)
-		if err == nil {
-			payKeysendResponse = &lnclient.PayKeysendResponse{
-				Fee: 0,
-			}
-		}
-	} else {
-		payKeysendResponse, err = lnClient.SendKeysend(ctx, amount, destination, customRecords, preimage)
+		_, incomingSettledEvent, err = svc.interceptSelfPayment(ctx, paymentHash, 0, lnClient)
+		if err == nil {
+			payKeysendResponse = &lnclient.PayKeysendResponse{
+				Fee: 0,
+			}
+		}
+	} else {
+		payKeysendResponse, err = lnClient.SendKeysend(ctx, amount, destination, customRecords, preimage)
+	}
+
+	if err != nil {
+		logger.Logger.WithFields(logrus.Fields{
+			"destination": destination,
+			"amount":      amount,
+		}).WithError(err).Error("Failed to send payment")
+
+		if errors.Is(err, lnclient.NewTimeoutError()) {
+
+			logger.Logger.WithFields(logrus.Fields{
+				"destination": destination,
+				"amount":      amount,
+			}).WithError(err).Error("Timed out waiting for payment to be sent. It may still succeed. Skipping update of transaction status")
+
+			// we cannot update the payment to failed as it still might succeed.
+			// we'll need to check the status of it later
+			// but we have the payment hash now, so save it on the transaction
+			dbErr := svc.db.Model(&dbTransaction).Updates(&db.Transaction{
+				PaymentHash: paymentHash,
+			}).Error
+			if dbErr != nil {
+				logger.Logger.WithFields(logrus.Fields{
+					"destination": destination,
+					"amount":      amount,
+				}).WithError(dbErr).Error("Failed to update DB transaction")
+			}
+			return nil, err
+		}
+
+		// As the LNClient did not return a timeout error, we assume the payment definitely failed
+		failedAt := time.Now()
+		dbErr := svc.db.Model(&dbTransaction).Updates(&db.Transaction{
+			PaymentHash: paymentHash,
+			State:       constants.TRANSACTION_STATE_FAILED,
+			FailedAt:    &failedAt,
+		}).Error
+		if dbErr != nil {
+			logger.Logger.WithFields(logrus.Fields{
+				"destination": destination,
+				"amount":      amount,
+			}).WithError(dbErr).Error("Failed to update DB transaction")
+		}
+
+		return nil, err
+	}
+
+	// the payment definitely succeeded
+	previousTransaction := dbTransaction
+	var settledTransaction *db.Transaction
+	err = svc.inTransaction(func(tx *gorm.DB, balanceChanges *[]balanceChange) error {
+		// the settled keysend is returned even if it was merged into an aggregated transaction,
+		// so the caller still gets its preimage and fee
+		settledTransaction, err = svc.markTransactionSettled(tx, &dbTransaction, preimage, payKeysendResponse.Fee, selfPayment, balanceChanges)
+		return err
+	})
+	if selfPayment {
+		svc.publishSelfPaymentEvents(incomingSettledEvent, selfPaymentSettledEvent(settledTransaction, &previousTransaction))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return settledTransaction, nil
+}
+
+// LookupTransaction returns the transaction for a payment hash. Without a transaction type,
+// the ambiguity of self payments (which have an incoming and an outgoing transaction with the
+// same payment hash) is resolved by preferring the side of the requesting app, then the outgoing side.
+func (svc *transactionsService) LookupTransaction(ctx context.Context, paymentHash string, transactionType *string, lnClient lnclient.LNClient, appId *uint, verifyIntegrity bool) (*Transaction, error) {
+	transaction, err := svc.findTransaction(paymentHash, transactionType, appId)
+	if err != nil {
+		return nil, err
+	}
+
+	if transaction.State == constants.TRANSACTION_STATE_PENDING {
+		svc.checkUnsettledTransaction(ctx, transaction, lnClient)
+	}
+
+	if verifyIntegrity {
+		transaction.PreimageMatchesPaymentHash = verifyPreimageMatchesPaymentHash(transaction)
+	}
+
+	return transaction, nil
+}
+
+// LookupTransactionByPreimage finds the transaction paid with a preimage, e.g. one handed over as proof of payment,
+// by the payment hash computed from it
+func (svc *transactionsService) LookupTransactionByPreimage(ctx context.Context, preimage string, appId *uint) (*Transaction, error) {
+	preimageBytes, err := hex.DecodeString(preimage)
+	if err != nil || len(preimageBytes) != 32 {
+		logger.Logger.WithField("preimage", preimage).WithError(err).Error("Invalid preimage")
+		return nil, NewInvalidPreimageError()
+	}
+
+	paymentHash := sha256.Sum256(preimageBytes)
+	return svc.findTransaction(hex.EncodeToString(paymentHash[:]), nil, appId)
+}
+
+// findTransaction returns the transaction for a payment hash visible to the app
+func (svc *transactionsService) findTransaction(paymentHash string, transactionType *string, appId *uint) (*Transaction, error) {
+	transaction := db.Transaction{}
+
+	// hidden (soft-deleted) transactions can still be looked up directly
+	tx := svc.db.Unscoped()
+
+	tx, err := svc.scopeToApp(tx, appId)
+	if err != nil {
+		return nil, err
+	}
+
+	// order settled first, otherwise by created date, as there can be multiple outgoing payments
+	// for the same payment hash (if you tried to pay an invoice multiple times - e.g. the first time failed)
+	order := "settled_at desc, created_at desc, id desc"
+	if transactionType != nil {
+		tx = tx.Where("type == ?", *transactionType)
+	} else {
+		// a self payment has an incoming and an outgoing transaction with the same payment hash.
+		// Without a type, the side belonging to the requesting app is returned, otherwise the outgoing side
+		order = fmt.Sprintf("settled_at IS NULL, type != '%s', %s", constants.TRANSACTION_TYPE_OUTGOING, order)
+		if appId != nil {
+			order = fmt.Sprintf("app_id IS NOT %d, %s", *appId, order)
+		}
+	}
+
+	// split shares have the payment hash of the transaction they were split from
+	result := tx.Order(order).Limit(1).Where("split_from_id IS NULL").Find(&transaction, &db.Transaction{
+		//Type:        transactionType,
+		PaymentHash: paymentHash,
+	})
+
+	if result.Error != nil {
+		logger.Logger.WithError(result.Error).Error("Failed to lookup transaction")
+		return nil, result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		logger.Logger.WithFields(logrus.Fields{
+			"payment_hash": paymentHash,
+			"app_id":       appId,
+		}).WithError(result.Error).Error("transaction not found")
+		return nil, NewNotFoundError()
+	}
+
+	return &transaction, nil
+}
+
+// scopeToApp limits a transactions query to the transactions the app can access:
+// isolated apps can only access their own transactions
+func (svc *transactionsService) scopeToApp(tx *gorm.DB, appId *uint) (*gorm.DB, error) {
+	if appId == nil {
+		return tx, nil
+	}
+
+	var app db.App
+	result := svc.db.Limit(1).Find(&app, &db.App{
+		ID: *appId,
+	})
+	if result.RowsAffected == 0 {
+		return nil, NewNotFoundError()
+	}
+	if app.Isolated {
+		tx = tx.Where("app_id == ?", *appId)
+	}
+	return tx, nil
+}
+
+// GetPaymentAttempts returns every outgoing payment made for a payment hash, oldest first
+// (e.g. a failed attempt followed by a successful one).
+func (svc *transactionsService) GetPaymentAttempts(ctx context.Context, paymentHash string, appId *uint) ([]Transaction, error) {
+	tx := svc.db.Unscoped().Where("type == ? AND payment_hash == ? AND split_from_id IS NULL", constants.TRANSACTION_TYPE_OUTGOING, paymentHash)
+
+	tx, err := svc.scopeToApp(tx, appId)
+	if err != nil {
+		return nil, err
+	}
+
+	var attempts []Transaction
+	result := tx.Order("created_at asc, id asc").Find(&attempts)
+	if result.Error != nil {
+		logger.Logger.WithError(result.Error).Error("Failed to list payment attempts")
+		return nil, result.Error
+	}
+
+	return attempts, nil
+}
+
+// SoftDeleteTransaction hides a completed transaction from transaction lists.
+// Hidden transactions still count towards balances, budgets and stats.
+func (svc *transactionsService) SoftDeleteTransaction(ctx context.Context, id uint) error {
+	var transaction db.Transaction
+	result := svc.db.Limit(1).Find(&transaction, &db.Transaction{
+		ID: id,
+	})
+	if result.RowsAffected == 0 {
+		return NewNotFoundError()
+	}
+	// pending transactions are still updated as payments complete
+	if transaction.State == constants.TRANSACTION_STATE_PENDING {
+		return errors.New("pending transactions cannot be deleted")
+	}
+
+	err := svc.db.Delete(&transaction).Error
+	if err != nil {
+		logger.Logger.WithError(err).WithField("id", id).Error("Failed to soft delete transaction")
+		return err
+	}
+	return nil
+}
+
+// RestoreTransaction shows a soft-deleted transaction in transaction lists again
+func (svc *transactionsService) RestoreTransaction(ctx context.Context, id uint) error {
+	result := svc.db.Unscoped().Model(&db.Transaction{}).Where("id = ? AND deleted_at IS NOT NULL", id).Update("deleted_at", nil)
+	if result.Error != nil {
+		logger.Logger.WithError(result.Error).WithField("id", id).Error("Failed to restore transaction")
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return NewNotFoundError()
+	}
+	return nil
+}
+
+// ForceFailPayment marks a pending outgoing payment as failed, e.g. one the operator knows failed
+// but is still pending because its outcome was unknown when it was sent.
+// The backend is asked for the payment's status first, so a payment that is still in flight
+// or has succeeded is never marked as failed.
+func (svc *transactionsService) ForceFailPayment(ctx context.Context, id uint, reason string, lnClient lnclient.LNClient) error {
+	var dbTransaction db.Transaction
+	result := svc.db.Unscoped().Limit(1).Find(&dbTransaction, &db.Transaction{
+		ID:   id,
+		Type: constants.TRANSACTION_TYPE_OUTGOING,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return NewNotFoundError()
+	}
+	if dbTransaction.State != constants.TRANSACTION_STATE_PENDING {
+		return fmt.Errorf("cannot fail payment in state %s", dbTransaction.State)
+	}
+
+	paymentStatus, err := lnClient.LookupPayment(ctx, dbTransaction.PaymentHash)
+	if err != nil {
+		logger.Logger.WithField("payment_hash", dbTransaction.PaymentHash).WithError(err).Error("Failed to look up payment status to force fail payment")
+		return err
+	}
+	switch paymentStatus {
+	case lnclient.PAYMENT_STATUS_FAILED, lnclient.PAYMENT_STATUS_NOT_FOUND:
+	case lnclient.PAYMENT_STATUS_SUCCEEDED:
+		return errors.New("the payment succeeded and cannot be marked as failed")
+	default:
+		return NewPaymentInFlightError()
+	}
+
+	return svc.inTransaction(func(tx *gorm.DB, balanceChanges *[]balanceChange) error {
+		// the payment may have completed while its status was being looked up
+		var currentTransaction db.Transaction
+		result := tx.Unscoped().Limit(1).Find(&currentTransaction, &db.Transaction{
+			ID: dbTransaction.ID,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if currentTransaction.State != constants.TRANSACTION_STATE_PENDING {
+			return fmt.Errorf("cannot fail payment in state %s", currentTransaction.State)
+		}
+
+		logger.Logger.WithFields(logrus.Fields{
+			"payment_hash":   dbTransaction.PaymentHash,
+			"payment_status": paymentStatus,
+			"reason":         reason,
+		}).Info("Force failing payment")
+		return svc.markPaymentFailed(tx, &dbTransaction, reason, balanceChanges)
+	})
+}
+
+func (svc *transactionsService) ListTransactions(ctx context.Context, from, until, limit, offset uint64, unpaidOutgoing bool, unpaidIncoming bool, transactionType *string, lnClient lnclient.LNClient, appId *uint, forceFilterByAppId bool, filter ListTransactionsFilter) (transactions []Transaction, err error) {
+	// reconcile before reading from the cache so cached reads do not skip settlements.
+	// Any transaction settled here invalidates the cache.
+	svc.checkUnsettledTransactions(ctx, lnClient)
+
+	cacheKey := listTransactionsCacheKey(from, until, limit, offset, unpaidOutgoing, unpaidIncoming, transactionType, appId, forceFilterByAppId, filter)
+	if cachedTransactions, ok := svc.listTransactionsCache.get(cacheKey); ok {
+		return cachedTransactions, nil
+	}
+
+	tx := svc.db
+
+	if !unpaidOutgoing && !unpaidIncoming {
+		tx = tx.Where("state == ?", constants.TRANSACTION_STATE_SETTLED)
+	} else if unpaidOutgoing && !unpaidIncoming {
+		tx = tx.Where(tx.Where("state == ?", constants.TRANSACTION_STATE_SETTLED).
+			Or("type == ?", constants.TRANSACTION_TYPE_OUTGOING))
+	} else if unpaidIncoming && !unpaidOutgoing {
+		tx = tx.Where(tx.Where("state == ?", constants.TRANSACTION_STATE_SETTLED).
+			Or("type == ?", constants.TRANSACTION_TYPE_INCOMING))
+	}
+
+	tx, err = svc.filterTransactions(tx, from, until, transactionType, appId, forceFilterByAppId)
+	if err != nil {
+		return nil, err
+	}
+
+	if filter.Environment != nil {
+		tx = tx.Where("environment == ?", *filter.Environment)
+	}
+
+	if filter.PaymentKind != nil {
+		// keysend payments are sent without a payment request
+		switch *filter.PaymentKind {
+		case constants.TRANSACTION_PAYMENT_KIND_KEYSEND:
+			tx = tx.Where("type == ? AND (payment_request IS NULL OR payment_request == '')", constants.TRANSACTION_TYPE_OUTGOING)
+		case constants.TRANSACTION_PAYMENT_KIND_INVOICE:
+			tx = tx.Where("type == ? AND payment_request != ''", constants.TRANSACTION_TYPE_OUTGOING)
+		default:
+			return nil, fmt.Errorf("unknown payment kind: %s", *filter.PaymentKind)
+		}
+	}
+
+	if filter.PinnedOnly {
+		tx = tx.Where("pinned")
+	}
+
+	if filter.IncomingKind != nil {
+		if !isValidIncomingKind(*filter.IncomingKind) {
+			return nil, fmt.Errorf("unknown incoming kind: %s", *filter.IncomingKind)
+		}
+		tx = tx.Where("type == ? AND "+incomingKindColumn+" == ?", constants.TRANSACTION_TYPE_INCOMING, *filter.IncomingKind)
+	}
+
+	if filter.BoostsOnly {
+		tx = tx.Where("is_boost")
+	}
+
+	if filter.IncludeDeleted {
+		tx = tx.Unscoped()
+	}
+
+	tx = tx.Order("updated_at desc")
+
+	if limit > 0 {
+		tx = tx.Limit(int(limit))
+	}
+	if offset > 0 {
+		tx = tx.Offset(int(offset))
+	}
+
+	if filter.OmitLargeFields {
+		// lighter payloads for list views that do not show metadata or boostagrams
+		tx = tx.Omit(largeTransactionColumns...)
 	}
 
+	result := tx.Find(&transactions)
+	if result.Error != nil {
+		logger.Logger.WithError(result.Error).Error("Failed to list DB transactions")
+		return nil, result.Error
+	}
+
+	svc.listTransactionsCache.set(cacheKey, transactions)
+
+	return transactions, nil
+}
+
+// SearchTransactions returns the transactions matching all filters in the query,
+// along with the total number of matches ignoring the query's limit and offset
+func (svc *transactionsService) SearchTransactions(ctx context.Context, query SearchQuery, appId *uint) ([]Transaction, uint64, error) {
+	tx, err := svc.filterTransactions(svc.db, query.From, query.Until, query.Type, appId, true)
 	if err != nil {
-		logger.Logger.WithFields(logrus.Fields{
-			"destination": destination,
-			"amount":      amount,
-		}).WithError(err).Error("Failed to send payment")
+		return nil, 0, err
+	}
 
-		if errors.Is(err, lnclient.NewTimeoutError()) {
+	if query.State != nil {
+		tx = tx.Where("state == ?", *query.State)
+	}
+	if query.RelayUrl != nil {
+		tx = tx.Where("relay_url == ?", *query.RelayUrl)
+	}
+	if query.MinAmountMsat > 0 {
+		tx = tx.Where("amount_msat >= ?", query.MinAmountMsat)
+	}
+	if query.MaxAmountMsat > 0 {
+		tx = tx.Where("amount_msat <= ?", query.MaxAmountMsat)
+	}
+	if query.Text != "" {
+		pattern := "%" + escapeLikePattern(query.Text) + "%"
+		tx = tx.Where("(description LIKE ? ESCAPE '\\' OR payment_hash LIKE ? ESCAPE '\\' OR payment_request LIKE ? ESCAPE '\\')", pattern, pattern, pattern)
+	}
 
-			logger.Logger.WithFields(logrus.Fields{
-				"destination": destination,
-				"amount":      amount,
-			}).WithError(err).Error("Timed out waiting for payment to be sent. It may still succeed. Skipping update of transaction status")
+	// allow the filtered query to be reused for both the count and the page
+	tx = tx.Session(&gorm.Session{})
 
-			// we cannot update the payment to failed as it still might succeed.
-			// we'll need to check the status of it later
-			// but we have the payment hash now, so save it on the transaction
-			dbErr := svc.db.Model(&dbTransaction).Updates(&db.Transaction{
-				PaymentHash: paymentHash,
-			}).Error
-			if dbErr != nil {
-				logger.Logger.WithFields(logrus.Fields{
-					"destination": destination,
-					"amount":      amount,
-				}).WithError(dbErr).Error("Failed to update DB transaction")
-			}
-			return nil, err
-		}
+	var totalCount int64
+	result := tx.Model(&Transaction{}).Count(&totalCount)
+	if result.Error != nil {
+		logger.Logger.WithError(result.Error).Error("Failed to count DB transactions")
+		return nil, 0, result.Error
+	}
 
-		// As the LNClient did not return a timeout error, we assume the payment definitely failed
-		dbErr := svc.db.Model(&dbTransaction).Updates(&db.Transaction{
-			PaymentHash: paymentHash,
-			State:       constants.TRANSACTION_STATE_FAILED,
-		}).Error
-		if dbErr != nil {
-			logger.Logger.WithFields(logrus.Fields{
-				"destination": destination,
-				"amount":      amount,
-			}).WithError(dbErr).Error("Failed to update DB transaction")
-		}
+	tx = tx.Order("updated_at desc")
+	if query.Limit > 0 {
+		tx = tx.Limit(int(query.Limit))
+	}
+	if query.Offset > 0 {
+		tx = tx.Offset(int(query.Offset))
+	}
 
-		return nil, err
+	transactions := []Transaction{}
+	result = tx.Find(&transactions)
+	if result.Error != nil {
+		logger.Logger.WithError(result.Error).Error("Failed to search DB transactions")
+		return nil, 0, result.Error
 	}
 
-	// the payment definitely succeeded
-	var settledTransaction *db.Transaction
-	err = svc.db.Transaction(func(tx *gorm.DB) error {
-		settledTransaction, err = svc.markTransactionSettled(tx, &dbTransaction, preimage, payKeysendResponse.Fee, selfPayment)
-		return err
-	})
+	return transactions, uint64(totalCount), nil
+}
 
+// GetPayeeReliability returns how often completed outgoing payments to the payee succeeded.
+// Pending payments and self payments are not counted.
+func (svc *transactionsService) GetPayeeReliability(ctx context.Context, payee string, excludeTestTransactions bool) (*ReliabilityStat, error) {
+	settledCount, failedCount, err := queries.GetPayeeOutcomeCounts(svc.db, payee, excludeTestTransactions)
 	if err != nil {
+		logger.Logger.WithError(err).WithField("payee", payee).Error("Failed to get payee reliability")
 		return nil, err
 	}
 
-	return settledTransaction, nil
+	stat := &ReliabilityStat{
+		Payee:        payee,
+		SettledCount: settledCount,
+		FailedCount:  failedCount,
+	}
+	if settledCount+failedCount > 0 {
+		stat.SuccessRate = float64(settledCount) / float64(settledCount+failedCount)
+	}
+	return stat, nil
 }
 
-func (svc *transactionsService) LookupTransaction(ctx context.Context, paymentHash string, transactionType *string, lnClient lnclient.LNClient, appId *uint) (*Transaction, error) {
-	transaction := db.Transaction{}
-
-	tx := svc.db
-
-	if appId != nil {
-		var app db.App
-		result := svc.db.Limit(1).Find(&app, &db.App{
-			ID: *appId,
-		})
-		if result.RowsAffected == 0 {
-			return nil, NewNotFoundError()
+// GetSettlementLatencyStats returns percentiles of the time from creation to settlement of
+// incoming and outgoing payments that settled between from and until (unix seconds, 0 = unbounded)
+func (svc *transactionsService) GetSettlementLatencyStats(ctx context.Context, from, until uint64) (*SettlementLatencyStats, error) {
+	stats := &SettlementLatencyStats{}
+	for _, transactionType := range []string{constants.TRANSACTION_TYPE_INCOMING, constants.TRANSACTION_TYPE_OUTGOING} {
+		latencies, err := queries.GetSettlementLatencies(svc.db, transactionType, from, until)
+		if err != nil {
+			logger.Logger.WithError(err).WithField("type", transactionType).Error("Failed to get settlement latencies")
+			return nil, err
 		}
-		if app.Isolated {
-			tx = tx.Where("app_id == ?", *appId)
+		if transactionType == constants.TRANSACTION_TYPE_INCOMING {
+			stats.Incoming = getLatencyPercentiles(latencies)
+		} else {
+			stats.Outgoing = getLatencyPercentiles(latencies)
 		}
 	}
+	return stats, nil
+}
 
-	if transactionType != nil {
-		tx = tx.Where("type == ?", *transactionType)
+func getLatencyPercentiles(latencies []time.Duration) LatencyPercentiles {
+	slices.Sort(latencies)
+	return LatencyPercentiles{
+		Count: uint64(len(latencies)),
+		P50:   getPercentile(latencies, 50),
+		P90:   getPercentile(latencies, 90),
+		P99:   getPercentile(latencies, 99),
 	}
+}
 
-	// order settled first, otherwise by created date, as there can be multiple outgoing payments
-	// for the same payment hash (if you tried to pay an invoice multiple times - e.g. the first time failed)
-	result := tx.Order("settled_at desc, created_at desc").Limit(1).Find(&transaction, &db.Transaction{
-		//Type:        transactionType,
-		PaymentHash: paymentHash,
-	})
-
-	if result.Error != nil {
-		logger.Logger.WithError(result.Error).Error("Failed to lookup transaction")
-		return nil, result.Error
+// getPercentile returns the nearest-rank percentile of sorted values
+func getPercentile[T cmp.Ordered](sortedValues []T, percentile int) T {
+	if len(sortedValues) == 0 {
+		var zero T
+		return zero
 	}
+	rank := (percentile*len(sortedValues) + 99) / 100
+	return sortedValues[max(rank, 1)-1]
+}
 
+// ListPendingBudgetReservations returns the app's in-flight payments, oldest first.
+// Each reserves its amount plus fee reserve from the app's budget (and balance, if isolated)
+// until it settles or fails.
+func (svc *transactionsService) ListPendingBudgetReservations(ctx context.Context, appId uint) ([]Transaction, error) {
+	var app db.App
+	result := svc.db.Limit(1).Find(&app, &db.App{
+		ID: appId,
+	})
 	if result.RowsAffected == 0 {
-		logger.Logger.WithFields(logrus.Fields{
-			"payment_hash": paymentHash,
-			"app_id":       appId,
-		}).WithError(result.Error).Error("transaction not found")
 		return nil, NewNotFoundError()
 	}
 
-	if transaction.State == constants.TRANSACTION_STATE_PENDING {
-		svc.checkUnsettledTransaction(ctx, &transaction, lnClient)
+	var transactions []Transaction
+	result = svc.db.
+		Where(&db.Transaction{
+			AppId: &appId,
+			Type:  constants.TRANSACTION_TYPE_OUTGOING,
+			State: constants.TRANSACTION_STATE_PENDING,
+		}).
+		Order("created_at asc").
+		Find(&transactions)
+	if result.Error != nil {
+		logger.Logger.WithError(result.Error).WithField("app_id", appId).Error("Failed to list pending budget reservations")
+		return nil, result.Error
 	}
 
-	return &transaction, nil
+	return transactions, nil
 }
 
-func (svc *transactionsService) ListTransactions(ctx context.Context, from, until, limit, offset uint64, unpaidOutgoing bool, unpaidIncoming bool, transactionType *string, lnClient lnclient.LNClient, appId *uint, forceFilterByAppId bool) (transactions []Transaction, err error) {
-	svc.checkUnsettledTransactions(ctx, lnClient)
-
-	tx := svc.db
-
-	if !unpaidOutgoing && !unpaidIncoming {
-		tx = tx.Where("state == ?", constants.TRANSACTION_STATE_SETTLED)
-	} else if unpaidOutgoing && !unpaidIncoming {
-		tx = tx.Where(tx.Where("state == ?", constants.TRANSACTION_STATE_SETTLED).
-			Or("type == ?", constants.TRANSACTION_TYPE_OUTGOING))
-	} else if unpaidIncoming && !unpaidOutgoing {
-		tx = tx.Where(tx.Where("state == ?", constants.TRANSACTION_STATE_SETTLED).
-			Or("type == ?", constants.TRANSACTION_TYPE_INCOMING))
-	}
-
+// filterTransactions applies the type, date range and app filters shared by transaction queries
+func (svc *transactionsService) filterTransactions(tx *gorm.DB, from, until uint64, transactionType *string, appId *uint, forceFilterByAppId bool) (*gorm.DB, error) {
 	if transactionType != nil {
 		tx = tx.Where("type == ?", *transactionType)
 	}
@@ -549,22 +2065,22 @@ func (svc *transactionsService) ListTransactions(ctx context.Context, from, unti
 		}
 	}
 
-	tx = tx.Order("updated_at desc")
+	return tx, nil
+}
 
-	if limit > 0 {
-		tx = tx.Limit(int(limit))
-	}
-	if offset > 0 {
-		tx = tx.Offset(int(offset))
+// validateKeysendDestination checks the destination is a hex-encoded 33-byte compressed pubkey
+func validateKeysendDestination(destination string) error {
+	if len(destination) != 66 || (!strings.HasPrefix(destination, "02") && !strings.HasPrefix(destination, "03")) {
+		return NewInvalidDestinationError()
 	}
-
-	result := tx.Find(&transactions)
-	if result.Error != nil {
-		logger.Logger.WithError(result.Error).Error("Failed to list DB transactions")
-		return nil, result.Error
+	if _, err := hex.DecodeString(destination); err != nil {
+		return NewInvalidDestinationError()
 	}
+	return nil
+}
 
-	return transactions, nil
+func escapeLikePattern(value string) string {
+	return strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(value)
 }
 
 func (svc *transactionsService) checkUnsettledTransactions(ctx context.Context, lnClient lnclient.LNClient) {
@@ -574,17 +2090,32 @@ func (svc *transactionsService) checkUnsettledTransactions(ctx context.Context,
 		return
 	}
 
-	// check pending payments less than a day old
+	// check pending payments less than a day old, or that can still be resolved
+	// because of the invoice's min final CLTV expiry
 	transactions := []Transaction{}
-	result := svc.db.Where("state == ? AND created_at > ?", constants.TRANSACTION_STATE_PENDING, time.Now().Add(-24*time.Hour)).Find(&transactions)
+	result := svc.db.Where("state == ? AND (created_at > ? OR min_final_cltv_expiry > ?)",
+		constants.TRANSACTION_STATE_PENDING,
+		time.Now().Add(-unsettledTransactionCheckWindow),
+		uint(unsettledTransactionCheckWindow/averageBlockInterval)).Find(&transactions)
 	if result.Error != nil {
 		logger.Logger.WithError(result.Error).Error("Failed to list DB transactions")
 		return
 	}
 	for _, transaction := range transactions {
+		if time.Now().After(getUnsettledTransactionCheckDeadline(&transaction)) {
+			continue
+		}
 		svc.checkUnsettledTransaction(ctx, &transaction, lnClient)
 	}
 }
+
+// getUnsettledTransactionCheckDeadline returns until when a pending transaction is checked.
+// Payments to invoices with a large min final CLTV expiry can legitimately take longer to resolve,
+// as their HTLCs can be held for at least that many blocks.
+func getUnsettledTransactionCheckDeadline(transaction *db.Transaction) time.Time {
+	window := max(unsettledTransactionCheckWindow, time.Duration(transaction.MinFinalCltvExpiry)*averageBlockInterval)
+	return transaction.CreatedAt.Add(window)
+}
 func (svc *transactionsService) checkUnsettledTransaction(ctx context.Context, transaction *db.Transaction, lnClient lnclient.LNClient) {
 	if slices.Contains(lnClient.GetSupportedNIP47NotificationTypes(), "payment_received") {
 		return
@@ -599,8 +2130,14 @@ func (svc *transactionsService) checkUnsettledTransaction(ctx context.Context, t
 	}
 	// update transaction state
 	if lnClientTransaction.SettledAt != nil {
-		err = svc.db.Transaction(func(tx *gorm.DB) error {
-			_, err = svc.markTransactionSettled(tx, transaction, lnClientTransaction.Preimage, uint64(lnClientTransaction.FeesPaid), false)
+		err = svc.inTransaction(func(tx *gorm.DB, balanceChanges *[]balanceChange) error {
+			if transaction.Type == constants.TRANSACTION_TYPE_INCOMING && lnClientTransaction.ChannelOpenFeeMsat > 0 {
+				err := tx.Model(transaction).Update("channel_open_fee_msat", uint64(lnClientTransaction.ChannelOpenFeeMsat)).Error
+				if err != nil {
+					return err
+				}
+			}
+			_, err = svc.markTransactionSettled(tx, transaction, lnClientTransaction.Preimage, uint64(lnClientTransaction.FeesPaid), false, balanceChanges)
 			return err
 		})
 
@@ -611,6 +2148,11 @@ func (svc *transactionsService) checkUnsettledTransaction(ctx context.Context, t
 }
 
 func (svc *transactionsService) ConsumeEvent(ctx context.Context, event *events.Event, globalProperties map[string]interface{}) {
+	if activityType, ok := activityTypesByEvent[event.Event]; ok {
+		svc.recordActivity(event, activityType)
+		return
+	}
+
 	switch event.Event {
 	case "nwc_lnclient_payment_received":
 		lnClientTransaction, ok := event.Properties.(*lnclient.Transaction)
@@ -619,65 +2161,8 @@ func (svc *transactionsService) ConsumeEvent(ctx context.Context, event *events.
 			return
 		}
 
-		var dbTransaction db.Transaction
-		err := svc.db.Transaction(func(tx *gorm.DB) error {
-
-			result := tx.Limit(1).Find(&dbTransaction, &db.Transaction{
-				Type:        constants.TRANSACTION_TYPE_INCOMING,
-				PaymentHash: lnClientTransaction.PaymentHash,
-			})
-
-			if result.RowsAffected == 0 {
-				var appId *uint
-				description := lnClientTransaction.Description
-				var metadataBytes []byte
-				var boostagramBytes []byte
-				if lnClientTransaction.Metadata != nil {
-					var err error
-					metadataBytes, err = json.Marshal(lnClientTransaction.Metadata)
-					if err != nil {
-						logger.Logger.WithError(err).Error("Failed to serialize transaction metadata")
-						return err
-					}
-
-					var customRecords []lnclient.TLVRecord
-					customRecords, _ = lnClientTransaction.Metadata["tlv_records"].([]lnclient.TLVRecord)
-					boostagramBytes = svc.getBoostagramFromCustomRecords(customRecords)
-					extractedDescription := svc.getDescriptionFromCustomRecords(customRecords)
-					if extractedDescription != "" {
-						description = extractedDescription
-					}
-					// find app by custom key/value records
-					appId = svc.getAppIdFromCustomRecords(customRecords)
-				}
-				var expiresAt *time.Time
-				if lnClientTransaction.ExpiresAt != nil {
-					expiresAtValue := time.Unix(*lnClientTransaction.ExpiresAt, 0)
-					expiresAt = &expiresAtValue
-				}
-				dbTransaction = db.Transaction{
-					Type:            constants.TRANSACTION_TYPE_INCOMING,
-					AmountMsat:      uint64(lnClientTransaction.Amount),
-					PaymentRequest:  lnClientTransaction.Invoice,
-					PaymentHash:     lnClientTransaction.PaymentHash,
-					Description:     description,
-					DescriptionHash: lnClientTransaction.DescriptionHash,
-					ExpiresAt:       expiresAt,
-					Metadata:        datatypes.JSON(metadataBytes),
-					Boostagram:      datatypes.JSON(boostagramBytes),
-					AppId:           appId,
-				}
-				err := tx.Create(&dbTransaction).Error
-				if err != nil {
-					logger.Logger.WithFields(logrus.Fields{
-						"payment_hash": lnClientTransaction.PaymentHash,
-					}).WithError(err).Error("Failed to create transaction")
-					return err
-				}
-			}
-
-			_, err := svc.markTransactionSettled(tx, &dbTransaction, lnClientTransaction.Preimage, uint64(lnClientTransaction.FeesPaid), false)
-			return err
+		err := svc.inTransaction(func(tx *gorm.DB, balanceChanges *[]balanceChange) error {
+			return svc.recordReceivedPayment(tx, lnClientTransaction, balanceChanges)
 		})
 
 		if err != nil {
@@ -694,8 +2179,8 @@ func (svc *transactionsService) ConsumeEvent(ctx context.Context, event *events.
 		}
 
 		var dbTransaction db.Transaction
-		err := svc.db.Transaction(func(tx *gorm.DB) error {
-			result := tx.Limit(1).Find(&dbTransaction, &db.Transaction{
+		err := svc.inTransaction(func(tx *gorm.DB, balanceChanges *[]balanceChange) error {
+			result := tx.Unscoped().Limit(1).Where("split_from_id IS NULL").Find(&dbTransaction, &db.Transaction{
 				Type:        constants.TRANSACTION_TYPE_OUTGOING,
 				PaymentHash: lnClientTransaction.PaymentHash,
 			})
@@ -711,7 +2196,7 @@ func (svc *transactionsService) ConsumeEvent(ctx context.Context, event *events.
 				return NewNotFoundError()
 			}
 
-			_, err := svc.markTransactionSettled(tx, &dbTransaction, lnClientTransaction.Preimage, uint64(lnClientTransaction.FeesPaid), false)
+			_, err := svc.markTransactionSettled(tx, &dbTransaction, lnClientTransaction.Preimage, uint64(lnClientTransaction.FeesPaid), false, balanceChanges)
 			return err
 		})
 
@@ -731,7 +2216,7 @@ func (svc *transactionsService) ConsumeEvent(ctx context.Context, event *events.
 		lnClientTransaction := paymentFailedAsyncProperties.Transaction
 
 		var dbTransaction db.Transaction
-		result := svc.db.Limit(1).Find(&dbTransaction, &db.Transaction{
+		result := svc.db.Limit(1).Where("split_from_id IS NULL").Find(&dbTransaction, &db.Transaction{
 			Type:        constants.TRANSACTION_TYPE_OUTGOING,
 			PaymentHash: lnClientTransaction.PaymentHash,
 		})
@@ -741,49 +2226,280 @@ func (svc *transactionsService) ConsumeEvent(ctx context.Context, event *events.
 			return
 		}
 
-		svc.db.Transaction(func(tx *gorm.DB) error {
-			return svc.markPaymentFailed(tx, &dbTransaction, paymentFailedAsyncProperties.Reason)
+		svc.inTransaction(func(tx *gorm.DB, balanceChanges *[]balanceChange) error {
+			return svc.markPaymentFailed(tx, &dbTransaction, paymentFailedAsyncProperties.Reason, balanceChanges)
 		})
 	}
 }
 
-func (svc *transactionsService) interceptSelfPayment(paymentHash string) (*lnclient.PayInvoiceResponse, error) {
+// recordReceivedPayment settles the incoming transaction of a payment received by the backend,
+// creating it if the payment was made to an invoice we have no record of (e.g. a keysend)
+func (svc *transactionsService) recordReceivedPayment(tx *gorm.DB, lnClientTransaction *lnclient.Transaction, balanceChanges *[]balanceChange) error {
+	var dbTransaction db.Transaction
+	result := tx.Unscoped().Limit(1).Where("split_from_id IS NULL").Find(&dbTransaction, &db.Transaction{
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		PaymentHash: lnClientTransaction.PaymentHash,
+	})
+
+	if result.RowsAffected == 0 {
+		var appId *uint
+		description := lnClientTransaction.Description
+		var metadataBytes []byte
+		var boostagramBytes []byte
+		if lnClientTransaction.Metadata != nil {
+			var err error
+			metadataBytes, err = json.Marshal(lnClientTransaction.Metadata)
+			if err != nil {
+				logger.Logger.WithError(err).Error("Failed to serialize transaction metadata")
+				return err
+			}
+
+			customRecords, err := getTLVRecords(lnClientTransaction.Metadata[tlvRecordsMetadataKey])
+			if err != nil {
+				logger.Logger.WithError(err).WithField("payment_hash", lnClientTransaction.PaymentHash).Warn("Ignoring malformed TLV records of received payment")
+			}
+			boostagramBytes = svc.getBoostagramFromCustomRecords(customRecords)
+			extractedDescription := svc.getDescriptionFromCustomRecords(customRecords)
+			if extractedDescription != "" {
+				description = extractedDescription
+			}
+			// find app by custom key/value records, or any other registered way
+			appId = svc.resolveAppId(customRecords, lnClientTransaction.Metadata, boostagramBytes)
+		}
+		var expiresAt *time.Time
+		if lnClientTransaction.ExpiresAt != nil {
+			expiresAtValue := time.Unix(*lnClientTransaction.ExpiresAt, 0)
+			expiresAt = &expiresAtValue
+		}
+		dbTransaction = db.Transaction{
+			Type:               constants.TRANSACTION_TYPE_INCOMING,
+			AmountMsat:         uint64(lnClientTransaction.Amount),
+			PaymentRequest:     lnClientTransaction.Invoice,
+			PaymentHash:        lnClientTransaction.PaymentHash,
+			Description:        description,
+			DescriptionHash:    lnClientTransaction.DescriptionHash,
+			ExpiresAt:          expiresAt,
+			Metadata:           datatypes.JSON(metadataBytes),
+			Boostagram:         datatypes.JSON(boostagramBytes),
+			IsBoost:            isBoost(boostagramBytes),
+			AppId:              appId,
+			InboundChannelId:   lnClientTransaction.InboundChannelId,
+			Environment:        constants.TRANSACTION_ENVIRONMENT_PROD,
+			ChannelOpenFeeMsat: uint64(max(lnClientTransaction.ChannelOpenFeeMsat, 0)),
+		}
+		quarantined := svc.unknownPaymentPolicy == UnknownPaymentPolicyQuarantine
+		if quarantined {
+			// held for review instead of settled, so no app is credited until it is approved
+			dbTransaction.State = constants.TRANSACTION_STATE_QUARANTINED
+			if lnClientTransaction.Preimage != "" {
+				dbTransaction.Preimage = &lnClientTransaction.Preimage
+			}
+		}
+		err := tx.Create(&dbTransaction).Error
+		if err != nil {
+			logger.Logger.WithFields(logrus.Fields{
+				"payment_hash": lnClientTransaction.PaymentHash,
+			}).WithError(err).Error("Failed to create transaction")
+			return err
+		}
+		if quarantined {
+			svc.publishPaymentQuarantined(&dbTransaction)
+			return nil
+		}
+	} else {
+		if dbTransaction.State == constants.TRANSACTION_STATE_QUARANTINED {
+			logger.Logger.WithField("payment_hash", dbTransaction.PaymentHash).Info("Received payment is already quarantined")
+			return nil
+		}
+
+		// not all backends report the channel the payment arrived on, or the cost of opening it
+		updates := map[string]interface{}{}
+		if lnClientTransaction.InboundChannelId != "" {
+			updates["inbound_channel_id"] = lnClientTransaction.InboundChannelId
+		}
+		if lnClientTransaction.ChannelOpenFeeMsat > 0 {
+			updates["channel_open_fee_msat"] = uint64(lnClientTransaction.ChannelOpenFeeMsat)
+		}
+
+		// a part of a payment received in parts (MPP) that the backend has not reported as settled
+		// is only settled once the full invoice amount has arrived. Some backends (e.g. phoenixd)
+		// report the amount net of the fee for the channel opened to receive it, so the fee counts too
+		partiallyPaid := false
+		if dbTransaction.State != constants.TRANSACTION_STATE_SETTLED && lnClientTransaction.Amount > 0 {
+			receivedAmountMsat := dbTransaction.ReceivedAmountMsat + uint64(lnClientTransaction.Amount)
+			updates["received_amount_msat"] = receivedAmountMsat
+			channelOpenFeeMsat := max(dbTransaction.ChannelOpenFeeMsat, uint64(max(lnClientTransaction.ChannelOpenFeeMsat, 0)))
+			if lnClientTransaction.SettledAt == nil && receivedAmountMsat+channelOpenFeeMsat < dbTransaction.AmountMsat {
+				updates["state"] = constants.TRANSACTION_STATE_ACCEPTED
+				partiallyPaid = true
+			}
+		}
+
+		if len(updates) > 0 {
+			err := tx.Model(&dbTransaction).Updates(updates).Error
+			if err != nil {
+				logger.Logger.WithFields(logrus.Fields{
+					"payment_hash": lnClientTransaction.PaymentHash,
+				}).WithError(err).Error("Failed to update received transaction")
+				return err
+			}
+		}
+
+		if partiallyPaid {
+			logger.Logger.WithFields(logrus.Fields{
+				"payment_hash":         dbTransaction.PaymentHash,
+				"received_amount_msat": dbTransaction.ReceivedAmountMsat,
+				"amount_msat":          dbTransaction.AmountMsat,
+			}).Info("Received part of payment, waiting for the remaining amount")
+			return nil
+		}
+	}
+
+	_, err := svc.markTransactionSettled(tx, &dbTransaction, lnClientTransaction.Preimage, uint64(lnClientTransaction.FeesPaid), false, balanceChanges)
+	return err
+}
+
+// interceptSelfPayment settles the incoming side of a payment to our own node.
+// A non-zero selfPaymentDepth is recorded in the incoming transaction's metadata so that
+// a payment forwarded on by the recipient can carry it along (see validateSelfPaymentDepth).
+// The settlement event of the incoming transaction is returned so it can be published together with
+// the outgoing side's (see publishSelfPaymentEvents)
+func (svc *transactionsService) interceptSelfPayment(ctx context.Context, paymentHash string, selfPaymentDepth int, lnClient lnclient.LNClient) (*lnclient.PayInvoiceResponse, *events.Event, error) {
 	logger.Logger.WithField("payment_hash", paymentHash).Debug("Intercepting self payment")
 	incomingTransaction := db.Transaction{}
-	result := svc.db.Limit(1).Find(&incomingTransaction, &db.Transaction{
+	result := svc.db.Unscoped().Limit(1).Where("split_from_id IS NULL").Find(&incomingTransaction, &db.Transaction{
 		Type:        constants.TRANSACTION_TYPE_INCOMING,
-		State:       constants.TRANSACTION_STATE_PENDING,
 		PaymentHash: paymentHash,
 	})
 	if result.Error != nil {
-		return nil, result.Error
+		return nil, nil, result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return nil, nil, NewSelfPaymentInvoiceNotFoundError()
+	}
+	if incomingTransaction.State == constants.TRANSACTION_STATE_SETTLED {
+		return nil, nil, NewSelfPaymentAlreadySettledError()
+	}
+	if incomingTransaction.State == constants.TRANSACTION_STATE_FAILED ||
+		(incomingTransaction.ExpiresAt != nil && time.Now().After(*incomingTransaction.ExpiresAt)) {
+		return nil, nil, NewSelfPaymentInvoiceExpiredError()
+	}
+	previousIncomingTransaction := incomingTransaction
+	if incomingTransaction.Preimage == nil {
+		// some backends only return the preimage once the invoice is settled,
+		// so it was not stored when the invoice was created
+		lnClientTransaction, err := lnClient.LookupInvoice(ctx, paymentHash)
+		if err != nil {
+			logger.Logger.WithField("payment_hash", paymentHash).WithError(err).Error("Failed to lookup invoice preimage for self payment")
+			return nil, nil, err
+		}
+		if lnClientTransaction.Preimage == "" {
+			return nil, nil, NewSelfPaymentPreimageNotSetError()
+		}
+		incomingTransaction.Preimage = &lnClientTransaction.Preimage
+	}
+
+	err := svc.inTransaction(func(tx *gorm.DB, balanceChanges *[]balanceChange) error {
+		if selfPaymentDepth > 0 {
+			incomingMetadata := map[string]interface{}{}
+			if incomingTransaction.Metadata != nil {
+				err := json.Unmarshal(incomingTransaction.Metadata, &incomingMetadata)
+				if err != nil {
+					return err
+				}
+			}
+			incomingMetadata[constants.SELF_PAYMENT_DEPTH_METADATA_KEY] = selfPaymentDepth
+			incomingMetadataBytes, err := json.Marshal(incomingMetadata)
+			if err != nil {
+				return err
+			}
+			err = tx.Model(&incomingTransaction).Update("metadata", datatypes.JSON(incomingMetadataBytes)).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err := svc.markTransactionSettled(tx, &incomingTransaction, *incomingTransaction.Preimage, uint64(0), true, balanceChanges)
+		return err
+	})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &lnclient.PayInvoiceResponse{
+		Preimage: *incomingTransaction.Preimage,
+		Fee:      0,
+	}, paymentSettledEvent(&incomingTransaction, &previousIncomingTransaction), nil
+}
+
+// getRequestRelayUrl returns the relay the NWC request with the given ID was received through
+func getRequestRelayUrl(tx *gorm.DB, requestEventId *uint) string {
+	if requestEventId == nil {
+		return ""
 	}
+	var requestEvent db.RequestEvent
+	tx.Limit(1).Select("relay_url").Find(&requestEvent, &db.RequestEvent{
+		ID: *requestEventId,
+	})
+	return requestEvent.RelayUrl
+}
 
-	if result.RowsAffected == 0 {
-		return nil, NewNotFoundError()
+// sameAppId returns true if both IDs refer to the same app, or both are nil (the node itself)
+func sameAppId(a *uint, b *uint) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
 	}
-	if incomingTransaction.Preimage == nil {
-		return nil, errors.New("preimage is not set on transaction. Self payments not supported")
+	return *a == *b
+}
+
+// getDecodedInvoiceToStore returns the complete decoded invoice for apps that store it
+// with their payments, so it can be shown without decoding the invoice again
+func (svc *transactionsService) getDecodedInvoiceToStore(tx *gorm.DB, appId *uint, paymentRequest *decodepay.Bolt11) (datatypes.JSON, error) {
+	if appId == nil {
+		return nil, nil
 	}
 
-	err := svc.db.Transaction(func(tx *gorm.DB) error {
-		_, err := svc.markTransactionSettled(tx, &incomingTransaction, *incomingTransaction.Preimage, uint64(0), true)
-		return err
+	var app db.App
+	result := tx.Limit(1).Find(&app, &db.App{
+		ID: *appId,
 	})
+	if result.RowsAffected == 0 || !app.StoreDecodedInvoices {
+		return nil, nil
+	}
 
+	decodedInvoiceBytes, err := json.Marshal(paymentRequest)
 	if err != nil {
+		logger.Logger.WithError(err).Error("Failed to serialize decoded invoice")
 		return nil, err
 	}
+	return datatypes.JSON(decodedInvoiceBytes), nil
+}
 
-	return &lnclient.PayInvoiceResponse{
-		Preimage: *incomingTransaction.Preimage,
-		Fee:      0,
-	}, nil
+// getEnvironment returns the environment a transaction is tagged with in its metadata,
+// defaulting to prod
+func getEnvironment(metadata map[string]interface{}) (string, error) {
+	environment, ok := metadata[constants.ENVIRONMENT_METADATA_KEY]
+	if !ok {
+		return constants.TRANSACTION_ENVIRONMENT_PROD, nil
+	}
+	switch environment {
+	case constants.TRANSACTION_ENVIRONMENT_PROD, constants.TRANSACTION_ENVIRONMENT_TEST:
+		return environment.(string), nil
+	default:
+		return "", fmt.Errorf("invalid transaction environment: %v", environment)
+	}
 }
 
-func (svc *transactionsService) validateCanPay(tx *gorm.DB, appId *uint, amount uint64, description string) error {
-	amountWithFeeReserve := amount + svc.calculateFeeReserveMsat(amount)
+// validateCanPay checks the app (if any) and node can afford a payment.
+// Events about the app's budget are added to pendingEvents, to be published once the payment
+// is committed. A nil pendingEvents is a check only, e.g. before a payment is made, so the
+// budget period is not advanced and isolated apps are not topped up.
+func (svc *transactionsService) validateCanPay(tx *gorm.DB, appId *uint, amount uint64, feeReserveMsat uint64, description string, lnClient lnclient.LNClient, pendingEvents *[]*events.Event) error {
+	amountWithFeeReserve := amount + feeReserveMsat
 
+	isolated := false
 	// ensure balance for isolated apps
 	if appId != nil {
 		var app db.App
@@ -794,6 +2510,16 @@ func (svc *transactionsService) validateCanPay(tx *gorm.DB, appId *uint, amount
 			return NewNotFoundError()
 		}
 
+		if app.Paused {
+			svc.publishAppPausedEvent(&app)
+			return NewAppPausedError()
+		}
+
+		err := svc.validateInFlightPayments(tx, &app)
+		if err != nil {
+			return err
+		}
+
 		var appPermission db.AppPermission
 		result = tx.Limit(1).Find(&appPermission, &db.AppPermission{
 			AppId: *appId,
@@ -803,11 +2529,24 @@ func (svc *transactionsService) validateCanPay(tx *gorm.DB, appId *uint, amount
 			return errors.New("app does not have pay_invoice scope")
 		}
 
+		err = svc.applyFiatBudget(&appPermission)
+		if err != nil {
+			return err
+		}
+
+		isolated = app.Isolated
 		if app.Isolated {
 			balance := queries.GetIsolatedBalance(tx, appPermission.AppId)
 
-			if amountWithFeeReserve > balance {
-				message := NewInsufficientBalanceError().Error()
+			// a check only leaves the top-up to the payment, so a shortfall is not an error yet
+			topUpOnPayment := svc.topUpCallback != nil && pendingEvents == nil
+			if amountWithFeeReserve > balance && svc.topUpCallback != nil && !topUpOnPayment {
+				balance = svc.topUpIsolatedBalance(tx, &app, amountWithFeeReserve-balance, balance)
+			}
+
+			if amountWithFeeReserve > balance && !topUpOnPayment {
+				insufficientBalanceError := newInsufficientBalanceErrorForApp(&app)
+				message := insufficientBalanceError.Error()
 				if description != "" {
 					message += " " + description
 				}
@@ -815,42 +2554,349 @@ func (svc *transactionsService) validateCanPay(tx *gorm.DB, appId *uint, amount
 				svc.eventPublisher.Publish(&events.Event{
 					Event: "nwc_permission_denied",
 					Properties: map[string]interface{}{
+						"app_id":   app.ID,
 						"app_name": app.Name,
 						"code":     constants.ERROR_INSUFFICIENT_BALANCE,
 						"message":  message,
 					},
 				})
-				return NewInsufficientBalanceError()
+				return insufficientBalanceError
 			}
 		}
 
-		if appPermission.MaxAmountSat > 0 {
-			budgetUsageSat := queries.GetBudgetUsageSat(tx, &appPermission)
-			if int(amountWithFeeReserve/1000) > appPermission.MaxAmountSat-int(budgetUsageSat) {
-				message := NewQuotaExceededError().Error()
+		maxAmountSat, budgetRenewal, budgetUsageSat := queries.GetAppBudget(tx, &app, &appPermission)
+		if maxAmountSat > 0 {
+			// the grace absorbs rounding of the amount and fee reserve estimate
+			budgetCheckedAmountMsat := amountWithFeeReserve - min(svc.budgetGraceMsat, amountWithFeeReserve)
+			if int(budgetCheckedAmountMsat/1000) > maxAmountSat-int(budgetUsageSat) {
+				var remainingMsat uint64
+				if uint64(maxAmountSat) > budgetUsageSat {
+					remainingMsat = (uint64(maxAmountSat) - budgetUsageSat) * 1000
+				}
+				quotaExceededError := newQuotaExceededErrorWithAmounts(&app, amountWithFeeReserve, remainingMsat)
+				message := quotaExceededError.Error()
 				if description != "" {
 					message += " " + description
 				}
 				svc.eventPublisher.Publish(&events.Event{
 					Event: "nwc_permission_denied",
 					Properties: map[string]interface{}{
-						"app_name": app.Name,
-						"code":     constants.ERROR_QUOTA_EXCEEDED,
-						"message":  message,
+						"app_id":         app.ID,
+						"app_name":       app.Name,
+						"code":           constants.ERROR_QUOTA_EXCEEDED,
+						"message":        message,
+						"requested_msat": amountWithFeeReserve,
+						"remaining_msat": remainingMsat,
 					},
 				})
-				return NewQuotaExceededError()
+				return quotaExceededError
 			}
 		}
+
+		if pendingEvents != nil {
+			svc.checkBudgetReset(tx, &app, &appPermission, maxAmountSat, budgetRenewal, budgetUsageSat, pendingEvents)
+		}
+	}
+
+	// isolated apps can only spend their own balance, which is not part of the reserve
+	if !isolated {
+		err := svc.validateNodeBalanceReserve(amountWithFeeReserve, lnClient)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkBudgetReset records the budget period an app pays in, adding nwc_budget_reset to pendingEvents
+// the first time it pays in a new period. Resets are detected lazily, so the event is published
+// on the app's first payment after the reset.
+func (svc *transactionsService) checkBudgetReset(tx *gorm.DB, app *db.App, appPermission *db.AppPermission, maxAmountSat int, budgetRenewal string, budgetUsageSat uint64, pendingEvents *[]*events.Event) {
+	if maxAmountSat == 0 {
+		return
+	}
+	budgetPeriodStart := queries.GetBudgetPeriodStart(budgetRenewal)
+	if budgetPeriodStart.IsZero() {
+		return
+	}
+	if appPermission.BudgetPeriodStart != nil && !budgetPeriodStart.After(*appPermission.BudgetPeriodStart) {
+		return
+	}
+
+	// the first period seen is not a reset
+	isReset := appPermission.BudgetPeriodStart != nil
+
+	err := tx.Model(appPermission).Update("budget_period_start", budgetPeriodStart).Error
+	if err != nil {
+		logger.Logger.WithField("app_id", app.ID).WithError(err).Error("Failed to update budget period start")
+		return
+	}
+
+	if !isReset {
+		return
+	}
+
+	var remainingSat uint64
+	if uint64(maxAmountSat) > budgetUsageSat {
+		remainingSat = uint64(maxAmountSat) - budgetUsageSat
+	}
+	*pendingEvents = append(*pendingEvents, &events.Event{
+		Event: "nwc_budget_reset",
+		Properties: map[string]interface{}{
+			"name":           app.Name,
+			"id":             app.ID,
+			"budget_renewal": budgetRenewal,
+			"remaining_sat":  remainingSat,
+		},
+	})
+}
+
+// validateSelfPaymentDepth rejects self payments that are too deep into a chain of
+// internal transfers (e.g. app A pays app B which automatically pays app A again)
+func (svc *transactionsService) validateSelfPaymentDepth(tx *gorm.DB, appId *uint, selfPaymentDepth int) error {
+	maxSelfPaymentDepth := constants.DEFAULT_MAX_SELF_PAYMENT_DEPTH
+	if appId != nil {
+		var app db.App
+		result := tx.Limit(1).Find(&app, &db.App{
+			ID: *appId,
+		})
+		if result.RowsAffected > 0 && app.MaxSelfPaymentDepth > 0 {
+			maxSelfPaymentDepth = int(app.MaxSelfPaymentDepth)
+		}
+	}
+
+	if selfPaymentDepth > maxSelfPaymentDepth {
+		logger.Logger.WithFields(logrus.Fields{
+			"app_id":                 appId,
+			"self_payment_depth":     selfPaymentDepth,
+			"max_self_payment_depth": maxSelfPaymentDepth,
+		}).Warn("Rejecting self payment exceeding maximum depth")
+		return NewSelfPaymentLoopError()
+	}
+	return nil
+}
+
+// getSelfPaymentDepth returns the number of self payments preceding a payment,
+// as provided by the caller in the payment metadata
+func getSelfPaymentDepth(metadata map[string]interface{}) int {
+	switch depth := metadata[constants.SELF_PAYMENT_DEPTH_METADATA_KEY].(type) {
+	case int:
+		return depth
+	case float64:
+		// metadata decoded from JSON
+		return int(depth)
+	default:
+		return 0
+	}
+}
+
+// getMaxMetadataLength returns the app's metadata limit if it has one,
+// capped by the global hard limit
+func (svc *transactionsService) getMaxMetadataLength(appId *uint) int {
+	if appId == nil {
+		return constants.INVOICE_METADATA_MAX_LENGTH
+	}
+
+	var app db.App
+	result := svc.db.Limit(1).Find(&app, &db.App{
+		ID: *appId,
+	})
+	if result.RowsAffected == 0 || app.MaxMetadataLength == 0 {
+		return constants.INVOICE_METADATA_MAX_LENGTH
+	}
+
+	return min(int(app.MaxMetadataLength), constants.INVOICE_METADATA_HARD_MAX_LENGTH)
+}
+
+// validateInvoiceNotExpired rejects invoices that expired more than invoiceExpiryPaymentGracePeriod ago
+func validateInvoiceNotExpired(paymentRequest *decodepay.Bolt11) error {
+	if paymentRequest.Expiry <= 0 {
+		return nil
+	}
+	expiresAt := time.Unix(int64(paymentRequest.CreatedAt)+int64(paymentRequest.Expiry), 0)
+	if time.Now().After(expiresAt.Add(invoiceExpiryPaymentGracePeriod)) {
+		return NewInvoiceExpiredError()
+	}
+	return nil
+}
+
+// validateDescription rejects invoices without a description or description hash
+// for apps that require one
+func (svc *transactionsService) validateDescription(tx *gorm.DB, appId *uint, description string, descriptionHash string) error {
+	if appId == nil || description != "" || descriptionHash != "" {
+		return nil
+	}
+
+	var app db.App
+	result := tx.Limit(1).Find(&app, &db.App{
+		ID: *appId,
+	})
+	if result.RowsAffected == 0 {
+		return NewNotFoundError()
+	}
+
+	if app.RequireDescription {
+		return NewDescriptionRequiredError()
+	}
+
+	return nil
+}
+
+// getDefaultInvoiceDescription returns the description of the app's invoices created without one
+func (svc *transactionsService) getDefaultInvoiceDescription(appId *uint) string {
+	if appId == nil {
+		return ""
+	}
+
+	var app db.App
+	result := svc.db.Limit(1).Find(&app, &db.App{
+		ID: *appId,
+	})
+	if result.RowsAffected == 0 {
+		return ""
+	}
+
+	return app.DefaultInvoiceDescription
+}
+
+// findOpenInvoiceWithDescriptionHash returns the app's unexpired pending invoice with the given
+// description hash, if the app only allows one open invoice per description hash
+func (svc *transactionsService) findOpenInvoiceWithDescriptionHash(tx *gorm.DB, appId *uint, descriptionHash string) (*db.Transaction, error) {
+	if appId == nil || descriptionHash == "" {
+		return nil, nil
+	}
+
+	var app db.App
+	result := tx.Limit(1).Find(&app, &db.App{
+		ID: *appId,
+	})
+	if result.RowsAffected == 0 || !app.UniqueDescriptionHash {
+		return nil, nil
+	}
+
+	var existingTransaction db.Transaction
+	result = tx.Limit(1).
+		Where("(expires_at IS NULL OR expires_at > ?)", time.Now()).
+		Order("created_at desc").
+		Find(&existingTransaction, &db.Transaction{
+			AppId:           appId,
+			Type:            constants.TRANSACTION_TYPE_INCOMING,
+			State:           constants.TRANSACTION_STATE_PENDING,
+			DescriptionHash: descriptionHash,
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &existingTransaction, nil
+}
+
+// validateCanReceive checks an app is allowed to create an invoice for the given amount (in millisats).
+// If the app has a max receive amount set, it limits the amount of a single invoice.
+func (svc *transactionsService) validateCanReceive(tx *gorm.DB, appId *uint, amount uint64, description string) error {
+	if appId == nil {
+		return nil
+	}
+
+	var app db.App
+	result := tx.Limit(1).Find(&app, &db.App{
+		ID: *appId,
+	})
+	if result.RowsAffected == 0 {
+		return NewNotFoundError()
+	}
+
+	result = tx.Limit(1).Find(&db.AppPermission{}, &db.AppPermission{
+		AppId: *appId,
+		Scope: constants.MAKE_INVOICE_SCOPE,
+	})
+	if result.RowsAffected == 0 {
+		err := errors.New("app does not have make_invoice scope")
+		svc.eventPublisher.Publish(&events.Event{
+			Event: "nwc_permission_denied",
+			Properties: map[string]interface{}{
+				"app_id":   app.ID,
+				"app_name": app.Name,
+				"code":     constants.ERROR_RESTRICTED,
+				"message":  err.Error(),
+			},
+		})
+		return err
+	}
+
+	if app.MaxReceiveAmountSat > 0 && amount/1000 > app.MaxReceiveAmountSat {
+		message := NewReceiveLimitExceededError().Error()
+		if description != "" {
+			message += " " + description
+		}
+		svc.eventPublisher.Publish(&events.Event{
+			Event: "nwc_permission_denied",
+			Properties: map[string]interface{}{
+				"app_id":   app.ID,
+				"app_name": app.Name,
+				"code":     constants.ERROR_RESTRICTED,
+				"message":  message,
+			},
+		})
+		return NewReceiveLimitExceededError()
 	}
 
 	return nil
 }
 
-// max of 1% or 10000 millisats (10 sats)
-func (svc *transactionsService) calculateFeeReserveMsat(amount uint64) uint64 {
-	// NOTE: LDK defaults to 1% of the payment amount + 50 sats
-	return uint64(math.Max(math.Ceil(float64(amount)*0.01), 10000))
+// minimum fee reserves for backends known to charge more than the default minimum
+var minFeeReserveMsatByBackendType = map[string]uint64{
+	// LDK defaults to a max fee of 1% of the payment amount + 50 sats
+	config.LDKBackendType: 50000,
+	// payments are routed through the LSP, which charges a base fee
+	config.PhoenixBackendType: 20000,
+	config.BreezBackendType:   20000,
+}
+
+// GetFeeReserve returns the fee reserve a payment of amountMsat would be charged, so it can be
+// shown before the payment is sent. The payee is optional; if it is known the reserve may be adjusted
+// based on previous payments to it, as when the payment is sent.
+func (svc *transactionsService) GetFeeReserve(amountMsat uint64, payee string, appId *uint, lnClient lnclient.LNClient) uint64 {
+	return svc.calculateFeeReserveMsat(amountMsat, payee, appId, lnClient)
+}
+
+// max of 1% or the minimum fee reserve (the app's override, or the backend's minimum fee reserve
+// which is 10 sats unless set above), adjusted based on previous payments to the payee
+// if the dynamic fee reserve is enabled
+func (svc *transactionsService) calculateFeeReserveMsat(amount uint64, payee string, appId *uint, lnClient lnclient.LNClient) uint64 {
+	minFeeReserveMsat := svc.getMinFeeReserveMsat(appId, lnClient)
+	feeReserveMsat := calculateStaticFeeReserveMsat(amount, minFeeReserveMsat, svc.feeReserveRounding)
+	if svc.dynamicFeeReserve && payee != "" {
+		feeReserveMsat = svc.adjustFeeReserveMsat(amount, payee, feeReserveMsat, minFeeReserveMsat)
+	}
+	return feeReserveMsat
+}
+
+// getMinFeeReserveMsat returns the app's override of the minimum fee reserve,
+// or the backend's minimum fee reserve
+func (svc *transactionsService) getMinFeeReserveMsat(appId *uint, lnClient lnclient.LNClient) uint64 {
+	minFeeReserveMsat, ok := minFeeReserveMsatByBackendType[lnClient.GetBackendType()]
+	if !ok {
+		minFeeReserveMsat = constants.DEFAULT_MIN_FEE_RESERVE_MSAT
+	}
+	if appId != nil {
+		var app db.App
+		result := svc.db.Limit(1).Find(&app, &db.App{
+			ID: *appId,
+		})
+		if result.RowsAffected > 0 && app.MinFeeReserveMsat > 0 {
+			minFeeReserveMsat = app.MinFeeReserveMsat
+		}
+	}
+	return minFeeReserveMsat
+}
+
+// max of 1% or the minimum fee reserve
+func calculateStaticFeeReserveMsat(amount uint64, minFeeReserveMsat uint64, rounding FeeReserveRounding) uint64 {
+	return uint64(math.Max(roundFeeReserveMsat(float64(amount)*0.01, rounding), float64(minFeeReserveMsat)))
 }
 
 func makePreimageHex() ([]byte, error) {
@@ -877,64 +2923,28 @@ func (svc *transactionsService) getBoostagramFromCustomRecords(customRecords []l
 }
 
 func (svc *transactionsService) getDescriptionFromCustomRecords(customRecords []lnclient.TLVRecord) string {
-	var description string
-
-	for _, record := range customRecords {
-		switch record.Type {
-		case BoostagramTlvType:
-			bytes, err := hex.DecodeString(record.Value)
-			if err != nil {
-				continue
-			}
-			var boostagram Boostagram
-			if err := json.Unmarshal(bytes, &boostagram); err != nil {
+	for _, extractor := range svc.descriptionExtractors {
+		for _, record := range customRecords {
+			if record.Type != extractor.tlvType {
 				continue
 			}
-			return boostagram.Message
-
-		// TODO: consider adding support for this in LDK
-		case WhatsatTlvType:
 			bytes, err := hex.DecodeString(record.Value)
-			if err == nil {
-				description = string(bytes)
-			}
-		}
-	}
-
-	return description
-}
-
-func (svc *transactionsService) getAppIdFromCustomRecords(customRecords []lnclient.TLVRecord) *uint {
-	app := db.App{}
-	for _, record := range customRecords {
-		if record.Type == CustomKeyTlvType {
-			decodedString, err := hex.DecodeString(record.Value)
 			if err != nil {
-				logger.Logger.WithError(err).Error("Failed to parse custom key TLV record as hex")
 				continue
 			}
-			customValue, err := strconv.ParseUint(string(decodedString), 10, 64)
-			if err != nil {
-				logger.Logger.WithError(err).Error("Failed to parse custom key TLV record as number")
-				continue
-			}
-			err = svc.db.Take(&app, &db.App{
-				ID: uint(customValue),
-			}).Error
-			if err != nil {
-				logger.Logger.WithError(err).Error("Failed to find app by id from custom key TLV record")
-				continue
+			if description, ok := extractor.extract(bytes); ok {
+				return description
 			}
-			return &app.ID
 		}
 	}
-	return nil
+
+	return ""
 }
 
-func (svc *transactionsService) markTransactionSettled(tx *gorm.DB, dbTransaction *db.Transaction, preimage string, fee uint64, selfPayment bool) (*db.Transaction, error) {
+func (svc *transactionsService) markTransactionSettled(tx *gorm.DB, dbTransaction *db.Transaction, preimage string, fee uint64, selfPayment bool, balanceChanges *[]balanceChange) (*db.Transaction, error) {
 	// TODO: it would be better to have a database constraint so we cannot have two pending payments
 	var existingSettledTransaction db.Transaction
-	if tx.Limit(1).Find(&existingSettledTransaction, &db.Transaction{
+	if tx.Unscoped().Limit(1).Where("split_from_id IS NULL").Find(&existingSettledTransaction, &db.Transaction{
 		Type:        dbTransaction.Type,
 		PaymentHash: dbTransaction.PaymentHash,
 		State:       constants.TRANSACTION_STATE_SETTLED,
@@ -947,8 +2957,11 @@ func (svc *transactionsService) markTransactionSettled(tx *gorm.DB, dbTransactio
 		return nil, errors.New("no preimage in payment")
 	}
 
+	previousTransaction := *dbTransaction
+	previousBalanceContributionMsat := isolatedBalanceContributionMsat(dbTransaction)
+
 	now := time.Now()
-	err := tx.Model(dbTransaction).Updates(map[string]interface{}{
+	err := tx.Unscoped().Model(dbTransaction).Updates(map[string]interface{}{
 		"State":          constants.TRANSACTION_STATE_SETTLED,
 		"Preimage":       &preimage,
 		"FeeMsat":        fee,
@@ -968,15 +2981,41 @@ func (svc *transactionsService) markTransactionSettled(tx *gorm.DB, dbTransactio
 		"type":         dbTransaction.Type,
 	}).Info("Marked transaction as settled")
 
-	event := "nwc_payment_sent"
-	if dbTransaction.Type == constants.TRANSACTION_TYPE_INCOMING {
-		event = "nwc_payment_received"
+	var splitTransactions []db.Transaction
+	if dbTransaction.Type == constants.TRANSACTION_TYPE_INCOMING && len(dbTransaction.SplitRule) > 0 {
+		splitTransactions, err = svc.applySplitRule(tx, dbTransaction, balanceChanges)
+		if err != nil {
+			logger.Logger.WithFields(logrus.Fields{
+				"payment_hash": dbTransaction.PaymentHash,
+			}).WithError(err).Error("Failed to split received payment")
+			return nil, err
+		}
 	}
 
-	svc.eventPublisher.Publish(&events.Event{
-		Event:      event,
-		Properties: dbTransaction,
-	})
+	recordBalanceChange(balanceChanges, dbTransaction, previousBalanceContributionMsat)
+
+	// a keysend merged into an aggregated transaction no longer exists,
+	// so its settlement event is published for the aggregate
+	eventTransaction, eventPreviousTransaction := dbTransaction, &previousTransaction
+	if dbTransaction.Type == constants.TRANSACTION_TYPE_OUTGOING && dbTransaction.PaymentRequest == "" && !selfPayment {
+		aggregateTransaction, previousAggregateTransaction, err := svc.aggregateKeysend(tx, dbTransaction)
+		if err != nil {
+			logger.Logger.WithFields(logrus.Fields{
+				"payment_hash": dbTransaction.PaymentHash,
+			}).WithError(err).Error("Failed to aggregate keysend")
+			return nil, err
+		}
+		if aggregateTransaction != nil {
+			eventTransaction, eventPreviousTransaction = aggregateTransaction, previousAggregateTransaction
+		}
+	}
+
+	// the events of both sides of a self payment are published together once
+	// both are settled, so their order is deterministic (see publishSelfPaymentEvents)
+	if !selfPayment {
+		svc.eventPublisher.Publish(svc.trackNotification(paymentSettledEvent(eventTransaction, eventPreviousTransaction)))
+	}
+	svc.publishSplitTransactions(splitTransactions)
 
 	if dbTransaction.Type == constants.TRANSACTION_TYPE_OUTGOING && dbTransaction.AppId != nil {
 		svc.checkBudgetUsage(dbTransaction)
@@ -1008,8 +3047,17 @@ func (svc *transactionsService) checkBudgetUsage(dbTransaction *db.Transaction)
 		return
 	}
 
-	budgetUsage := queries.GetBudgetUsageSat(svc.db, &appPermission)
-	warningUsage := uint64(math.Floor(float64(appPermission.MaxAmountSat) * 0.8))
+	err := svc.applyFiatBudget(&appPermission)
+	if err != nil {
+		logger.Logger.WithField("app_id", dbTransaction.AppId).WithError(err).Error("failed to apply fiat budget")
+		return
+	}
+
+	maxAmountSat, _, budgetUsage := queries.GetAppBudget(svc.db, &app, &appPermission)
+	if maxAmountSat == 0 {
+		return
+	}
+	warningUsage := uint64(math.Floor(float64(maxAmountSat) * 0.8))
 	if budgetUsage >= warningUsage && budgetUsage-dbTransaction.AmountMsat/1000 < warningUsage {
 		svc.eventPublisher.Publish(&events.Event{
 			Event: "nwc_budget_warning",
@@ -1021,9 +3069,9 @@ func (svc *transactionsService) checkBudgetUsage(dbTransaction *db.Transaction)
 	}
 }
 
-func (svc *transactionsService) markPaymentFailed(tx *gorm.DB, dbTransaction *db.Transaction, reason string) error {
+func (svc *transactionsService) markPaymentFailed(tx *gorm.DB, dbTransaction *db.Transaction, reason string, balanceChanges *[]balanceChange) error {
 	var existingTransaction db.Transaction
-	result := tx.Limit(1).Find(&existingTransaction, &db.Transaction{
+	result := tx.Unscoped().Limit(1).Find(&existingTransaction, &db.Transaction{
 		ID: dbTransaction.ID,
 	})
 
@@ -1037,10 +3085,12 @@ func (svc *transactionsService) markPaymentFailed(tx *gorm.DB, dbTransaction *db
 		return nil
 	}
 
-	err := tx.Model(dbTransaction).Updates(map[string]interface{}{
+	now := time.Now()
+	err := tx.Unscoped().Model(dbTransaction).Updates(map[string]interface{}{
 		"State":          constants.TRANSACTION_STATE_FAILED,
 		"FeeReserveMsat": 0,
 		"FailureReason":  reason,
+		"FailedAt":       &now,
 	}).Error
 	if err != nil {
 		logger.Logger.WithFields(logrus.Fields{
@@ -1050,9 +3100,93 @@ func (svc *transactionsService) markPaymentFailed(tx *gorm.DB, dbTransaction *db
 	}
 	logger.Logger.WithField("payment_hash", dbTransaction.PaymentHash).Info("Marked transaction as failed")
 
+	recordBalanceChange(balanceChanges, dbTransaction, isolatedBalanceContributionMsat(&existingTransaction))
+
 	svc.eventPublisher.Publish(&events.Event{
-		Event:      "nwc_payment_failed",
-		Properties: dbTransaction,
+		Event:              "nwc_payment_failed",
+		Properties:         dbTransaction,
+		PreviousProperties: &existingTransaction,
+	})
+	return nil
+}
+
+// balanceChange is a change to an app's balance made within a database transaction,
+// to be published once the transaction has been committed
+type balanceChange struct {
+	appId     uint
+	deltaMsat int64
+}
+
+// inTransaction runs fn in a database transaction and publishes the balance changes
+// it records only after the transaction has been committed successfully
+func (svc *transactionsService) inTransaction(fn func(tx *gorm.DB, balanceChanges *[]balanceChange) error) error {
+	balanceChanges := []balanceChange{}
+	err := svc.db.Transaction(func(tx *gorm.DB) error {
+		return fn(tx, &balanceChanges)
 	})
+	if err != nil {
+		return err
+	}
+
+	// transactions are settled or failed within these database transactions
+	svc.listTransactionsCache.invalidate()
+	svc.publishBalanceChanges(balanceChanges)
 	return nil
 }
+
+// publishEvents publishes events collected while a database transaction was open, once it is committed
+func (svc *transactionsService) publishEvents(pendingEvents []*events.Event) {
+	for _, event := range pendingEvents {
+		svc.eventPublisher.Publish(event)
+	}
+}
+
+func (svc *transactionsService) publishBalanceChanges(balanceChanges []balanceChange) {
+	for _, balanceChange := range balanceChanges {
+		var app db.App
+		result := svc.db.Limit(1).Find(&app, &db.App{
+			ID: balanceChange.appId,
+		})
+		if result.RowsAffected == 0 || !app.Isolated {
+			continue
+		}
+
+		svc.eventPublisher.Publish(&events.Event{
+			Event: "nwc_balance_changed",
+			Properties: map[string]interface{}{
+				"app_id":       app.ID,
+				"balance_msat": queries.GetIsolatedBalance(svc.db, app.ID),
+				"delta_msat":   balanceChange.deltaMsat,
+			},
+		})
+	}
+}
+
+// recordBalanceChange records the change to the app's balance caused by a transaction
+// moving from a state contributing previousBalanceContributionMsat to its current state
+func recordBalanceChange(balanceChanges *[]balanceChange, dbTransaction *db.Transaction, previousBalanceContributionMsat int64) {
+	if balanceChanges == nil || dbTransaction.AppId == nil {
+		return
+	}
+	deltaMsat := isolatedBalanceContributionMsat(dbTransaction) - previousBalanceContributionMsat
+	if deltaMsat == 0 {
+		return
+	}
+	*balanceChanges = append(*balanceChanges, balanceChange{
+		appId:     *dbTransaction.AppId,
+		deltaMsat: deltaMsat,
+	})
+}
+
+// isolatedBalanceContributionMsat returns how much a transaction adds to (or, if negative,
+// reserves or spends from) an isolated app's balance. See queries.GetIsolatedBalance
+func isolatedBalanceContributionMsat(dbTransaction *db.Transaction) int64 {
+	switch {
+	case dbTransaction.Type == constants.TRANSACTION_TYPE_INCOMING && dbTransaction.State == constants.TRANSACTION_STATE_SETTLED:
+		return int64(dbTransaction.AmountMsat)
+	case dbTransaction.Type == constants.TRANSACTION_TYPE_OUTGOING && (dbTransaction.State == constants.TRANSACTION_STATE_SETTLED || dbTransaction.State == constants.TRANSACTION_STATE_PENDING):
+		return -int64(dbTransaction.AmountMsat + dbTransaction.FeeMsat + dbTransaction.FeeReserveMsat)
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,68 @@
+package transactions
+
+import (
+	"context"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/events"
+	"github.com/getAlby/hub/logger"
+	"gorm.io/gorm"
+)
+
+// UnknownPaymentPolicy is how a payment received for an invoice we have no record of
+// (e.g. a keysend, or an invoice created outside of the hub) is handled
+type UnknownPaymentPolicy string
+
+const (
+	// the payment is settled straight away, crediting the app it is for. This is the default.
+	UnknownPaymentPolicyAccept UnknownPaymentPolicy = "accept"
+	// the payment is recorded as quarantined and only settled once approved
+	// (see ApproveQuarantinedPayment), so no app is credited until then
+	UnknownPaymentPolicyQuarantine UnknownPaymentPolicy = "quarantine"
+)
+
+// SetUnknownPaymentPolicy sets how payments received for unknown invoices are handled
+func (svc *transactionsService) SetUnknownPaymentPolicy(policy UnknownPaymentPolicy) {
+	svc.unknownPaymentPolicy = policy
+}
+
+func (svc *transactionsService) publishPaymentQuarantined(dbTransaction *db.Transaction) {
+	logger.Logger.WithField("payment_hash", dbTransaction.PaymentHash).Warn("Quarantined payment received for an unknown invoice")
+	svc.eventPublisher.Publish(&events.Event{
+		Event:      "nwc_payment_quarantined",
+		Properties: dbTransaction,
+	})
+}
+
+// ApproveQuarantinedPayment settles a payment held for review, crediting the app it is for
+func (svc *transactionsService) ApproveQuarantinedPayment(ctx context.Context, id uint) (*Transaction, error) {
+	var settledTransaction *db.Transaction
+	err := svc.inTransaction(func(tx *gorm.DB, balanceChanges *[]balanceChange) error {
+		var dbTransaction db.Transaction
+		result := tx.Limit(1).Find(&dbTransaction, &db.Transaction{
+			ID:    id,
+			Type:  constants.TRANSACTION_TYPE_INCOMING,
+			State: constants.TRANSACTION_STATE_QUARANTINED,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return NewNotFoundError()
+		}
+
+		var preimage string
+		if dbTransaction.Preimage != nil {
+			preimage = *dbTransaction.Preimage
+		}
+		var err error
+		settledTransaction, err = svc.markTransactionSettled(tx, &dbTransaction, preimage, 0, false, balanceChanges)
+		return err
+	})
+	if err != nil {
+		logger.Logger.WithField("id", id).WithError(err).Error("Failed to approve quarantined payment")
+		return nil, err
+	}
+	return settledTransaction, nil
+}
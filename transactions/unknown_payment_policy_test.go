@@ -0,0 +1,163 @@
+package transactions
+
+import (
+	"context"
+	"encoding/hex"
+	"strconv"
+	"testing"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/db/queries"
+	"github.com/getAlby/hub/events"
+	"github.com/getAlby/hub/lnclient"
+	"github.com/getAlby/hub/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReceivePayment_UnknownPaymentPolicy(t *testing.T) {
+	ctx := context.TODO()
+
+	for name, testCase := range map[string]struct {
+		policy        UnknownPaymentPolicy
+		expectedState string
+		expectedMsat  uint64
+	}{
+		"accept": {
+			policy:        UnknownPaymentPolicyAccept,
+			expectedState: constants.TRANSACTION_STATE_SETTLED,
+			expectedMsat:  1000,
+		},
+		"quarantine": {
+			policy:        UnknownPaymentPolicyQuarantine,
+			expectedState: constants.TRANSACTION_STATE_QUARANTINED,
+			expectedMsat:  0,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer tests.RemoveTestService()
+			svc, err := tests.CreateTestService()
+			require.NoError(t, err)
+
+			app, _, err := tests.CreateApp(svc)
+			require.NoError(t, err)
+			app.Isolated = true
+			require.NoError(t, svc.DB.Save(app).Error)
+
+			mockEventConsumer := tests.NewMockEventConsumer()
+			svc.EventPublisher.RegisterSubscriber(mockEventConsumer)
+
+			transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+			transactionsService.SetUnknownPaymentPolicy(testCase.policy)
+
+			// a keysend to the app, received twice as backends may report a payment more than once
+			lnClientTransaction := newKeysendToApp(app.ID)
+			for i := 0; i < 2; i++ {
+				transactionsService.ConsumeEvent(ctx, &events.Event{
+					Event:      "nwc_lnclient_payment_received",
+					Properties: lnClientTransaction,
+				}, map[string]interface{}{})
+			}
+
+			var transactions []db.Transaction
+			require.NoError(t, svc.DB.Find(&transactions).Error)
+			require.Equal(t, 1, len(transactions))
+			assert.Equal(t, testCase.expectedState, transactions[0].State)
+			assert.Equal(t, app.ID, *transactions[0].AppId)
+			assert.Equal(t, lnClientTransaction.Preimage, *transactions[0].Preimage)
+			assert.Equal(t, testCase.expectedMsat, queries.GetIsolatedBalance(svc.DB, app.ID))
+
+			consumedEvents := []string{}
+			for _, event := range mockEventConsumer.GetConsumedEvents() {
+				consumedEvents = append(consumedEvents, event.Event)
+			}
+			if testCase.policy == UnknownPaymentPolicyQuarantine {
+				assert.Contains(t, consumedEvents, "nwc_payment_quarantined")
+				assert.NotContains(t, consumedEvents, "nwc_payment_received")
+			} else {
+				assert.Contains(t, consumedEvents, "nwc_payment_received")
+				assert.NotContains(t, consumedEvents, "nwc_payment_quarantined")
+			}
+		})
+	}
+}
+
+func TestApproveQuarantinedPayment(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+	app.Isolated = true
+	require.NoError(t, svc.DB.Save(app).Error)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transactionsService.SetUnknownPaymentPolicy(UnknownPaymentPolicyQuarantine)
+
+	lnClientTransaction := newKeysendToApp(app.ID)
+	transactionsService.ConsumeEvent(ctx, &events.Event{
+		Event:      "nwc_lnclient_payment_received",
+		Properties: lnClientTransaction,
+	}, map[string]interface{}{})
+
+	var quarantinedTransaction db.Transaction
+	require.NoError(t, svc.DB.First(&quarantinedTransaction).Error)
+	assert.Zero(t, queries.GetIsolatedBalance(svc.DB, app.ID))
+
+	transaction, err := transactionsService.ApproveQuarantinedPayment(ctx, quarantinedTransaction.ID)
+	require.NoError(t, err)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transaction.State)
+	assert.NotNil(t, transaction.SettledAt)
+	assert.Equal(t, uint64(1000), queries.GetIsolatedBalance(svc.DB, app.ID))
+
+	// only quarantined payments can be approved
+	_, err = transactionsService.ApproveQuarantinedPayment(ctx, quarantinedTransaction.ID)
+	assert.ErrorIs(t, err, NewNotFoundError())
+}
+
+func TestReceivePayment_QuarantinePolicyKnownInvoice(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	transactionsService := NewTransactionsService(svc.DB, svc.EventPublisher)
+	transactionsService.SetUnknownPaymentPolicy(UnknownPaymentPolicyQuarantine)
+
+	_, err = transactionsService.MakeInvoice(ctx, 123000, "Hello world", "", 0, nil, svc.LNClient, nil, nil, "")
+	require.NoError(t, err)
+
+	transactionsService.ConsumeEvent(ctx, &events.Event{
+		Event:      "nwc_lnclient_payment_received",
+		Properties: tests.MockLNClientTransaction,
+	}, map[string]interface{}{})
+
+	// payments for our own invoices are expected, so they settle as usual
+	transactionType := constants.TRANSACTION_TYPE_INCOMING
+	transaction, err := transactionsService.LookupTransaction(ctx, tests.MockLNClientTransaction.PaymentHash, &transactionType, svc.LNClient, nil, false)
+	require.NoError(t, err)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, transaction.State)
+}
+
+func newKeysendToApp(appId uint) *lnclient.Transaction {
+	return &lnclient.Transaction{
+		Type:        "incoming",
+		Preimage:    "9f59b18f80a77c2930deb8be5ff1143eacdd1891c63c23d61bc9f99c64e57325",
+		PaymentHash: "ae4277b7be3ca1420cafd24c143866190f52b996856b0e4164763f936e61ea1b",
+		Amount:      1000,
+		SettledAt:   &tests.MockTimeUnix,
+		Metadata: map[string]interface{}{
+			"tlv_records": []lnclient.TLVRecord{
+				{
+					Type:  CustomKeyTlvType,
+					Value: hex.EncodeToString([]byte(strconv.FormatUint(uint64(appId), 10))),
+				},
+			},
+		},
+	}
+}
@@ -3,6 +3,7 @@ package utils
 import (
 	"fmt"
 	"io"
+	"net"
 	"os"
 )
 
@@ -55,3 +56,10 @@ func Filter[T any](s []T, f func(T) bool) []T {
 	}
 	return r
 }
+
+// IsPublicIP returns false for loopback, private, link-local and other addresses
+// that do not reach a host on the public internet
+func IsPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified())
+}
@@ -0,0 +1,371 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/events"
+	"github.com/getAlby/hub/logger"
+	"github.com/getAlby/hub/utils"
+	"github.com/sirupsen/logrus"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+const (
+	SignatureHeader = "X-Hub-Signature-256"
+	TimestampHeader = "X-Hub-Timestamp"
+	EventHeader     = "X-Hub-Event"
+)
+
+type WebhooksService interface {
+	events.EventSubscriber
+	// RegisterWebhook sets the callback URL for an app and returns a newly generated signing secret
+	RegisterWebhook(appId uint, webhookUrl string) (string, error)
+	DeleteWebhook(appId uint) error
+}
+
+type webhooksService struct {
+	db     *gorm.DB
+	client *http.Client
+	// client for the callbacks registered with invoices, which only connects to public addresses
+	notifyClient *http.Client
+	maxAttempts  int
+	retryDelay   time.Duration
+	// deliveries that are still being attempted
+	deliveries sync.WaitGroup
+}
+
+func NewWebhooksService(db *gorm.DB) *webhooksService {
+	return &webhooksService{
+		db:           db,
+		client:       &http.Client{Timeout: 10 * time.Second},
+		notifyClient: newPublicOnlyClient(),
+		maxAttempts:  5,
+		retryDelay:   5 * time.Second,
+	}
+}
+
+type webhookPayload struct {
+	Event       string             `json:"event"`
+	Transaction webhookTransaction `json:"transaction"`
+	// what changed in the transaction, if its previous state is known
+	Changes *webhookChanges `json:"changes,omitempty"`
+}
+
+type webhookChanges struct {
+	PreviousState string `json:"previous_state"`
+	State         string `json:"state"`
+	// the previous and new values of each changed field, keyed by field name
+	Fields map[string]webhookFieldChange `json:"fields"`
+}
+
+type webhookFieldChange struct {
+	Previous interface{} `json:"previous"`
+	Current  interface{} `json:"current"`
+}
+
+type webhookTransaction struct {
+	Type            string         `json:"type"`
+	State           string         `json:"state"`
+	Invoice         string         `json:"invoice"`
+	Description     string         `json:"description"`
+	DescriptionHash string         `json:"description_hash"`
+	Preimage        *string        `json:"preimage"`
+	PaymentHash     string         `json:"payment_hash"`
+	AmountMsat      uint64         `json:"amount"`
+	FeesPaidMsat    uint64         `json:"fees_paid"`
+	CreatedAt       time.Time      `json:"created_at"`
+	ExpiresAt       *time.Time     `json:"expires_at"`
+	SettledAt       *time.Time     `json:"settled_at"`
+	Metadata        datatypes.JSON `json:"metadata,omitempty"`
+	FailureReason   string         `json:"failure_reason,omitempty"`
+}
+
+func (svc *webhooksService) RegisterWebhook(appId uint, webhookUrl string) (string, error) {
+	parsedUrl, err := url.Parse(webhookUrl)
+	if err != nil || (parsedUrl.Scheme != "https" && parsedUrl.Scheme != "http") || parsedUrl.Host == "" {
+		return "", fmt.Errorf("invalid webhook url: %s", webhookUrl)
+	}
+
+	secretBytes := make([]byte, 32)
+	_, err = rand.Read(secretBytes)
+	if err != nil {
+		return "", err
+	}
+	secret := hex.EncodeToString(secretBytes)
+
+	result := svc.db.Model(&db.App{}).Where("id = ?", appId).Updates(map[string]interface{}{
+		"webhook_url":    webhookUrl,
+		"webhook_secret": secret,
+	})
+	if result.Error != nil {
+		return "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		return "", errors.New("app not found")
+	}
+
+	return secret, nil
+}
+
+func (svc *webhooksService) DeleteWebhook(appId uint) error {
+	return svc.db.Model(&db.App{}).Where("id = ?", appId).Updates(map[string]interface{}{
+		"webhook_url":    "",
+		"webhook_secret": "",
+	}).Error
+}
+
+func (svc *webhooksService) ConsumeEvent(ctx context.Context, event *events.Event, globalProperties map[string]interface{}) {
+	switch event.Event {
+	case "nwc_payment_received", "nwc_payment_sent", "nwc_payment_failed":
+	default:
+		return
+	}
+
+	transaction, ok := event.Properties.(*db.Transaction)
+	if !ok {
+		logger.Logger.WithField("event", event).Error("Failed to cast event properties to transaction")
+		return
+	}
+
+	var app *db.App
+	if transaction.AppId != nil {
+		var dbApp db.App
+		result := svc.db.Limit(1).Find(&dbApp, &db.App{
+			ID: *transaction.AppId,
+		})
+		if result.RowsAffected > 0 {
+			app = &dbApp
+		}
+	}
+
+	notifyInvoice := event.Event == "nwc_payment_received" && transaction.NotifyUrl != ""
+	if (app == nil || app.WebhookUrl == "") && !notifyInvoice {
+		return
+	}
+
+	payload := &webhookPayload{
+		Event:       event.Event,
+		Transaction: newWebhookTransaction(transaction),
+	}
+	if previousTransaction, ok := event.PreviousProperties.(*db.Transaction); ok {
+		changes, err := getWebhookChanges(newWebhookTransaction(previousTransaction), payload.Transaction)
+		if err != nil {
+			logger.Logger.WithError(err).Error("Failed to compute webhook transaction changes")
+			return
+		}
+		payload.Changes = changes
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		logger.Logger.WithError(err).Error("Failed to serialize webhook payload")
+		return
+	}
+
+	if app != nil && app.WebhookUrl != "" {
+		svc.deliverInBackground(svc.client, app.WebhookUrl, app.WebhookSecret, logrus.Fields{"app_id": app.ID}, event.Event, body)
+	}
+
+	// the one-time callback registered with the invoice. It is signed with the app's
+	// webhook secret, if the app has one, so it can be verified like the app's webhooks
+	if notifyInvoice {
+		var secret string
+		if app != nil {
+			secret = app.WebhookSecret
+		}
+		svc.deliverInBackground(svc.notifyClient, transaction.NotifyUrl, secret, logrus.Fields{"payment_hash": transaction.PaymentHash}, event.Event, body)
+	}
+}
+
+func newWebhookTransaction(transaction *db.Transaction) webhookTransaction {
+	return webhookTransaction{
+		Type:            transaction.Type,
+		State:           transaction.State,
+		Invoice:         transaction.PaymentRequest,
+		Description:     transaction.Description,
+		DescriptionHash: transaction.DescriptionHash,
+		Preimage:        transaction.Preimage,
+		PaymentHash:     transaction.PaymentHash,
+		AmountMsat:      transaction.AmountMsat,
+		FeesPaidMsat:    transaction.FeeMsat,
+		CreatedAt:       transaction.CreatedAt,
+		ExpiresAt:       transaction.ExpiresAt,
+		SettledAt:       transaction.SettledAt,
+		Metadata:        transaction.Metadata,
+		FailureReason:   transaction.FailureReason,
+	}
+}
+
+// getWebhookChanges compares the webhook representations of a transaction before and after a change,
+// so fields are named and formatted as in the transaction in the payload
+func getWebhookChanges(previous webhookTransaction, current webhookTransaction) (*webhookChanges, error) {
+	previousFields, err := toJSONObject(previous)
+	if err != nil {
+		return nil, err
+	}
+	currentFields, err := toJSONObject(current)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := &webhookChanges{
+		PreviousState: previous.State,
+		State:         current.State,
+		Fields:        map[string]webhookFieldChange{},
+	}
+	for field, currentValue := range currentFields {
+		previousValue := previousFields[field]
+		if !reflect.DeepEqual(previousValue, currentValue) {
+			changes.Fields[field] = webhookFieldChange{
+				Previous: previousValue,
+				Current:  currentValue,
+			}
+		}
+	}
+	// fields left out when empty, e.g. a removed failure reason
+	for field, previousValue := range previousFields {
+		if _, ok := currentFields[field]; !ok {
+			changes.Fields[field] = webhookFieldChange{
+				Previous: previousValue,
+			}
+		}
+	}
+	return changes, nil
+}
+
+func toJSONObject(value interface{}) (map[string]interface{}, error) {
+	valueBytes, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	object := map[string]interface{}{}
+	err = json.Unmarshal(valueBytes, &object)
+	if err != nil {
+		return nil, err
+	}
+	return object, nil
+}
+
+// deliverInBackground delivers the payload on its own goroutine, so retries do not hold up
+// the event publisher or delay the event being marked as consumed
+func (svc *webhooksService) deliverInBackground(client *http.Client, webhookUrl string, secret string, fields logrus.Fields, event string, body []byte) {
+	svc.deliveries.Add(1)
+	go func() {
+		defer svc.deliveries.Done()
+		svc.deliver(context.Background(), client, webhookUrl, secret, fields, event, body)
+	}()
+}
+
+// deliver posts the payload to a webhook URL, retrying with exponential backoff
+// until the endpoint returns a 2xx status or the maximum number of attempts is reached
+func (svc *webhooksService) deliver(ctx context.Context, client *http.Client, webhookUrl string, secret string, fields logrus.Fields, event string, body []byte) {
+	retryDelay := svc.retryDelay
+	for attempt := 1; attempt <= svc.maxAttempts; attempt++ {
+		err := svc.post(ctx, client, webhookUrl, secret, event, body)
+		if err == nil {
+			logger.Logger.WithFields(fields).WithFields(logrus.Fields{
+				"event":   event,
+				"attempt": attempt,
+			}).Debug("Delivered webhook")
+			return
+		}
+
+		logger.Logger.WithFields(fields).WithFields(logrus.Fields{
+			"event":   event,
+			"attempt": attempt,
+		}).WithError(err).Warn("Failed to deliver webhook")
+
+		if attempt == svc.maxAttempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryDelay):
+		}
+		retryDelay *= 2
+	}
+
+	logger.Logger.WithFields(fields).WithField("event", event).Error("Giving up delivering webhook")
+}
+
+// post sends the payload once, signed with the secret unless it is empty
+func (svc *webhooksService) post(ctx context.Context, client *http.Client, webhookUrl string, secret string, event string, body []byte) error {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookUrl, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, event)
+	req.Header.Set(TimestampHeader, timestamp)
+	if secret != "" {
+		req.Header.Set(SignatureHeader, "sha256="+Sign(secret, timestamp, body))
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	}
+	return nil
+}
+
+// newPublicOnlyClient returns an HTTP client that refuses to connect to loopback, private and
+// link-local addresses. The address is checked when dialing, after the host name is resolved,
+// so a public host name resolving to an internal address is refused too
+func newPublicOnlyClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network string, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || !utils.IsPublicIP(ip) {
+				return fmt.Errorf("refusing to connect to non-public address: %s", address)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: transport,
+	}
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of "<timestamp>.<body>" using the app's webhook secret
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
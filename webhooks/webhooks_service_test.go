@@ -0,0 +1,463 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getAlby/hub/constants"
+	"github.com/getAlby/hub/db"
+	"github.com/getAlby/hub/events"
+	"github.com/getAlby/hub/tests"
+	"github.com/getAlby/hub/transactions"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+}
+
+func newTestWebhookServer(t *testing.T, failures int) (*httptest.Server, *[]receivedWebhook) {
+	received := []receivedWebhook{}
+	server := httptest.NewServer(newTestWebhookHandler(t, failures, &received))
+	return server, &received
+}
+
+// newTestNotifyServer starts an https server for invoice callbacks, along with a client that
+// connects to it for any host, as callbacks are only delivered to public https hosts
+func newTestNotifyServer(t *testing.T, failures int) (*httptest.Server, *[]receivedWebhook, *http.Client) {
+	received := []receivedWebhook{}
+	server := httptest.NewTLSServer(newTestWebhookHandler(t, failures, &received))
+	client := server.Client()
+	transport := client.Transport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network string, address string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+	}
+	client.Transport = transport
+	return server, &received, client
+}
+
+func newTestWebhookHandler(t *testing.T, failures int, received *[]receivedWebhook) http.Handler {
+	var mu sync.Mutex
+	attempts := 0
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts <= failures {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		*received = append(*received, receivedWebhook{header: r.Header.Clone(), body: body})
+	})
+}
+
+func TestWebhook_OnlyDeliveredToOwnApp(t *testing.T) {
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	serverA, receivedA := newTestWebhookServer(t, 0)
+	defer serverA.Close()
+	serverB, receivedB := newTestWebhookServer(t, 0)
+	defer serverB.Close()
+
+	appA, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+	appB, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+
+	webhooksService := NewWebhooksService(svc.DB)
+	secretA, err := webhooksService.RegisterWebhook(appA.ID, serverA.URL)
+	require.NoError(t, err)
+	_, err = webhooksService.RegisterWebhook(appB.ID, serverB.URL)
+	require.NoError(t, err)
+
+	preimage := "preimage"
+	webhooksService.ConsumeEvent(context.TODO(), &events.Event{
+		Event: "nwc_payment_received",
+		Properties: &db.Transaction{
+			AppId:       &appA.ID,
+			Type:        constants.TRANSACTION_TYPE_INCOMING,
+			State:       constants.TRANSACTION_STATE_SETTLED,
+			AmountMsat:  123000,
+			PaymentHash: tests.MockPaymentHash,
+			Preimage:    &preimage,
+		},
+	}, map[string]interface{}{})
+
+	webhooksService.deliveries.Wait()
+	assert.Equal(t, 1, len(*receivedA))
+	assert.Equal(t, 0, len(*receivedB))
+
+	webhook := (*receivedA)[0]
+	assert.Equal(t, "nwc_payment_received", webhook.header.Get(EventHeader))
+	expectedSignature := "sha256=" + Sign(secretA, webhook.header.Get(TimestampHeader), webhook.body)
+	assert.Equal(t, expectedSignature, webhook.header.Get(SignatureHeader))
+
+	var payload webhookPayload
+	err = json.Unmarshal(webhook.body, &payload)
+	assert.NoError(t, err)
+	assert.Equal(t, "nwc_payment_received", payload.Event)
+	assert.Equal(t, tests.MockPaymentHash, payload.Transaction.PaymentHash)
+	assert.Equal(t, uint64(123000), payload.Transaction.AmountMsat)
+	assert.Equal(t, "preimage", *payload.Transaction.Preimage)
+	// the previous state of the transaction is unknown
+	assert.Nil(t, payload.Changes)
+}
+
+func TestWebhook_Changes_PendingToSettled(t *testing.T) {
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	server, received := newTestWebhookServer(t, 0)
+	defer server.Close()
+
+	app, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+
+	webhooksService := NewWebhooksService(svc.DB)
+	_, err = webhooksService.RegisterWebhook(app.ID, server.URL)
+	require.NoError(t, err)
+
+	createdAt := time.Date(2024, 12, 29, 12, 0, 0, 0, time.UTC)
+	settledAt := createdAt.Add(time.Minute)
+	preimage := "preimage"
+	previousTransaction := &db.Transaction{
+		AppId:       &app.ID,
+		Type:        constants.TRANSACTION_TYPE_OUTGOING,
+		State:       constants.TRANSACTION_STATE_PENDING,
+		AmountMsat:  123000,
+		PaymentHash: tests.MockPaymentHash,
+		CreatedAt:   createdAt,
+	}
+	settledTransaction := *previousTransaction
+	settledTransaction.State = constants.TRANSACTION_STATE_SETTLED
+	settledTransaction.Preimage = &preimage
+	settledTransaction.FeeMsat = 1000
+	settledTransaction.SettledAt = &settledAt
+
+	webhooksService.ConsumeEvent(context.TODO(), &events.Event{
+		Event:              "nwc_payment_sent",
+		Properties:         &settledTransaction,
+		PreviousProperties: previousTransaction,
+	}, map[string]interface{}{})
+
+	webhooksService.deliveries.Wait()
+	require.Equal(t, 1, len(*received))
+	var payload webhookPayload
+	err = json.Unmarshal((*received)[0].body, &payload)
+	require.NoError(t, err)
+
+	require.NotNil(t, payload.Changes)
+	assert.Equal(t, constants.TRANSACTION_STATE_PENDING, payload.Changes.PreviousState)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, payload.Changes.State)
+	assert.Equal(t, map[string]webhookFieldChange{
+		"state": {
+			Previous: constants.TRANSACTION_STATE_PENDING,
+			Current:  constants.TRANSACTION_STATE_SETTLED,
+		},
+		"preimage": {
+			Previous: nil,
+			Current:  "preimage",
+		},
+		"fees_paid": {
+			Previous: float64(0),
+			Current:  float64(1000),
+		},
+		"settled_at": {
+			Previous: nil,
+			Current:  "2024-12-29T12:01:00Z",
+		},
+	}, payload.Changes.Fields)
+}
+
+func TestWebhook_NoAppOrNoWebhook(t *testing.T) {
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	server, received := newTestWebhookServer(t, 0)
+	defer server.Close()
+
+	app, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+
+	webhooksService := NewWebhooksService(svc.DB)
+
+	// app without a webhook
+	webhooksService.ConsumeEvent(context.TODO(), &events.Event{
+		Event:      "nwc_payment_sent",
+		Properties: &db.Transaction{AppId: &app.ID},
+	}, map[string]interface{}{})
+
+	_, err = webhooksService.RegisterWebhook(app.ID, server.URL)
+	require.NoError(t, err)
+
+	// transaction without an app
+	webhooksService.ConsumeEvent(context.TODO(), &events.Event{
+		Event:      "nwc_payment_sent",
+		Properties: &db.Transaction{},
+	}, map[string]interface{}{})
+
+	// unrelated event
+	webhooksService.ConsumeEvent(context.TODO(), &events.Event{
+		Event:      "nwc_budget_warning",
+		Properties: map[string]interface{}{"id": app.ID},
+	}, map[string]interface{}{})
+
+	err = webhooksService.DeleteWebhook(app.ID)
+	require.NoError(t, err)
+
+	// webhook removed
+	webhooksService.ConsumeEvent(context.TODO(), &events.Event{
+		Event:      "nwc_payment_sent",
+		Properties: &db.Transaction{AppId: &app.ID},
+	}, map[string]interface{}{})
+
+	webhooksService.deliveries.Wait()
+	assert.Equal(t, 0, len(*received))
+}
+
+func TestWebhook_Retries(t *testing.T) {
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	server, received := newTestWebhookServer(t, 2)
+	defer server.Close()
+
+	app, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+
+	webhooksService := NewWebhooksService(svc.DB)
+	webhooksService.retryDelay = time.Millisecond
+	_, err = webhooksService.RegisterWebhook(app.ID, server.URL)
+	require.NoError(t, err)
+
+	webhooksService.ConsumeEvent(context.TODO(), &events.Event{
+		Event:      "nwc_payment_failed",
+		Properties: &db.Transaction{AppId: &app.ID},
+	}, map[string]interface{}{})
+
+	webhooksService.deliveries.Wait()
+	assert.Equal(t, 1, len(*received))
+}
+
+func TestWebhook_DoesNotBlockConsumeEvent(t *testing.T) {
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	// the endpoint keeps failing, so the delivery is retried
+	server, received := newTestWebhookServer(t, 10)
+	defer server.Close()
+
+	app, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+
+	webhooksService := NewWebhooksService(svc.DB)
+	webhooksService.retryDelay = 100 * time.Millisecond
+	webhooksService.maxAttempts = 3
+	_, err = webhooksService.RegisterWebhook(app.ID, server.URL)
+	require.NoError(t, err)
+
+	start := time.Now()
+	webhooksService.ConsumeEvent(context.TODO(), &events.Event{
+		Event:      "nwc_payment_failed",
+		Properties: &db.Transaction{AppId: &app.ID},
+	}, map[string]interface{}{})
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+
+	webhooksService.deliveries.Wait()
+	assert.GreaterOrEqual(t, time.Since(start), 300*time.Millisecond)
+	assert.Equal(t, 0, len(*received))
+}
+
+func TestWebhook_GivesUpAfterMaxAttempts(t *testing.T) {
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	server, received := newTestWebhookServer(t, 10)
+	defer server.Close()
+
+	app, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+
+	webhooksService := NewWebhooksService(svc.DB)
+	webhooksService.retryDelay = time.Millisecond
+	webhooksService.maxAttempts = 3
+	_, err = webhooksService.RegisterWebhook(app.ID, server.URL)
+	require.NoError(t, err)
+
+	webhooksService.ConsumeEvent(context.TODO(), &events.Event{
+		Event:      "nwc_payment_failed",
+		Properties: &db.Transaction{AppId: &app.ID},
+	}, map[string]interface{}{})
+
+	webhooksService.deliveries.Wait()
+	assert.Equal(t, 0, len(*received))
+}
+
+func TestRegisterWebhook_InvalidUrl(t *testing.T) {
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	app, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+
+	webhooksService := NewWebhooksService(svc.DB)
+	_, err = webhooksService.RegisterWebhook(app.ID, "not a url")
+	assert.Error(t, err)
+}
+
+func TestInvoiceNotifyUrl_DeliveredOnSettle(t *testing.T) {
+	ctx := context.TODO()
+
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	server, received, notifyClient := newTestNotifyServer(t, 1)
+	defer server.Close()
+
+	webhooksService := NewWebhooksService(svc.DB)
+	webhooksService.notifyClient = notifyClient
+	webhooksService.retryDelay = time.Millisecond
+	mockEventConsumer := tests.NewMockEventConsumer()
+	svc.EventPublisher.RegisterSubscriber(mockEventConsumer)
+
+	transactionsService := transactions.NewTransactionsService(svc.DB, svc.EventPublisher)
+	_, err = transactionsService.MakeInvoice(ctx, 123000, "", "", 0, nil, svc.LNClient, nil, nil, "https://example.com/paid")
+	require.NoError(t, err)
+	// an unrelated invoice without a callback
+	svc.DB.Create(&db.Transaction{
+		State:          constants.TRANSACTION_STATE_PENDING,
+		Type:           constants.TRANSACTION_TYPE_INCOMING,
+		PaymentRequest: tests.MockInvoiceWithoutDescription,
+		PaymentHash:    tests.MockPaymentHashWithoutDescription,
+		AmountMsat:     123000,
+	})
+
+	settle := func(paymentHash string) {
+		lnClientTransaction := *tests.MockLNClientTransaction
+		lnClientTransaction.PaymentHash = paymentHash
+		transactionsService.ConsumeEvent(ctx, &events.Event{
+			Event:      "nwc_lnclient_payment_received",
+			Properties: &lnClientTransaction,
+		}, map[string]interface{}{})
+	}
+	deliveredEventCount := 0
+	deliverEvents := func() {
+		consumedEvents := mockEventConsumer.GetConsumedEvents()
+		for _, event := range consumedEvents[deliveredEventCount:] {
+			webhooksService.ConsumeEvent(ctx, event, map[string]interface{}{})
+		}
+		deliveredEventCount = len(consumedEvents)
+	}
+
+	settle(tests.MockPaymentHashWithoutDescription)
+	deliverEvents()
+	webhooksService.deliveries.Wait()
+	assert.Equal(t, 0, len(*received))
+
+	settle(tests.MockPaymentHash)
+	deliverEvents()
+	webhooksService.deliveries.Wait()
+	require.Equal(t, 1, len(*received))
+
+	webhook := (*received)[0]
+	assert.Equal(t, "nwc_payment_received", webhook.header.Get(EventHeader))
+	// the invoice has no app, so there is no secret to sign with
+	assert.Empty(t, webhook.header.Get(SignatureHeader))
+
+	var payload webhookPayload
+	require.NoError(t, json.Unmarshal(webhook.body, &payload))
+	assert.Equal(t, tests.MockPaymentHash, payload.Transaction.PaymentHash)
+	assert.Equal(t, constants.TRANSACTION_STATE_SETTLED, payload.Transaction.State)
+}
+
+func TestInvoiceNotifyUrl_SignedWithAppSecret(t *testing.T) {
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	appWebhookServer, appWebhookReceived := newTestWebhookServer(t, 0)
+	defer appWebhookServer.Close()
+	notifyServer, notifyReceived, notifyClient := newTestNotifyServer(t, 0)
+	defer notifyServer.Close()
+
+	app, _, err := tests.CreateApp(svc)
+	require.NoError(t, err)
+
+	webhooksService := NewWebhooksService(svc.DB)
+	webhooksService.notifyClient = notifyClient
+	secret, err := webhooksService.RegisterWebhook(app.ID, appWebhookServer.URL)
+	require.NoError(t, err)
+
+	transaction := &db.Transaction{
+		AppId:       &app.ID,
+		Type:        constants.TRANSACTION_TYPE_INCOMING,
+		State:       constants.TRANSACTION_STATE_SETTLED,
+		PaymentHash: tests.MockPaymentHash,
+		NotifyUrl:   "https://example.com/paid",
+	}
+
+	// only notified once the invoice is paid
+	webhooksService.ConsumeEvent(context.TODO(), &events.Event{
+		Event:      "nwc_payment_failed",
+		Properties: transaction,
+	}, map[string]interface{}{})
+	webhooksService.deliveries.Wait()
+	assert.Equal(t, 0, len(*notifyReceived))
+
+	webhooksService.ConsumeEvent(context.TODO(), &events.Event{
+		Event:      "nwc_payment_received",
+		Properties: transaction,
+	}, map[string]interface{}{})
+
+	webhooksService.deliveries.Wait()
+	assert.Equal(t, 2, len(*appWebhookReceived))
+	require.Equal(t, 1, len(*notifyReceived))
+	webhook := (*notifyReceived)[0]
+	assert.Equal(t, "sha256="+Sign(secret, webhook.header.Get(TimestampHeader), webhook.body), webhook.header.Get(SignatureHeader))
+}
+
+func TestInvoiceNotifyUrl_NotDeliveredToNonPublicAddress(t *testing.T) {
+	defer tests.RemoveTestService()
+	svc, err := tests.CreateTestService()
+	require.NoError(t, err)
+
+	// a loopback server, e.g. reached through a host name that resolves to an internal address
+	server, received := newTestWebhookServer(t, 0)
+	defer server.Close()
+
+	webhooksService := NewWebhooksService(svc.DB)
+	webhooksService.maxAttempts = 1
+
+	webhooksService.ConsumeEvent(context.TODO(), &events.Event{
+		Event: "nwc_payment_received",
+		Properties: &db.Transaction{
+			Type:        constants.TRANSACTION_TYPE_INCOMING,
+			State:       constants.TRANSACTION_STATE_SETTLED,
+			PaymentHash: tests.MockPaymentHash,
+			NotifyUrl:   server.URL,
+		},
+	}, map[string]interface{}{})
+
+	webhooksService.deliveries.Wait()
+	assert.Equal(t, 0, len(*received))
+}